@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+
+	kbdgr "github.com/decentralized-identity/kerigo/pkg/db/badger"
+	"github.com/decentralized-identity/kerigo/pkg/direct"
+	"github.com/decentralized-identity/kerigo/pkg/keymanager"
+	"github.com/decentralized-identity/kerigo/pkg/witness"
+)
+
+func main() {
+	addr := flag.String("a", ":5631", "Address to accept direct mode connections on.")
+	httpAddr := flag.String("h", ":5632", "Address to serve witnessed KERLs over HTTP on.")
+	dir := flag.String("d", "./witness", "Directory to store the witness database in.")
+	flag.Parse()
+
+	db, err := kbdgr.New(*dir)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
+
+	km, err := keymanager.NewKeyManager(keymanager.WithStore(db))
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	wit, err := witness.New(km, db)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	fmt.Printf("Witness %s accepting events on %s and serving KERLs on %s\n\n", wit.Prefix(), *addr, *httpAddr)
+
+	go func() {
+		err := http.ListenAndServe(*httpAddr, wit)
+		log.Fatalf("http server exited with %v\n", err)
+	}()
+
+	srv := &direct.Server{
+		Addr:    *addr,
+		Handler: wit,
+	}
+
+	err = srv.ListenAndServe()
+	log.Printf("direct mode server exited with %v\n", err)
+}
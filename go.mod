@@ -4,6 +4,7 @@ go 1.13
 
 require (
 	github.com/cenkalti/backoff/v4 v4.1.0
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1
 	github.com/dgraph-io/badger v1.6.2
 	github.com/google/tink/go v1.5.0
 	github.com/mitchellh/mapstructure v1.1.2
@@ -2,6 +2,8 @@ package badger
 
 import (
 	"bytes"
+	"fmt"
+	"io"
 	"strconv"
 	"time"
 
@@ -24,11 +26,21 @@ type DB struct {
 	sigs *Set        // prefix:digest = multiple fully qualified event sigs
 	rcts *Set        // prefix:digest = multiple non-transferable receipt couplets
 	vrcs *Set        // prefix:digest = multiple transferable receipt quadlet
+	wigs *Set        // prefix:digest = multiple witness receipt couplets
+	ures *Set        // prefix = multiple seq no., digest and couplet of receipts for unseen events
+	vres *Set        // prefix = multiple prefix, seq no., digest and quadlet of unverified transferable receipts
 	kels *OrderedSet // prefix:seq no. = multiple ordered event digests as event log
 	estb *OrderedSet // prefix:seq no. = multiple ordered event digests as establishment event log
 	pses *OrderedSet // prefix:seq no. = multiple ordered event digests of partially signed events
+	pwes *Set        // prefix:seq no. = multiple event digests of partially witnessed events
+	dees *Set        // delegator = multiple prefix/digest of delegated events awaiting approval
+	exes *Set        // prefix = multiple digests of exchange messages from unverified senders
+	ends *Value      // prefix/role/eid = digest of the endpoint authorization
 	ooes *Set        // prefix:seq no. = multiple event digests as out of order escrow
-	dels *Set        // prefix:seq no. = multiple event digests as duplicitous log
+	dels *Set        // prefix:seq no. = multiple accepted/duplicitous event digest pairs as duplicitous log
+	dwgs *Set        // prefix:digest = multiple witness receipt couplets of duplicitous events
+	drcs *Set        // prefix:digest = multiple non-transferable receipt couplets of duplicitous events
+	sups *Set        // prefix:seq no. = multiple event digests superseded by a recovery rotation
 	ldes *Set        // prefix:seq no. = multiple event digests as likely duplicitous events
 }
 
@@ -51,11 +63,21 @@ func New(dir string) (*DB, error) {
 	out.sigs = NewSet("sigs", "/%s/%s")           // prefix:digest = multiple fully qualified event sigs
 	out.rcts = NewSet("rcts", "/%s/%s")           // prefix:digest = multiple non-transferable receipt couplets
 	out.vrcs = NewSet("vrcs", "/%s/%s")           // prefix:digest = multiple transferable receipt quadlet
+	out.wigs = NewSet("wigs", "/%s/%s")           // prefix:digest = multiple witness receipt couplets
+	out.ures = NewSet("ures", "/%s")              // prefix = multiple seq no., digest and couplet of receipts for unseen events
+	out.vres = NewSet("vres", "/%s")              // prefix = multiple prefix, seq no., digest and quadlet of unverified transferable receipts
 	out.kels = NewOrderedSet("kels", "/%s/%032d") // prefix:seq no. = multiple ordered event digests as event log
 	out.estb = NewOrderedSet("estb", "/%s/%032d") // prefix:seq no. = multiple ordered event digests as establishment event log
 	out.pses = NewOrderedSet("pses", "/%s/%032d") // prefix:seq no. = multiple ordered event digests of partially signed events
+	out.pwes = NewSet("pwes", "/%s/%032d")        // prefix:seq no. = multiple event digests of partially witnessed events
+	out.dees = NewSet("dees", "/%s")              // delegator = multiple prefix/digest of delegated events awaiting approval
+	out.exes = NewSet("exes", "/%s")              // prefix = multiple digests of exchange messages from unverified senders
+	out.ends = NewValue("ends", "/%s/%s/%s")      // prefix/role/eid = digest of the endpoint authorization
 	out.ooes = NewSet("ooes", "/%s/%032d")        // prefix:seq no. = multiple event digests as out of order escrow
-	out.dels = NewSet("dels", "/%s/%032d")        // prefix:seq no. = multiple event digests as duplicitous log
+	out.dels = NewSet("dels", "/%s/%032d")        // prefix:seq no. = multiple accepted/duplicitous event digest pairs as duplicitous log
+	out.dwgs = NewSet("dwgs", "/%s/%s")           // prefix:digest = multiple witness receipt couplets of duplicitous events
+	out.drcs = NewSet("drcs", "/%s/%s")           // prefix:digest = multiple non-transferable receipt couplets of duplicitous events
+	out.sups = NewSet("sups", "/%s/%032d")        // prefix:seq no. = multiple event digests superseded by a recovery rotation
 	out.ldes = NewSet("ldes", "/%s/%032d")        // prefix:seq no. = multiple event digests as likely duplicitous events
 
 	return out, nil
@@ -109,6 +131,18 @@ func (r *DB) Get(k string) ([]byte, error) {
 	return val, nil
 }
 
+func (r *DB) Delete(k string) error {
+	err := r.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(k))
+	})
+
+	if err != nil {
+		return errors.Wrap(err, "error deleting from badger")
+	}
+
+	return nil
+}
+
 func (r *DB) Seen(pre string) bool {
 	txn := r.db.NewTransaction(false)
 	defer txn.Discard()
@@ -124,7 +158,7 @@ func (r *DB) LogEvent(e *event.Message, first bool) error {
 	pre := e.Event.Prefix
 	sn := e.Event.SequenceInt()
 
-	dig, err := e.Event.GetDigest()
+	dig, err := e.Digest()
 	if err != nil {
 		return err
 	}
@@ -152,7 +186,7 @@ func (r *DB) LogEvent(e *event.Message, first bool) error {
 		}
 	}
 
-	ser, err := e.Event.Serialize()
+	ser, err := e.Raw()
 	if err != nil {
 		return err
 	}
@@ -299,11 +333,12 @@ func (r *DB) CurrentEvent(pre string) (*event.Message, error) {
 	txn := r.db.NewTransaction(false)
 	defer txn.Discard()
 
-	dig, err := r.fses.Last(txn, pre)
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to get last event digest")
+	digs, err := r.kels.Last(txn, pre)
+	if err != nil || len(digs) == 0 {
+		return nil, errors.New("unable to get last event digest")
 	}
-	return r.message(txn, pre, string(dig))
+
+	return r.message(txn, pre, string(digs[len(digs)-1]))
 }
 
 func (r *DB) CurrentEstablishmentEvent(pre string) (*event.Message, error) {
@@ -371,17 +406,28 @@ func (r *DB) Event(pre, dig string) (*event.Event, error) {
 }
 
 func (r *DB) event(txn *badger.Txn, pre, dig string) (*event.Event, error) {
+	evt, _, err := r.rawEvent(txn, pre, dig)
+	return evt, err
+}
+
+// rawEvent returns the stored event along with the exact bytes it was stored as
+func (r *DB) rawEvent(txn *badger.Txn, pre, dig string) (*event.Event, []byte, error) {
 	d, err := r.evts.Get(txn, pre, dig)
 	if err != nil {
-		return nil, errors.Wrap(err, "raw event not found")
+		return nil, nil, errors.Wrap(err, "raw event not found")
+	}
+
+	f, err := event.Sniff(d)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid data stored at raw event")
 	}
 
-	evt, err := event.Deserialize(d, event.JSON)
+	evt, err := event.Deserialize(d, f)
 	if err != nil {
-		return nil, errors.Wrap(err, "invalid data stored at raw event")
+		return nil, nil, errors.Wrap(err, "invalid data stored at raw event")
 	}
 
-	return evt, nil
+	return evt, d, nil
 }
 
 func (r *DB) Message(pre, dig string) (*event.Message, error) {
@@ -391,7 +437,7 @@ func (r *DB) Message(pre, dig string) (*event.Message, error) {
 }
 
 func (r *DB) message(txn *badger.Txn, pre, dig string) (*event.Message, error) {
-	evt, err := r.event(txn, pre, dig)
+	evt, raw, err := r.rawEvent(txn, pre, dig)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to load raw event")
 	}
@@ -423,7 +469,7 @@ func (r *DB) message(txn *badger.Txn, pre, dig string) (*event.Message, error) {
 			event.WithSignature(quad.Signature),
 			event.WithEstablishmentSeal(&event.Seal{
 				Prefix:   quad.Prefix.AsPrefix(),
-				Sequence: strconv.Itoa(quad.Sequence),
+				Sequence: strconv.FormatInt(int64(quad.Sequence), 16),
 				Digest:   quad.Digest.AsPrefix(),
 			}),
 		)
@@ -449,12 +495,16 @@ func (r *DB) message(txn *badger.Txn, pre, dig string) (*event.Message, error) {
 		rcts[i] = rcpt
 	}
 
-	return &event.Message{
-		Event:                   evt,
-		Signatures:              sigs,
-		TransferableReceipts:    vrcs,
-		NonTransferableReceipts: rcts,
-	}, nil
+	msg, err := event.NewMessage(evt, event.WithRaw(raw))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid raw event")
+	}
+
+	msg.Signatures = sigs
+	msg.TransferableReceipts = vrcs
+	msg.NonTransferableReceipts = rcts
+
+	return msg, nil
 }
 
 func (r *DB) EventAt(pre string, sn int) (*event.Message, error) {
@@ -475,7 +525,7 @@ func (r *DB) EscrowPendingEvent(e *event.Message) error {
 	defer txn.Discard()
 
 	pre := e.Event.Prefix
-	dig, err := e.Event.GetDigest()
+	dig, err := e.Digest()
 	if err != nil {
 		return err
 	}
@@ -495,7 +545,7 @@ func (r *DB) EscrowPendingEvent(e *event.Message) error {
 		}
 	}
 
-	ser, err := e.Event.Serialize()
+	ser, err := e.Raw()
 	if err != nil {
 		return err
 	}
@@ -525,12 +575,12 @@ func (r *DB) RemovePendingEscrow(prefix string, sn int, dig string) error {
 	return txn.Commit()
 }
 
-func (r *DB) EscrowOutOfOrderEvent(e *event.Message) error {
+func (r *DB) EscrowPartiallyWitnessedEvent(e *event.Message) error {
 	txn := r.db.NewTransaction(true)
 	defer txn.Discard()
 
 	pre := e.Event.Prefix
-	dig, err := e.Event.GetDigest()
+	dig, err := e.Digest()
 	if err != nil {
 		return err
 	}
@@ -550,7 +600,7 @@ func (r *DB) EscrowOutOfOrderEvent(e *event.Message) error {
 		}
 	}
 
-	ser, err := e.Event.Serialize()
+	ser, err := e.Raw()
 	if err != nil {
 		return err
 	}
@@ -560,7 +610,7 @@ func (r *DB) EscrowOutOfOrderEvent(e *event.Message) error {
 		return err
 	}
 
-	err = r.ooes.Add(txn, []byte(dig), pre, e.Event.SequenceInt())
+	err = r.pwes.Add(txn, []byte(dig), pre, e.Event.SequenceInt())
 	if err != nil {
 		return err
 	}
@@ -568,12 +618,48 @@ func (r *DB) EscrowOutOfOrderEvent(e *event.Message) error {
 	return txn.Commit()
 }
 
-func (r *DB) EscrowLikelyDuplicitiousEvent(e *event.Message) error {
+func (r *DB) RemovePartiallyWitnessedEscrow(prefix string, sn int, dig string) error {
+	txn := r.db.NewTransaction(true)
+	defer txn.Discard()
+
+	err := r.pwes.RemoveFromSet(txn, []byte(dig), prefix, sn)
+	if err != nil {
+		return err
+	}
+
+	return txn.Commit()
+}
+
+func (r *DB) StreamPartiallyWitnessed(pre string, handler func(*event.Message) error) error {
+	txn := r.db.NewTransaction(false)
+	defer txn.Discard()
+
+	it := r.pwes.Iterator(txn, pre)
+	defer it.Close()
+
+	for it.Next() {
+		for _, dig := range it.Value() {
+			msg, err := r.message(txn, pre, string(dig))
+			if err != nil {
+				return errors.Wrap(err, "unable to load partially witnessed event")
+			}
+
+			err = handler(msg)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *DB) EscrowDelegatedEvent(delegator string, e *event.Message) error {
 	txn := r.db.NewTransaction(true)
 	defer txn.Discard()
 
 	pre := e.Event.Prefix
-	dig, err := e.Event.GetDigest()
+	dig, err := e.Digest()
 	if err != nil {
 		return err
 	}
@@ -593,7 +679,7 @@ func (r *DB) EscrowLikelyDuplicitiousEvent(e *event.Message) error {
 		}
 	}
 
-	ser, err := e.Event.Serialize()
+	ser, err := e.Raw()
 	if err != nil {
 		return err
 	}
@@ -603,7 +689,7 @@ func (r *DB) EscrowLikelyDuplicitiousEvent(e *event.Message) error {
 		return err
 	}
 
-	err = r.ldes.Add(txn, []byte(dig), pre, e.Event.SequenceInt())
+	err = r.dees.Add(txn, delegatedKey(pre, dig), delegator)
 	if err != nil {
 		return err
 	}
@@ -611,32 +697,82 @@ func (r *DB) EscrowLikelyDuplicitiousEvent(e *event.Message) error {
 	return txn.Commit()
 }
 
-func (r *DB) LastAcceptedDigest(pre string, seq int) ([]byte, error) {
+func (r *DB) RemoveDelegatedEscrow(delegator, prefix string, sn int, dig string) error {
+	txn := r.db.NewTransaction(true)
+	defer txn.Discard()
+
+	err := r.dees.RemoveFromSet(txn, delegatedKey(prefix, dig), delegator)
+	if err != nil {
+		return err
+	}
+
+	return txn.Commit()
+}
+
+func (r *DB) StreamDelegated(delegator string, handler func(*event.Message) error) error {
 	txn := r.db.NewTransaction(false)
 	defer txn.Discard()
 
-	vals, err := r.kels.Last(txn, pre, seq)
+	vals, err := r.dees.Get(txn, delegator)
 	if err != nil {
-		return nil, errors.Wrap(err, "unable to get last event")
+		return nil
 	}
 
-	if len(vals) == 0 {
-		return nil, errors.New("not found")
+	for _, val := range vals {
+		parts := bytes.SplitN(val, []byte("/"), 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		msg, err := r.message(txn, string(parts[0]), string(parts[1]))
+		if err != nil {
+			return errors.Wrap(err, "")
+		}
+
+		err = handler(msg)
+		if err != nil {
+			return err
+		}
 	}
 
-	return vals[len(vals)-1], nil
+	return nil
 }
 
-func (r *DB) LogTransferableReceipt(vrc *event.Receipt) error {
+// delegatedKey is the value stored in the delegated escrow, the
+// delegated events are stored under their own prefix and digest
+func delegatedKey(pre, dig string) []byte {
+	return []byte(pre + "/" + dig)
+}
+
+func (r *DB) EscrowExchange(exn *event.Message) error {
 	txn := r.db.NewTransaction(true)
 	defer txn.Discard()
 
-	pre := vrc.Prefix
-	dig := vrc.Digest
+	pre := exn.Event.Prefix
+	dig, err := exn.Digest()
+	if err != nil {
+		return err
+	}
 
-	quadlet := vrc.Text()
+	for _, sig := range exn.Signatures {
+		sigp := sig.AsPrefix()
+		err = r.sigs.Add(txn, []byte(sigp), pre, dig)
+		if err != nil {
+			return err
+		}
+	}
 
-	err := r.vrcs.Add(txn, quadlet, pre, dig)
+	ser, err := exn.Raw()
+	if err != nil {
+		return err
+	}
+
+	err = r.evts.Set(txn, ser, pre, dig)
+	if err != nil {
+		return err
+	}
+
+	err = r.exes.Add(txn, []byte(dig), pre)
 	if err != nil {
 		return err
 	}
@@ -644,15 +780,181 @@ func (r *DB) LogTransferableReceipt(vrc *event.Receipt) error {
 	return txn.Commit()
 }
 
-func (r *DB) LogNonTransferableReceipt(rct *event.Receipt) error {
+func (r *DB) RemoveExchangeEscrow(pre, dig string) error {
 	txn := r.db.NewTransaction(true)
 	defer txn.Discard()
 
-	pre := rct.Prefix
-	dig := rct.Digest
-	couplet := rct.Text()
+	err := r.exes.RemoveFromSet(txn, []byte(dig), pre)
+	if err != nil {
+		return err
+	}
 
-	err := r.rcts.Add(txn, couplet, pre, dig)
+	return txn.Commit()
+}
+
+func (r *DB) StreamExchangeEscrow(pre string, handler func(*event.Message) error) error {
+	txn := r.db.NewTransaction(false)
+	defer txn.Discard()
+
+	digs, err := r.exes.Get(txn, pre)
+	if err != nil {
+		return nil
+	}
+
+	msgs := []*event.Message{}
+	for _, dig := range digs {
+		msg, err := r.message(txn, pre, string(dig))
+		if err != nil {
+			return errors.Wrap(err, "unable to load escrowed exchange message")
+		}
+
+		msgs = append(msgs, msg)
+	}
+
+	// the handler may remove messages from the escrow
+	txn.Discard()
+
+	for _, msg := range msgs {
+		err := handler(msg)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *DB) LogEndRole(rpy *event.Message) error {
+	end, err := event.ParseEndRole(rpy.Event)
+	if err != nil {
+		return err
+	}
+
+	txn := r.db.NewTransaction(true)
+	defer txn.Discard()
+
+	pre := end.Controller
+	dig, err := rpy.Digest()
+	if err != nil {
+		return err
+	}
+
+	// drop the authorization being replaced
+	old, err := r.ends.Get(txn, pre, end.Role, end.EID)
+	if err == nil && string(old) != dig {
+		err = r.evts.Delete(txn, pre, string(old))
+		if err != nil {
+			return err
+		}
+
+		err = r.sigs.Delete(txn, pre, string(old))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, sig := range rpy.Signatures {
+		sigp := sig.AsPrefix()
+		err = r.sigs.Add(txn, []byte(sigp), pre, dig)
+		if err != nil {
+			return err
+		}
+	}
+
+	ser, err := rpy.Raw()
+	if err != nil {
+		return err
+	}
+
+	err = r.evts.Set(txn, ser, pre, dig)
+	if err != nil {
+		return err
+	}
+
+	err = r.ends.Set(txn, []byte(dig), pre, end.Role, end.EID)
+	if err != nil {
+		return err
+	}
+
+	return txn.Commit()
+}
+
+func (r *DB) EndRole(cid, role, eid string) (*event.Message, error) {
+	txn := r.db.NewTransaction(false)
+	defer txn.Discard()
+
+	dig, err := r.ends.Get(txn, cid, role, eid)
+	if err != nil {
+		return nil, errors.New("not found")
+	}
+
+	return r.message(txn, cid, string(dig))
+}
+
+func (r *DB) StreamEndRoles(cid, role string, handler func(*event.Message) error) error {
+	txn := r.db.NewTransaction(false)
+	defer txn.Discard()
+
+	it := r.ends.Iterator(txn, cid, role)
+	defer it.Close()
+
+	// the iterator matches on key prefix, which includes roles the role is a prefix of
+	seek := []byte(fmt.Sprintf("/ends/%s/%s/", cid, role))
+	for it.Next() {
+		if !bytes.HasPrefix(it.Key(), seek) {
+			continue
+		}
+
+		msg, err := r.message(txn, cid, string(it.Value()))
+		if err != nil {
+			return errors.Wrap(err, "unable to load endpoint authorization")
+		}
+
+		err = handler(msg)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *DB) EscrowOutOfOrderEvent(e *event.Message) error {
+	txn := r.db.NewTransaction(true)
+	defer txn.Discard()
+
+	pre := e.Event.Prefix
+	dig, err := e.Digest()
+	if err != nil {
+		return err
+	}
+
+	dts := time.Now().Format(time.RFC3339)
+
+	err = r.dtss.Put(txn, []byte(dts), pre, dig)
+	if err != nil {
+		return err
+	}
+
+	for _, sig := range e.Signatures {
+		sigp := sig.AsPrefix()
+		err = r.sigs.Add(txn, []byte(sigp), pre, dig)
+		if err != nil {
+			return err
+		}
+	}
+
+	ser, err := e.Raw()
+	if err != nil {
+		return err
+	}
+
+	err = r.evts.Set(txn, ser, pre, dig)
+	if err != nil {
+		return err
+	}
+
+	err = r.ooes.Add(txn, []byte(dig), pre, e.Event.SequenceInt())
 	if err != nil {
 		return err
 	}
@@ -660,6 +962,530 @@ func (r *DB) LogNonTransferableReceipt(rct *event.Receipt) error {
 	return txn.Commit()
 }
 
+func (r *DB) EscrowLikelyDuplicitiousEvent(e *event.Message) error {
+	txn := r.db.NewTransaction(true)
+	defer txn.Discard()
+
+	pre := e.Event.Prefix
+	dig, err := e.Digest()
+	if err != nil {
+		return err
+	}
+
+	dts := time.Now().Format(time.RFC3339)
+
+	err = r.dtss.Put(txn, []byte(dts), pre, dig)
+	if err != nil {
+		return err
+	}
+
+	for _, sig := range e.Signatures {
+		sigp := sig.AsPrefix()
+		err = r.sigs.Add(txn, []byte(sigp), pre, dig)
+		if err != nil {
+			return err
+		}
+	}
+
+	ser, err := e.Raw()
+	if err != nil {
+		return err
+	}
+
+	err = r.evts.Set(txn, ser, pre, dig)
+	if err != nil {
+		return err
+	}
+
+	err = r.ldes.Add(txn, []byte(dig), pre, e.Event.SequenceInt())
+	if err != nil {
+		return err
+	}
+
+	return txn.Commit()
+}
+
+func (r *DB) LogDuplicitousEvent(accepted string, e *event.Message) error {
+	txn := r.db.NewTransaction(true)
+	defer txn.Discard()
+
+	pre := e.Event.Prefix
+	dig, err := e.Digest()
+	if err != nil {
+		return err
+	}
+
+	if !r.evts.Exists(txn, pre, accepted) {
+		return errors.New("accepted event not found")
+	}
+
+	for _, sig := range e.Signatures {
+		sigp := sig.AsPrefix()
+		err = r.sigs.Add(txn, []byte(sigp), pre, dig)
+		if err != nil {
+			return err
+		}
+	}
+
+	ser, err := e.Raw()
+	if err != nil {
+		return err
+	}
+
+	err = r.evts.Set(txn, ser, pre, dig)
+	if err != nil {
+		return err
+	}
+
+	// the receipts attached to the duplicitous event are kept with it only
+	for _, rcpt := range e.WitnessReceipts {
+		err = r.dwgs.Add(txn, rcpt.Text(), pre, dig)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, rcpt := range e.NonTransferableReceipts {
+		err = r.drcs.Add(txn, rcpt.Text(), pre, dig)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = r.dels.Add(txn, duplicityKey(accepted, dig), pre, e.Event.SequenceInt())
+	if err != nil {
+		return err
+	}
+
+	return txn.Commit()
+}
+
+func (r *DB) StreamDuplicitous(pre string, handler func(accepted, dup *event.Message) error) error {
+	txn := r.db.NewTransaction(false)
+	defer txn.Discard()
+
+	it := r.dels.Iterator(txn, pre)
+	defer it.Close()
+
+	for it.Next() {
+		for _, pair := range it.Value() {
+			digs := bytes.SplitN(pair, []byte("/"), 2)
+			if len(digs) != 2 {
+				continue
+			}
+
+			acc, err := r.message(txn, pre, string(digs[0]))
+			if err != nil {
+				return errors.Wrap(err, "unable to load accepted event")
+			}
+
+			dup, err := r.message(txn, pre, string(digs[1]))
+			if err != nil {
+				return errors.Wrap(err, "unable to load duplicitous event")
+			}
+
+			dup.WitnessReceipts, err = r.couplets(txn, r.dwgs, dup.Event, string(digs[1]))
+			if err != nil {
+				return errors.Wrap(err, "unable to load duplicitous event receipts")
+			}
+
+			dup.NonTransferableReceipts, err = r.couplets(txn, r.drcs, dup.Event, string(digs[1]))
+			if err != nil {
+				return errors.Wrap(err, "unable to load duplicitous event receipts")
+			}
+
+			err = handler(acc, dup)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// SupersedeEvents moves the events accepted from the sequence number on
+// out of the event log, keeping them, their signatures and receipts as
+// superseded. The first seen log is left as it is.
+func (r *DB) SupersedeEvents(pre string, sn int) error {
+	txn := r.db.NewTransaction(true)
+	defer txn.Discard()
+
+	if sn <= 0 {
+		return errors.New("no events to supersede")
+	}
+
+	found := false
+	for i := sn; ; i++ {
+		digs, err := r.kels.Get(txn, pre, i)
+		if err != nil {
+			return err
+		}
+
+		if len(digs) == 0 {
+			break
+		}
+
+		for _, dig := range digs {
+			err = r.sups.Add(txn, dig, pre, i)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = r.kels.Delete(txn, pre, i)
+		if err != nil {
+			return err
+		}
+
+		err = r.estb.Delete(txn, pre, i)
+		if err != nil {
+			return err
+		}
+
+		found = true
+	}
+
+	if !found {
+		return errors.New("no events to supersede")
+	}
+
+	return txn.Commit()
+}
+
+func (r *DB) StreamSuperseded(pre string, handler func(*event.Message) error) error {
+	txn := r.db.NewTransaction(false)
+	defer txn.Discard()
+
+	it := r.sups.Iterator(txn, pre)
+	defer it.Close()
+
+	for it.Next() {
+		for _, dig := range it.Value() {
+			msg, err := r.message(txn, pre, string(dig))
+			if err != nil {
+				return errors.Wrap(err, "unable to load superseded event")
+			}
+
+			err = handler(msg)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// duplicityKey is the value stored in the duplicitous log, linking the
+// duplicitous event to the accepted event it conflicts with
+// couplets loads the receipt couplets stored in the set for the event
+func (r *DB) couplets(txn *badger.Txn, set *Set, evt *event.Event, dig string) ([]*event.Receipt, error) {
+	vals, err := set.Get(txn, evt.Prefix, dig)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*event.Receipt, len(vals))
+	for i, val := range vals {
+		couple, err := event.ParseAttachedCouplet(bytes.NewReader(val))
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to parse couplet")
+		}
+
+		out[i], err = event.NewReceipt(evt,
+			event.WithQB64(val),
+			event.WithSignerPrefix(couple.Prefix.AsPrefix()),
+			event.WithSignature(couple.Signature))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+func duplicityKey(accepted, dig string) []byte {
+	return []byte(accepted + "/" + dig)
+}
+
+func (r *DB) LastAcceptedDigest(pre string, seq int) ([]byte, error) {
+	txn := r.db.NewTransaction(false)
+	defer txn.Discard()
+
+	vals, err := r.kels.Get(txn, pre, seq)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get last event")
+	}
+
+	if len(vals) == 0 {
+		return nil, errors.New("not found")
+	}
+
+	return vals[len(vals)-1], nil
+}
+
+func (r *DB) LogTransferableReceipt(vrc *event.Receipt) error {
+	txn := r.db.NewTransaction(true)
+	defer txn.Discard()
+
+	pre := vrc.Prefix
+	dig := vrc.Digest
+
+	quadlet := vrc.Text()
+
+	err := r.vrcs.Add(txn, quadlet, pre, dig)
+	if err != nil {
+		return err
+	}
+
+	return txn.Commit()
+}
+
+func (r *DB) LogNonTransferableReceipt(rct *event.Receipt) error {
+	txn := r.db.NewTransaction(true)
+	defer txn.Discard()
+
+	pre := rct.Prefix
+	dig := rct.Digest
+	couplet := rct.Text()
+
+	err := r.rcts.Add(txn, couplet, pre, dig)
+	if err != nil {
+		return err
+	}
+
+	return txn.Commit()
+}
+
+func (r *DB) StreamNonTransferableReceipts(pre, dig string, handler func(couplet []byte) error) error {
+	txn := r.db.NewTransaction(false)
+	defer txn.Discard()
+
+	vals, err := r.rcts.Get(txn, pre, dig)
+	if err != nil {
+		return errors.Wrap(err, "unable to get non-transferable receipts")
+	}
+
+	for _, val := range vals {
+		err = handler(val)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *DB) EscrowNonTransferableReceipt(rct *event.Receipt) error {
+	txn := r.db.NewTransaction(true)
+	defer txn.Discard()
+
+	err := r.ures.Add(txn, escrowedReceipt(rct), rct.Prefix)
+	if err != nil {
+		return err
+	}
+
+	return txn.Commit()
+}
+
+func (r *DB) RemoveNonTransferableReceiptEscrow(rct *event.Receipt) error {
+	txn := r.db.NewTransaction(true)
+	defer txn.Discard()
+
+	err := r.ures.RemoveFromSet(txn, escrowedReceipt(rct), rct.Prefix)
+	if err != nil {
+		return err
+	}
+
+	return txn.Commit()
+}
+
+func (r *DB) StreamNonTransferableReceiptEscrow(pre string, handler func(rct *event.Receipt) error) error {
+	txn := r.db.NewTransaction(false)
+	defer txn.Discard()
+
+	vals, err := r.ures.Get(txn, pre)
+	if err != nil {
+		return errors.Wrap(err, "unable to get escrowed receipts")
+	}
+
+	for _, val := range vals {
+		rct, err := parseEscrowedReceipt(pre, val, false)
+		if err != nil {
+			return errors.Wrap(err, "unable to load escrowed receipt")
+		}
+
+		err = handler(rct)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *DB) EscrowTransferableReceipt(vrc *event.Receipt) error {
+	txn := r.db.NewTransaction(true)
+	defer txn.Discard()
+
+	val := append([]byte(vrc.Prefix), escrowedReceipt(vrc)...)
+	err := r.vres.Add(txn, val, vrc.Prefix)
+	if err != nil {
+		return err
+	}
+
+	return txn.Commit()
+}
+
+func (r *DB) RemoveTransferableReceiptEscrow(vrc *event.Receipt) error {
+	txn := r.db.NewTransaction(true)
+	defer txn.Discard()
+
+	val := append([]byte(vrc.Prefix), escrowedReceipt(vrc)...)
+	err := r.vres.RemoveFromSet(txn, val, vrc.Prefix)
+	if err != nil {
+		return err
+	}
+
+	return txn.Commit()
+}
+
+func (r *DB) StreamTransferableReceiptEscrow(handler func(vrc *event.Receipt) error) error {
+	txn := r.db.NewTransaction(false)
+	defer txn.Discard()
+
+	// the receipts are collected first as the handler may update the escrow
+	vrcs := []*event.Receipt{}
+
+	it := r.vres.Iterator(txn)
+	for it.Next() {
+		for _, val := range it.Value() {
+			buf := bytes.NewReader(val)
+
+			pre, err := derivation.ParsePrefix(buf)
+			if err != nil {
+				it.Close()
+				return errors.Wrap(err, "unable to load escrowed receipt")
+			}
+
+			rest := val[len(val)-buf.Len():]
+			vrc, err := parseEscrowedReceipt(pre.AsPrefix(), rest, true)
+			if err != nil {
+				it.Close()
+				return errors.Wrap(err, "unable to load escrowed receipt")
+			}
+
+			vrcs = append(vrcs, vrc)
+		}
+	}
+	it.Close()
+
+	for _, vrc := range vrcs {
+		err := handler(vrc)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// escrowedReceipt serializes an escrowed receipt as the receipted sequence
+// number in fixed width hex, the receipted digest and the couplet or quadlet
+func escrowedReceipt(rct *event.Receipt) []byte {
+	out := []byte(fmt.Sprintf("%032x", rct.Sequence))
+	out = append(out, rct.Digest...)
+	return append(out, rct.Text()...)
+}
+
+func parseEscrowedReceipt(pre string, val []byte, transferable bool) (*event.Receipt, error) {
+	buf := bytes.NewReader(val)
+
+	raw := make([]byte, 32)
+	_, err := io.ReadFull(buf, raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read receipted sequence number")
+	}
+
+	sn, err := strconv.ParseInt(string(raw), 16, 64)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid receipted sequence number")
+	}
+
+	dig, err := derivation.ParsePrefix(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	evt := &event.Event{
+		Version:     event.DefaultVersionString(event.JSON),
+		Prefix:      pre,
+		Sequence:    strconv.FormatInt(sn, 16),
+		EventType:   event.RCT.String(),
+		EventDigest: dig.AsPrefix(),
+	}
+
+	if transferable {
+		rest := val[len(val)-buf.Len():]
+		quad, err := event.ParseAttachedQuadlet(buf)
+		if err != nil {
+			return nil, err
+		}
+
+		return event.NewReceipt(evt,
+			event.WithQB64(rest),
+			event.WithSignature(quad.Signature),
+			event.WithEstablishmentSeal(&event.Seal{
+				Prefix:   quad.Prefix.AsPrefix(),
+				Sequence: strconv.FormatInt(int64(quad.Sequence), 16),
+				Digest:   quad.Digest.AsPrefix(),
+			}),
+		)
+	}
+
+	couplet, err := event.ParseAttachedCouplet(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return event.NewReceipt(evt,
+		event.WithSignerPrefix(couplet.Prefix.AsPrefix()),
+		event.WithSignature(couplet.Signature),
+	)
+}
+
+func (r *DB) LogWitnessReceipt(rct *event.Receipt) error {
+	txn := r.db.NewTransaction(true)
+	defer txn.Discard()
+
+	err := r.wigs.Add(txn, rct.Text(), rct.Prefix, rct.Digest)
+	if err != nil {
+		return err
+	}
+
+	return txn.Commit()
+}
+
+func (r *DB) StreamWitnessReceipts(pre, dig string, handler func(couplet []byte) error) error {
+	txn := r.db.NewTransaction(false)
+	defer txn.Discard()
+
+	vals, err := r.wigs.Get(txn, pre, dig)
+	if err != nil {
+		return errors.Wrap(err, "unable to get witness receipts")
+	}
+
+	for _, val := range vals {
+		err = handler(val)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (r *DB) StreamTransferableReceipts(pre string, sn int, handler func(quadlet []byte) error) error {
 	txn := r.db.NewTransaction(false)
 	defer txn.Discard()
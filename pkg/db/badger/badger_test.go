@@ -86,6 +86,39 @@ func TestLogEvent(t *testing.T) {
 	assert.EqualValues(t, expectedDig, actualDig)
 }
 
+func TestLogCBOREvent(t *testing.T) {
+	td, cleanup := getTempDir(t)
+	defer cleanup()
+
+	db, err := New(td)
+	assert.NoError(t, err)
+
+	evt := &event.Event{
+		Prefix:    "pre",
+		Version:   event.DefaultVersionString(event.CBOR),
+		EventType: "icp",
+		Sequence:  "0",
+		Keys:      []string{"k1.1", "k1.2", "k1.3"},
+		Next:      "next1",
+		Witnesses: []string{"w1"},
+	}
+
+	err = db.LogEvent(&event.Message{Event: evt}, true)
+	assert.NoError(t, err)
+
+	icp, err := db.Inception("pre")
+	assert.NoError(t, err)
+	assert.Equal(t, evt.Version, icp.Event.Version)
+	assert.Equal(t, evt.Keys, icp.Event.Keys)
+
+	expectedDig, err := evt.GetDigest()
+	assert.NoError(t, err)
+	actualDig, err := icp.Event.GetDigest()
+	assert.NoError(t, err)
+
+	assert.EqualValues(t, expectedDig, actualDig)
+}
+
 func TestLogSize(t *testing.T) {
 	td, cleanup := getTempDir(t)
 	defer cleanup()
@@ -378,6 +411,526 @@ func TestPending(t *testing.T) {
 
 }
 
+func TestPartiallyWitnessed(t *testing.T) {
+	td, cleanup := getTempDir(t)
+	defer cleanup()
+
+	db, err := New(td)
+	assert.NoError(t, err)
+	assert.NotNil(t, db)
+
+	evt := &event.Event{
+		Prefix:    "pre",
+		Version:   event.DefaultVersionString(event.JSON),
+		EventType: "icp",
+		Sequence:  "0",
+		Keys:      []string{"k1.1"},
+		Next:      "next1",
+		Witnesses: []string{"w1", "w2"},
+	}
+
+	err = db.EscrowPartiallyWitnessedEvent(&event.Message{Event: evt})
+	require.NoError(t, err)
+
+	count := 0
+	err = db.StreamPartiallyWitnessed("pre", func(e *event.Message) error {
+		count++
+		assert.Equal(t, evt.Witnesses, e.Event.Witnesses)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	dig, err := evt.GetDigest()
+	require.NoError(t, err)
+
+	err = db.RemovePartiallyWitnessedEscrow("pre", 0, dig)
+	assert.NoError(t, err)
+
+	count = 0
+	err = db.StreamPartiallyWitnessed("pre", func(e *event.Message) error {
+		count++
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestNonTransferableReceiptEscrow(t *testing.T) {
+	td, cleanup := getTempDir(t)
+	defer cleanup()
+
+	db, err := New(td)
+	assert.NoError(t, err)
+	assert.NotNil(t, db)
+
+	kms := testkms.GetKMS(t, secrets, db)
+
+	evt := &event.Event{
+		Prefix:    "pre",
+		Version:   event.DefaultVersionString(event.JSON),
+		EventType: "ixn",
+		Sequence:  "a",
+	}
+
+	sig, err := derivation.New(derivation.WithCode(derivation.Ed25519Sig), derivation.WithSigner(kms.Signer()))
+	require.NoError(t, err)
+	_, err = sig.Derive([]byte("event"))
+	require.NoError(t, err)
+
+	nt, err := derivation.New(derivation.WithCode(derivation.Ed25519NT), derivation.WithRaw(kms.PublicKey()))
+	require.NoError(t, err)
+
+	rct, err := event.NewReceipt(evt, event.WithSignerPrefix(nt.AsPrefix()), event.WithSignature(sig))
+	require.NoError(t, err)
+
+	err = db.EscrowNonTransferableReceipt(rct)
+	require.NoError(t, err)
+
+	count := 0
+	err = db.StreamNonTransferableReceiptEscrow("pre", func(r *event.Receipt) error {
+		count++
+		assert.Equal(t, 10, r.Sequence)
+		assert.Equal(t, rct.Digest, r.Digest)
+		assert.Equal(t, nt.AsPrefix(), r.EstPrefix)
+		assert.Equal(t, rct.Text(), r.Text())
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	err = db.RemoveNonTransferableReceiptEscrow(rct)
+	assert.NoError(t, err)
+
+	count = 0
+	err = db.StreamNonTransferableReceiptEscrow("pre", func(r *event.Receipt) error {
+		count++
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestReceiptEscrowLargeSequence(t *testing.T) {
+	td, cleanup := getTempDir(t)
+	defer cleanup()
+
+	db, err := New(td)
+	assert.NoError(t, err)
+	assert.NotNil(t, db)
+
+	kms := testkms.GetKMS(t, secrets, db)
+
+	evt := &event.Event{
+		Prefix:    "Eh0fefvTQ55Jwps4dVnIekf7mZgWoU8bCUsDsKeGiEgU",
+		Version:   event.DefaultVersionString(event.JSON),
+		EventType: "ixn",
+		Sequence:  "1000a",
+	}
+
+	est := &event.Event{
+		Prefix:    "EZ-i0d8JZAoTNZH3ULaU6JR2nmwyvYAfSVPzhzS6b5CM",
+		Version:   event.DefaultVersionString(event.JSON),
+		EventType: "rot",
+		Sequence:  "c",
+	}
+
+	sig, err := derivation.New(derivation.WithCode(derivation.Ed25519Sig), derivation.WithSigner(kms.Signer()))
+	require.NoError(t, err)
+	_, err = sig.Derive([]byte("event"))
+	require.NoError(t, err)
+
+	nt, err := derivation.New(derivation.WithCode(derivation.Ed25519NT), derivation.WithRaw(kms.PublicKey()))
+	require.NoError(t, err)
+
+	rct, err := event.NewReceipt(evt, event.WithSignerPrefix(nt.AsPrefix()), event.WithSignature(sig))
+	require.NoError(t, err)
+
+	err = db.EscrowNonTransferableReceipt(rct)
+	require.NoError(t, err)
+
+	count := 0
+	err = db.StreamNonTransferableReceiptEscrow(evt.Prefix, func(r *event.Receipt) error {
+		count++
+		assert.Equal(t, 0x1000a, r.Sequence)
+		assert.Equal(t, rct.Digest, r.Digest)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	tsig, err := derivation.New(derivation.WithCode(derivation.Ed25519Attached), derivation.WithSigner(kms.Signer()))
+	require.NoError(t, err)
+	_, err = tsig.Derive([]byte("event"))
+	require.NoError(t, err)
+
+	vrc, err := event.NewReceipt(evt, event.WithSignature(tsig), event.WithEstablishmentEvent(est))
+	require.NoError(t, err)
+
+	err = db.EscrowTransferableReceipt(vrc)
+	require.NoError(t, err)
+
+	count = 0
+	err = db.StreamTransferableReceiptEscrow(func(r *event.Receipt) error {
+		count++
+		assert.Equal(t, 0x1000a, r.Sequence)
+		assert.Equal(t, vrc.Digest, r.Digest)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestTransferableReceiptEscrow(t *testing.T) {
+	td, cleanup := getTempDir(t)
+	defer cleanup()
+
+	db, err := New(td)
+	assert.NoError(t, err)
+	assert.NotNil(t, db)
+
+	kms := testkms.GetKMS(t, secrets, db)
+
+	evt := &event.Event{
+		Prefix:    "Eh0fefvTQ55Jwps4dVnIekf7mZgWoU8bCUsDsKeGiEgU",
+		Version:   event.DefaultVersionString(event.JSON),
+		EventType: "ixn",
+		Sequence:  "b",
+	}
+
+	est := &event.Event{
+		Prefix:    "EZ-i0d8JZAoTNZH3ULaU6JR2nmwyvYAfSVPzhzS6b5CM",
+		Version:   event.DefaultVersionString(event.JSON),
+		EventType: "rot",
+		Sequence:  "c",
+	}
+
+	sig, err := derivation.New(derivation.WithCode(derivation.Ed25519Attached), derivation.WithSigner(kms.Signer()))
+	require.NoError(t, err)
+	_, err = sig.Derive([]byte("event"))
+	require.NoError(t, err)
+
+	vrc, err := event.NewReceipt(evt, event.WithSignature(sig), event.WithEstablishmentEvent(est))
+	require.NoError(t, err)
+
+	err = db.EscrowTransferableReceipt(vrc)
+	require.NoError(t, err)
+
+	count := 0
+	err = db.StreamTransferableReceiptEscrow(func(r *event.Receipt) error {
+		count++
+		assert.Equal(t, evt.Prefix, r.Prefix)
+		assert.Equal(t, 11, r.Sequence)
+		assert.Equal(t, vrc.Digest, r.Digest)
+		assert.Equal(t, est.Prefix, r.EstPrefix)
+		assert.Equal(t, 12, r.EstSequence)
+		assert.Equal(t, vrc.EstDigest, r.EstDigest)
+		assert.Equal(t, vrc.Text(), r.Text())
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	err = db.RemoveTransferableReceiptEscrow(vrc)
+	assert.NoError(t, err)
+
+	count = 0
+	err = db.StreamTransferableReceiptEscrow(func(r *event.Receipt) error {
+		count++
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestExchangeEscrow(t *testing.T) {
+	td, cleanup := getTempDir(t)
+	defer cleanup()
+
+	db, err := New(td)
+	assert.NoError(t, err)
+	assert.NotNil(t, db)
+
+	kms := testkms.GetKMS(t, secrets, db)
+
+	seal, err := event.NewEventSeal("Edig", "pre", "1")
+	require.NoError(t, err)
+
+	exn, err := event.NewExchange("/greet", map[string]string{"msg": "hello"}, seal, event.JSON)
+	require.NoError(t, err)
+
+	raw, err := exn.Serialize()
+	require.NoError(t, err)
+
+	sig, err := derivation.New(derivation.WithCode(derivation.Ed25519Attached), derivation.WithSigner(kms.Signer()))
+	require.NoError(t, err)
+	_, err = sig.Derive(raw)
+	require.NoError(t, err)
+
+	msg := &event.Message{Event: exn, Signatures: []derivation.Derivation{*sig}}
+	err = db.EscrowExchange(msg)
+	require.NoError(t, err)
+
+	dig, err := exn.GetDigest()
+	require.NoError(t, err)
+
+	count := 0
+	err = db.StreamExchangeEscrow("pre", func(m *event.Message) error {
+		count++
+
+		mdig, err := m.Event.GetDigest()
+		assert.NoError(t, err)
+		assert.Equal(t, dig, mdig)
+		assert.Equal(t, "/greet", m.Event.Route)
+		assert.JSONEq(t, `{"msg":"hello"}`, string(m.Event.Payload))
+		if assert.Len(t, m.Signatures, 1) {
+			assert.Equal(t, sig.Raw, m.Signatures[0].Raw)
+		}
+
+		// messages can be removed while streaming
+		return db.RemoveExchangeEscrow("pre", dig)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	count = 0
+	err = db.StreamExchangeEscrow("pre", func(m *event.Message) error {
+		count++
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestEndRoles(t *testing.T) {
+	td, cleanup := getTempDir(t)
+	defer cleanup()
+
+	db, err := New(td)
+	assert.NoError(t, err)
+	assert.NotNil(t, db)
+
+	seal, err := event.NewEventSeal("Edig", "pre", "0")
+	require.NoError(t, err)
+
+	endRole := func(role, eid, url string) *event.Message {
+		rpy, err := event.NewEndRoleReply(&event.EndRole{Controller: "pre", Role: role, EID: eid, URL: url}, seal, event.JSON)
+		require.NoError(t, err)
+
+		return &event.Message{Event: rpy}
+	}
+
+	_, err = db.EndRole("pre", "witness", "w1")
+	assert.Error(t, err)
+
+	for _, rpy := range []*event.Message{
+		endRole("witness", "w1", "http://127.0.0.1:5642"),
+		endRole("witness", "w2", "http://127.0.0.1:5643"),
+		endRole("witnesses", "w3", "http://127.0.0.1:5644"),
+		endRole("witness", "w1", "http://127.0.0.1:5645"),
+	} {
+		err = db.LogEndRole(rpy)
+		require.NoError(t, err)
+	}
+
+	rpy, err := db.EndRole("pre", "witness", "w1")
+	require.NoError(t, err)
+
+	end, err := event.ParseEndRole(rpy.Event)
+	require.NoError(t, err)
+	assert.Equal(t, "http://127.0.0.1:5645", end.URL)
+
+	urls := []string{}
+	err = db.StreamEndRoles("pre", "witness", func(m *event.Message) error {
+		end, err := event.ParseEndRole(m.Event)
+		if err != nil {
+			return err
+		}
+
+		urls = append(urls, end.URL)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"http://127.0.0.1:5645", "http://127.0.0.1:5643"}, urls)
+}
+
+func TestDuplicitousLog(t *testing.T) {
+	td, cleanup := getTempDir(t)
+	defer cleanup()
+
+	db, err := New(td)
+	assert.NoError(t, err)
+	assert.NotNil(t, db)
+
+	newEvent := func(next string) *event.Event {
+		return &event.Event{
+			Prefix:    "pre",
+			Version:   event.DefaultVersionString(event.JSON),
+			EventType: "icp",
+			Sequence:  "0",
+			Keys:      []string{"k1.1"},
+			Next:      next,
+		}
+	}
+
+	acc := newEvent("next1")
+	err = db.LogEvent(&event.Message{Event: acc}, true)
+	require.NoError(t, err)
+
+	accDig, err := acc.GetDigest()
+	require.NoError(t, err)
+
+	dup := newEvent("next2")
+	dupDig, err := dup.GetDigest()
+	require.NoError(t, err)
+
+	err = db.LogDuplicitousEvent("unknown", &event.Message{Event: dup})
+	assert.Error(t, err)
+
+	kms := testkms.GetKMS(t, secrets, db)
+
+	sig, err := derivation.New(derivation.WithCode(derivation.Ed25519Sig), derivation.WithSigner(kms.Signer()))
+	require.NoError(t, err)
+	_, err = sig.Derive([]byte("event"))
+	require.NoError(t, err)
+
+	nt, err := derivation.New(derivation.WithCode(derivation.Ed25519NT), derivation.WithRaw(kms.PublicKey()))
+	require.NoError(t, err)
+
+	rct, err := event.NewReceipt(dup, event.WithSignerPrefix(nt.AsPrefix()), event.WithSignature(sig))
+	require.NoError(t, err)
+
+	err = db.LogDuplicitousEvent(accDig, &event.Message{Event: dup, NonTransferableReceipts: []*event.Receipt{rct}})
+	require.NoError(t, err)
+
+	// receipts of the duplicitous event are only kept with it
+	err = db.StreamNonTransferableReceipts("pre", dupDig, func([]byte) error {
+		t.Error("unexpected receipt")
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// logging the same pair again does not duplicate it
+	err = db.LogDuplicitousEvent(accDig, &event.Message{Event: dup})
+	require.NoError(t, err)
+
+	count := 0
+	err = db.StreamDuplicitous("pre", func(a, d *event.Message) error {
+		count++
+
+		dig, err := a.Event.GetDigest()
+		assert.NoError(t, err)
+		assert.Equal(t, accDig, dig)
+
+		dig, err = d.Event.GetDigest()
+		assert.NoError(t, err)
+		assert.Equal(t, dupDig, dig)
+
+		if assert.Len(t, d.NonTransferableReceipts, 1) {
+			assert.Equal(t, nt.AsPrefix(), d.NonTransferableReceipts[0].EstPrefix)
+		}
+		assert.Empty(t, d.WitnessReceipts)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestSupersedeEvents(t *testing.T) {
+	td, cleanup := getTempDir(t)
+	defer cleanup()
+
+	db, err := New(td)
+	assert.NoError(t, err)
+	assert.NotNil(t, db)
+
+	evts := []*event.Event{{
+		Prefix:    "pre",
+		Version:   event.DefaultVersionString(event.JSON),
+		EventType: "icp",
+		Sequence:  "0",
+		Keys:      []string{"k1.1"},
+		Next:      "next1",
+	}}
+	for sn := 1; sn < 4; sn++ {
+		evts = append(evts, &event.Event{
+			Prefix:    "pre",
+			Version:   event.DefaultVersionString(event.JSON),
+			EventType: "ixn",
+			Sequence:  fmt.Sprintf("%x", sn),
+		})
+	}
+
+	digs := []string{}
+	for _, evt := range evts {
+		err = db.LogEvent(&event.Message{Event: evt}, true)
+		require.NoError(t, err)
+
+		dig, err := evt.GetDigest()
+		require.NoError(t, err)
+		digs = append(digs, dig)
+	}
+
+	err = db.SupersedeEvents("pre", 0)
+	assert.Error(t, err)
+
+	err = db.SupersedeEvents("pre", 4)
+	assert.Error(t, err)
+
+	err = db.SupersedeEvents("pre", 2)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, db.LogSize("pre"))
+
+	cur, err := db.CurrentEvent("pre")
+	require.NoError(t, err)
+	curDig, err := cur.Event.GetDigest()
+	require.NoError(t, err)
+	assert.Equal(t, digs[1], curDig)
+
+	_, err = db.EventAt("pre", 2)
+	assert.Error(t, err)
+
+	sup := []string{}
+	err = db.StreamSuperseded("pre", func(msg *event.Message) error {
+		dig, err := msg.Event.GetDigest()
+		require.NoError(t, err)
+		sup = append(sup, dig)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, digs[2:], sup)
+
+	// the recovery rotation takes the place of the superseded events
+	rot := &event.Event{
+		Prefix:    "pre",
+		Version:   event.DefaultVersionString(event.JSON),
+		EventType: "rot",
+		Sequence:  "2",
+		Keys:      []string{"k2.1"},
+		Next:      "next2",
+	}
+	err = db.LogEvent(&event.Message{Event: rot}, true)
+	require.NoError(t, err)
+
+	rotDig, err := rot.GetDigest()
+	require.NoError(t, err)
+
+	dig, err := db.LastAcceptedDigest("pre", 2)
+	require.NoError(t, err)
+	assert.Equal(t, rotDig, string(dig))
+
+	seen := []string{}
+	err = db.StreamAsFirstSeen("pre", func(msg *event.Message) error {
+		dig, err := msg.Event.GetDigest()
+		require.NoError(t, err)
+		seen = append(seen, dig)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, append(digs, rotDig), seen)
+}
+
 func TestSeen(t *testing.T) {
 	td, cleanup := getTempDir(t)
 	defer cleanup()
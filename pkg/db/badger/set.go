@@ -48,6 +48,11 @@ func (r *Set) Delete(txn *badger.Txn, keyvals ...interface{}) error {
 	return delVals(txn, key)
 }
 
+func (r *Set) RemoveFromSet(txn *badger.Txn, val []byte, keyvals ...interface{}) error {
+	key := fmt.Sprintf(r.keyCode, keyvals...)
+	return removeFromVals(txn, key, val)
+}
+
 func (r *Set) Iterator(txn *badger.Txn, keyvals ...interface{}) *SetIterator {
 	seek := []byte(fmt.Sprintf(r.iterator, keyvals...))
 	return NewSetIterator(txn, seek)
@@ -7,23 +7,55 @@ import (
 type DB interface {
 	Put(k string, v []byte) error
 	Get(k string) ([]byte, error)
+	Delete(k string) error
 
 	LogEvent(e *event.Message, first bool) error
 	LogTransferableReceipt(vrc *event.Receipt) error
 	LogNonTransferableReceipt(rct *event.Receipt) error
+	LogWitnessReceipt(rct *event.Receipt) error
 
 	EscrowPendingEvent(e *event.Message) error
 	RemovePendingEscrow(prefix string, sn int, dig string) error
 
+	EscrowPartiallyWitnessedEvent(e *event.Message) error
+	RemovePartiallyWitnessedEscrow(prefix string, sn int, dig string) error
+
+	EscrowDelegatedEvent(delegator string, e *event.Message) error
+	RemoveDelegatedEscrow(delegator, prefix string, sn int, dig string) error
+
+	EscrowNonTransferableReceipt(rct *event.Receipt) error
+	RemoveNonTransferableReceiptEscrow(rct *event.Receipt) error
+
+	EscrowTransferableReceipt(vrc *event.Receipt) error
+	RemoveTransferableReceiptEscrow(vrc *event.Receipt) error
+
+	EscrowExchange(exn *event.Message) error
+	RemoveExchangeEscrow(pre, dig string) error
+
+	LogEndRole(rpy *event.Message) error
+	EndRole(cid, role, eid string) (*event.Message, error)
+
 	EscrowOutOfOrderEvent(e *event.Message) error
 	EscrowLikelyDuplicitiousEvent(e *event.Message) error
+	LogDuplicitousEvent(accepted string, e *event.Message) error
+	SupersedeEvents(pre string, sn int) error
 
 	LogSize(pre string) int
 	StreamEstablisment(pre string, handler func(*event.Message) error) error
 	StreamAsFirstSeen(pre string, handler func(*event.Message) error) error
 	StreamBySequenceNo(pre string, handler func(*event.Message) error) error
 	StreamPending(pre string, handler func(*event.Message) error) error
+	StreamPartiallyWitnessed(pre string, handler func(*event.Message) error) error
+	StreamDelegated(delegator string, handler func(*event.Message) error) error
 	StreamTransferableReceipts(pre string, sn int, handler func(quadlet []byte) error) error
+	StreamNonTransferableReceipts(pre, dig string, handler func(couplet []byte) error) error
+	StreamWitnessReceipts(pre, dig string, handler func(couplet []byte) error) error
+	StreamNonTransferableReceiptEscrow(pre string, handler func(rct *event.Receipt) error) error
+	StreamTransferableReceiptEscrow(handler func(vrc *event.Receipt) error) error
+	StreamExchangeEscrow(pre string, handler func(exn *event.Message) error) error
+	StreamEndRoles(cid, role string, handler func(rpy *event.Message) error) error
+	StreamDuplicitous(pre string, handler func(accepted, dup *event.Message) error) error
+	StreamSuperseded(pre string, handler func(*event.Message) error) error
 
 	Seen(pre string) bool
 	Inception(pre string) (*event.Message, error)
@@ -3,8 +3,10 @@ package mem
 import (
 	"bytes"
 	"errors"
+	"sort"
 	"sync"
 
+	"github.com/decentralized-identity/kerigo/pkg/derivation"
 	"github.com/decentralized-identity/kerigo/pkg/event"
 )
 
@@ -12,18 +14,36 @@ type DB struct {
 	valueLock sync.RWMutex
 	values    map[string][]byte
 
-	logLock sync.RWMutex
-	logs    map[string][][]*event.Message
-	seen    map[string][]*event.Message
+	logLock    sync.RWMutex
+	logs       map[string][][]*event.Message
+	seen       map[string][]*event.Message
+	superseded map[string][]*event.Message
 
 	pendLock sync.RWMutex
 	pending  map[string][][]*event.Message
 
 	dupLock    sync.RWMutex
 	likelyDups map[string][][]*event.Message
+	duplicity  map[string][][2]*event.Message
+
+	partLock sync.RWMutex
+	partial  map[string][][]*event.Message
+
+	delLock   sync.RWMutex
+	delegated map[string][]*event.Message
+
+	exnLock   sync.RWMutex
+	exchanges map[string][]*event.Message
+
+	endLock  sync.RWMutex
+	endRoles map[string]map[string]*event.Message
 
 	rcptLock sync.RWMutex
 	rcpts    map[string][]string
+	ntrs     map[string][]string
+	wigs     map[string][]string
+	ures     map[string][]*event.Receipt
+	vres     []*event.Receipt
 }
 
 func New() *DB {
@@ -31,18 +51,35 @@ func New() *DB {
 		valueLock: sync.RWMutex{},
 		values:    map[string][]byte{},
 
-		logLock: sync.RWMutex{},
-		logs:    map[string][][]*event.Message{},
-		seen:    map[string][]*event.Message{},
+		logLock:    sync.RWMutex{},
+		logs:       map[string][][]*event.Message{},
+		seen:       map[string][]*event.Message{},
+		superseded: map[string][]*event.Message{},
 
 		pendLock: sync.RWMutex{},
 		pending:  map[string][][]*event.Message{},
 
 		dupLock:    sync.RWMutex{},
 		likelyDups: map[string][][]*event.Message{},
+		duplicity:  map[string][][2]*event.Message{},
+
+		partLock: sync.RWMutex{},
+		partial:  map[string][][]*event.Message{},
+
+		delLock:   sync.RWMutex{},
+		delegated: map[string][]*event.Message{},
+
+		exnLock:   sync.RWMutex{},
+		exchanges: map[string][]*event.Message{},
+
+		endLock:  sync.RWMutex{},
+		endRoles: map[string]map[string]*event.Message{},
 
 		rcptLock: sync.RWMutex{},
 		rcpts:    map[string][]string{},
+		ntrs:     map[string][]string{},
+		wigs:     map[string][]string{},
+		ures:     map[string][]*event.Receipt{},
 	}
 }
 
@@ -65,6 +102,14 @@ func (r *DB) Get(k string) ([]byte, error) {
 	return v, nil
 }
 
+func (r *DB) Delete(k string) error {
+	r.valueLock.Lock()
+	defer r.valueLock.Unlock()
+
+	delete(r.values, k)
+	return nil
+}
+
 func (r *DB) LogSize(pre string) int {
 	r.logLock.RLock()
 	defer r.logLock.RUnlock()
@@ -136,7 +181,7 @@ func (r *DB) EventAt(pre string, sequence int) (*event.Message, error) {
 	defer r.logLock.RUnlock()
 
 	l, ok := r.logs[pre]
-	if !ok || len(l) < sequence-1 || sequence < 0 {
+	if !ok || len(l) <= sequence || sequence < 0 {
 		return nil, errors.New("not found")
 	}
 
@@ -156,6 +201,16 @@ func (r *DB) LogEvent(e *event.Message, first bool) error {
 	} else {
 		sn := e.Event.SequenceInt()
 		if sn < len(l) {
+			// additional signatures for an event we have already logged
+			dig, _ := e.Digest()
+			for _, logged := range l[sn] {
+				loggedDig, _ := logged.Digest()
+				if loggedDig == dig {
+					logged.Signatures = mergeSignatures(logged.Signatures, e.Signatures)
+					return nil
+				}
+			}
+
 			l[sn] = append(l[sn], e)
 		} else {
 			r.logs[pre] = append(l, []*event.Message{e})
@@ -239,7 +294,7 @@ func (r *DB) StreamBySequenceNo(pre string, handler func(*event.Message) error)
 		}
 
 		if len(evts) > 1 {
-			dig, _ := evt.Event.GetDigest()
+			dig, _ := evt.Digest()
 			fork = []byte(dig)
 		} else {
 			fork = []byte{}
@@ -259,13 +314,13 @@ func (r *DB) LastAcceptedDigest(pre string, seq int) ([]byte, error) {
 	defer r.logLock.RUnlock()
 
 	log, ok := r.logs[pre]
-	if !ok {
+	if !ok || seq < 0 || seq >= len(log) {
 		return nil, errors.New("not found")
 	}
 
-	last := log[len(log)-1]
-	evt := last[len(last)-1]
-	dig, err := evt.Event.GetDigest()
+	evts := log[seq]
+	evt := evts[len(evts)-1]
+	dig, err := evt.Digest()
 	if err != nil {
 		return nil, err
 	}
@@ -273,6 +328,241 @@ func (r *DB) LastAcceptedDigest(pre string, seq int) ([]byte, error) {
 	return []byte(dig), nil
 }
 
+func (r *DB) EscrowPartiallyWitnessedEvent(e *event.Message) error {
+	r.partLock.Lock()
+	defer r.partLock.Unlock()
+
+	pre := e.Event.Prefix
+	sn := e.Event.SequenceInt()
+	dig, err := e.Digest()
+	if err != nil {
+		return err
+	}
+
+	l := r.partial[pre]
+	for len(l) <= sn {
+		l = append(l, []*event.Message{})
+	}
+
+	for _, esc := range l[sn] {
+		escDig, _ := esc.Digest()
+		if escDig == dig {
+			esc.Signatures = mergeSignatures(esc.Signatures, e.Signatures)
+			return nil
+		}
+	}
+
+	l[sn] = append(l[sn], e)
+	r.partial[pre] = l
+
+	return nil
+}
+
+func (r *DB) RemovePartiallyWitnessedEscrow(prefix string, sn int, dig string) error {
+	r.partLock.Lock()
+	defer r.partLock.Unlock()
+
+	l, ok := r.partial[prefix]
+	if ok && sn < len(l) {
+		digs := l[sn]
+		n := 0
+		for _, x := range digs {
+			xdig, _ := x.Digest()
+			if xdig != dig {
+				digs[n] = x
+				n++
+			}
+		}
+		l[sn] = digs[:n]
+	}
+
+	return nil
+}
+
+func (r *DB) StreamPartiallyWitnessed(pre string, handler func(*event.Message) error) error {
+	r.partLock.RLock()
+	evts := []*event.Message{}
+	for _, sn := range r.partial[pre] {
+		evts = append(evts, sn...)
+	}
+	r.partLock.RUnlock()
+
+	for _, evt := range evts {
+		err := handler(evt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *DB) EscrowDelegatedEvent(delegator string, e *event.Message) error {
+	r.delLock.Lock()
+	defer r.delLock.Unlock()
+
+	dig, err := e.Digest()
+	if err != nil {
+		return err
+	}
+
+	for _, esc := range r.delegated[delegator] {
+		escDig, _ := esc.Digest()
+		if esc.Event.Prefix == e.Event.Prefix && escDig == dig {
+			esc.Signatures = mergeSignatures(esc.Signatures, e.Signatures)
+			return nil
+		}
+	}
+
+	r.delegated[delegator] = append(r.delegated[delegator], e)
+
+	return nil
+}
+
+func (r *DB) RemoveDelegatedEscrow(delegator, prefix string, sn int, dig string) error {
+	r.delLock.Lock()
+	defer r.delLock.Unlock()
+
+	l := r.delegated[delegator]
+	n := 0
+	for _, x := range l {
+		xdig, _ := x.Digest()
+		if x.Event.Prefix != prefix || x.Event.SequenceInt() != sn || xdig != dig {
+			l[n] = x
+			n++
+		}
+	}
+	r.delegated[delegator] = l[:n]
+
+	return nil
+}
+
+func (r *DB) StreamDelegated(delegator string, handler func(*event.Message) error) error {
+	r.delLock.RLock()
+	evts := append([]*event.Message{}, r.delegated[delegator]...)
+	r.delLock.RUnlock()
+
+	for _, evt := range evts {
+		err := handler(evt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *DB) EscrowExchange(exn *event.Message) error {
+	r.exnLock.Lock()
+	defer r.exnLock.Unlock()
+
+	dig, err := exn.Digest()
+	if err != nil {
+		return err
+	}
+
+	pre := exn.Event.Prefix
+	for _, esc := range r.exchanges[pre] {
+		escDig, _ := esc.Digest()
+		if escDig == dig {
+			return nil
+		}
+	}
+
+	r.exchanges[pre] = append(r.exchanges[pre], exn)
+
+	return nil
+}
+
+func (r *DB) RemoveExchangeEscrow(pre, dig string) error {
+	r.exnLock.Lock()
+	defer r.exnLock.Unlock()
+
+	l := r.exchanges[pre]
+	n := 0
+	for _, x := range l {
+		xdig, _ := x.Digest()
+		if xdig != dig {
+			l[n] = x
+			n++
+		}
+	}
+	r.exchanges[pre] = l[:n]
+
+	return nil
+}
+
+func (r *DB) StreamExchangeEscrow(pre string, handler func(*event.Message) error) error {
+	r.exnLock.RLock()
+	exns := append([]*event.Message{}, r.exchanges[pre]...)
+	r.exnLock.RUnlock()
+
+	for _, exn := range exns {
+		err := handler(exn)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *DB) LogEndRole(rpy *event.Message) error {
+	end, err := event.ParseEndRole(rpy.Event)
+	if err != nil {
+		return err
+	}
+
+	r.endLock.Lock()
+	defer r.endLock.Unlock()
+
+	k := end.Controller + "/" + end.Role
+	if _, ok := r.endRoles[k]; !ok {
+		r.endRoles[k] = map[string]*event.Message{}
+	}
+
+	r.endRoles[k][end.EID] = rpy
+
+	return nil
+}
+
+func (r *DB) EndRole(cid, role, eid string) (*event.Message, error) {
+	r.endLock.RLock()
+	defer r.endLock.RUnlock()
+
+	rpy, ok := r.endRoles[cid+"/"+role][eid]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+
+	return rpy, nil
+}
+
+func (r *DB) StreamEndRoles(cid, role string, handler func(*event.Message) error) error {
+	r.endLock.RLock()
+	ends := r.endRoles[cid+"/"+role]
+	eids := make([]string, 0, len(ends))
+	for eid := range ends {
+		eids = append(eids, eid)
+	}
+	sort.Strings(eids)
+
+	rpys := make([]*event.Message, len(eids))
+	for i, eid := range eids {
+		rpys[i] = ends[eid]
+	}
+	r.endLock.RUnlock()
+
+	for _, rpy := range rpys {
+		err := handler(rpy)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (r *DB) EscrowOutOfOrderEvent(e *event.Message) error {
 	return nil
 }
@@ -298,24 +588,135 @@ func (r *DB) EscrowLikelyDuplicitiousEvent(e *event.Message) error {
 	return nil
 }
 
+func (r *DB) LogDuplicitousEvent(accepted string, e *event.Message) error {
+	pre := e.Event.Prefix
+	sn := e.Event.SequenceInt()
+
+	var acc *event.Message
+	r.logLock.RLock()
+	if l := r.logs[pre]; sn >= 0 && sn < len(l) {
+		for _, evt := range l[sn] {
+			evtDig, _ := evt.Digest()
+			if evtDig == accepted {
+				acc = evt
+			}
+		}
+	}
+	r.logLock.RUnlock()
+
+	if acc == nil {
+		return errors.New("accepted event not found")
+	}
+
+	dig, err := e.Digest()
+	if err != nil {
+		return err
+	}
+
+	r.dupLock.Lock()
+	defer r.dupLock.Unlock()
+
+	// the receipts attached to the duplicitous event are kept with it only
+	dup := *e
+	for i, pair := range r.duplicity[pre] {
+		pairDig, _ := pair[1].Digest()
+		if pairDig == dig {
+			dup = *pair[1]
+			dup.Signatures = mergeSignatures(append([]derivation.Derivation{}, dup.Signatures...), e.Signatures)
+			dup.WitnessReceipts = mergeReceipts(dup.WitnessReceipts, e.WitnessReceipts)
+			dup.NonTransferableReceipts = mergeReceipts(dup.NonTransferableReceipts, e.NonTransferableReceipts)
+			r.duplicity[pre][i][1] = &dup
+			return nil
+		}
+	}
+
+	r.duplicity[pre] = append(r.duplicity[pre], [2]*event.Message{acc, &dup})
+
+	return nil
+}
+
+// SupersedeEvents moves the events accepted from the sequence number on
+// out of the log, keeping them as superseded
+func (r *DB) SupersedeEvents(pre string, sn int) error {
+	r.logLock.Lock()
+	defer r.logLock.Unlock()
+
+	l, ok := r.logs[pre]
+	if !ok || sn <= 0 || sn >= len(l) {
+		return errors.New("no events to supersede")
+	}
+
+	for _, evts := range l[sn:] {
+		r.superseded[pre] = append(r.superseded[pre], evts...)
+	}
+
+	r.logs[pre] = l[:sn]
+
+	return nil
+}
+
+func (r *DB) StreamSuperseded(pre string, handler func(*event.Message) error) error {
+	r.logLock.RLock()
+	evts := append([]*event.Message{}, r.superseded[pre]...)
+	r.logLock.RUnlock()
+
+	for _, evt := range evts {
+		err := handler(evt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *DB) StreamDuplicitous(pre string, handler func(accepted, dup *event.Message) error) error {
+	r.dupLock.RLock()
+	pairs := append([][2]*event.Message{}, r.duplicity[pre]...)
+	r.dupLock.RUnlock()
+
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i][1].Event.SequenceInt() < pairs[j][1].Event.SequenceInt()
+	})
+
+	for _, pair := range pairs {
+		err := handler(pair[0], pair[1])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (r *DB) EscrowPendingEvent(e *event.Message) error {
 	r.pendLock.Lock()
 	defer r.pendLock.Unlock()
 
 	pre := e.Event.Prefix
-	l, ok := r.pending[pre]
-	if !ok {
-		l := [][]*event.Message{{e}}
-		r.pending[pre] = l
-	} else {
-		sn := e.Event.SequenceInt()
-		if sn < len(l) {
-			l[sn] = append(l[sn], e)
-		} else {
-			r.pending[pre] = append(l, []*event.Message{e})
+	sn := e.Event.SequenceInt()
+	dig, err := e.Digest()
+	if err != nil {
+		return err
+	}
+
+	l := r.pending[pre]
+	for len(l) <= sn {
+		l = append(l, []*event.Message{})
+	}
+
+	// collect additional signatures for an event already in escrow
+	for _, esc := range l[sn] {
+		escDig, _ := esc.Digest()
+		if escDig == dig {
+			esc.Signatures = mergeSignatures(esc.Signatures, e.Signatures)
+			return nil
 		}
 	}
 
+	l[sn] = append(l[sn], e)
+	r.pending[pre] = l
+
 	return nil
 }
 
@@ -329,13 +730,13 @@ func (r *DB) RemovePendingEscrow(prefix string, sn int, dig string) error {
 			digs := l[sn]
 			n := 0
 			for _, x := range digs {
-				xdig, _ := x.Event.GetDigest()
+				xdig, _ := x.Digest()
 				if xdig != dig {
 					digs[n] = x
 					n++
 				}
 			}
-			digs = digs[:n]
+			l[sn] = digs[:n]
 		}
 	}
 
@@ -344,19 +745,23 @@ func (r *DB) RemovePendingEscrow(prefix string, sn int, dig string) error {
 
 func (r *DB) StreamPending(pre string, handler func(*event.Message) error) error {
 	r.pendLock.RLock()
-	defer r.pendLock.RUnlock()
-
 	log, ok := r.pending[pre]
 	if !ok {
+		r.pendLock.RUnlock()
 		return errors.New("not found")
 	}
 
-	for _, evts := range log {
-		for _, evt := range evts {
-			err := handler(evt)
-			if err != nil {
-				return err
-			}
+	// copy the escrow so the handler is free to modify it
+	evts := []*event.Message{}
+	for _, sn := range log {
+		evts = append(evts, sn...)
+	}
+	r.pendLock.RUnlock()
+
+	for _, evt := range evts {
+		err := handler(evt)
+		if err != nil {
+			return err
 		}
 	}
 
@@ -364,6 +769,44 @@ func (r *DB) StreamPending(pre string, handler func(*event.Message) error) error
 
 }
 
+// mergeSignatures adds the signatures for keys that have not already signed
+func mergeSignatures(current, new []derivation.Derivation) []derivation.Derivation {
+	for _, sig := range new {
+		found := false
+		for _, currentSig := range current {
+			if currentSig.KeyIndex == sig.KeyIndex {
+				found = true
+				break
+			}
+		}
+		if !found {
+			current = append(current, sig)
+		}
+	}
+
+	return current
+}
+
+// mergeReceipts returns a copy of the current receipts with the new ones
+// that are not among them added
+func mergeReceipts(current, new []*event.Receipt) []*event.Receipt {
+	out := append([]*event.Receipt{}, current...)
+	for _, rcpt := range new {
+		found := false
+		for _, cur := range current {
+			if bytes.Equal(cur.Text(), rcpt.Text()) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			out = append(out, rcpt)
+		}
+	}
+
+	return out
+}
+
 func (r *DB) LogTransferableReceipt(vrc *event.Receipt) error {
 	r.rcptLock.Lock()
 	defer r.rcptLock.Unlock()
@@ -381,19 +824,165 @@ func (r *DB) LogTransferableReceipt(vrc *event.Receipt) error {
 	return nil
 }
 
-func (r *DB) LogNonTransferableReceipt(vrc *event.Receipt) error {
+func (r *DB) LogNonTransferableReceipt(rct *event.Receipt) error {
 	r.rcptLock.Lock()
 	defer r.rcptLock.Unlock()
 
-	pre := vrc.Prefix
-	couplet := vrc.Text()
+	key := rct.Prefix + "/" + rct.Digest
+	couplet := string(rct.Text())
 
-	_, ok := r.rcpts[pre]
-	if !ok {
-		r.rcpts[pre] = []string{}
+	for _, c := range r.ntrs[key] {
+		if c == couplet {
+			return nil
+		}
 	}
 
-	r.rcpts[pre] = append(r.rcpts[pre], string(couplet))
+	r.ntrs[key] = append(r.ntrs[key], couplet)
+
+	return nil
+}
+
+func (r *DB) StreamNonTransferableReceipts(pre, dig string, handler func(couplet []byte) error) error {
+	r.rcptLock.RLock()
+	ntrs := make([]string, len(r.ntrs[pre+"/"+dig]))
+	copy(ntrs, r.ntrs[pre+"/"+dig])
+	r.rcptLock.RUnlock()
+
+	for _, couplet := range ntrs {
+		err := handler([]byte(couplet))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *DB) EscrowNonTransferableReceipt(rct *event.Receipt) error {
+	r.rcptLock.Lock()
+	defer r.rcptLock.Unlock()
+
+	for _, u := range r.ures[rct.Prefix] {
+		if sameReceipt(u, rct) {
+			return nil
+		}
+	}
+
+	r.ures[rct.Prefix] = append(r.ures[rct.Prefix], rct)
+
+	return nil
+}
+
+func (r *DB) RemoveNonTransferableReceiptEscrow(rct *event.Receipt) error {
+	r.rcptLock.Lock()
+	defer r.rcptLock.Unlock()
+
+	ures := r.ures[rct.Prefix]
+	for i, u := range ures {
+		if sameReceipt(u, rct) {
+			r.ures[rct.Prefix] = append(ures[:i:i], ures[i+1:]...)
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (r *DB) StreamNonTransferableReceiptEscrow(pre string, handler func(rct *event.Receipt) error) error {
+	r.rcptLock.RLock()
+	ures := make([]*event.Receipt, len(r.ures[pre]))
+	copy(ures, r.ures[pre])
+	r.rcptLock.RUnlock()
+
+	for _, rct := range ures {
+		err := handler(rct)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *DB) EscrowTransferableReceipt(vrc *event.Receipt) error {
+	r.rcptLock.Lock()
+	defer r.rcptLock.Unlock()
+
+	for _, v := range r.vres {
+		if v.Prefix == vrc.Prefix && sameReceipt(v, vrc) {
+			return nil
+		}
+	}
+
+	r.vres = append(r.vres, vrc)
+
+	return nil
+}
+
+func (r *DB) RemoveTransferableReceiptEscrow(vrc *event.Receipt) error {
+	r.rcptLock.Lock()
+	defer r.rcptLock.Unlock()
+
+	for i, v := range r.vres {
+		if v.Prefix == vrc.Prefix && sameReceipt(v, vrc) {
+			r.vres = append(r.vres[:i:i], r.vres[i+1:]...)
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (r *DB) StreamTransferableReceiptEscrow(handler func(vrc *event.Receipt) error) error {
+	r.rcptLock.RLock()
+	vres := make([]*event.Receipt, len(r.vres))
+	copy(vres, r.vres)
+	r.rcptLock.RUnlock()
+
+	for _, vrc := range vres {
+		err := handler(vrc)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func sameReceipt(a, b *event.Receipt) bool {
+	return a.Sequence == b.Sequence && a.Digest == b.Digest && bytes.Equal(a.Text(), b.Text())
+}
+
+func (r *DB) LogWitnessReceipt(rct *event.Receipt) error {
+	r.rcptLock.Lock()
+	defer r.rcptLock.Unlock()
+
+	key := rct.Prefix + "/" + rct.Digest
+	couplet := string(rct.Text())
+
+	for _, c := range r.wigs[key] {
+		if c == couplet {
+			return nil
+		}
+	}
+
+	r.wigs[key] = append(r.wigs[key], couplet)
+
+	return nil
+}
+
+func (r *DB) StreamWitnessReceipts(pre, dig string, handler func(couplet []byte) error) error {
+	r.rcptLock.RLock()
+	wigs := make([]string, len(r.wigs[pre+"/"+dig]))
+	copy(wigs, r.wigs[pre+"/"+dig])
+	r.rcptLock.RUnlock()
+
+	for _, couplet := range wigs {
+		err := handler([]byte(couplet))
+		if err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
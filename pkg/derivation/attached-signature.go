@@ -84,6 +84,10 @@ func FromAttachedSignature(sig string) (*Derivation, error) {
 		code = Ed25519Attached
 	case "B":
 		code = EcDSAAttached
+	case "E":
+		code = EcDSA256r1Attached
+	default:
+		return nil, fmt.Errorf("unknown attached signature code %s", sig[:1])
 	}
 
 	if len(sig) != code.PrefixBase64Length() {
@@ -125,8 +129,8 @@ func ParseAttachedSignatures(buf io.Reader) ([]Derivation, error) {
 	derivations := []Derivation{}
 
 	sigCountBytes := make([]byte, 4)
-	read, err := buf.Read(sigCountBytes)
-	if read != 4 || err != nil {
+	_, err := io.ReadFull(buf, sigCountBytes)
+	if err != nil {
 		return nil, errors.New("invalid signature count")
 	}
 
@@ -138,25 +142,7 @@ func ParseAttachedSignatures(buf io.Reader) ([]Derivation, error) {
 	// iterate over the signatures bytes for each signature
 	current := uint16(0)
 	for current < sigCount {
-		dCode := make([]byte, 1)
-		read, err := buf.Read(dCode)
-		if read != 1 || err != nil {
-			return nil, fmt.Errorf("unable to read signature (%s)", err)
-		}
-
-		// get expected b64 length
-		var sigString []byte
-		if c, ok := codeValue[string(dCode)+"X"]; ok {
-			sigString = make([]byte, c.PrefixBase64Length()-1)
-			read, err := buf.Read(sigString)
-			if read != c.PrefixBase64Length()-1 || err != nil {
-				return nil, errors.New("invalid signature string length")
-			}
-		} else {
-			return nil, fmt.Errorf("unable to determin signature derivation from code (%s)", string(dCode))
-		}
-
-		der, err := FromAttachedSignature(string(append(dCode, sigString...)))
+		der, err := ParseAttachedSignature(buf)
 		if err != nil {
 			return nil, err
 		}
@@ -169,15 +155,42 @@ func ParseAttachedSignatures(buf io.Reader) ([]Derivation, error) {
 	return derivations, nil
 }
 
+// ParseAttachedSignature reads a single indexed signature from the reader
+func ParseAttachedSignature(buf io.Reader) (*Derivation, error) {
+	dCode := make([]byte, 1)
+	_, err := io.ReadFull(buf, dCode)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read signature (%s)", err)
+	}
+
+	// get expected b64 length
+	var sigString []byte
+	if c, ok := codeValue[string(dCode)+"X"]; ok {
+		sigString = make([]byte, c.PrefixBase64Length()-1)
+		_, err := io.ReadFull(buf, sigString)
+		if err != nil {
+			return nil, errors.New("invalid signature string length")
+		}
+	} else {
+		return nil, fmt.Errorf("unable to determin signature derivation from code (%s)", string(dCode))
+	}
+
+	return FromAttachedSignature(string(append(dCode, sigString...)))
+}
+
 // VerifyWithAttachedSignature takes the key and signature derivations
 // and verifies the provided message bytes using the correct sig alg.
 func VerifyWithAttachedSignature(key, signature *Derivation, msg []byte) error {
 	switch signature.Code {
-	case Ed25519Attached:
+	case Ed25519Attached, Ed25519Sig:
 		if !ed25519.Verify(key.Raw, msg, signature.Raw) {
 			return errors.New("invalid message signature")
 		}
 		return nil
+	case EcDSAAttached, EcDSASig:
+		return verifySecp256k1(key.Raw, msg, signature.Raw)
+	case EcDSA256r1Attached, EcDSA256r1Sig:
+		return verifyP256(key.Raw, msg, signature.Raw)
 	}
 
 	return errors.New("unknown or unsupported signature derivation")
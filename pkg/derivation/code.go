@@ -1,6 +1,7 @@
 package derivation
 
 import (
+	"fmt"
 	"strings"
 )
 
@@ -27,133 +28,175 @@ const (
 	SHA2512
 	Ed25519Attached
 	EcDSAAttached
+	EcDSA256k1NT
+	EcDSA256k1
+	EcDSA256r1NT
+	EcDSA256r1
+	EcDSA256r1Sig
+	EcDSA256r1Attached
 )
 
 var (
 	codeValue = map[string]Code{
-		"A":  Ed25519Seed,
-		"B":  Ed25519NT,
-		"C":  X25519,
-		"D":  Ed25519,
-		"E":  Blake3256,
-		"F":  Blake2b256,
-		"G":  Blake2s256,
-		"H":  SHA3256,
-		"I":  SHA2256,
-		"0A": RandomSeed128,
-		"0B": Ed25519Sig,
-		"0C": EcDSASig,
-		"0D": Blake3512,
-		"0E": SHA3512,
-		"0F": Blake2b512,
-		"0G": SHA2512,
-		"AX": Ed25519Attached,
-		"BX": EcDSAAttached,
+		"A":    Ed25519Seed,
+		"B":    Ed25519NT,
+		"C":    X25519,
+		"D":    Ed25519,
+		"E":    Blake3256,
+		"F":    Blake2b256,
+		"G":    Blake2s256,
+		"H":    SHA3256,
+		"I":    SHA2256,
+		"0A":   RandomSeed128,
+		"0B":   Ed25519Sig,
+		"0C":   EcDSASig,
+		"0D":   Blake3512,
+		"0E":   SHA3512,
+		"0F":   Blake2b512,
+		"0G":   SHA2512,
+		"AX":   Ed25519Attached,
+		"BX":   EcDSAAttached,
+		"1AAA": EcDSA256k1NT,
+		"1AAB": EcDSA256k1,
+		"1AAI": EcDSA256r1NT,
+		"1AAJ": EcDSA256r1,
+		"0I":   EcDSA256r1Sig,
+		"EX":   EcDSA256r1Attached,
 	}
 
 	codeString = map[Code]string{
-		Ed25519Seed:     "A",
-		Ed25519NT:       "B",
-		X25519:          "C",
-		Ed25519:         "D",
-		Blake3256:       "E",
-		Blake2b256:      "F",
-		Blake2s256:      "G",
-		SHA3256:         "H",
-		SHA2256:         "I",
-		RandomSeed128:   "0A",
-		Ed25519Sig:      "0B",
-		EcDSASig:        "0C",
-		Blake3512:       "0D",
-		SHA3512:         "0E",
-		Blake2b512:      "0F",
-		SHA2512:         "0G",
-		Ed25519Attached: "AX",
-		EcDSAAttached:   "BX",
+		Ed25519Seed:        "A",
+		Ed25519NT:          "B",
+		X25519:             "C",
+		Ed25519:            "D",
+		Blake3256:          "E",
+		Blake2b256:         "F",
+		Blake2s256:         "G",
+		SHA3256:            "H",
+		SHA2256:            "I",
+		RandomSeed128:      "0A",
+		Ed25519Sig:         "0B",
+		EcDSASig:           "0C",
+		Blake3512:          "0D",
+		SHA3512:            "0E",
+		Blake2b512:         "0F",
+		SHA2512:            "0G",
+		Ed25519Attached:    "AX",
+		EcDSAAttached:      "BX",
+		EcDSA256k1NT:       "1AAA",
+		EcDSA256k1:         "1AAB",
+		EcDSA256r1NT:       "1AAI",
+		EcDSA256r1:         "1AAJ",
+		EcDSA256r1Sig:      "0I",
+		EcDSA256r1Attached: "EX",
 	}
 
 	codeName = map[Code]string{
-		Ed25519Seed:     "Ed25519Seed",
-		Ed25519NT:       "Ed25519NT",
-		X25519:          "X25519",
-		Ed25519:         "Ed25519",
-		Blake3256:       "Blake3256",
-		Blake2b256:      "Blake2b256",
-		Blake2s256:      "Blake2s256",
-		SHA3256:         "SHA3256",
-		SHA2256:         "SHA2256",
-		RandomSeed128:   "RandomSeed128",
-		Ed25519Sig:      "Ed25519Sig",
-		EcDSASig:        "EcDSASig",
-		Blake3512:       "Blake3512",
-		SHA3512:         "SHA3512",
-		Blake2b512:      "Blake2b512",
-		SHA2512:         "SHA2512",
-		Ed25519Attached: "Ed25519Attached",
-		EcDSAAttached:   "EcDSAAttached",
+		Ed25519Seed:        "Ed25519Seed",
+		Ed25519NT:          "Ed25519NT",
+		X25519:             "X25519",
+		Ed25519:            "Ed25519",
+		Blake3256:          "Blake3256",
+		Blake2b256:         "Blake2b256",
+		Blake2s256:         "Blake2s256",
+		SHA3256:            "SHA3256",
+		SHA2256:            "SHA2256",
+		RandomSeed128:      "RandomSeed128",
+		Ed25519Sig:         "Ed25519Sig",
+		EcDSASig:           "EcDSASig",
+		Blake3512:          "Blake3512",
+		SHA3512:            "SHA3512",
+		Blake2b512:         "Blake2b512",
+		SHA2512:            "SHA2512",
+		Ed25519Attached:    "Ed25519Attached",
+		EcDSAAttached:      "EcDSAAttached",
+		EcDSA256k1NT:       "EcDSA256k1NT",
+		EcDSA256k1:         "EcDSA256k1",
+		EcDSA256r1NT:       "EcDSA256r1NT",
+		EcDSA256r1:         "EcDSA256r1",
+		EcDSA256r1Sig:      "EcDSA256r1Sig",
+		EcDSA256r1Attached: "EcDSA256r1Attached",
 	}
 
 	codeDataLength = map[Code]int{
-		Ed25519Seed:     32,
-		Ed25519NT:       32,
-		X25519:          32,
-		Ed25519:         32,
-		Blake3256:       32,
-		Blake2b256:      32,
-		Blake2s256:      32,
-		SHA3256:         32,
-		SHA2256:         32,
-		RandomSeed128:   16,
-		Ed25519Sig:      64,
-		EcDSASig:        64,
-		Blake3512:       64,
-		SHA3512:         64,
-		Blake2b512:      64,
-		SHA2512:         64,
-		Ed25519Attached: 64,
-		EcDSAAttached:   64,
+		Ed25519Seed:        32,
+		Ed25519NT:          32,
+		X25519:             32,
+		Ed25519:            32,
+		Blake3256:          32,
+		Blake2b256:         32,
+		Blake2s256:         32,
+		SHA3256:            32,
+		SHA2256:            32,
+		RandomSeed128:      16,
+		Ed25519Sig:         64,
+		EcDSASig:           64,
+		Blake3512:          64,
+		SHA3512:            64,
+		Blake2b512:         64,
+		SHA2512:            64,
+		Ed25519Attached:    64,
+		EcDSAAttached:      64,
+		EcDSA256k1NT:       33,
+		EcDSA256k1:         33,
+		EcDSA256r1NT:       33,
+		EcDSA256r1:         33,
+		EcDSA256r1Sig:      64,
+		EcDSA256r1Attached: 64,
 	}
 
 	codePrefixBase64Length = map[Code]int{
-		Ed25519Seed:     44,
-		Ed25519NT:       44,
-		X25519:          44,
-		Ed25519:         44,
-		Blake3256:       44,
-		Blake2b256:      44,
-		Blake2s256:      44,
-		SHA3256:         44,
-		SHA2256:         44,
-		RandomSeed128:   24,
-		Ed25519Sig:      88,
-		EcDSASig:        88,
-		Blake3512:       88,
-		SHA3512:         88,
-		Blake2b512:      88,
-		SHA2512:         88,
-		Ed25519Attached: 88,
-		EcDSAAttached:   88,
+		Ed25519Seed:        44,
+		Ed25519NT:          44,
+		X25519:             44,
+		Ed25519:            44,
+		Blake3256:          44,
+		Blake2b256:         44,
+		Blake2s256:         44,
+		SHA3256:            44,
+		SHA2256:            44,
+		RandomSeed128:      24,
+		Ed25519Sig:         88,
+		EcDSASig:           88,
+		Blake3512:          88,
+		SHA3512:            88,
+		Blake2b512:         88,
+		SHA2512:            88,
+		Ed25519Attached:    88,
+		EcDSAAttached:      88,
+		EcDSA256k1NT:       48,
+		EcDSA256k1:         48,
+		EcDSA256r1NT:       48,
+		EcDSA256r1:         48,
+		EcDSA256r1Sig:      88,
+		EcDSA256r1Attached: 88,
 	}
 
 	codePrefixDataLength = map[Code]int{
-		Ed25519Seed:     33,
-		Ed25519NT:       33,
-		X25519:          33,
-		Ed25519:         33,
-		Blake3256:       33,
-		Blake2b256:      33,
-		Blake2s256:      33,
-		SHA3256:         33,
-		SHA2256:         33,
-		RandomSeed128:   18,
-		Ed25519Sig:      66,
-		EcDSASig:        66,
-		Blake3512:       66,
-		SHA3512:         66,
-		Blake2b512:      66,
-		SHA2512:         66,
-		Ed25519Attached: 66,
-		EcDSAAttached:   66,
+		Ed25519Seed:        33,
+		Ed25519NT:          33,
+		X25519:             33,
+		Ed25519:            33,
+		Blake3256:          33,
+		Blake2b256:         33,
+		Blake2s256:         33,
+		SHA3256:            33,
+		SHA2256:            33,
+		RandomSeed128:      18,
+		Ed25519Sig:         66,
+		EcDSASig:           66,
+		Blake3512:          66,
+		SHA3512:            66,
+		Blake2b512:         66,
+		SHA2512:            66,
+		Ed25519Attached:    66,
+		EcDSAAttached:      66,
+		EcDSA256k1NT:       36,
+		EcDSA256k1:         36,
+		EcDSA256r1NT:       36,
+		EcDSA256r1:         36,
+		EcDSA256r1Sig:      66,
+		EcDSA256r1Attached: 66,
 	}
 )
 
@@ -209,7 +252,7 @@ func (c Code) SelfAddressing() bool {
 // SelfSigning derivaitons
 func (c Code) SelfSigning() bool {
 	switch c {
-	case Ed25519Sig:
+	case Ed25519Sig, EcDSASig, EcDSA256r1Sig:
 		return true
 	}
 	return false
@@ -218,7 +261,7 @@ func (c Code) SelfSigning() bool {
 // Basic derivations
 func (c Code) Basic() bool {
 	switch c {
-	case Ed25519NT, Ed25519:
+	case Ed25519NT, Ed25519, EcDSA256k1NT, EcDSA256k1, EcDSA256r1NT, EcDSA256r1:
 		return true
 	}
 	return false
@@ -227,8 +270,50 @@ func (c Code) Basic() bool {
 // AttachedSignature derivation
 func (c Code) AttachedSignature() bool {
 	switch c {
-	case Ed25519Attached, EcDSAAttached:
+	case Ed25519Attached, EcDSAAttached, EcDSA256r1Attached:
 		return true
 	}
 	return false
 }
+
+// AttachedSignatureCode returns the attached signature derivation
+// used for signatures created by a key of this basic derivation
+func (c Code) AttachedSignatureCode() (Code, error) {
+	switch c {
+	case Ed25519NT, Ed25519:
+		return Ed25519Attached, nil
+	case EcDSA256k1NT, EcDSA256k1:
+		return EcDSAAttached, nil
+	case EcDSA256r1NT, EcDSA256r1:
+		return EcDSA256r1Attached, nil
+	}
+	return -1, fmt.Errorf("no attached signature derivation for %s", c.Name())
+}
+
+// SignatureCode returns the non-indexed signature derivation used
+// for signatures created by a key of this basic derivation
+func (c Code) SignatureCode() (Code, error) {
+	switch c {
+	case Ed25519NT, Ed25519:
+		return Ed25519Sig, nil
+	case EcDSA256k1NT, EcDSA256k1:
+		return EcDSASig, nil
+	case EcDSA256r1NT, EcDSA256r1:
+		return EcDSA256r1Sig, nil
+	}
+	return -1, fmt.Errorf("no signature derivation for %s", c.Name())
+}
+
+// NonTransferableCode returns the non-transferable basic derivation
+// for keys of this basic derivation
+func (c Code) NonTransferableCode() (Code, error) {
+	switch c {
+	case Ed25519NT, Ed25519:
+		return Ed25519NT, nil
+	case EcDSA256k1NT, EcDSA256k1:
+		return EcDSA256k1NT, nil
+	case EcDSA256r1NT, EcDSA256r1:
+		return EcDSA256r1NT, nil
+	}
+	return -1, fmt.Errorf("no non-transferable derivation for %s", c.Name())
+}
@@ -1,6 +1,7 @@
 package derivation
 
 import (
+	"errors"
 	"fmt"
 )
 
@@ -98,6 +99,35 @@ func (r *Counter) String() (string, error) {
 	return fmt.Sprintf("%s%.*s%s", cs, pad, "A", b64), nil
 }
 
+// Code returns the count code of the counter
+func (r *Counter) Code() CountCode {
+	return r.code
+}
+
+// Count returns the number of items in the group
+func (r *Counter) Count() int {
+	return int(r.count)
+}
+
+// ParseCounter parses a well formatted 4 character count code
+func ParseCounter(count string) (*Counter, error) {
+	if len(count) != 4 {
+		return nil, errors.New("count code must be 4 characters long")
+	}
+
+	code, ok := CountCodes[count[:SigCountLen]]
+	if !ok {
+		return nil, fmt.Errorf("unknown count code %s", count[:SigCountLen])
+	}
+
+	c, err := Base64ToIndex(count[SigCountLen:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid count (%s)", err)
+	}
+
+	return NewSigCounter(code, WithCount(int(c)))
+}
+
 func WithCount(count int) CountOpt {
 	return func(s *Counter) error {
 		s.count = uint16(count)
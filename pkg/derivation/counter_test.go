@@ -83,3 +83,30 @@ func TestSigCounter_String(t *testing.T) {
 		})
 	}
 }
+
+func TestParseCounter(t *testing.T) {
+	c, err := ParseCounter("-AEA")
+	if err != nil {
+		t.Fatalf("ParseCounter() error = %v", err)
+	}
+
+	if c.Code() != ControllerSigCountCode || c.Count() != 256 {
+		t.Errorf("ParseCounter() = %v %d, want %v %d", c.Code(), c.Count(), ControllerSigCountCode, 256)
+	}
+
+	c, err = ParseCounter("-EAC")
+	if err != nil {
+		t.Fatalf("ParseCounter() error = %v", err)
+	}
+
+	if c.Code() != FirstSeenReplayCountCode || c.Count() != 2 {
+		t.Errorf("ParseCounter() = %v %d, want %v %d", c.Code(), c.Count(), FirstSeenReplayCountCode, 2)
+	}
+
+	for _, bad := range []string{"-AA", "-QAB", "-A!!"} {
+		_, err = ParseCounter(bad)
+		if err == nil {
+			t.Errorf("ParseCounter(%s) expected error", bad)
+		}
+	}
+}
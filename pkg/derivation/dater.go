@@ -0,0 +1,65 @@
+package derivation
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	daterCode   = "1AAG"
+	daterLength = 36
+
+	// DaterFormat is the ISO 8601 format, with microseconds, used for
+	// date times in KERI
+	DaterFormat = "2006-01-02T15:04:05.000000-07:00"
+)
+
+var (
+	// date time characters that are not valid base64 are replaced
+	// so a date time can be used as a qualified primitive
+	daterToBase64   = strings.NewReplacer(":", "c", ".", "d", "+", "p")
+	daterFromBase64 = strings.NewReplacer("c", ":", "d", ".", "p", "+")
+)
+
+// Dater is a fully qualified ISO 8601 date time, used for things like the
+// first seen date time of an event during replay
+type Dater struct {
+	dts time.Time
+}
+
+func NewDater(t time.Time) *Dater {
+	return &Dater{dts: t}
+}
+
+func (r *Dater) Base64() []byte {
+	dts := r.dts.Format(DaterFormat)
+	return []byte(daterCode + daterToBase64.Replace(dts))
+}
+
+func (r *Dater) Time() time.Time {
+	return r.dts
+}
+
+func ParseDater(r io.Reader) (*Dater, error) {
+	buf := make([]byte, daterLength)
+
+	_, err := io.ReadFull(r, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	if string(buf[:len(daterCode)]) != daterCode {
+		return nil, errors.New(fmt.Sprint("invalid dater", " ", string(buf)))
+	}
+
+	dts := daterFromBase64.Replace(string(buf[len(daterCode):]))
+	t, err := time.Parse(DaterFormat, dts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dater date time (%s)", err)
+	}
+
+	return NewDater(t), nil
+}
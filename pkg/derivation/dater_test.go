@@ -0,0 +1,23 @@
+package derivation
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDater(t *testing.T) {
+	dts := time.Date(2020, 8, 22, 17, 50, 9, 988921000, time.UTC)
+
+	d := NewDater(dts)
+	assert.Equal(t, "1AAG2020-08-22T17c50c09d988921p00c00", string(d.Base64()))
+
+	parsed, err := ParseDater(bytes.NewReader(d.Base64()))
+	assert.NoError(t, err)
+	assert.True(t, dts.Equal(parsed.Time()))
+
+	_, err = ParseDater(bytes.NewReader([]byte("0AAG2020-08-22T17c50c09d988921p00c00")))
+	assert.Error(t, err)
+}
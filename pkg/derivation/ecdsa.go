@@ -0,0 +1,134 @@
+package derivation
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	secp256k1ecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// ECDSA signatures are the 32 byte R value followed by the 32 byte S
+// value, calculated over the SHA-256 digest of the signed data
+const ecdsaScalarLength = 32
+
+// SignSecp256k1 signs the provided data with the raw secp256k1 private key
+func SignSecp256k1(priv, data []byte) ([]byte, error) {
+	if len(priv) != ecdsaScalarLength {
+		return nil, errors.New("invalid secp256k1 private key length")
+	}
+
+	key := secp256k1.PrivKeyFromBytes(priv)
+	hash := sha256.Sum256(data)
+
+	// the compact signature is prefixed with a recovery code we don't use
+	sig := secp256k1ecdsa.SignCompact(key, hash[:], true)
+
+	return sig[1:], nil
+}
+
+// Secp256k1PublicKey returns the compressed public key for the raw private key
+func Secp256k1PublicKey(priv []byte) ([]byte, error) {
+	if len(priv) != ecdsaScalarLength {
+		return nil, errors.New("invalid secp256k1 private key length")
+	}
+
+	return secp256k1.PrivKeyFromBytes(priv).PubKey().SerializeCompressed(), nil
+}
+
+func verifySecp256k1(pub, data, sig []byte) error {
+	key, err := secp256k1.ParsePubKey(pub)
+	if err != nil {
+		return errors.New("invalid secp256k1 public key")
+	}
+
+	if len(sig) != 2*ecdsaScalarLength {
+		return errors.New("invalid secp256k1 signature length")
+	}
+
+	var r, s secp256k1.ModNScalar
+	if r.SetByteSlice(sig[:ecdsaScalarLength]) || s.SetByteSlice(sig[ecdsaScalarLength:]) {
+		return errors.New("invalid secp256k1 signature")
+	}
+
+	hash := sha256.Sum256(data)
+	if !secp256k1ecdsa.NewSignature(&r, &s).Verify(hash[:], key) {
+		return errors.New("invalid message signature")
+	}
+
+	return nil
+}
+
+// SignP256 signs the provided data with the raw P-256 private key
+func SignP256(priv, data []byte) ([]byte, error) {
+	key, err := p256PrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(data)
+	r, s, err := ecdsa.Sign(rand.Reader, key, hash[:])
+	if err != nil {
+		return nil, err
+	}
+
+	sig := make([]byte, 2*ecdsaScalarLength)
+	r.FillBytes(sig[:ecdsaScalarLength])
+	s.FillBytes(sig[ecdsaScalarLength:])
+
+	return sig, nil
+}
+
+// P256PublicKey returns the compressed public key for the raw private key
+func P256PublicKey(priv []byte) ([]byte, error) {
+	key, err := p256PrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+
+	return elliptic.MarshalCompressed(key.Curve, key.X, key.Y), nil
+}
+
+func p256PrivateKey(priv []byte) (*ecdsa.PrivateKey, error) {
+	if len(priv) != ecdsaScalarLength {
+		return nil, errors.New("invalid P-256 private key length")
+	}
+
+	curve := elliptic.P256()
+	d := new(big.Int).SetBytes(priv)
+	if d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0 {
+		return nil, errors.New("invalid P-256 private key")
+	}
+
+	key := &ecdsa.PrivateKey{D: d}
+	key.Curve = curve
+	key.X, key.Y = curve.ScalarBaseMult(priv)
+
+	return key, nil
+}
+
+func verifyP256(pub, data, sig []byte) error {
+	curve := elliptic.P256()
+	x, y := elliptic.UnmarshalCompressed(curve, pub)
+	if x == nil {
+		return errors.New("invalid P-256 public key")
+	}
+
+	if len(sig) != 2*ecdsaScalarLength {
+		return errors.New("invalid P-256 signature length")
+	}
+
+	r := new(big.Int).SetBytes(sig[:ecdsaScalarLength])
+	s := new(big.Int).SetBytes(sig[ecdsaScalarLength:])
+
+	hash := sha256.Sum256(data)
+	if !ecdsa.Verify(&ecdsa.PublicKey{Curve: curve, X: x, Y: y}, hash[:], r, s) {
+		return errors.New("invalid message signature")
+	}
+
+	return nil
+}
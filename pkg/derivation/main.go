@@ -116,6 +116,15 @@ func FromPrefix(data string) (*Derivation, error) {
 	var d *Derivation
 
 	switch data[:1] {
+	case "1":
+		if dc, ok := codeValue[data[:4]]; ok {
+			d, _ = New(WithCode(dc))
+			if len(data) != d.Code.PrefixBase64Length() {
+				return nil, fmt.Errorf("invalid prefix length (%d) for derevation %s", len(data), d.Code.Name())
+			}
+		} else {
+			return nil, fmt.Errorf("unable to determin derevation from code %s", data[:4])
+		}
 	case "0":
 		if dc, ok := codeValue[data[:2]]; ok {
 			d, _ = New(WithCode(dc))
@@ -155,8 +164,8 @@ func FromPrefix(data string) (*Derivation, error) {
 // and raw (base64 unencoded) data represented by the prefix.
 func ParsePrefix(buf io.Reader) (*Derivation, error) {
 	dCode := make([]byte, 1)
-	read, err := buf.Read(dCode)
-	if read != 1 || err != nil {
+	_, err := io.ReadFull(buf, dCode)
+	if err != nil {
 		return nil, fmt.Errorf("unable to read receipt (%s)", err)
 	}
 
@@ -164,9 +173,22 @@ func ParsePrefix(buf io.Reader) (*Derivation, error) {
 
 	var code string
 	switch dCode[0] {
+	case '1':
+		rest := make([]byte, 3)
+		_, err = io.ReadFull(buf, rest)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read receipt (%s)", err)
+		}
+
+		code = string(append(dCode, rest...))
+		if dc, ok := codeValue[code]; ok {
+			d, _ = New(WithCode(dc))
+		} else {
+			return nil, fmt.Errorf("unable to determin derevation from code %s", code)
+		}
 	case '0':
-		read, err = buf.Read(dCode)
-		if read != 1 || err != nil {
+		_, err = io.ReadFull(buf, dCode)
+		if err != nil {
 			return nil, fmt.Errorf("unable to read receipt (%s)", err)
 		}
 
@@ -193,8 +215,8 @@ func ParsePrefix(buf io.Reader) (*Derivation, error) {
 	dlen := d.Code.PrefixBase64Length() - len(code)
 
 	rest := make([]byte, dlen)
-	read, err = buf.Read(rest)
-	if read != dlen || err != nil {
+	_, err = io.ReadFull(buf, rest)
+	if err != nil {
 		return nil, fmt.Errorf("unable to read receipt (%s)", err)
 	}
 
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto/rand"
 	"encoding/base64"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -340,3 +341,104 @@ func TestParseAttachedSignatures(t *testing.T) {
 	ders, err = ParseAttachedSignatures(bytes.NewBuffer(sigString))
 	assert.NotNil(err)
 }
+
+func TestSecp256k1(t *testing.T) {
+	assert := assert.New(t)
+
+	seed, err := FromPrefix("ADW3o9m3udwEf0aoOdZLLJdf1aylokP0lwwI_M2J9h0s")
+	assert.NoError(err)
+
+	pub, err := Secp256k1PublicKey(seed.Raw)
+	assert.NoError(err)
+	assert.Len(pub, 33)
+
+	key, err := New(WithCode(EcDSA256k1), WithRaw(pub))
+	assert.NoError(err)
+	assert.True(key.Code.Basic())
+
+	pre := key.AsPrefix()
+	assert.Equal("1AAB", pre[:4])
+	assert.Len(pre, EcDSA256k1.PrefixBase64Length())
+
+	parsed, err := FromPrefix(pre)
+	assert.NoError(err)
+	assert.Equal(EcDSA256k1, parsed.Code)
+	assert.Equal(pub, parsed.Raw)
+
+	parsed, err = ParsePrefix(strings.NewReader(pre))
+	assert.NoError(err)
+	assert.Equal(EcDSA256k1, parsed.Code)
+	assert.Equal(pub, parsed.Raw)
+
+	sc, err := key.Code.AttachedSignatureCode()
+	assert.NoError(err)
+	assert.Equal(EcDSAAttached, sc)
+
+	msg := []byte("this is test data")
+	sig, err := New(WithCode(sc), WithSigner(func(data []byte) ([]byte, error) {
+		return SignSecp256k1(seed.Raw, data)
+	}))
+	assert.NoError(err)
+	_, err = sig.Derive(msg)
+	assert.NoError(err)
+
+	attached, err := FromAttachedSignature(sig.AsPrefix())
+	assert.NoError(err)
+	assert.Equal(EcDSAAttached, attached.Code)
+
+	assert.NoError(VerifyWithAttachedSignature(parsed, attached, msg))
+	assert.Error(VerifyWithAttachedSignature(parsed, attached, []byte("other data")))
+}
+
+func TestP256(t *testing.T) {
+	assert := assert.New(t)
+
+	seed, err := FromPrefix("ADW3o9m3udwEf0aoOdZLLJdf1aylokP0lwwI_M2J9h0s")
+	assert.NoError(err)
+
+	pub, err := P256PublicKey(seed.Raw)
+	assert.NoError(err)
+
+	for _, code := range []Code{EcDSA256r1, EcDSA256r1NT} {
+		key, err := New(WithCode(code), WithRaw(pub))
+		assert.NoError(err)
+		assert.True(key.Code.Basic())
+
+		parsed, err := FromPrefix(key.AsPrefix())
+		assert.NoError(err)
+		assert.Equal(code, parsed.Code)
+		assert.Equal(pub, parsed.Raw)
+	}
+
+	key, err := FromPrefix("1AAJ" + base64.RawURLEncoding.EncodeToString(pub))
+	assert.NoError(err)
+
+	msg := []byte("this is test data")
+	signer := func(data []byte) ([]byte, error) {
+		return SignP256(seed.Raw, data)
+	}
+
+	sig, err := New(WithCode(EcDSA256r1Attached), WithSigner(signer))
+	assert.NoError(err)
+	sig.KeyIndex = 2
+	_, err = sig.Derive(msg)
+	assert.NoError(err)
+
+	attached, err := FromAttachedSignature(sig.AsPrefix())
+	assert.NoError(err)
+	assert.Equal(EcDSA256r1Attached, attached.Code)
+	assert.Equal(uint16(2), attached.KeyIndex)
+	assert.NoError(VerifyWithAttachedSignature(key, attached, msg))
+
+	// non-indexed signatures
+	nsig, err := New(WithCode(EcDSA256r1Sig), WithSigner(signer))
+	assert.NoError(err)
+	_, err = nsig.Derive(msg)
+	assert.NoError(err)
+
+	parsed, err := FromPrefix(nsig.AsPrefix())
+	assert.NoError(err)
+	assert.Equal(EcDSA256r1Sig, parsed.Code)
+	assert.NoError(VerifyWithAttachedSignature(key, parsed, msg))
+	assert.Error(VerifyWithAttachedSignature(key, parsed, []byte("other data")))
+}
@@ -42,7 +42,7 @@ func ParseOrdinal(r io.Reader) (*Ordinal, error) {
 	b64len := RandomSeed128.PrefixBase64Length()
 	buf := make([]byte, b64len)
 
-	c, err := r.Read(buf)
+	c, err := io.ReadFull(r, buf)
 	if err != nil {
 		return nil, err
 	}
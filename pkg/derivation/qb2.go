@@ -0,0 +1,100 @@
+package derivation
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+)
+
+// QB2 and QB64 are the binary and text domains of the same data. Every
+// primitive and count code in the text domain is a multiple of 4 characters,
+// which means the binary domain is simply the base64 decoded text, with
+// every 4 characters of text represented by 3 bytes.
+const (
+	qb64Quadlet = 4
+	qb2Triplet  = 3
+)
+
+// ToQB2 converts the provided qb64 text into its qb2 binary representation
+func ToQB2(qb64 []byte) ([]byte, error) {
+	if len(qb64)%qb64Quadlet != 0 {
+		return nil, errors.New("qb64 length must be a multiple of 4 to convert to qb2")
+	}
+
+	out := make([]byte, base64.RawURLEncoding.DecodedLen(len(qb64)))
+	_, err := base64.RawURLEncoding.Decode(out, qb64)
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// ToQB64 converts the provided qb2 binary data into its qb64 text representation
+func ToQB64(qb2 []byte) ([]byte, error) {
+	if len(qb2)%qb2Triplet != 0 {
+		return nil, errors.New("qb2 length must be a multiple of 3 to convert to qb64")
+	}
+
+	out := make([]byte, base64.RawURLEncoding.EncodedLen(len(qb2)))
+	base64.RawURLEncoding.Encode(out, qb2)
+
+	return out, nil
+}
+
+// QB2Reader translates a binary (qb2) stream into text (qb64) as it is read.
+// It reads exactly 3 bytes from the underlying reader for every 4 characters
+// of text requested so the text parsers can be used for the binary domain
+// without reading past the end of an attachment group.
+type QB2Reader struct {
+	r   io.Reader
+	txt []byte
+}
+
+func NewQB2Reader(r io.Reader) *QB2Reader {
+	return &QB2Reader{r: r}
+}
+
+// fill translates enough of the underlying stream to have at least n
+// characters of text available
+func (q *QB2Reader) fill(n int) error {
+	for len(q.txt) < n {
+		b := make([]byte, qb2Triplet)
+		_, err := io.ReadFull(q.r, b)
+		if err != nil {
+			return err
+		}
+
+		txt, _ := ToQB64(b)
+		q.txt = append(q.txt, txt...)
+	}
+
+	return nil
+}
+
+// Read reads up to len(p) characters of text
+func (q *QB2Reader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	err := q.fill(len(p))
+	if err != nil && len(q.txt) == 0 {
+		return 0, err
+	}
+
+	n := copy(p, q.txt)
+	q.txt = q.txt[n:]
+
+	return n, nil
+}
+
+// Peek returns the next n characters of text without advancing the reader
+func (q *QB2Reader) Peek(n int) ([]byte, error) {
+	err := q.fill(n)
+	if err != nil {
+		return nil, err
+	}
+
+	return q.txt[:n], nil
+}
@@ -0,0 +1,55 @@
+package derivation
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQB2RoundTrip(t *testing.T) {
+	txt := []byte("-AABAA8UlKZCFEDmeWhk1MhyqwjXVobNEnjdApJ02k2ES3eDTT4jZBo8gZ0rdPRACS11xcCiXBYWLasL0bezI1JyzxBg")
+
+	bin, err := ToQB2(txt)
+	assert.NoError(t, err)
+	assert.Len(t, bin, len(txt)/4*3)
+
+	// count codes always start with the binary tritet 0b111
+	assert.Equal(t, byte(0b11100000), bin[0]&0b11100000)
+
+	out, err := ToQB64(bin)
+	assert.NoError(t, err)
+	assert.Equal(t, txt, out)
+
+	_, err = ToQB2([]byte("-AA"))
+	assert.Error(t, err)
+
+	_, err = ToQB64([]byte{0xf8})
+	assert.Error(t, err)
+}
+
+func TestQB2Reader(t *testing.T) {
+	txt := []byte("-AABAA8UlKZCFEDmeWhk1MhyqwjXVobNEnjdApJ02k2ES3eDTT4jZBo8gZ0rdPRACS11xcCiXBYWLasL0bezI1JyzxBg")
+	bin, err := ToQB2(txt)
+	assert.NoError(t, err)
+
+	trailing := []byte("{\"v\"")
+	src := bytes.NewReader(append(bin, trailing...))
+	r := NewQB2Reader(src)
+
+	p, err := r.Peek(2)
+	assert.NoError(t, err)
+	assert.Equal(t, "-A", string(p))
+
+	sigs, err := ParseAttachedSignatures(r)
+	assert.NoError(t, err)
+	if assert.Len(t, sigs, 1) {
+		assert.Equal(t, string(txt[4:]), sigs[0].AsPrefix())
+	}
+
+	// the reader must not consume anything past the attachment group
+	rest, err := ioutil.ReadAll(src)
+	assert.NoError(t, err)
+	assert.Equal(t, trailing, rest)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"log"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
@@ -22,6 +23,31 @@ type Client struct {
 	addr string
 	ioc  *conn
 	id   *keri.Keri
+
+	queryLock  sync.Mutex
+	queries    map[string]chan *queryReply
+	replied    []*event.Message
+	replyErr   error
+	introduced bool
+}
+
+// QueryResult holds the messages a peer sent in reply to a query
+type QueryResult struct {
+	// Reply is the rpy message that ended the reply
+	Reply *event.Message
+
+	// Logs holds the key events of the queried identifier for a logs query
+	Logs []*event.Message
+
+	// KeyState holds the key state notice for a ksn query, if the peer has one
+	KeyState *event.Message
+}
+
+// queryReply is the result of a query, or the error
+// processing the messages sent in reply to it
+type queryReply struct {
+	res *QueryResult
+	err error
 }
 
 type Notify func(rcpt *event.Event, err error)
@@ -33,8 +59,9 @@ func Dial(id *keri.Keri, addr string) (*Client, error) {
 func DialTimeout(id *keri.Keri, addr string, timeout time.Duration) (*Client, error) {
 
 	o := &Client{
-		addr: addr,
-		id:   id,
+		addr:    addr,
+		id:      id,
+		queries: map[string]chan *queryReply{},
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
@@ -49,7 +76,7 @@ func DialTimeout(id *keri.Keri, addr string, timeout time.Duration) (*Client, er
 
 		o.ioc = &conn{
 			reader: stream.NewReader(c),
-			writer: stream.NewWriter(c),
+			writer: stream.NewWriter(c, stream.WithAttachmentGroups()),
 			conn:   c,
 		}
 		return nil
@@ -61,15 +88,27 @@ func DialTimeout(id *keri.Keri, addr string, timeout time.Duration) (*Client, er
 
 	log.Print(id.Prefix(), ":\n", "connected to", addr, "\n\n")
 
-	go func() {
-		err := handleConnection(o.ioc, o.id)
-		log.Printf("client connection closed with (%v)\n", err)
-	}()
+	go o.handle()
 
 	return o, nil
 
 }
 
+// handle processes the messages received on the connection until it
+// closes, ending any pending queries with the reason it closed
+func (r *Client) handle() {
+	err := handleConnection(r.ioc, r)
+	log.Printf("client connection closed with (%v)\n", err)
+
+	r.queryLock.Lock()
+	defer r.queryLock.Unlock()
+
+	for dig, ch := range r.queries {
+		ch <- &queryReply{err: errors.Wrap(err, "no reply to query")}
+		delete(r.queries, dig)
+	}
+}
+
 func (r *Client) Write(msg *event.Message) error {
 	err := r.ioc.Write(msg)
 	if err != nil {
@@ -99,6 +138,163 @@ func (r *Client) WriteNotify(msg *event.Message, n Notify) error {
 	return nil
 }
 
+// Query sends a signed query for the route to the peer and waits for its
+// reply, or until the context is done. The peer can only verify queries from
+// identifiers it knows, so our KEL is sent ahead of the first query. The
+// messages in the reply have been processed by our identity by the time
+// they are returned, and the query fails if any of them could not be.
+func (r *Client) Query(ctx context.Context, route string, q *event.Query) (*QueryResult, error) {
+	err := r.introduce()
+	if err != nil {
+		return nil, err
+	}
+
+	qry, err := r.id.Query(route, q)
+	if err != nil {
+		return nil, err
+	}
+
+	dig, err := qry.Event.GetDigest()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to digest query")
+	}
+
+	ch := make(chan *queryReply, 1)
+
+	r.queryLock.Lock()
+	r.queries[dig] = ch
+	r.queryLock.Unlock()
+
+	defer func() {
+		r.queryLock.Lock()
+		delete(r.queries, dig)
+		r.queryLock.Unlock()
+	}()
+
+	err = r.Write(qry)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case reply := <-ch:
+		if reply.err != nil {
+			return nil, reply.err
+		}
+
+		return reply.res, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// introduce sends our KEL to the peer, once per connection
+func (r *Client) introduce() error {
+	r.queryLock.Lock()
+	defer r.queryLock.Unlock()
+
+	if r.introduced {
+		return nil
+	}
+
+	kel, err := r.id.KERL(r.id.Prefix())
+	if err != nil {
+		return errors.Wrap(err, "unable to load our KEL")
+	}
+
+	for _, msg := range kel {
+		err = r.Write(msg)
+		if err != nil {
+			return err
+		}
+	}
+
+	r.introduced = true
+	return nil
+}
+
+// ProcessEvents passes the messages received on the connection to our
+// identity, collecting those sent in reply to our pending queries. While a
+// query is pending, messages that fail to process do not close the connection,
+// their error is passed on to the query once its reply arrives instead.
+func (r *Client) ProcessEvents(msgs ...*event.Message) ([]*event.Message, error) {
+	out, err := r.id.ProcessEvents(msgs...)
+
+	r.queryLock.Lock()
+	defer r.queryLock.Unlock()
+
+	if len(r.queries) == 0 {
+		r.replied = nil
+		r.replyErr = nil
+		return out, err
+	}
+
+	if err != nil && r.replyErr == nil {
+		r.replyErr = errors.Wrap(err, "unable to process query reply")
+	}
+
+	for _, msg := range msgs {
+		if len(r.queries) == 0 {
+			r.replied = nil
+			r.replyErr = nil
+			break
+		}
+
+		if msg.Event.ILK() != event.RPY || msg.Event.Route == event.EndRoleRoute {
+			r.replied = append(r.replied, msg)
+			continue
+		}
+
+		// the peer writes the messages for a query just before its reply
+		if ch, ok := r.queries[msg.Event.EventDigest]; ok {
+			ch <- &queryReply{res: queryResult(msg, r.replied), err: r.replyErr}
+			delete(r.queries, msg.Event.EventDigest)
+		}
+
+		r.replied = nil
+		r.replyErr = nil
+	}
+
+	return out, nil
+}
+
+// queryResult picks the messages that answer the query out of those
+// received before the reply. Events the peer sent more than once, such as
+// its inception when we introduced ourselves, are only returned once.
+func queryResult(rpy *event.Message, msgs []*event.Message) *QueryResult {
+	res := &QueryResult{Reply: rpy}
+	if rpy.Event.Query == nil {
+		return res
+	}
+
+	pre := rpy.Event.Query.Prefix
+	seen := map[string]bool{}
+	for _, msg := range msgs {
+		if msg.Event.Prefix != pre {
+			continue
+		}
+
+		switch msg.Event.ILK() {
+		case event.ICP, event.ROT, event.IXN, event.DIP, event.DRT:
+			dig, err := msg.Digest()
+			if err != nil || seen[dig] {
+				continue
+			}
+			seen[dig] = true
+
+			if rpy.Event.Route == event.LogsRoute {
+				res.Logs = append(res.Logs, msg)
+			}
+		case event.KSN:
+			if rpy.Event.Route == event.KeyStateRoute {
+				res.KeyState = msg
+			}
+		}
+	}
+
+	return res
+}
+
 func (r *Client) Close() error {
 	return r.ioc.conn.Close()
 }
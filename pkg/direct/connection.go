@@ -9,7 +9,6 @@ import (
 
 	"github.com/decentralized-identity/kerigo/pkg/encoding"
 	"github.com/decentralized-identity/kerigo/pkg/event"
-	"github.com/decentralized-identity/kerigo/pkg/keri"
 )
 
 type conn struct {
@@ -30,7 +29,7 @@ func (r *conn) Write(msg *event.Message) error {
 	return nil
 }
 
-func handleConnection(ioc *conn, id *keri.Keri) error {
+func handleConnection(ioc *conn, id Handler) error {
 
 	for {
 		msg, err := ioc.reader.Read()
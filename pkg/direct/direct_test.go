@@ -1,6 +1,7 @@
 package direct
 
 import (
+	"context"
 	"net"
 	"sync/atomic"
 	"testing"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/decentralized-identity/kerigo/pkg/db/badger"
 	"github.com/decentralized-identity/kerigo/pkg/db/mem"
+	"github.com/decentralized-identity/kerigo/pkg/encoding/stream"
 	"github.com/decentralized-identity/kerigo/pkg/event"
 	"github.com/decentralized-identity/kerigo/pkg/keri"
 	"github.com/decentralized-identity/kerigo/pkg/test/kms"
@@ -173,3 +175,139 @@ func xTestWithNotify(t *testing.T) {
 	assert.NoError(t, err)
 
 }
+
+func TestQuery(t *testing.T) {
+	eveDB := mem.New()
+	eveID, err := keri.New(kms.GetKMS(t, nil, eveDB), eveDB)
+	assert.NoError(t, err)
+
+	_, err = eveID.Interaction(event.SealArray{})
+	assert.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	srv := &Server{
+		BaseIdentity: func(l net.Listener) *keri.Keri {
+			return eveID
+		},
+	}
+
+	go func() {
+		_ = srv.Serve(ln)
+	}()
+
+	bobDB := mem.New()
+	bobID, err := keri.New(kms.GetKMS(t, nil, bobDB), bobDB)
+	assert.NoError(t, err)
+
+	cli, err := DialTimeout(bobID, ln.Addr().String(), 5*time.Second)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer cli.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// bob sends his KEL ahead of his first query so eve can verify it
+	res, err := cli.Query(ctx, event.LogsRoute, &event.Query{Prefix: eveID.Prefix()})
+	assert.NoError(t, err)
+	if assert.NotNil(t, res) {
+		assert.Len(t, res.Logs, 2)
+		assert.Nil(t, res.KeyState)
+		assert.Equal(t, event.RPY, res.Reply.Event.ILK())
+	}
+
+	kel, err := bobID.FindConnection(eveID.Prefix())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, kel.Size())
+
+	res, err = cli.Query(ctx, event.LogsRoute, &event.Query{Prefix: eveID.Prefix(), Sequence: "1"})
+	assert.NoError(t, err)
+	if assert.NotNil(t, res) && assert.Len(t, res.Logs, 1) {
+		assert.Equal(t, event.IXN, res.Logs[0].Event.ILK())
+	}
+
+	res, err = cli.Query(ctx, event.KeyStateRoute, &event.Query{Prefix: eveID.Prefix()})
+	assert.NoError(t, err)
+	if assert.NotNil(t, res) && assert.NotNil(t, res.KeyState) {
+		assert.Equal(t, "1", res.KeyState.Event.Sequence)
+	}
+
+	stale, err := bobID.Stale(eveID.Prefix())
+	assert.NoError(t, err)
+	assert.False(t, stale)
+
+	// eve has nothing for identifiers she doesn't know
+	res, err = cli.Query(ctx, event.LogsRoute, &event.Query{Prefix: "unknown"})
+	assert.NoError(t, err)
+	if assert.NotNil(t, res) {
+		assert.Len(t, res.Logs, 0)
+	}
+}
+
+func TestQueryReplyError(t *testing.T) {
+	eveDB := mem.New()
+	eveID, err := keri.New(kms.GetKMS(t, nil, eveDB), eveDB)
+	assert.NoError(t, err)
+
+	_, err = eveID.Interaction(event.SealArray{})
+	assert.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	// eve replies to the query with an interaction bob can't verify
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+
+		qry, err := stream.NewReader(c).Read()
+		if err != nil {
+			return
+		}
+
+		msgs, err := eveID.Reply(qry)
+		if err != nil {
+			return
+		}
+
+		ixn := msgs[1]
+		ixn.Signatures[0].Raw = append([]byte{}, ixn.Signatures[0].Raw...)
+		ixn.Signatures[0].Raw[0] ^= 0xff
+
+		w := stream.NewWriter(c, stream.WithAttachmentGroups())
+		for _, msg := range msgs {
+			_ = w.Write(msg)
+		}
+
+		// keep the connection open until bob is done
+		_, _ = c.Read(make([]byte, 1))
+	}()
+
+	bobDB := mem.New()
+	bobID, err := keri.New(kms.GetKMS(t, nil, bobDB), bobDB)
+	assert.NoError(t, err)
+
+	cli, err := DialTimeout(bobID, ln.Addr().String(), 5*time.Second)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer cli.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the reply still ends the query, with the error processing it
+	res, err := cli.Query(ctx, event.LogsRoute, &event.Query{Prefix: eveID.Prefix()})
+	assert.Error(t, err)
+	assert.NotEqual(t, context.DeadlineExceeded, err)
+	assert.Nil(t, res)
+	assert.NoError(t, ctx.Err())
+}
@@ -19,6 +19,12 @@ const (
 	DefaultDirectModeAddr = ":5620"
 )
 
+// Handler processes the messages received on a connection, returning
+// any messages that should be written back to the sender
+type Handler interface {
+	ProcessEvents(msgs ...*event.Message) ([]*event.Message, error)
+}
+
 type Server struct {
 	Addr string
 
@@ -39,6 +45,12 @@ type Server struct {
 	// value.
 	ConnIdentity func(base *keri.Keri, prefix string, c net.Conn) *keri.Keri
 
+	// Handler optionally processes every message received by the
+	// server in place of a keri.Keri identity, so other components
+	// such as witnesses can be served in direct mode. When set, the
+	// KMS, BaseIdentity and ConnIdentity are not used.
+	Handler Handler
+
 	connLock sync.Mutex
 	conns    []*conn
 }
@@ -59,21 +71,25 @@ func (r *Server) ListenAndServe() error {
 
 func (r *Server) Serve(l net.Listener) error {
 
-	if r.KMS == nil {
-		r.KMS = defaultKMS()
-	}
+	var baseID *keri.Keri
+	if r.Handler == nil {
+		if r.KMS == nil {
+			r.KMS = defaultKMS()
+		}
 
-	if r.DB == nil {
-		r.DB = mem.New()
-	}
+		if r.DB == nil {
+			r.DB = mem.New()
+		}
 
-	baseID, err := keri.New(r.KMS, r.DB)
-	if err != nil {
-		return err
-	}
+		var err error
+		baseID, err = keri.New(r.KMS, r.DB)
+		if err != nil {
+			return err
+		}
 
-	if r.BaseIdentity != nil {
-		baseID = r.BaseIdentity(l)
+		if r.BaseIdentity != nil {
+			baseID = r.BaseIdentity(l)
+		}
 	}
 
 	for {
@@ -94,34 +110,39 @@ func (r *Server) Serve(l net.Listener) error {
 		ioc := &conn{
 			reader: br,
 			conn:   c,
-			writer: stream.NewWriter(c),
+			writer: stream.NewWriter(c, stream.WithAttachmentGroups()),
 		}
 
 		r.addConnection(ioc)
 
-		connID := baseID
-		pre := firstMsg.Event.Prefix
+		h := r.Handler
+		if h == nil {
+			connID := baseID
+			pre := firstMsg.Event.Prefix
 
-		if cc := r.ConnIdentity; cc != nil {
-			connID = cc(connID, pre, c)
-			if connID == nil {
-				panic("ConnIdentity returned nil")
+			if cc := r.ConnIdentity; cc != nil {
+				connID = cc(connID, pre, c)
+				if connID == nil {
+					panic("ConnIdentity returned nil")
+				}
 			}
-		}
 
-		if firstMsg.Event.ILK() == event.ICP || firstMsg.Event.ILK() == event.DIP {
-			_, err := connID.FindConnection(pre)
-			if err != nil {
-				err = sendOwnInception(connID, ioc)
+			if firstMsg.Event.ILK() == event.ICP || firstMsg.Event.ILK() == event.DIP {
+				_, err := connID.FindConnection(pre)
 				if err != nil {
-					log.Println("error sending own icp to connection", err)
-					c.Close()
-					continue
+					err = sendOwnInception(connID, ioc)
+					if err != nil {
+						log.Println("error sending own icp to connection", err)
+						c.Close()
+						continue
+					}
 				}
 			}
+
+			h = connID
 		}
 
-		outmsgs, err := connID.ProcessEvents(firstMsg)
+		outmsgs, err := h.ProcessEvents(firstMsg)
 		if err != nil {
 			log.Println("error reading initial message on connection", err)
 			c.Close()
@@ -138,7 +159,7 @@ func (r *Server) Serve(l net.Listener) error {
 		}
 
 		go func() {
-			err := handleConnection(ioc, connID)
+			err := handleConnection(ioc, h)
 			r.removeConnection(ioc)
 			log.Printf("server connection closed with : (%v)\n", err)
 		}()
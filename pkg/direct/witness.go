@@ -0,0 +1,84 @@
+package direct
+
+import (
+	"context"
+	"net"
+
+	"github.com/pkg/errors"
+
+	"github.com/decentralized-identity/kerigo/pkg/encoding/stream"
+	"github.com/decentralized-identity/kerigo/pkg/event"
+	"github.com/decentralized-identity/kerigo/pkg/keri"
+)
+
+var _ keri.WitnessClient = (*WitnessClient)(nil)
+
+// WitnessClient submits events to a witness served in direct mode,
+// opening a new connection for each submission
+type WitnessClient struct {
+	addr string
+}
+
+func NewWitnessClient(addr string) *WitnessClient {
+	return &WitnessClient{addr: addr}
+}
+
+// Submit writes the messages to the witness and waits for a receipt for
+// each key event in them and a notice for each key state notice request,
+// or until the context is done
+func (r *WitnessClient) Submit(ctx context.Context, msgs ...*event.Message) ([]*event.Message, error) {
+	var d net.Dialer
+	c, err := d.DialContext(ctx, "tcp", r.addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to connect to witness at %s", r.addr)
+	}
+	defer c.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = c.SetDeadline(deadline)
+	}
+
+	// unblock the reads below if the context is cancelled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-done:
+		}
+	}()
+
+	expected := 0
+	for _, msg := range msgs {
+		switch msg.Event.ILK() {
+		case event.ICP, event.ROT, event.IXN, event.DIP, event.DRT:
+			expected++
+		case event.KSN:
+			if event.IsKeyStateNoticeRequest(msg) {
+				expected++
+			}
+		}
+	}
+
+	err = stream.NewWriter(c, stream.WithAttachmentGroups()).WriteAll(msgs)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to write to witness")
+	}
+
+	reader := stream.NewReader(c)
+	out := []*event.Message{}
+	for len(out) < expected {
+		msg, err := reader.Read()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, errors.Wrap(err, "unable to read witness receipt")
+		}
+
+		out = append(out, msg)
+	}
+
+	return out, nil
+}
@@ -15,7 +15,7 @@ const (
 	MsgPackPrefix = byte(0b10000000)
 	JSONPrefix    = byte(0b01100000)
 	QB64Prefix    = byte(0b00100000)
-	QB2Prefix     = byte(0b01000000)
+	QB2Prefix     = byte(0b11100000)
 )
 
 var (
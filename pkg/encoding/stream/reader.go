@@ -2,6 +2,7 @@ package stream
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"regexp"
@@ -74,29 +75,25 @@ func (r *Reader) Read() (*event.Message, error) {
 		return nil, fmt.Errorf("unable to unmarshal event: (%v)", err)
 	}
 
-	opts := []event.MessageOption{}
-	for {
-		att, err := r.nextAttachment()
-		if err == EOA {
-			break
-		}
-
-		if err != nil {
-			return nil, err
-		}
+	atts, err := r.attachments()
+	if err != nil {
+		return nil, err
+	}
 
+	opts := []event.MessageOption{event.WithRaw(buff)}
+	for _, att := range atts {
 		switch att.Code {
 		case derivation.ControllerSigCountCode:
 			opts = append(opts, event.WithSignatures(att.Signatures))
-			return event.NewMessage(evt, opts...)
 		case derivation.WitnessSigCountCode:
 			opts = append(opts, event.WithWitnessReceipts(att.WitnessReceipts))
 		case derivation.NonTransferableRctCountCode:
 			opts = append(opts, event.WithNonTransferableReceipts(att.NonTransferableReceipts))
 		case derivation.TransferableRctCountCode:
 			opts = append(opts, event.WithTransferableReceipts(att.TransferableReceipts))
+		case derivation.FirstSeenReplayCountCode:
+			opts = append(opts, event.WithFirstSeenReplays(att.FirstSeenReplays))
 		}
-
 	}
 
 	return event.NewMessage(evt, opts...)
@@ -121,8 +118,93 @@ func (r *Reader) ReadAll() ([]*event.Message, error) {
 	return out, nil
 }
 
-func (r *Reader) nextAttachment() (*event.Attachment, error) {
+// attachments reads the attachments following a message. An attached
+// material group is read exactly. Otherwise counted groups are read until the
+// next message starts, the stream ends, or a counted group ends the data
+// received so far, so a live peer that does not group its attachments is
+// never waited on for its next message.
+func (r *Reader) attachments() ([]*event.Attachment, error) {
+	src := r.buf
+
+	grp, err := r.attachmentGroup()
+	if err != nil {
+		return nil, err
+	}
+
+	if grp != nil {
+		src = bufio.NewReader(bytes.NewReader(grp))
+	}
+
+	out := []*event.Attachment{}
+	for {
+		att, err := nextAttachment(src)
+		if err == EOA {
+			return out, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, att)
+
+		if grp == nil && src.Buffered() == 0 {
+			return out, nil
+		}
+	}
+}
+
+// attachmentGroup reads the attached material group following a message and
+// returns its contents as qb64, or nil if the attachments are not grouped
+func (r *Reader) attachmentGroup() ([]byte, error) {
 	f, err := r.buf.Peek(1)
+	if err != nil {
+		// anything other than the end of the stream is
+		// reported when reading the attachments
+		return nil, nil
+	}
+
+	switch DetectFrameType(f) {
+	case QB64Frame:
+		return r.group(4, func(b []byte) ([]byte, error) { return b, nil })
+	case QB2Frame:
+		return r.group(3, derivation.ToQB64)
+	}
+
+	return nil, nil
+}
+
+// group reads an attached material group whose count is in units of
+// size bytes, using toText to convert the group into qb64
+func (r *Reader) group(size int, toText func([]byte) ([]byte, error)) ([]byte, error) {
+	b, err := r.buf.Peek(size)
+	if err != nil {
+		return nil, nil
+	}
+
+	code, err := toText(b)
+	if err != nil || derivation.CountCodes[string(code[:derivation.SigCountLen])] != derivation.AttachedMaterialCountCode {
+		return nil, nil
+	}
+
+	cnt, err := derivation.ParseCounter(string(code))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid attachment group count")
+	}
+
+	_, _ = r.buf.Discard(size)
+
+	grp := make([]byte, cnt.Count()*size)
+	_, err = io.ReadFull(r.buf, grp)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read attachment group")
+	}
+
+	return toText(grp)
+}
+
+func nextAttachment(buf *bufio.Reader) (*event.Attachment, error) {
+	f, err := buf.Peek(1)
 	if err == io.EOF {
 		return nil, EOA
 	}
@@ -136,10 +218,9 @@ func (r *Reader) nextAttachment() (*event.Attachment, error) {
 	case JSONFrame, MsgPackFrame, CBORFrame:
 		return nil, EOA
 	case QB64Frame:
-		return event.ParseAttachment(r.buf)
+		return event.ParseAttachment(buf)
 	case QB2Frame:
-		//TODO:  apply binary translation here
-		return event.ParseAttachment(r.buf)
+		return event.ParseAttachment(derivation.NewQB2Reader(buf))
 	}
 
 	return nil, errors.New("invalid stream state")
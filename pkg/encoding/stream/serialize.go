@@ -10,39 +10,67 @@ import (
 
 type ReplayMode int
 
+// maxGroupCount is the largest count a two character count can hold
+const maxGroupCount = 64*64 - 1
+
 const (
 	DisjointMode ReplayMode = iota
 	ConjointMode
 )
 
+// Domain is the CESR domain attachments are serialized in
+type Domain int
+
+const (
+	TextDomain Domain = iota
+	BinaryDomain
+)
+
+// encoding is how message attachments are written to a stream
+type encoding struct {
+	domain  Domain
+	grouped bool
+}
+
 func ToDisjoint(m *event.Message) ([]byte, error) {
-	evt, err := m.Event.Serialize()
+	return toDisjoint(m, encoding{domain: TextDomain})
+}
+
+func toDisjoint(m *event.Message, enc encoding) ([]byte, error) {
+	// witness receipt messages carry their couplets as attachments
+	if m.Event.ILK() == event.RCT && len(m.Signatures) == 0 {
+		return conjoint(m, enc)
+	}
+
+	evt, err := m.Raw()
 	if err != nil {
 		return nil, err
 	}
 
-	sc, err := derivation.NewSigCounter(derivation.ControllerSigCountCode, derivation.WithCount(len(m.Signatures)))
+	att, err := signatures(m)
 	if err != nil {
 		return nil, err
 	}
 
-	cntCode, err := sc.String()
+	fsrs, err := firstSeenReplays(m)
 	if err != nil {
 		return nil, err
 	}
 
-	evt = append(evt, cntCode...)
-	for _, sig := range m.Signatures {
-		evt = append(evt, sig.AsPrefix()...)
+	att, err = enc.attachments(append(att, fsrs...))
+	if err != nil {
+		return nil, err
 	}
 
+	evt = append(evt, att...)
+
 	for _, rcpt := range m.TransferableReceipts {
 		msg, err := rcpt.Message()
 		if err != nil {
 			return nil, err
 		}
 
-		d, err := ToDisjoint(msg)
+		d, err := toDisjoint(msg, enc)
 		if err != nil {
 			return nil, err
 		}
@@ -50,13 +78,15 @@ func ToDisjoint(m *event.Message) ([]byte, error) {
 		evt = append(evt, d...)
 	}
 
-	for _, rcpt := range m.NonTransferableReceipts {
-		msg, err := rcpt.Message()
+	// receipt couplets carry non-indexed signatures, so they follow
+	// the event in a single rct message rather than as signatures
+	if len(m.NonTransferableReceipts) > 0 {
+		msg, err := event.NonTransferableReceiptMessage(m.NonTransferableReceipts...)
 		if err != nil {
 			return nil, err
 		}
 
-		d, err := ToDisjoint(msg)
+		d, err := conjoint(msg, enc)
 		if err != nil {
 			return nil, err
 		}
@@ -64,13 +94,13 @@ func ToDisjoint(m *event.Message) ([]byte, error) {
 		evt = append(evt, d...)
 	}
 
-	for _, rcpt := range m.WitnessReceipts {
-		msg, err := rcpt.Message()
+	if len(m.WitnessReceipts) > 0 {
+		msg, err := event.WitnessReceiptMessage(m.WitnessReceipts...)
 		if err != nil {
 			return nil, err
 		}
 
-		d, err := ToDisjoint(msg)
+		d, err := conjoint(msg, enc)
 		if err != nil {
 			return nil, err
 		}
@@ -82,38 +112,46 @@ func ToDisjoint(m *event.Message) ([]byte, error) {
 }
 
 func ToConjoint(m *event.Message) ([]byte, error) {
+	return toConjoint(m, encoding{domain: TextDomain})
+}
 
+func toConjoint(m *event.Message, enc encoding) ([]byte, error) {
 	switch m.Event.ILK() {
 	case event.VRC:
-		return conjointVRC(m)
+		d, err := conjointVRC(m)
+		if err != nil {
+			return nil, err
+		}
+
+		return toDomain(d, enc.domain)
 	case event.RCT:
-		return conjointRCT(m)
+		d, err := conjointRCT(m)
+		if err != nil {
+			return nil, err
+		}
+
+		return toDomain(d, enc.domain)
 	default:
-		return conjoint(m)
+		return conjoint(m, enc)
 	}
 }
 
-func conjoint(m *event.Message) ([]byte, error) {
+func conjoint(m *event.Message, enc encoding) ([]byte, error) {
 
-	evt, err := m.Event.Serialize()
+	evt, err := m.Raw()
 	if err != nil {
 		return nil, err
 	}
 
-	sc, err := derivation.NewSigCounter(derivation.ControllerSigCountCode, derivation.WithCount(len(m.Signatures)))
-	if err != nil {
-		return nil, err
-	}
-
-	cntCode, err := sc.String()
+	att, err := signatures(m)
 	if err != nil {
 		return nil, err
 	}
 
-	evt = append(evt, cntCode...)
-	for _, sig := range m.Signatures {
-		evt = append(evt, sig.AsPrefix()...)
-	}
+	var (
+		sc      *derivation.Counter
+		cntCode string
+	)
 
 	if len(m.TransferableReceipts) > 0 {
 		sc, err = derivation.NewSigCounter(derivation.TransferableRctCountCode, derivation.WithCount(len(m.TransferableReceipts)))
@@ -126,14 +164,14 @@ func conjoint(m *event.Message) ([]byte, error) {
 			return nil, err
 		}
 
-		evt = append(evt, cntCode...)
+		att = append(att, cntCode...)
 		for _, rcpt := range m.TransferableReceipts {
-			evt = append(evt, rcpt.Text()...)
+			att = append(att, rcpt.Text()...)
 		}
 	}
 
 	if len(m.NonTransferableReceipts) > 0 {
-		sc, err = derivation.NewSigCounter(derivation.NonTransferableRctCountCode, derivation.WithCount(len(m.TransferableReceipts)))
+		sc, err = derivation.NewSigCounter(derivation.NonTransferableRctCountCode, derivation.WithCount(len(m.NonTransferableReceipts)))
 		if err != nil {
 			return nil, err
 		}
@@ -143,12 +181,142 @@ func conjoint(m *event.Message) ([]byte, error) {
 			return nil, err
 		}
 
-		evt = append(evt, cntCode...)
+		att = append(att, cntCode...)
 		for _, rcpt := range m.NonTransferableReceipts {
-			evt = append(evt, rcpt.Text()...)
+			att = append(att, rcpt.Text()...)
 		}
 	}
-	return evt, nil
+
+	if len(m.WitnessReceipts) > 0 {
+		sc, err = derivation.NewSigCounter(derivation.WitnessSigCountCode, derivation.WithCount(len(m.WitnessReceipts)))
+		if err != nil {
+			return nil, err
+		}
+
+		cntCode, err = sc.String()
+		if err != nil {
+			return nil, err
+		}
+
+		att = append(att, cntCode...)
+		for _, rcpt := range m.WitnessReceipts {
+			att = append(att, rcpt.Text()...)
+		}
+	}
+
+	fsrs, err := firstSeenReplays(m)
+	if err != nil {
+		return nil, err
+	}
+
+	att, err = enc.attachments(append(att, fsrs...))
+	if err != nil {
+		return nil, err
+	}
+
+	return append(evt, att...), nil
+}
+
+// signatures returns the qb64 controller signature group for the message,
+// or nothing for witness receipt messages which carry no signatures
+func signatures(m *event.Message) ([]byte, error) {
+	// receipts carry their signatures as receipt couplets and
+	// unsigned key state notices are requests for the notice
+	if ilk := m.Event.ILK(); len(m.Signatures) == 0 && (ilk == event.RCT || ilk == event.KSN) {
+		return nil, nil
+	}
+
+	sc, err := derivation.NewSigCounter(derivation.ControllerSigCountCode, derivation.WithCount(len(m.Signatures)))
+	if err != nil {
+		return nil, err
+	}
+
+	cntCode, err := sc.String()
+	if err != nil {
+		return nil, err
+	}
+
+	out := []byte(cntCode)
+	for _, sig := range m.Signatures {
+		out = append(out, sig.AsPrefix()...)
+	}
+
+	return out, nil
+}
+
+// firstSeenReplays returns the qb64 first seen replay group for the
+// message, or nothing if the message has no first seen replay couples
+func firstSeenReplays(m *event.Message) ([]byte, error) {
+	if len(m.FirstSeenReplays) == 0 {
+		return nil, nil
+	}
+
+	sc, err := derivation.NewSigCounter(derivation.FirstSeenReplayCountCode, derivation.WithCount(len(m.FirstSeenReplays)))
+	if err != nil {
+		return nil, err
+	}
+
+	cntCode, err := sc.String()
+	if err != nil {
+		return nil, err
+	}
+
+	out := []byte(cntCode)
+	for _, fsr := range m.FirstSeenReplays {
+		out = append(out, derivation.NewOrdinal(uint16(fsr.Sequence)).Base64()...)
+		out = append(out, fsr.Date.Base64()...)
+	}
+
+	return out, nil
+}
+
+// attachments converts the qb64 attachments of a message into the domain
+// being written, wrapping them in an attached material group if requested
+func (e encoding) attachments(att []byte) ([]byte, error) {
+	if e.grouped {
+		grp, err := attachmentGroup(att)
+		if err != nil {
+			return nil, err
+		}
+
+		att = grp
+	}
+
+	return toDomain(att, e.domain)
+}
+
+// attachmentGroup prefixes qb64 attachments with an attached material count
+// code holding their length in quadlets. The count is the same in the qb2
+// domain where every quadlet becomes a triplet.
+func attachmentGroup(att []byte) ([]byte, error) {
+	quadlets := len(att) / 4
+	if len(att)%4 != 0 || quadlets > maxGroupCount {
+		return nil, fmt.Errorf("unable to group %d characters of attachments", len(att))
+	}
+
+	sc, err := derivation.NewSigCounter(derivation.AttachedMaterialCountCode, derivation.WithCount(quadlets))
+	if err != nil {
+		return nil, err
+	}
+
+	cntCode, err := sc.String()
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(cntCode), att...), nil
+}
+
+// toDomain converts qb64 attachments into the requested domain
+func toDomain(att []byte, domain Domain) ([]byte, error) {
+	switch domain {
+	case TextDomain:
+		return att, nil
+	case BinaryDomain:
+		return derivation.ToQB2(att)
+	}
+
+	return nil, fmt.Errorf("invalid attachment domain %d", domain)
 }
 
 func conjointVRC(m *event.Message) ([]byte, error) {
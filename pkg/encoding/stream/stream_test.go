@@ -1,8 +1,13 @@
 package stream
 
 import (
+	"bytes"
 	"crypto/ed25519"
+	"io"
+	"net"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"github.com/google/tink/go/signature/subtle"
 	"github.com/stretchr/testify/assert"
@@ -10,6 +15,7 @@ import (
 	"github.com/decentralized-identity/kerigo/pkg/derivation"
 	"github.com/decentralized-identity/kerigo/pkg/event"
 	"github.com/decentralized-identity/kerigo/pkg/prefix"
+	"github.com/decentralized-identity/kerigo/pkg/version"
 )
 
 func TestMessageSerialization(t *testing.T) {
@@ -63,3 +69,336 @@ func TestMessageSerialization(t *testing.T) {
 	assert.Equal(t, expectedMsgBytes, string(b))
 
 }
+
+func TestBinaryMessageRoundTrip(t *testing.T) {
+	t.Run("cbor", func(t *testing.T) {
+		testBinaryMessageRoundTrip(t, event.CBOR, CBORFrame)
+	})
+
+	t.Run("msgpack", func(t *testing.T) {
+		testBinaryMessageRoundTrip(t, event.MSGPK, MsgPackFrame)
+	})
+}
+
+func testBinaryMessageRoundTrip(t *testing.T, format event.FORMAT, frame FrameType) {
+	der, err := derivation.FromPrefix("ADW3o9m3udwEf0aoOdZLLJdf1aylokP0lwwI_M2J9h0s")
+	assert.NoError(t, err)
+
+	edPriv := ed25519.NewKeyFromSeed(der.Raw)
+	signer, err := subtle.NewED25519SignerFromPrivateKey(&edPriv)
+	assert.NoError(t, err)
+
+	keyDer, err := derivation.New(derivation.WithCode(derivation.Ed25519), derivation.WithRaw(edPriv.Public().(ed25519.PublicKey)))
+	assert.NoError(t, err)
+
+	icp, err := event.NewInceptionEvent(
+		event.WithPrefix("Eh0fefvTQ55Jwps4dVnIekf7mZgWoU8bCUsDsKeGiEgU"),
+		event.WithKeys(prefix.New(keyDer)),
+		event.WithDefaultVersion(format),
+		event.WithNext("1", derivation.Blake3256, prefix.New(keyDer)))
+	assert.NoError(t, err)
+
+	d, err := icp.Serialize()
+	assert.NoError(t, err)
+	icp.Version = event.VersionString(format, version.Code(), len(d))
+
+	d, err = icp.Serialize()
+	assert.NoError(t, err)
+	assert.Equal(t, frame, DetectFrameType(d))
+
+	sig, err := derivation.New(derivation.WithCode(derivation.Ed25519Attached), derivation.WithSigner(signer.Sign))
+	assert.NoError(t, err)
+
+	_, err = sig.Derive(d)
+	assert.NoError(t, err)
+
+	msg := &event.Message{
+		Event:      icp,
+		Signatures: []derivation.Derivation{*sig},
+	}
+
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	err = w.WriteAll([]*event.Message{msg, msg})
+	assert.NoError(t, err)
+
+	r := NewReader(buf)
+	msgs, err := r.ReadAll()
+	assert.NoError(t, err)
+	if !assert.Len(t, msgs, 2) {
+		return
+	}
+
+	for _, m := range msgs {
+		assert.Equal(t, icp.Version, m.Event.Version)
+		assert.Equal(t, icp.Keys, m.Event.Keys)
+		assert.Equal(t, sig.Raw, m.Signatures[0].Raw)
+
+		ser, err := m.Event.Serialize()
+		assert.NoError(t, err)
+		assert.Equal(t, d, ser)
+
+		err = derivation.VerifyWithAttachedSignature(keyDer, &m.Signatures[0], ser)
+		assert.NoError(t, err)
+	}
+}
+
+func TestAttachmentDomains(t *testing.T) {
+	msg := attachedMessage(t)
+	icp, sig := msg.Event, msg.Signatures[0]
+
+	d, err := msg.Raw()
+	assert.NoError(t, err)
+
+	txt := &bytes.Buffer{}
+	err = NewWriter(txt, WithSerializationMode(ConjointMode)).Write(msg)
+	assert.NoError(t, err)
+
+	bin := &bytes.Buffer{}
+	err = NewWriter(bin, WithSerializationMode(ConjointMode), WithDomain(BinaryDomain)).Write(msg)
+	assert.NoError(t, err)
+
+	// the binary domain is 3/4 the size of the text domain attachments
+	assert.Equal(t, d, bin.Bytes()[:len(d)])
+	assert.Equal(t, QB2Frame, DetectFrameType(bin.Bytes()[len(d):]))
+	assert.Equal(t, (txt.Len()-len(d))/4*3, bin.Len()-len(d))
+
+	qb2, err := derivation.ToQB2(txt.Bytes()[len(d):])
+	assert.NoError(t, err)
+	assert.Equal(t, qb2, bin.Bytes()[len(d):])
+
+	for _, buf := range []*bytes.Buffer{txt, bin} {
+		m, err := NewReader(buf).Read()
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		assert.Equal(t, icp.Prefix, m.Event.Prefix)
+		if assert.Len(t, m.Signatures, 1) {
+			assert.Equal(t, sig.Raw, m.Signatures[0].Raw)
+		}
+
+		if assert.Len(t, m.TransferableReceipts, 1) {
+			assert.Equal(t, msg.TransferableReceipts[0].Text(), m.TransferableReceipts[0].Text())
+			assert.Equal(t, msg.TransferableReceipts[0].Bin(), m.TransferableReceipts[0].Bin())
+		}
+
+		if assert.Len(t, m.NonTransferableReceipts, 1) {
+			assert.Equal(t, msg.NonTransferableReceipts[0].Text(), m.NonTransferableReceipts[0].Text())
+		}
+
+		if assert.Len(t, m.WitnessReceipts, 1) {
+			assert.Equal(t, msg.WitnessReceipts[0].Text(), m.WitnessReceipts[0].Text())
+		}
+
+		if assert.Len(t, m.FirstSeenReplays, 1) {
+			assert.Equal(t, 0, m.FirstSeenReplays[0].Sequence)
+			assert.True(t, msg.FirstSeenReplays[0].Date.Time().Equal(m.FirstSeenReplays[0].Date.Time()))
+		}
+
+		_, err = NewReader(buf).Read()
+		assert.Equal(t, io.EOF, err)
+	}
+}
+
+// attachedMessage returns a signed inception event with one of every attachment
+func attachedMessage(t *testing.T) *event.Message {
+	der, err := derivation.FromPrefix("ADW3o9m3udwEf0aoOdZLLJdf1aylokP0lwwI_M2J9h0s")
+	assert.NoError(t, err)
+
+	edPriv := ed25519.NewKeyFromSeed(der.Raw)
+	signer, err := subtle.NewED25519SignerFromPrivateKey(&edPriv)
+	assert.NoError(t, err)
+
+	keyDer, err := derivation.New(derivation.WithCode(derivation.Ed25519), derivation.WithRaw(edPriv.Public().(ed25519.PublicKey)))
+	assert.NoError(t, err)
+
+	icp, err := event.NewInceptionEvent(
+		event.WithPrefix("Eh0fefvTQ55Jwps4dVnIekf7mZgWoU8bCUsDsKeGiEgU"),
+		event.WithKeys(prefix.New(keyDer)),
+		event.WithDefaultVersion(event.JSON),
+		event.WithNext("1", derivation.Blake3256, prefix.New(keyDer)))
+	assert.NoError(t, err)
+
+	d, err := icp.Serialize()
+	assert.NoError(t, err)
+	icp.Version = event.VersionString(event.JSON, version.Code(), len(d))
+
+	d, err = icp.Serialize()
+	assert.NoError(t, err)
+
+	sig, err := derivation.New(derivation.WithCode(derivation.Ed25519Attached), derivation.WithSigner(signer.Sign))
+	assert.NoError(t, err)
+
+	_, err = sig.Derive(d)
+	assert.NoError(t, err)
+
+	// receipt couplets carry non-indexed signatures
+	nsig, err := derivation.New(derivation.WithCode(derivation.Ed25519Sig), derivation.WithSigner(signer.Sign))
+	assert.NoError(t, err)
+
+	_, err = nsig.Derive(d)
+	assert.NoError(t, err)
+
+	dig, err := icp.GetDigest()
+	assert.NoError(t, err)
+
+	msg, err := event.NewMessage(icp,
+		event.WithSignatures([]derivation.Derivation{*sig}),
+		event.WithTransferableReceipts([]*event.Quadlet{{
+			Prefix:    must(derivation.FromPrefix(icp.Prefix)),
+			Sequence:  0,
+			Digest:    must(derivation.FromPrefix(dig)),
+			Signature: sig,
+		}}),
+		event.WithNonTransferableReceipts([]*event.Couplet{{Prefix: keyDer, Signature: nsig}}),
+		event.WithWitnessReceipts([]*event.Couplet{{Prefix: keyDer, Signature: nsig}}),
+		event.WithFirstSeenReplays([]*event.FirstSeenReplay{{
+			Sequence: 0,
+			Date:     derivation.NewDater(time.Date(2020, 8, 22, 17, 50, 9, 988921000, time.UTC)),
+		}}),
+	)
+	assert.NoError(t, err)
+
+	return msg
+}
+
+func TestSplitReads(t *testing.T) {
+	msg := attachedMessage(t)
+
+	raw, err := msg.Raw()
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		opts    []EncodeOption
+		grouped bool
+	}{
+		{"disjoint", nil, false},
+		{"conjoint", []EncodeOption{WithSerializationMode(ConjointMode)}, false},
+		{"binary", []EncodeOption{WithSerializationMode(ConjointMode), WithDomain(BinaryDomain)}, false},
+		{"grouped", []EncodeOption{WithSerializationMode(ConjointMode), WithAttachmentGroups()}, true},
+		{"grouped binary", []EncodeOption{WithSerializationMode(ConjointMode), WithDomain(BinaryDomain), WithAttachmentGroups()}, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			err := NewWriter(buf, tc.opts...).WriteAll([]*event.Message{msg, msg})
+			assert.NoError(t, err)
+
+			whole, err := NewReader(bytes.NewReader(buf.Bytes())).ReadAll()
+			assert.NoError(t, err)
+			assert.Len(t, whole[0].Signatures, 1)
+
+			// attachments arriving in later reads than their event are not dropped
+			readers := []io.Reader{iotest.OneByteReader(bytes.NewReader(buf.Bytes())), iotest.HalfReader(bytes.NewReader(buf.Bytes()))}
+			if !tc.grouped {
+				// ungrouped attachments end with the data received so far,
+				// so only a counted group split across reads is waited for
+				split := len(raw) + 2
+				readers = []io.Reader{io.MultiReader(bytes.NewReader(buf.Bytes()[:split]), bytes.NewReader(buf.Bytes()[split:]))}
+			}
+
+			for _, rd := range readers {
+				msgs, err := NewReader(rd).ReadAll()
+				if !assert.NoError(t, err) || !assert.Len(t, msgs, len(whole)) {
+					continue
+				}
+
+				for i, m := range msgs {
+					assert.Len(t, m.Signatures, len(whole[i].Signatures))
+					assert.Len(t, m.TransferableReceipts, len(whole[i].TransferableReceipts))
+					assert.Len(t, m.NonTransferableReceipts, len(whole[i].NonTransferableReceipts))
+					assert.Len(t, m.WitnessReceipts, len(whole[i].WitnessReceipts))
+					assert.Len(t, m.FirstSeenReplays, len(whole[i].FirstSeenReplays))
+				}
+			}
+		})
+	}
+}
+
+func TestAttachmentGroups(t *testing.T) {
+	msg := attachedMessage(t)
+
+	d, err := msg.Raw()
+	assert.NoError(t, err)
+
+	r, w := io.Pipe()
+	go func() {
+		_ = NewWriter(w, WithSerializationMode(ConjointMode), WithAttachmentGroups()).Write(msg)
+	}()
+
+	// a grouped message is read without waiting for the next message
+	// or the end of the stream, as on a live connection
+	m, err := NewReader(r).Read()
+	assert.NoError(t, err)
+	assert.Len(t, m.Signatures, 1)
+	assert.Len(t, m.WitnessReceipts, 1)
+	assert.Len(t, m.FirstSeenReplays, 1)
+
+	buf := &bytes.Buffer{}
+	err = NewWriter(buf, WithSerializationMode(ConjointMode), WithAttachmentGroups()).Write(msg)
+	assert.NoError(t, err)
+	assert.Equal(t, "-V", string(buf.Bytes()[len(d):len(d)+2]))
+}
+
+func TestUngroupedLiveConnection(t *testing.T) {
+	msg := attachedMessage(t)
+
+	tests := []struct {
+		name string
+		opts []EncodeOption
+	}{
+		{"disjoint", nil},
+		{"conjoint", []EncodeOption{WithSerializationMode(ConjointMode)}},
+		{"binary", []EncodeOption{WithSerializationMode(ConjointMode), WithDomain(BinaryDomain)}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			err := NewWriter(buf, tc.opts...).Write(msg)
+			assert.NoError(t, err)
+
+			whole, err := NewReader(buf).Read()
+			assert.NoError(t, err)
+
+			r, w := net.Pipe()
+			defer r.Close()
+			defer w.Close()
+
+			go func() {
+				_ = NewWriter(w, tc.opts...).Write(msg)
+			}()
+
+			// the writer stays open, as a peer that does not group its
+			// attachments would between messages
+			read := make(chan *event.Message, 1)
+			go func() {
+				m, err := NewReader(r).Read()
+				assert.NoError(t, err)
+				read <- m
+			}()
+
+			select {
+			case m := <-read:
+				if assert.NotNil(t, m) {
+					assert.Len(t, m.Signatures, 1)
+					assert.Len(t, m.WitnessReceipts, len(whole.WitnessReceipts))
+					assert.Len(t, m.FirstSeenReplays, len(whole.FirstSeenReplays))
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("message not read until the writer sends the next one")
+			}
+		})
+	}
+}
+
+func must(d *derivation.Derivation, err error) *derivation.Derivation {
+	if err != nil {
+		panic(err)
+	}
+
+	return d
+}
@@ -11,6 +11,7 @@ import (
 type Writer struct {
 	writ io.Writer
 	mode ReplayMode
+	enc  encoding
 }
 
 type EncodeOption func(*Writer)
@@ -19,6 +20,7 @@ func NewWriter(w io.Writer, opts ...EncodeOption) *Writer {
 	enc := &Writer{
 		writ: w,
 		mode: DisjointMode,
+		enc:  encoding{domain: TextDomain},
 	}
 
 	for _, opt := range opts {
@@ -46,9 +48,9 @@ func (r *Writer) Write(msg *event.Message) error {
 
 	switch r.mode {
 	case DisjointMode:
-		d, err = ToDisjoint(msg)
+		d, err = toDisjoint(msg, r.enc)
 	case ConjointMode:
-		d, err = ToConjoint(msg)
+		d, err = toConjoint(msg, r.enc)
 	default:
 		return errors.New("invalid stream mode")
 	}
@@ -70,3 +72,21 @@ func WithSerializationMode(sm ReplayMode) EncodeOption {
 		e.mode = sm
 	}
 }
+
+// WithDomain sets the domain attachments are written in, either
+// qb64 text or compact qb2 binary
+func WithDomain(d Domain) EncodeOption {
+	return func(e *Writer) {
+		e.enc.domain = d
+	}
+}
+
+// WithAttachmentGroups wraps the attachments of every message in an attached
+// material group so readers know where a message ends without waiting for
+// the next one, which is required on connections that are not closed after
+// writing
+func WithAttachmentGroups() EncodeOption {
+	return func(e *Writer) {
+		e.enc.grouped = true
+	}
+}
@@ -1,7 +1,6 @@
 package event
 
 import (
-	"bufio"
 	"fmt"
 	"io"
 
@@ -13,19 +12,13 @@ import (
 func ParseAttachedCouplets(buf io.Reader) ([]*Couplet, error) {
 	out := []*Couplet{}
 
-	rctCountBytes := make([]byte, 4)
-	read, err := buf.Read(rctCountBytes)
-	if read != 4 || err != nil {
-		return nil, errors.New("invalid receipt count")
-	}
-
-	rctCount, err := derivation.Base64ToIndex(string(rctCountBytes))
+	rctCount, err := parseCount(buf)
 	if err != nil {
 		return nil, fmt.Errorf("invalid receipt count (%s)", err)
 	}
 
 	// iterate over the receipt bytes for each receipt
-	current := uint16(0)
+	current := 0
 	for current < rctCount {
 		rct, err := ParseAttachedCouplet(buf)
 		if err != nil {
@@ -60,19 +53,13 @@ func ParseAttachedCouplet(r io.Reader) (*Couplet, error) {
 func ParseAttachedQuadlets(buf io.Reader) ([]*Quadlet, error) {
 	out := []*Quadlet{}
 
-	rctCountBytes := make([]byte, 4)
-	read, err := buf.Read(rctCountBytes)
-	if read != 4 || err != nil {
-		return nil, errors.New("invalid receipt count")
-	}
-
-	rctCount, err := derivation.Base64ToIndex(string(rctCountBytes))
+	rctCount, err := parseCount(buf)
 	if err != nil {
 		return nil, fmt.Errorf("invalid receipt count (%s)", err)
 	}
 
 	// iterate over the receipt bytes for each receipt
-	current := uint16(0)
+	current := 0
 	for current < rctCount {
 		rct, err := ParseAttachedQuadlet(buf)
 		if err != nil {
@@ -86,8 +73,7 @@ func ParseAttachedQuadlets(buf io.Reader) ([]*Quadlet, error) {
 	return out, nil
 }
 
-func ParseAttachedQuadlet(r io.Reader) (*Quadlet, error) {
-	buf := bufio.NewReader(r)
+func ParseAttachedQuadlet(buf io.Reader) (*Quadlet, error) {
 	pre, err := derivation.ParsePrefix(buf)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to read prefix from beginning of receipt")
@@ -103,7 +89,7 @@ func ParseAttachedQuadlet(r io.Reader) (*Quadlet, error) {
 		return nil, errors.Wrap(err, "unable to read establishment digest")
 	}
 
-	sig, err := derivation.ParsePrefix(buf)
+	sig, err := derivation.ParseAttachedSignature(buf)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to read signature for receipt")
 	}
@@ -116,3 +102,59 @@ func ParseAttachedQuadlet(r io.Reader) (*Quadlet, error) {
 	}, nil
 
 }
+
+func ParseAttachedFirstSeenReplays(buf io.Reader) ([]*FirstSeenReplay, error) {
+	out := []*FirstSeenReplay{}
+
+	count, err := parseCount(buf)
+	if err != nil {
+		return nil, fmt.Errorf("invalid first seen replay count (%s)", err)
+	}
+
+	current := 0
+	for current < count {
+		fsr, err := ParseAttachedFirstSeenReplay(buf)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing first seen replay couple %d", current)
+		}
+
+		out = append(out, fsr)
+		current++
+	}
+
+	return out, nil
+}
+
+func ParseAttachedFirstSeenReplay(buf io.Reader) (*FirstSeenReplay, error) {
+	o, err := derivation.ParseOrdinal(buf)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read first seen ordinal")
+	}
+
+	dts, err := derivation.ParseDater(buf)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read first seen date time")
+	}
+
+	return &FirstSeenReplay{
+		Sequence: o.Num(),
+		Date:     dts,
+	}, nil
+}
+
+// parseCount reads the 4 character count code at the start of
+// an attachment group and returns the number of items in the group
+func parseCount(buf io.Reader) (int, error) {
+	countBytes := make([]byte, 4)
+	_, err := io.ReadFull(buf, countBytes)
+	if err != nil {
+		return 0, err
+	}
+
+	c, err := derivation.ParseCounter(string(countBytes))
+	if err != nil {
+		return 0, err
+	}
+
+	return c.Count(), nil
+}
@@ -17,6 +17,7 @@ type Attachment struct {
 	TransferableReceipts    []*Quadlet
 	NonTransferableReceipts []*Couplet
 	WitnessReceipts         []*Couplet
+	FirstSeenReplays        []*FirstSeenReplay
 }
 
 type Couplet struct {
@@ -31,10 +32,29 @@ type Quadlet struct {
 	Sequence  int
 }
 
+// FirstSeenReplay is the first seen ordinal and date time of an
+// event, attached when replaying a log in first seen order
+type FirstSeenReplay struct {
+	Sequence int
+	Date     *derivation.Dater
+}
+
+// peeker is implemented by readers that can look ahead without
+// consuming, such as bufio.Reader and derivation.QB2Reader
+type peeker interface {
+	io.Reader
+	Peek(n int) ([]byte, error)
+}
+
 func ParseAttachment(rd io.Reader) (*Attachment, error) {
-	buf := bufio.NewReader(rd)
+	// only wrap the reader if we have to, so we do not consume
+	// any more of the underlying stream than the attachment itself
+	buf, ok := rd.(peeker)
+	if !ok {
+		buf = bufio.NewReader(rd)
+	}
 
-	f, err := buf.Peek(5)
+	f, err := buf.Peek(4)
 	if err != nil {
 		return nil, errors.Wrap(err, "error peeking")
 	}
@@ -99,6 +119,16 @@ func ParseAttached(c derivation.CountCode, buf io.Reader) (*Attachment, error) {
 			Code:                 derivation.TransferableRctCountCode,
 			TransferableReceipts: rcpts,
 		}, nil
+	case derivation.FirstSeenReplayCountCode:
+		fsrs, err := ParseAttachedFirstSeenReplays(buf)
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading first seen replay couples")
+		}
+
+		return &Attachment{
+			Code:             derivation.FirstSeenReplayCountCode,
+			FirstSeenReplays: fsrs,
+		}, nil
 	}
 
 	return nil, errors.New("not implemented")
@@ -0,0 +1,154 @@
+package event
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+
+	"github.com/pkg/errors"
+	"github.com/ugorji/go/codec"
+)
+
+var (
+	cborHandle    = &codec.CborHandle{}
+	msgpackHandle = &codec.MsgpackHandle{WriteExt: true}
+)
+
+func init() {
+	mapType := reflect.TypeOf(map[string]interface{}(nil))
+
+	cborHandle.MapType = mapType
+
+	msgpackHandle.MapType = mapType
+	msgpackHandle.RawToString = true
+}
+
+// orderedMap is a flattened list of key/value pairs that is encoded
+// as a map by the binary codecs. This allows us to keep the field
+// order of an event identical across all serialization formats,
+// which is required for digests and signatures to match those
+// created by other KERI implementations
+type orderedMap []interface{}
+
+// MapBySlice tells the codec to encode the slice as a map
+func (orderedMap) MapBySlice() {}
+
+// marshalBinary serializes the event using the provided codec handle.
+// The JSON serialization of the event is used as the source of truth
+// for which fields are included, and in which order
+func marshalBinary(e *Event, h codec.Handle) ([]byte, error) {
+	j, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(j))
+	dec.UseNumber()
+
+	fields, err := orderedValue(dec)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to order event fields")
+	}
+
+	var out []byte
+	err = codec.NewEncoderBytes(&out, h).Encode(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// unmarshalBinary deserializes the provided data using the codec handle
+func unmarshalBinary(data []byte, h codec.Handle) (*Event, error) {
+	var fields interface{}
+	err := codec.NewDecoderBytes(data, h).Decode(&fields)
+	if err != nil {
+		return nil, err
+	}
+
+	// the JSON unmarshalers already understand all of the
+	// variations of thresholds, seals and configuration
+	j, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	evt := &Event{}
+	err = json.Unmarshal(j, evt)
+	if err != nil {
+		return nil, err
+	}
+
+	return evt, nil
+}
+
+// orderedValue reads the next JSON value from the decoder, converting
+// any objects into ordered maps
+func orderedValue(dec *json.Decoder) (interface{}, error) {
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := t.(type) {
+	case json.Delim:
+		switch v {
+		case '{':
+			m := orderedMap{}
+			for dec.More() {
+				k, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+
+				val, err := orderedValue(dec)
+				if err != nil {
+					return nil, err
+				}
+
+				m = append(m, k, val)
+			}
+
+			// consume the closing delimiter
+			_, err = dec.Token()
+			return m, err
+		case '[':
+			l := []interface{}{}
+			for dec.More() {
+				val, err := orderedValue(dec)
+				if err != nil {
+					return nil, err
+				}
+
+				l = append(l, val)
+			}
+
+			_, err = dec.Token()
+			return l, err
+		}
+
+		return nil, errors.New("unexpected delimiter")
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+
+		return v.Float64()
+	}
+
+	return t, nil
+}
+
+// Sniff returns the serialization format of the raw event bytes based
+// on the version string, which must be within the first few bytes
+func Sniff(data []byte) (FORMAT, error) {
+	// the version string is the first field of the event, but in the binary
+	// formats it is preceded by the map header and the field label
+	idx := bytes.Index(data, []byte("KERI"))
+	if idx == -1 || idx > 12 || len(data) < idx+9 {
+		return -1, errors.New("unable to locate version string")
+	}
+
+	return FormatFromVersion(string(data[idx:]))
+}
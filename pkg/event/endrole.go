@@ -0,0 +1,76 @@
+package event
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// EndRoleRoute is the route of rpy messages that authorize an
+// endpoint to serve an identifier in a role
+const EndRoleRoute = "/end/role"
+
+// EndRole authorizes the endpoint URL to serve the controller identifier
+// in the role. The EID is the prefix of the identifier running the
+// endpoint, if it is not the controller itself.
+type EndRole struct {
+	Controller string `json:"cid"`
+	Role       string `json:"role"`
+	EID        string `json:"eid,omitempty"`
+	URL        string `json:"url"`
+}
+
+// NewEndRoleReply returns an rpy event carrying the endpoint authorization,
+// ready to be signed by the controller with the keys of the sealed
+// establishment event. The signed datetime orders the authorizations
+// given for the same role and EID.
+func NewEndRoleReply(end *EndRole, signer *Seal, format FORMAT) (*Event, error) {
+	if end == nil || end.Controller == "" || end.Role == "" || end.URL == "" {
+		return nil, errors.New("endpoint controller, role and url required")
+	}
+
+	if signer == nil || signer.Prefix != end.Controller {
+		return nil, errors.New("endpoint authorization must be signed by its controller")
+	}
+
+	pl, err := json.Marshal(end)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to encode endpoint authorization")
+	}
+
+	rpy := &Event{
+		Prefix:    end.Controller,
+		EventType: RPY.String(),
+		Datetime:  time.Now().UTC().Format(time.RFC3339Nano),
+		Route:     EndRoleRoute,
+		Payload:   pl,
+		Seals:     SealArray{signer},
+	}
+
+	err = resize(rpy, format)
+	if err != nil {
+		return nil, err
+	}
+
+	return rpy, nil
+}
+
+// ParseEndRole returns the endpoint authorization carried by the rpy event
+func ParseEndRole(rpy *Event) (*EndRole, error) {
+	if rpy.ILK() != RPY || rpy.Route != EndRoleRoute {
+		return nil, errors.New("not an endpoint authorization")
+	}
+
+	end := &EndRole{}
+	err := json.Unmarshal(rpy.Payload, end)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decode endpoint authorization")
+	}
+
+	if end.Controller != rpy.Prefix || end.Role == "" || end.URL == "" {
+		return nil, errors.New("invalid endpoint authorization")
+	}
+
+	return end, nil
+}
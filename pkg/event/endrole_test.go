@@ -0,0 +1,50 @@
+package event
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEndRoleReply(t *testing.T) {
+	signer, err := NewEventSeal("Edig", "Epre", "0")
+	assert.NoError(t, err)
+
+	end := &EndRole{Controller: "Epre", Role: "witness", EID: "Bwit", URL: "http://127.0.0.1:5642"}
+
+	_, err = NewEndRoleReply(&EndRole{Controller: "Epre", Role: "witness"}, signer, JSON)
+	assert.Error(t, err)
+
+	_, err = NewEndRoleReply(&EndRole{Controller: "Eother", Role: "witness", URL: "http://127.0.0.1:5642"}, signer, JSON)
+	assert.Error(t, err)
+
+	for _, f := range []FORMAT{JSON, CBOR, MSGPK} {
+		rpy, err := NewEndRoleReply(end, signer, f)
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		ser, err := rpy.Serialize()
+		assert.NoError(t, err)
+
+		size, err := SizeFromVersion(rpy.Version)
+		assert.NoError(t, err)
+		assert.Equal(t, len(ser), size)
+
+		evt, err := Deserialize(ser, f)
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		assert.Equal(t, RPY, evt.ILK())
+		assert.Equal(t, EndRoleRoute, evt.Route)
+		assert.NotEmpty(t, evt.Datetime)
+
+		parsed, err := ParseEndRole(evt)
+		assert.NoError(t, err)
+		assert.Equal(t, end, parsed)
+	}
+
+	_, err = ParseEndRole(&Event{EventType: RPY.String(), Route: LogsRoute})
+	assert.Error(t, err)
+}
@@ -26,6 +26,10 @@ const (
 	VRC
 	DRT
 	KST
+	KSN
+	QRY
+	RPY
+	EXN
 )
 
 var (
@@ -38,6 +42,10 @@ var (
 		"vrc": VRC,
 		"drt": DRT,
 		"kst": KST,
+		"ksn": KSN,
+		"qry": QRY,
+		"rpy": RPY,
+		"exn": EXN,
 	}
 
 	ilkString = map[ILK]string{
@@ -49,6 +57,10 @@ var (
 		VRC: "vrc",
 		DRT: "drt",
 		KST: "kst",
+		KSN: "ksn",
+		QRY: "qry",
+		RPY: "rpy",
+		EXN: "exn",
 	}
 
 	serFields = map[ILK][]string{
@@ -90,13 +102,14 @@ var (
 	formatString = map[FORMAT]string{
 		JSON:  "JSON",
 		CBOR:  "CBOR",
-		MSGPK: "MSGPK",
+		MSGPK: "MGPK",
 		EDS:   "ExtractedDataSet",
 	}
 
 	formatValue = map[string]FORMAT{
 		"JSON":  JSON,
 		"CBOR":  CBOR,
+		"MGPK":  MSGPK,
 		"MSGPK": MSGPK,
 	}
 )
@@ -120,6 +133,10 @@ type Event struct {
 	DelegatorSeal     *Seal          `json:"da,omitempty"`
 	LastEvent         *Seal          `json:"e,omitempty"`
 	LastEstablishment *Seal          `json:"ee,omitempty"`
+	Datetime          string         `json:"dt,omitempty"`
+	Route             string         `json:"r,omitempty"`
+	Query             *Query         `json:"q,omitempty"`
+	Payload           RawPayload     `json:"pl,omitempty"`
 	_dig              string
 }
 
@@ -132,6 +149,28 @@ func (e *Event) IsEstablishment() bool {
 	return estIlks[e.ILK()]
 }
 
+// HasTrait returns true if the trait is set in the configuration of the event
+func (e *Event) HasTrait(t prefix.Trait) bool {
+	for _, c := range e.Config {
+		if c == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasWitness returns true if the prefix is one of the witnesses of the event
+func (e *Event) HasWitness(pre string) bool {
+	for _, w := range e.Witnesses {
+		if w == pre {
+			return true
+		}
+	}
+
+	return false
+}
+
 // MarshalJSON interface implementation.
 // not all events requrie all fields, and some event types
 // requrie empty arrays in place of null values. This allows
@@ -178,7 +217,7 @@ func (e *Event) MarshalJSON() ([]byte, error) {
 			Seals:      e.Seals,
 		})
 
-	case ICP.String():
+	case ICP.String(), DIP.String():
 		// Inception events need cnfg
 		if e.Config == nil {
 			e.Config = []prefix.Trait{}
@@ -271,6 +310,9 @@ func (e *Event) NextDigest(code derivation.Code) (string, error) {
 	return NextDigest(e.SigThreshold.String(), code, kps...)
 }
 
+// GetDigest returns the digest of the event. Events received with raw bytes
+// (see WithRaw) are digested as received, otherwise the serialized event is
+// digested.
 func (e *Event) GetDigest() (string, error) {
 	if e._dig == "" {
 		ser, err := e.Serialize()
@@ -295,12 +337,12 @@ func (e *Event) GetDigest() (string, error) {
 	return e._dig, nil
 }
 
-// DefaultVersionString returns a weGetDigestll formated version string
+// DefaultVersionString returns a well formated version string
 // for the provided format, with 0s for size
 func DefaultVersionString(in FORMAT) string {
 	switch in {
-	case JSON:
-		return fmt.Sprintf("KERI%sJSON000000_", version.Code())
+	case JSON, CBOR, MSGPK:
+		return fmt.Sprintf("KERI%s%s000000_", version.Code(), formatString[in])
 	}
 	return ""
 }
@@ -314,18 +356,37 @@ func VersionString(in FORMAT, keriVer string, size int) string {
 // FormatFromVersion returns the message format parsed
 // from the given version string
 func FormatFromVersion(vs string) (FORMAT, error) {
+	if len(vs) < 9 {
+		return -1, errors.New("version string too short to determine format")
+	}
+
 	switch vs[6:9] {
 	case "JSO":
 		return JSON, nil
 	case "CBO":
 		return CBOR, nil
-	case "MSG":
+	case "MGP", "MSG":
 		return MSGPK, nil
 	}
 
 	return -1, errors.New("unable to determin format from version string")
 }
 
+// SizeFromVersion returns the message size parsed
+// from the given version string
+func SizeFromVersion(vs string) (int, error) {
+	if len(vs) < 17 || vs[16] != '_' {
+		return -1, errors.New("version string too short to determine size")
+	}
+
+	size, err := strconv.ParseInt(vs[10:16], 16, 64)
+	if err != nil {
+		return -1, errors.New("invalid version string size")
+	}
+
+	return int(size), nil
+}
+
 func Format(f string) (FORMAT, error) {
 	out, ok := formatValue[f]
 	if !ok {
@@ -340,12 +401,12 @@ func Serialize(e *Event, to FORMAT) ([]byte, error) {
 	switch to {
 	case JSON:
 		return json.Marshal(e)
+	case CBOR:
+		return marshalBinary(e, cborHandle)
+	case MSGPK:
+		return marshalBinary(e, msgpackHandle)
 	case EDS:
 		return e.extractDataSet()
-	case CBOR, MSGPK:
-		// unimplemented
-		// TODO: implement!
-		return nil, errors.New("unimplemented")
 	}
 
 	return nil, errors.New("unrecognized format")
@@ -360,10 +421,18 @@ func Deserialize(data []byte, from FORMAT) (*Event, error) {
 			return nil, errors.Wrap(err, "unable to unmarshal event from JSON")
 		}
 		return evt, nil
-	case CBOR, MSGPK:
-		// unimplemented
-		// TODO: implement!
-		return nil, errors.New("unimplemented")
+	case CBOR:
+		evt, err := unmarshalBinary(data, cborHandle)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to unmarshal event from CBOR")
+		}
+		return evt, nil
+	case MSGPK:
+		evt, err := unmarshalBinary(data, msgpackHandle)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to unmarshal event from MessagePack")
+		}
+		return evt, nil
 	}
 
 	return nil, errors.New("unrecognized format")
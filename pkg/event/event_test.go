@@ -40,6 +40,10 @@ func TestFormatFromVersion(t *testing.T) {
 	assert.Nil(err)
 	assert.Equal(MSGPK, f)
 
+	f, err = FormatFromVersion("KERI10MGPK")
+	assert.Nil(err)
+	assert.Equal(MSGPK, f)
+
 	f, err = FormatFromVersion("KERI10PROTO")
 	assert.NotNil(err)
 	assert.Equal(FORMAT(-1), f)
@@ -55,7 +59,7 @@ func TestVersionString(t *testing.T) {
 	assert.Equal("KERI10CBOR00007b_", vs)
 
 	vs = VersionString(MSGPK, "10", 123)
-	assert.Equal("KERI10MSGPK00007b_", vs)
+	assert.Equal("KERI10MGPK00007b_", vs)
 }
 
 func TestSerialize(t *testing.T) {
@@ -87,6 +91,121 @@ func TestSerialize(t *testing.T) {
 
 }
 
+func TestSerializeCBOR(t *testing.T) {
+	assert := assert.New(t)
+
+	e := &Event{
+		Version:          "KERI10CBOR0000c0_",
+		Prefix:           "ETT9n-TCGn8XfkGkcNeNmZgdZSwHPLyDsojFXotBXdSo",
+		EventType:        "icp",
+		Sequence:         "0",
+		SigThreshold:     &SigThreshold{conditions: [][]*big.Rat{{big.NewRat(1, 1)}}},
+		WitnessThreshold: "0",
+		Keys:             []string{"DSuhyBcPZEZLK-fcw5tzHn2N46wRCG_ZOoeKtWTOunRA"},
+		Next:             "EGAPkzNZMtX-QiVgbRbyAIZGoXvbGv9IPb0foWTZvI_4",
+		Config:           []prefix.Trait{},
+		Witnesses:        []string{},
+	}
+
+	cborSer, err := e.Serialize()
+	assert.NoError(err)
+	assert.Len(cborSer, 0xc0)
+
+	// map(10), "v", text(17)
+	assert.Equal([]byte{0xaa, 0x61, 'v', 0x71}, cborSer[:4])
+	assert.Equal("KERI10CBOR0000c0_", string(cborSer[4:21]))
+
+	// fields must be in the same order as the JSON serialization
+	labels := []string{"v", "i", "s", "t", "kt", "k", "n", "wt", "w", "c"}
+	idx := 0
+	for _, l := range labels {
+		next := bytes.Index(cborSer[idx:], append([]byte{0x60 + byte(len(l))}, l...))
+		if !assert.NotEqual(-1, next, "missing field %s", l) {
+			return
+		}
+		idx += next
+	}
+
+	f, err := Sniff(cborSer)
+	assert.NoError(err)
+	assert.Equal(CBOR, f)
+
+	evt, err := Deserialize(cborSer, CBOR)
+	assert.NoError(err)
+	assert.Equal(e.Prefix, evt.Prefix)
+	assert.Equal(e.Keys, evt.Keys)
+	assert.Equal(e.Next, evt.Next)
+	assert.Equal("1", evt.SigThreshold.String())
+
+	reser, err := evt.Serialize()
+	assert.NoError(err)
+	assert.Equal(cborSer, reser)
+}
+
+func TestSerializeMsgPack(t *testing.T) {
+	assert := assert.New(t)
+
+	st, err := NewMultiWeighted([]string{"1/2", "1/2"}, []string{"1"})
+	assert.NoError(err)
+
+	seal, err := NewEventSeal("EGAPkzNZMtX-QiVgbRbyAIZGoXvbGv9IPb0foWTZvI_4", "ETT9n-TCGn8XfkGkcNeNmZgdZSwHPLyDsojFXotBXdSo", "1")
+	assert.NoError(err)
+
+	e := &Event{
+		Version:          DefaultVersionString(MSGPK),
+		Prefix:           "ETT9n-TCGn8XfkGkcNeNmZgdZSwHPLyDsojFXotBXdSo",
+		EventType:        "rot",
+		Sequence:         "2",
+		PriorEventDigest: "EGAPkzNZMtX-QiVgbRbyAIZGoXvbGv9IPb0foWTZvI_4",
+		SigThreshold:     st,
+		WitnessThreshold: "0",
+		Keys:             []string{"DSuhyBcPZEZLK-fcw5tzHn2N46wRCG_ZOoeKtWTOunRA", "DSuhyBcPZEZLK-fcw5tzHn2N46wRCG_ZOoeKtWTOunRA"},
+		Next:             "EGAPkzNZMtX-QiVgbRbyAIZGoXvbGv9IPb0foWTZvI_4",
+		Config:           []prefix.Trait{prefix.EstablishmentOnly, prefix.DoNotDelegate},
+		Seals:            SealArray{seal, seal},
+	}
+
+	ser, err := e.Serialize()
+	assert.NoError(err)
+	e.Version = VersionString(MSGPK, "10", len(ser))
+
+	ser, err = e.Serialize()
+	assert.NoError(err)
+
+	// fixmap, "v", fixstr(17)
+	assert.Equal([]byte{0x80, 'v', 0xb1}, []byte{ser[0] & 0xf0, ser[2], ser[3]})
+	assert.Equal(e.Version, string(ser[4:21]))
+
+	// fields must be in the same order as the JSON serialization
+	labels := []string{"v", "i", "s", "t", "p", "kt", "k", "n", "wt", "c", "wr", "wa", "a"}
+	idx := 0
+	for _, l := range labels {
+		next := bytes.Index(ser[idx:], append([]byte{0xa0 + byte(len(l))}, l...))
+		if !assert.NotEqual(-1, next, "missing field %s", l) {
+			return
+		}
+		idx += next
+	}
+
+	f, err := Sniff(ser)
+	assert.NoError(err)
+	assert.Equal(MSGPK, f)
+
+	evt, err := Deserialize(ser, MSGPK)
+	assert.NoError(err)
+	assert.Equal(e.Version, evt.Version)
+	assert.Equal(st.String(), evt.SigThreshold.String())
+	assert.Equal(e.Config, evt.Config)
+	assert.Len(evt.Seals, 2)
+	assert.Equal(seal.Digest, evt.Seals[1].Digest)
+	assert.Equal(seal.Prefix, evt.Seals[1].Prefix)
+	assert.Equal(seal.Sequence, evt.Seals[1].Sequence)
+
+	reser, err := evt.Serialize()
+	assert.NoError(err)
+	assert.Equal(ser, reser)
+}
+
 func TestDigest(t *testing.T) {
 	assert := assert.New(t)
 
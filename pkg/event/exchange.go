@@ -0,0 +1,45 @@
+package event
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RawPayload holds the JSON encoded payload of an exn message
+type RawPayload = json.RawMessage
+
+// NewExchange returns an exn event that carries the payload to the route,
+// ready to be signed by the sender with the keys of the sealed establishment
+// event. Senders with non-transferable identifiers seal only their prefix.
+func NewExchange(route string, payload interface{}, sender *Seal, format FORMAT) (*Event, error) {
+	if route == "" {
+		return nil, errors.New("exchange route required")
+	}
+
+	if sender == nil || sender.Prefix == "" {
+		return nil, errors.New("sender seal required")
+	}
+
+	pl, err := json.Marshal(payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to encode exchange payload")
+	}
+
+	exn := &Event{
+		Prefix:    sender.Prefix,
+		EventType: EXN.String(),
+		Datetime:  time.Now().UTC().Format(time.RFC3339Nano),
+		Route:     route,
+		Payload:   pl,
+		Seals:     SealArray{sender},
+	}
+
+	err = resize(exn, format)
+	if err != nil {
+		return nil, err
+	}
+
+	return exn, nil
+}
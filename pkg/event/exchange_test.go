@@ -0,0 +1,49 @@
+package event
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExchange(t *testing.T) {
+	sender, err := NewEventSeal("Edig", "Epre", "0")
+	assert.NoError(t, err)
+
+	_, err = NewExchange("", nil, sender, JSON)
+	assert.Error(t, err)
+
+	_, err = NewExchange("/greet", nil, nil, JSON)
+	assert.Error(t, err)
+
+	_, err = NewExchange("/greet", func() {}, sender, JSON)
+	assert.Error(t, err)
+
+	for _, f := range []FORMAT{JSON, CBOR, MSGPK} {
+		exn, err := NewExchange("/greet", map[string]interface{}{"msg": "hello", "n": 1}, sender, f)
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		ser, err := exn.Serialize()
+		assert.NoError(t, err)
+
+		size, err := SizeFromVersion(exn.Version)
+		assert.NoError(t, err)
+		assert.Equal(t, len(ser), size)
+
+		evt, err := Deserialize(ser, f)
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		assert.Equal(t, EXN, evt.ILK())
+		assert.Equal(t, "Epre", evt.Prefix)
+		assert.Equal(t, "/greet", evt.Route)
+		assert.NotEmpty(t, evt.Datetime)
+		assert.JSONEq(t, `{"msg":"hello","n":1}`, string(evt.Payload))
+		if assert.Len(t, evt.Seals, 1) {
+			assert.Equal(t, "Edig", evt.Seals[0].Digest)
+		}
+	}
+}
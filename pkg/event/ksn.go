@@ -0,0 +1,73 @@
+package event
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/decentralized-identity/kerigo/pkg/version"
+)
+
+// KeyStateNoticeRequest returns an unsigned ksn message that asks
+// the recipient for its key state notice for the prefix
+func KeyStateNoticeRequest(pre string) (*Message, error) {
+	req := &Event{
+		Version:   VersionString(JSON, version.Code(), 0),
+		Prefix:    pre,
+		EventType: KSN.String(),
+	}
+
+	err := resize(req, JSON)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{Event: req}, nil
+}
+
+// IsKeyStateNoticeRequest returns true if the message is a request
+// for a key state notice rather than a notice
+func IsKeyStateNoticeRequest(m *Message) bool {
+	return m.Event.ILK() == KSN && len(m.Signatures) == 0 && m.Event.LastEvent == nil
+}
+
+// KeyStateNotice returns a copy of the ksn event with the seal of the
+// establishment event of its signer, ready to be signed. Signers with
+// non-transferable identifiers seal only their prefix.
+func KeyStateNotice(ksn *Event, signer *Seal) (*Event, error) {
+	if ksn.ILK() != KSN {
+		return nil, errors.New("not a key state notice")
+	}
+
+	if signer == nil || signer.Prefix == "" {
+		return nil, errors.New("signer seal required")
+	}
+
+	format, err := FormatFromVersion(ksn.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &Event{}
+	*out = *ksn
+	out._dig = ""
+	out.Seals = SealArray{signer}
+
+	err = resize(out, format)
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// resize sets the size of the event in its version string
+func resize(e *Event, format FORMAT) error {
+	e.Version = VersionString(format, version.Code(), 0)
+
+	ser, err := Serialize(e, format)
+	if err != nil {
+		return errors.Wrap(err, "unable to serialize event")
+	}
+
+	e.Version = VersionString(format, version.Code(), len(ser))
+	return nil
+}
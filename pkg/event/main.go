@@ -27,7 +27,7 @@ func WithWitnesses(keys ...prefix.Prefix) EventOption {
 	return func(e *Event) error {
 		for i := 0; i < len(keys); i++ {
 			k := keys[i].String()
-			e.Witnesses = append(e.Keys, k)
+			e.Witnesses = append(e.Witnesses, k)
 		}
 		return nil
 	}
@@ -64,6 +64,48 @@ func WithThreshold(threshold int64) EventOption {
 	}
 }
 
+// WithSigThreshold sets the key threshold to an existing signing threshold
+func WithSigThreshold(st *SigThreshold) EventOption {
+	return func(e *Event) error {
+		if st == nil {
+			return errors.New("signing threshold required")
+		}
+		e.SigThreshold = st
+		return nil
+	}
+}
+
+// WithDelegator sets the prefix of the identifier delegating this event,
+// which must approve it by anchoring a seal of the event in its own log
+func WithDelegator(pre string) EventOption {
+	return func(e *Event) error {
+		if pre == "" {
+			return errors.New("delegator prefix required")
+		}
+
+		e.DelegatorSeal = &Seal{Type: EventSeal, Prefix: pre}
+		return nil
+	}
+}
+
+// WithConfig sets the configuration traits of the identifier, such as
+// establishment only or do not delegate, which hold for its lifetime
+func WithConfig(traits ...prefix.Trait) EventOption {
+	return func(e *Event) error {
+		for _, t := range traits {
+			if t.String() == "" {
+				return fmt.Errorf("unknown trait %d", t)
+			}
+
+			if !e.HasTrait(t) {
+				e.Config = append(e.Config, t)
+			}
+		}
+
+		return nil
+	}
+}
+
 // WithWeightedTheshold sets a weighted signing threshold using provided
 // string int or fraction values. The total for all conditions must be
 // >= 1 otherwise the threshold can not be met. The order in which
@@ -235,12 +277,17 @@ func NewRotationEvent(opts ...EventOption) (*Event, error) {
 		rot.Version = DefaultVersionString(JSON)
 	}
 
-	eventBytes, err := Serialize(rot, JSON)
+	format, err := FormatFromVersion(rot.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	eventBytes, err := Serialize(rot, format)
 	if err != nil {
 		return nil, err
 	}
 
-	rot.Version = VersionString(JSON, version.Code(), len(eventBytes))
+	rot.Version = VersionString(format, version.Code(), len(eventBytes))
 
 	return rot, nil
 }
@@ -264,13 +311,21 @@ func NewInteractionEvent(opts ...EventOption) (*Event, error) {
 	}
 
 	// Serialize with defaults to get correct length for version string
-	rot.Version = DefaultVersionString(JSON)
-	eventBytes, err := Serialize(rot, JSON)
+	if rot.Version == "" {
+		rot.Version = DefaultVersionString(JSON)
+	}
+
+	format, err := FormatFromVersion(rot.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	eventBytes, err := Serialize(rot, format)
 	if err != nil {
 		return nil, err
 	}
 
-	rot.Version = VersionString(JSON, version.Code(), len(eventBytes))
+	rot.Version = VersionString(format, version.Code(), len(eventBytes))
 
 	return rot, nil
 }
@@ -34,6 +34,30 @@ func TestNewInceptionEvent(t *testing.T) {
 
 }
 
+func TestWithConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	icp, err := NewInceptionEvent(WithConfig(prefix.EstablishmentOnly, prefix.DoNotDelegate, prefix.EstablishmentOnly))
+	assert.Nil(err)
+	assert.Equal([]prefix.Trait{prefix.EstablishmentOnly, prefix.DoNotDelegate}, icp.Config)
+	assert.True(icp.HasTrait(prefix.DoNotDelegate))
+
+	_, err = NewInceptionEvent(WithConfig(prefix.Trait(42)))
+	assert.NotNil(err)
+}
+
+func TestHasWitness(t *testing.T) {
+	assert := assert.New(t)
+
+	wit, _ := derivation.FromPrefix("BrHLayDN-mXKv62DAjFLX1_Y5yEUe0vA9YPe_ihiKYHE")
+	other, _ := derivation.FromPrefix("BujP_71bmWFVcvFmkE9uS8BTZ54GIstZ20nj_UloF8Rk")
+
+	icp, err := NewInceptionEvent(WithWitnesses(prefix.New(wit)))
+	assert.Nil(err)
+	assert.True(icp.HasWitness(wit.AsPrefix()))
+	assert.False(icp.HasWitness(other.AsPrefix()))
+}
+
 func TestNext(t *testing.T) {
 	assert := assert.New(t)
 
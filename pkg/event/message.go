@@ -1,19 +1,24 @@
 package event
 
 import (
+	"fmt"
 	"strconv"
 
 	"github.com/decentralized-identity/kerigo/pkg/derivation"
 )
 
 // an event message holds the deserialized event
-// along with the provided signature
+// along with the provided signature and, when it was
+// received from somewhere, the raw serialized event
 type Message struct {
 	Event                   *Event
 	Signatures              []derivation.Derivation
 	TransferableReceipts    []*Receipt
 	NonTransferableReceipts []*Receipt
 	WitnessReceipts         []*Receipt
+	FirstSeenReplays        []*FirstSeenReplay
+
+	raw []byte
 }
 
 type MessageOption func(*Message) error
@@ -31,6 +36,75 @@ func NewMessage(evt *Event, opts ...MessageOption) (*Message, error) {
 	return msg, nil
 }
 
+// WithRaw sets the exact serialized event bytes the message was received with.
+// The event is identified by the digest of those bytes rather than of its
+// re-serialization, which may differ if the sender orders fields differently.
+// The message gets its own copy of the event carrying that digest, as the
+// event it was created with may be shared, for example by the database.
+func WithRaw(raw []byte) MessageOption {
+	return func(msg *Message) error {
+		msg.raw = raw
+
+		if msg.Event != nil {
+			dig, err := DigestString(raw, derivation.Blake3256)
+			if err != nil {
+				return err
+			}
+
+			evt := *msg.Event
+			evt._dig = dig
+			msg.Event = &evt
+		}
+
+		return nil
+	}
+}
+
+// Raw returns the serialized event for the message. If the message
+// was received with raw bytes they are returned untouched, so signatures
+// are always verified against what was actually signed. Otherwise the
+// event is serialized using the format named in its version string
+func (m *Message) Raw() ([]byte, error) {
+	if m.raw != nil {
+		return m.raw, nil
+	}
+
+	return m.Event.Serialize()
+}
+
+// Digest returns the digest of the raw event for the message
+func (m *Message) Digest() (string, error) {
+	if m.raw == nil {
+		return m.Event.GetDigest()
+	}
+
+	return DigestString(m.raw, derivation.Blake3256)
+}
+
+// VerifySize confirms the size in the event version string
+// matches the size of the serialized event
+func (m *Message) VerifySize() error {
+	raw, err := m.Raw()
+	if err != nil {
+		return err
+	}
+
+	return checkSize(m.Event.Version, raw)
+}
+
+func checkSize(vs string, raw []byte) error {
+	size, err := SizeFromVersion(vs)
+	if err != nil {
+		return err
+	}
+
+	if size != len(raw) {
+		return fmt.Errorf("version string size %d does not match event size %d", size, len(raw))
+	}
+
+	return nil
+}
+
 func WithSignatures(sigs []derivation.Derivation) MessageOption {
 	return func(msg *Message) error {
 		msg.Signatures = append(msg.Signatures, sigs...)
@@ -94,3 +168,10 @@ func WithWitnessReceipts(couples []*Couplet) MessageOption {
 		return nil
 	}
 }
+
+func WithFirstSeenReplays(fsrs []*FirstSeenReplay) MessageOption {
+	return func(msg *Message) error {
+		msg.FirstSeenReplays = append(msg.FirstSeenReplays, fsrs...)
+		return nil
+	}
+}
@@ -0,0 +1,114 @@
+package event
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// LogsRoute queries the key event log of an identifier,
+	// starting at the sequence number in the query
+	LogsRoute = "logs"
+
+	// KeyStateRoute queries the key state notice of an identifier
+	KeyStateRoute = "ksn"
+)
+
+// Query holds the parameters of a qry message
+type Query struct {
+	Prefix   string `json:"i"`
+	Sequence string `json:"s,omitempty"`
+}
+
+// SequenceInt returns the sequence number the query starts
+// at, or 0 if the query does not have one
+func (q *Query) SequenceInt() int {
+	if q.Sequence == "" {
+		return 0
+	}
+
+	sn, err := strconv.ParseInt(q.Sequence, 16, 64)
+	if err != nil {
+		return -1
+	}
+
+	return int(sn)
+}
+
+// NewQuery returns a qry event for the route, ready to be signed by
+// the identifier whose establishment event is sealed by the signer seal
+func NewQuery(route string, q *Query, signer *Seal, format FORMAT) (*Event, error) {
+	switch route {
+	case LogsRoute, KeyStateRoute:
+	default:
+		return nil, errors.Errorf("unknown query route %s", route)
+	}
+
+	if q == nil || q.Prefix == "" {
+		return nil, errors.New("query prefix required")
+	}
+
+	if q.SequenceInt() < 0 {
+		return nil, errors.New("invalid query sequence number")
+	}
+
+	if signer == nil || signer.Prefix == "" {
+		return nil, errors.New("signer seal required")
+	}
+
+	qry := &Event{
+		EventType: QRY.String(),
+		Datetime:  time.Now().UTC().Format(time.RFC3339Nano),
+		Route:     route,
+		Query:     q,
+		Seals:     SealArray{signer},
+	}
+
+	err := resize(qry, format)
+	if err != nil {
+		return nil, err
+	}
+
+	return qry, nil
+}
+
+// NewReply returns an rpy event that marks the end of the messages sent
+// in reply to the query, ready to be signed by the identifier whose
+// establishment event is sealed by the signer seal
+func NewReply(qry *Event, signer *Seal) (*Event, error) {
+	if qry.ILK() != QRY {
+		return nil, errors.New("not a query")
+	}
+
+	if signer == nil || signer.Prefix == "" {
+		return nil, errors.New("signer seal required")
+	}
+
+	format, err := FormatFromVersion(qry.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	dig, err := qry.GetDigest()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to digest query")
+	}
+
+	rpy := &Event{
+		EventType:   RPY.String(),
+		EventDigest: dig,
+		Datetime:    time.Now().UTC().Format(time.RFC3339Nano),
+		Route:       qry.Route,
+		Query:       qry.Query,
+		Seals:       SealArray{signer},
+	}
+
+	err = resize(rpy, format)
+	if err != nil {
+		return nil, err
+	}
+
+	return rpy, nil
+}
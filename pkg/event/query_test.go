@@ -0,0 +1,67 @@
+package event
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuery(t *testing.T) {
+	signer, err := NewEventSeal("Edig", "Epre", "0")
+	assert.NoError(t, err)
+
+	_, err = NewQuery("unknown", &Query{Prefix: "Eother"}, signer, JSON)
+	assert.Error(t, err)
+
+	_, err = NewQuery(LogsRoute, &Query{}, signer, JSON)
+	assert.Error(t, err)
+
+	_, err = NewQuery(LogsRoute, &Query{Prefix: "Eother", Sequence: "x"}, signer, JSON)
+	assert.Error(t, err)
+
+	_, err = NewQuery(LogsRoute, &Query{Prefix: "Eother"}, nil, JSON)
+	assert.Error(t, err)
+
+	for _, f := range []FORMAT{JSON, CBOR, MSGPK} {
+		qry, err := NewQuery(LogsRoute, &Query{Prefix: "Eother", Sequence: "a"}, signer, f)
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		ser, err := qry.Serialize()
+		assert.NoError(t, err)
+
+		size, err := SizeFromVersion(qry.Version)
+		assert.NoError(t, err)
+		assert.Equal(t, len(ser), size)
+
+		evt, err := Deserialize(ser, f)
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		assert.Equal(t, QRY, evt.ILK())
+		assert.Equal(t, LogsRoute, evt.Route)
+		assert.NotEmpty(t, evt.Datetime)
+		if assert.NotNil(t, evt.Query) {
+			assert.Equal(t, "Eother", evt.Query.Prefix)
+			assert.Equal(t, 10, evt.Query.SequenceInt())
+		}
+
+		rpy, err := NewReply(evt, signer)
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		dig, err := qry.GetDigest()
+		assert.NoError(t, err)
+
+		assert.Equal(t, RPY, rpy.ILK())
+		assert.Equal(t, dig, rpy.EventDigest)
+		assert.Equal(t, LogsRoute, rpy.Route)
+		assert.Equal(t, qry.Query, rpy.Query)
+
+		_, err = NewReply(rpy, signer)
+		assert.Error(t, err)
+	}
+}
@@ -1,7 +1,6 @@
 package event
 
 import (
-	"bytes"
 	"strconv"
 	"strings"
 
@@ -34,6 +33,12 @@ func NewReceipt(evt *Event, opts ...ReceiptOpt) (*Receipt, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to get digest to create event")
 	}
+
+	// receipts attached to a receipt message are for the event it references
+	if ilk := evt.ILK(); ilk == RCT || ilk == VRC {
+		dig = evt.EventDigest
+	}
+
 	r := &Receipt{
 		RctType:  RCT,
 		Prefix:   evt.Prefix,
@@ -124,20 +129,15 @@ func (r *Receipt) Text() []byte {
 	return r.txt
 }
 
+// Bin returns the receipt couplet or quadlet in the binary (qb2) domain
 func (r *Receipt) Bin() []byte {
 	if r.bin == nil {
-		pre, _ := derivation.FromPrefix(r.EstPrefix)
-
-		switch r.RctType {
-		case VRC:
-			dig, _ := derivation.FromPrefix(r.EstDigest)
-			o := derivation.NewOrdinal(uint16(r.EstSequence))
-			quadlet := bytes.Join([][]byte{pre.Raw, o.Base64(), dig.Raw, r.Signature.Raw}, []byte{})
-			r.bin = quadlet
-		case RCT:
-			couplet := bytes.Join([][]byte{pre.Raw, r.Signature.Raw}, []byte{})
-			r.bin = couplet
+		bin, err := derivation.ToQB2(r.Text())
+		if err != nil {
+			return nil
 		}
+
+		r.bin = bin
 	}
 
 	return r.bin
@@ -154,7 +154,7 @@ func (r *Receipt) Message() (*Message, error) {
 
 	switch r.RctType {
 	case VRC:
-		s, _ := NewEventSeal(r.EstDigest, r.EstPrefix, strconv.Itoa(r.EstSequence))
+		s, _ := NewEventSeal(r.EstDigest, r.EstPrefix, strconv.FormatInt(int64(r.EstSequence), 16))
 		opts = append(opts, WithSeals([]*Seal{s}))
 	case RCT:
 		s, _ := NewSeal(EventSeal, WithSealPrefix(r.EstPrefix))
@@ -185,3 +185,58 @@ func (r *Receipt) Message() (*Message, error) {
 
 	return msg, nil
 }
+
+// WitnessReceiptMessage returns an rct message for the receipted event
+// with the provided receipts attached as witness signature couplets
+func WitnessReceiptMessage(rcpts ...*Receipt) (*Message, error) {
+	msg, err := receiptMessage(rcpts)
+	if err != nil {
+		return nil, err
+	}
+
+	msg.WitnessReceipts = rcpts
+	return msg, nil
+}
+
+// NonTransferableReceiptMessage returns an rct message for the receipted event
+// with the provided receipts attached as non-transferable receipt couplets
+func NonTransferableReceiptMessage(rcpts ...*Receipt) (*Message, error) {
+	msg, err := receiptMessage(rcpts)
+	if err != nil {
+		return nil, err
+	}
+
+	msg.NonTransferableReceipts = rcpts
+	return msg, nil
+}
+
+func receiptMessage(rcpts []*Receipt) (*Message, error) {
+	if len(rcpts) == 0 {
+		return nil, errors.New("at least one receipt required")
+	}
+
+	r := rcpts[0]
+	for _, rcpt := range rcpts {
+		if rcpt.RctType != RCT || rcpt.Prefix != r.Prefix || rcpt.Digest != r.Digest {
+			return nil, errors.New("receipts must be non-transferable receipts of the same event")
+		}
+	}
+
+	// rct messages only reference the receipted event
+	receipt := &Event{
+		Version:     VersionString(JSON, version.Code(), 0),
+		Prefix:      r.Prefix,
+		Sequence:    strconv.FormatInt(int64(r.Sequence), 16),
+		EventType:   RCT.String(),
+		EventDigest: r.Digest,
+	}
+
+	eventBytes, err := Serialize(receipt, JSON)
+	if err != nil {
+		return nil, errors.Wrap(err, "unexpected error serializing receipt")
+	}
+
+	receipt.Version = VersionString(JSON, version.Code(), len(eventBytes))
+
+	return &Message{Event: receipt}, nil
+}
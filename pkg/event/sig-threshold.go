@@ -175,6 +175,32 @@ func (s *SigThreshold) String() string {
 	return b.String()
 }
 
+// Validate checks that the threshold can be met by signatures from
+// the provided number of keys. Weighted thresholds must provide a
+// weight for every key.
+func (s *SigThreshold) Validate(keys int) error {
+	if !s.Weighted() {
+		required := 0
+		if len(s.conditions) == 1 && len(s.conditions[0]) == 1 {
+			required = int(s.conditions[0][0].Num().Int64())
+		}
+
+		if required < 1 || required > keys {
+			return fmt.Errorf("threshold %d not satisfiable with %d keys", required, keys)
+		}
+
+		return nil
+	}
+
+	for _, c := range s.conditions {
+		if len(c) != keys {
+			return fmt.Errorf("weighted threshold has %d weights for %d keys", len(c), keys)
+		}
+	}
+
+	return nil
+}
+
 // returns true if this is a weighted threshold - i.e. there
 // is one or more lists of weights
 func (s *SigThreshold) Weighted() bool {
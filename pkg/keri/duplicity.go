@@ -0,0 +1,55 @@
+package keri
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/decentralized-identity/kerigo/pkg/event"
+	klog "github.com/decentralized-identity/kerigo/pkg/log"
+)
+
+// DuplicityHandler is called when an identifier is found to have signed
+// an event that conflicts with one already accepted in its log
+type DuplicityHandler func(pre string, d *klog.Duplicity)
+
+// WithDuplicityHandler sets the handler called for each new duplicity detected
+func WithDuplicityHandler(h DuplicityHandler) Option {
+	return func(k *Keri) error {
+		if h == nil {
+			return errors.New("duplicity handler required")
+		}
+
+		k.dupHandler = h
+		return nil
+	}
+}
+
+// Duplicity returns the duplicity recorded for the identifier
+func (r *Keri) Duplicity(pre string) ([]*klog.Duplicity, error) {
+	return klog.New(pre, r.db).Duplicity()
+}
+
+// notifyDuplicity calls the duplicity handler with the
+// duplicity recorded for the event
+func (r *Keri) notifyDuplicity(kel *klog.Log, msg *event.Message) {
+	if r.dupHandler == nil {
+		return
+	}
+
+	dig, err := msg.Digest()
+	if err != nil {
+		return
+	}
+
+	dups, err := kel.Duplicity()
+	if err != nil {
+		return
+	}
+
+	for _, d := range dups {
+		dupDig, _ := d.Duplicitous.Digest()
+		if dupDig == dig {
+			r.dupHandler(msg.Event.Prefix, d)
+			return
+		}
+	}
+}
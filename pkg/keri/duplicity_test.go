@@ -0,0 +1,276 @@
+package keri
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/decentralized-identity/kerigo/pkg/db/mem"
+	"github.com/decentralized-identity/kerigo/pkg/derivation"
+	"github.com/decentralized-identity/kerigo/pkg/event"
+	klog "github.com/decentralized-identity/kerigo/pkg/log"
+	testkms "github.com/decentralized-identity/kerigo/pkg/test/kms"
+)
+
+func TestDuplicity(t *testing.T) {
+	secrets := []string{"ADW3o9m3udwEf0aoOdZLLJdf1aylokP0lwwI_M2J9h0s", "AagumsL8FeGES7tYcnr_5oN6qcwJzZfLKxoniKUpG4qc"}
+
+	db := mem.New()
+	good, err := New(testkms.GetKMS(t, secrets, db), db)
+	require.NoError(t, err)
+
+	db = mem.New()
+	bad, err := New(testkms.GetKMS(t, secrets, db), db)
+	require.NoError(t, err)
+
+	found := []*klog.Duplicity{}
+	db = mem.New()
+	bob, err := New(testkms.GetKMS(t, nil, db), db, WithDuplicityHandler(func(pre string, d *klog.Duplicity) {
+		assert.Equal(t, good.Prefix(), pre)
+		found = append(found, d)
+	}))
+	require.NoError(t, err)
+
+	icp, err := good.Inception()
+	require.NoError(t, err)
+
+	ixn, err := good.Interaction(event.SealArray{})
+	require.NoError(t, err)
+
+	_, err = bob.ProcessEvents(icp, ixn)
+	require.NoError(t, err)
+
+	seal, err := event.NewEventSeal("Edig", "Epre", "0")
+	require.NoError(t, err)
+
+	dup, err := bad.Interaction(event.SealArray{seal})
+	require.NoError(t, err)
+
+	raw, err := dup.Raw()
+	require.NoError(t, err)
+
+	kms := testkms.GetKMS(t, nil, mem.New())
+	nt, err := derivation.New(derivation.WithCode(derivation.Ed25519NT), derivation.WithRaw(kms.PublicKey()))
+	require.NoError(t, err)
+
+	sig, err := derivation.New(derivation.WithCode(derivation.Ed25519Sig), derivation.WithSigner(kms.Signer()))
+	require.NoError(t, err)
+	_, err = sig.Derive(raw)
+	require.NoError(t, err)
+
+	rcpt, err := event.NewReceipt(dup.Event, event.WithSignerPrefix(nt.AsPrefix()), event.WithSignature(sig))
+	require.NoError(t, err)
+	dup.NonTransferableReceipts = []*event.Receipt{rcpt}
+
+	// an event that conflicts with the accepted one, signed by the controller
+	_, err = bob.ProcessEvents(dup)
+	assert.Equal(t, klog.ErrDuplicitous, errors.Cause(err))
+	require.Len(t, found, 1)
+
+	ixnDig, err := ixn.Event.GetDigest()
+	require.NoError(t, err)
+	dupDig, err := dup.Event.GetDigest()
+	require.NoError(t, err)
+
+	dups, err := bob.Duplicity(good.Prefix())
+	require.NoError(t, err)
+	require.Len(t, dups, 1)
+
+	accDig, err := dups[0].Accepted.Event.GetDigest()
+	require.NoError(t, err)
+	assert.Equal(t, ixnDig, accDig)
+
+	gotDig, err := dups[0].Duplicitous.Event.GetDigest()
+	require.NoError(t, err)
+	assert.Equal(t, dupDig, gotDig)
+	assert.Len(t, dups[0].Duplicitous.Signatures, 1)
+
+	// the receipts of the conflicting event are only kept with the duplicity
+	require.Len(t, dups[0].Duplicitous.NonTransferableReceipts, 1)
+	assert.Equal(t, nt.AsPrefix(), dups[0].Duplicitous.NonTransferableReceipts[0].EstPrefix)
+	assert.Empty(t, dups[0].Accepted.NonTransferableReceipts)
+
+	kel, err := bob.FindConnection(good.Prefix())
+	require.NoError(t, err)
+
+	rcpts, err := kel.NonTransferableReceipts(dup.Event)
+	require.NoError(t, err)
+	assert.Empty(t, rcpts)
+
+	foundDig, err := found[0].Duplicitous.Event.GetDigest()
+	require.NoError(t, err)
+	assert.Equal(t, dupDig, foundDig)
+
+	// the same duplicity is only reported once
+	_, err = bob.ProcessEvents(dup)
+	assert.Error(t, err)
+	assert.NotEqual(t, klog.ErrDuplicitous, errors.Cause(err))
+	assert.Len(t, found, 1)
+
+	// receipts that don't verify are reported
+	forgedSig, err := derivation.New(derivation.WithCode(derivation.Ed25519Sig), derivation.WithSigner(kms.Signer()))
+	require.NoError(t, err)
+	_, err = forgedSig.Derive([]byte("forged"))
+	require.NoError(t, err)
+
+	forgedRcpt, err := event.NewReceipt(dup.Event, event.WithSignerPrefix(nt.AsPrefix()), event.WithSignature(forgedSig))
+	require.NoError(t, err)
+
+	_, err = bob.ProcessEvents(&event.Message{Event: dup.Event, Signatures: dup.Signatures, NonTransferableReceipts: []*event.Receipt{forgedRcpt}})
+	assert.Error(t, err)
+	assert.NotEqual(t, klog.ErrDuplicitous, errors.Cause(err))
+
+	// conflicting events the controller did not sign are not duplicity
+	other, err := New(testkms.GetKMS(t, nil, mem.New()), mem.New())
+	require.NoError(t, err)
+
+	forged := &event.Message{Event: dup.Event, Signatures: []derivation.Derivation{dup.Signatures[0]}}
+	forged.Signatures[0].Raw, err = other.Sign([]byte("forged"))
+	require.NoError(t, err)
+
+	_, err = bob.ProcessEvents(forged)
+	assert.Error(t, err)
+	assert.NotEqual(t, klog.ErrDuplicitous, errors.Cause(err))
+
+	dups, err = bob.Duplicity(good.Prefix())
+	require.NoError(t, err)
+	assert.Len(t, dups, 1)
+	assert.Len(t, found, 1)
+}
+
+func TestRecovery(t *testing.T) {
+	secrets := []string{"ADW3o9m3udwEf0aoOdZLLJdf1aylokP0lwwI_M2J9h0s", "AagumsL8FeGES7tYcnr_5oN6qcwJzZfLKxoniKUpG4qc"}
+
+	db := mem.New()
+	good, err := New(testkms.GetKMS(t, secrets, db), db)
+	require.NoError(t, err)
+
+	// bad holds the current signing keys, but good holds the pre-rotated ones
+	db = mem.New()
+	bad, err := New(testkms.GetKMS(t, secrets, db), db)
+	require.NoError(t, err)
+
+	db = mem.New()
+	bob, err := New(testkms.GetKMS(t, nil, db), db)
+	require.NoError(t, err)
+
+	icp, err := good.Inception()
+	require.NoError(t, err)
+
+	ixn1, err := bad.Interaction(event.SealArray{})
+	require.NoError(t, err)
+
+	ixn2, err := bad.Interaction(event.SealArray{})
+	require.NoError(t, err)
+
+	_, err = bob.ProcessEvents(icp, ixn1, ixn2)
+	require.NoError(t, err)
+
+	kel, err := bob.FindConnection(good.Prefix())
+	require.NoError(t, err)
+	assert.Equal(t, 3, kel.Size())
+
+	// the rotation supersedes the interaction events signed with the compromised keys
+	rot, err := good.Rotate()
+	require.NoError(t, err)
+	assert.Equal(t, 1, rot.Event.SequenceInt())
+
+	_, err = bob.ProcessEvents(rot)
+	require.NoError(t, err)
+
+	rotDig, err := rot.Event.GetDigest()
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, kel.Size())
+	curDig, err := kel.Current().GetDigest()
+	require.NoError(t, err)
+	assert.Equal(t, rotDig, curDig)
+
+	digs := func(msgs []*event.Message) []string {
+		out := []string{}
+		for _, msg := range msgs {
+			dig, err := msg.Event.GetDigest()
+			require.NoError(t, err)
+			out = append(out, dig)
+		}
+		return out
+	}
+
+	sup, err := kel.Superseded()
+	require.NoError(t, err)
+	assert.Equal(t, digs([]*event.Message{ixn1, ixn2}), digs(sup))
+	for _, msg := range sup {
+		assert.Len(t, msg.Signatures, 1)
+	}
+
+	// the first seen log records the recovery after the superseded events
+	seen := []*event.Message{}
+	err = bob.Replay(good.Prefix(), FirstSeenReplay, func(e *event.Message) error {
+		seen = append(seen, e)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, digs([]*event.Message{icp, ixn1, ixn2, rot}), digs(seen))
+
+	seen = []*event.Message{}
+	err = bob.Replay(good.Prefix(), SequenceNumberReplay, func(e *event.Message) error {
+		seen = append(seen, e)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, digs([]*event.Message{icp, rot}), digs(seen))
+
+	// superseded events are not duplicity
+	_, err = bob.ProcessEvents(ixn1)
+	assert.Error(t, err)
+
+	dups, err := bob.Duplicity(good.Prefix())
+	require.NoError(t, err)
+	assert.Empty(t, dups)
+
+	// resending the rotation only adds signatures
+	_, err = bob.ProcessEvents(rot)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, kel.Size())
+
+	ixn, err := good.Interaction(event.SealArray{})
+	require.NoError(t, err)
+
+	_, err = bob.ProcessEvents(ixn)
+	require.NoError(t, err)
+	assert.Equal(t, 3, kel.Size())
+
+	// the inception is still a duplicate after the rotation
+	_, err = bob.ProcessEvents(icp)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, kel.Size())
+
+	// a rotation can't supersede an establishment event, a properly signed
+	// conflicting rotation is duplicity
+	db = mem.New()
+	other, err := New(testkms.GetKMS(t, secrets, db), db)
+	require.NoError(t, err)
+
+	seal, err := event.NewEventSeal("Edig", "Epre", "0")
+	require.NoError(t, err)
+
+	conflict, err := other.Rotate(seal)
+	require.NoError(t, err)
+	assert.Equal(t, 1, conflict.Event.SequenceInt())
+
+	_, err = bob.ProcessEvents(conflict)
+	assert.Equal(t, klog.ErrDuplicitous, errors.Cause(err))
+	assert.Equal(t, 3, kel.Size())
+
+	sup, err = kel.Superseded()
+	require.NoError(t, err)
+	assert.Len(t, sup, 2)
+
+	dups, err = bob.Duplicity(good.Prefix())
+	require.NoError(t, err)
+	require.Len(t, dups, 1)
+	assert.Equal(t, digs([]*event.Message{rot}), digs([]*event.Message{dups[0].Accepted}))
+	assert.Equal(t, digs([]*event.Message{conflict}), digs([]*event.Message{dups[0].Duplicitous}))
+}
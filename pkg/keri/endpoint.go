@@ -0,0 +1,221 @@
+package keri
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/decentralized-identity/kerigo/pkg/event"
+	klog "github.com/decentralized-identity/kerigo/pkg/log"
+)
+
+const (
+	// ControllerRole is the role of an endpoint run by the controller of an identifier
+	ControllerRole = "controller"
+
+	// WitnessRole is the role of an endpoint run by a witness of an identifier
+	WitnessRole = "witness"
+
+	// WatcherRole is the role of an endpoint run by a watcher of an identifier
+	WatcherRole = "watcher"
+
+	// MailboxRole is the role of an endpoint that stores messages for an identifier
+	MailboxRole = "mailbox"
+)
+
+// Endpoint is a URL an identifier can be reached at in a role. The EID
+// is the prefix of the identifier running the endpoint, if it is not
+// the identifier itself.
+type Endpoint struct {
+	Role string `json:"role"`
+	EID  string `json:"eid,omitempty"`
+	URL  string `json:"url"`
+}
+
+// AddEndpoint records an endpoint the identifier can be reached at,
+// replacing any endpoint already recorded for the same role and EID.
+// Recorded endpoints are where we learned of the identifier, such as a
+// resolved OOBI, and are not authorized by its controller.
+func (r *Keri) AddEndpoint(pre string, end *Endpoint) error {
+	if end == nil || end.Role == "" || end.URL == "" {
+		return errors.New("endpoint role and url required")
+	}
+
+	r.endLock.Lock()
+	defer r.endLock.Unlock()
+
+	ends, err := r.Endpoints(pre)
+	if err != nil {
+		return err
+	}
+
+	out := []*Endpoint{end}
+	for _, e := range ends {
+		if e.Role != end.Role || e.EID != end.EID {
+			out = append(out, e)
+		}
+	}
+
+	raw, err := json.Marshal(out)
+	if err != nil {
+		return errors.Wrap(err, "unable to encode endpoints")
+	}
+
+	err = r.db.Put(endName(pre), raw)
+	if err != nil {
+		return errors.Wrap(err, "unable to store endpoints")
+	}
+
+	return nil
+}
+
+// Endpoints returns the endpoints recorded for the identifier, most recent
+// first. They are hints for reaching the identifier, use AuthorizedEndpoints
+// for endpoints the controller has signed for.
+func (r *Keri) Endpoints(pre string) ([]*Endpoint, error) {
+	raw, err := r.db.Get(endName(pre))
+	if err != nil {
+		return []*Endpoint{}, nil
+	}
+
+	ends := []*Endpoint{}
+	err = json.Unmarshal(raw, &ends)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decode endpoints")
+	}
+
+	return ends, nil
+}
+
+// AuthorizeEndpoint returns a signed reply record that authorizes the
+// endpoint URL, run by the identifier with the EID prefix, to serve us in
+// the role. The record is stored, replacing any we gave for the role and EID.
+func (r *Keri) AuthorizeEndpoint(role, eid, url string) (*event.Message, error) {
+	if !validRole(role) {
+		return nil, errors.Errorf("unknown endpoint role %s", role)
+	}
+
+	seal, err := r.signerSeal()
+	if err != nil {
+		return nil, err
+	}
+
+	end := &event.EndRole{Controller: r.pre, Role: role, EID: eid, URL: url}
+	rpy, err := event.NewEndRoleReply(end, seal, r.format)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create endpoint authorization")
+	}
+
+	sigs, err := r.sign(rpy)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &event.Message{Event: rpy, Signatures: sigs}
+	err = r.ProcessEndRole(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// ProcessEndRole verifies an endpoint authorization against the keys its
+// controller held when signing it and stores it. Authorizations signed with
+// keys from an earlier establishment event than the one we hold for the role
+// and EID, or with the same keys at or before its datetime, are dropped so
+// replayed records or rotated out keys can not undo newer ones.
+func (r *Keri) ProcessEndRole(rpy *event.Message) error {
+	end, err := event.ParseEndRole(rpy.Event)
+	if err != nil {
+		return err
+	}
+
+	if !validRole(end.Role) {
+		return errors.Errorf("unknown endpoint role %s", end.Role)
+	}
+
+	dt, err := time.Parse(time.RFC3339Nano, rpy.Event.Datetime)
+	if err != nil {
+		return errors.Wrap(err, "invalid endpoint authorization datetime")
+	}
+
+	if len(rpy.Event.Seals) != 1 || rpy.Event.Seals[0].Prefix != end.Controller {
+		return errors.New("endpoint authorization must be signed by its controller")
+	}
+
+	seal := rpy.Event.Seals[0]
+	kel := klog.New(end.Controller, r.db)
+
+	// non-transferable controllers seal only their prefix, so they can always be verified
+	if seal.Digest != "" && seal.SequenceInt() >= kel.Size() {
+		return errors.Errorf("unable to verify endpoint authorization from %s", end.Controller)
+	}
+
+	err = kel.VerifySealedSignatures(seal, rpy)
+	if err != nil {
+		return errors.Wrap(err, "invalid endpoint authorization")
+	}
+
+	r.endLock.Lock()
+	defer r.endLock.Unlock()
+
+	cur, err := r.db.EndRole(end.Controller, end.Role, end.EID)
+	if err == nil && !supersedes(rpy.Event, dt, cur.Event) {
+		return nil
+	}
+
+	err = r.db.LogEndRole(rpy)
+	if err != nil {
+		return errors.Wrap(err, "unable to store endpoint authorization")
+	}
+
+	return nil
+}
+
+// AuthorizedEndpoints returns the endpoints the identifier has
+// authorized to serve it in the role. Unlike Endpoints these are
+// verified against the controller's keys, so they are the ones to
+// trust for the role.
+func (r *Keri) AuthorizedEndpoints(pre, role string) ([]*Endpoint, error) {
+	out := []*Endpoint{}
+	err := r.db.StreamEndRoles(pre, role, func(rpy *event.Message) error {
+		end, err := event.ParseEndRole(rpy.Event)
+		if err != nil {
+			return err
+		}
+
+		out = append(out, &Endpoint{Role: end.Role, EID: end.EID, URL: end.URL})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to load endpoint authorizations")
+	}
+
+	return out, nil
+}
+
+// supersedes returns true if the authorization signed at dt replaces the current one
+func supersedes(rpy *event.Event, dt time.Time, cur *event.Event) bool {
+	sn, cursn := rpy.Seals[0].SequenceInt(), cur.Seals[0].SequenceInt()
+	if sn != cursn {
+		return sn > cursn
+	}
+
+	curdt, err := time.Parse(time.RFC3339Nano, cur.Datetime)
+	return err != nil || dt.After(curdt)
+}
+
+func validRole(role string) bool {
+	switch role {
+	case ControllerRole, WitnessRole, WatcherRole, MailboxRole:
+		return true
+	}
+
+	return false
+}
+
+func endName(pre string) string {
+	return "end/" + pre
+}
@@ -0,0 +1,128 @@
+package keri
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/decentralized-identity/kerigo/pkg/db/mem"
+	"github.com/decentralized-identity/kerigo/pkg/derivation"
+	"github.com/decentralized-identity/kerigo/pkg/event"
+	testkms "github.com/decentralized-identity/kerigo/pkg/test/kms"
+)
+
+func TestEndpoints(t *testing.T) {
+	db := mem.New()
+	k, err := New(testkms.GetKMS(t, nil, db), db)
+	assert.NoError(t, err)
+
+	ends, err := k.Endpoints("Eabc")
+	assert.NoError(t, err)
+	assert.Empty(t, ends)
+
+	err = k.AddEndpoint("Eabc", &Endpoint{Role: ControllerRole})
+	assert.Error(t, err)
+
+	err = k.AddEndpoint("Eabc", &Endpoint{Role: ControllerRole, URL: "http://127.0.0.1:5642"})
+	assert.NoError(t, err)
+
+	err = k.AddEndpoint("Eabc", &Endpoint{Role: WitnessRole, EID: "Babc", URL: "http://127.0.0.1:5643"})
+	assert.NoError(t, err)
+
+	// the latest endpoint for a role replaces the previous one
+	err = k.AddEndpoint("Eabc", &Endpoint{Role: ControllerRole, URL: "http://127.0.0.1:5644"})
+	assert.NoError(t, err)
+
+	ends, err = k.Endpoints("Eabc")
+	assert.NoError(t, err)
+	assert.Equal(t, []*Endpoint{
+		{Role: ControllerRole, URL: "http://127.0.0.1:5644"},
+		{Role: WitnessRole, EID: "Babc", URL: "http://127.0.0.1:5643"},
+	}, ends)
+}
+
+func TestAuthorizedEndpoints(t *testing.T) {
+	db := mem.New()
+	alice, err := New(testkms.GetKMS(t, nil, db), db)
+	assert.NoError(t, err)
+
+	db = mem.New()
+	bob, err := New(testkms.GetKMS(t, nil, db), db)
+	assert.NoError(t, err)
+
+	_, err = alice.AuthorizeEndpoint("janitor", "", "http://127.0.0.1:5642")
+	assert.Error(t, err)
+
+	first, err := alice.AuthorizeEndpoint(WitnessRole, "Bwit", "http://127.0.0.1:5642")
+	assert.NoError(t, err)
+
+	ends, err := alice.AuthorizedEndpoints(alice.Prefix(), WitnessRole)
+	assert.NoError(t, err)
+	assert.Equal(t, []*Endpoint{{Role: WitnessRole, EID: "Bwit", URL: "http://127.0.0.1:5642"}}, ends)
+
+	// bob can't verify the record without alice's log
+	_, err = bob.ProcessEvents(roundTrip(t, first)...)
+	assert.Error(t, err)
+
+	icp, err := alice.Inception()
+	assert.NoError(t, err)
+
+	_, err = bob.ProcessEvents(icp)
+	assert.NoError(t, err)
+
+	_, err = bob.ProcessEvents(roundTrip(t, first)...)
+	assert.NoError(t, err)
+
+	ends, err = bob.AuthorizedEndpoints(alice.Prefix(), WitnessRole)
+	assert.NoError(t, err)
+	assert.Equal(t, []*Endpoint{{Role: WitnessRole, EID: "Bwit", URL: "http://127.0.0.1:5642"}}, ends)
+
+	ends, err = bob.AuthorizedEndpoints(alice.Prefix(), WatcherRole)
+	assert.NoError(t, err)
+	assert.Empty(t, ends)
+
+	// a record signed with keys that are later rotated out, dated in the future
+	seal, err := alice.signerSeal()
+	assert.NoError(t, err)
+
+	end := &event.EndRole{Controller: alice.Prefix(), Role: WitnessRole, EID: "Bwit", URL: "http://127.0.0.1:5644"}
+	future, err := event.NewEndRoleReply(end, seal, alice.format)
+	assert.NoError(t, err)
+
+	future.Datetime = "2999" + future.Datetime[4:]
+	sigs, err := alice.sign(future)
+	assert.NoError(t, err)
+
+	// records are verified against the keys alice held when signing them
+	rot, err := alice.Rotate()
+	assert.NoError(t, err)
+
+	_, err = bob.ProcessEvents(rot)
+	assert.NoError(t, err)
+
+	second, err := alice.AuthorizeEndpoint(WitnessRole, "Bwit", "http://127.0.0.1:5643")
+	assert.NoError(t, err)
+
+	_, err = bob.ProcessEvents(roundTrip(t, second)...)
+	assert.NoError(t, err)
+
+	// replaying the older record does not undo the newer one, even if
+	// it is dated later than the one signed with the current keys
+	_, err = bob.ProcessEvents(roundTrip(t, first)...)
+	assert.NoError(t, err)
+
+	err = bob.ProcessEndRole(&event.Message{Event: future, Signatures: sigs})
+	assert.NoError(t, err)
+
+	ends, err = bob.AuthorizedEndpoints(alice.Prefix(), WitnessRole)
+	assert.NoError(t, err)
+	assert.Equal(t, []*Endpoint{{Role: WitnessRole, EID: "Bwit", URL: "http://127.0.0.1:5643"}}, ends)
+
+	// records we can't verify are rejected
+	forged := &event.Message{Event: second.Event, Signatures: []derivation.Derivation{second.Signatures[0]}}
+	forged.Signatures[0].Raw = append([]byte{}, forged.Signatures[0].Raw...)
+	forged.Signatures[0].Raw[0] ^= 0xff
+
+	err = bob.ProcessEndRole(forged)
+	assert.Error(t, err)
+}
@@ -0,0 +1,263 @@
+package keri
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/decentralized-identity/kerigo/pkg/event"
+	klog "github.com/decentralized-identity/kerigo/pkg/log"
+)
+
+const (
+	// exchangeEscrowSize is the most exn messages escrowed for a single sender
+	exchangeEscrowSize = 16
+
+	// exchangeEscrowTotal is the most exn messages escrowed across all senders
+	exchangeEscrowTotal = 256
+
+	// exchangeEscrowTimeout is how long an exn message is escrowed
+	// waiting for the keys it was signed with before it is dropped
+	exchangeEscrowTimeout = 10 * time.Minute
+)
+
+// ExchangeHandler handles a verified exn message sent to the route it
+// was registered for, returning any messages to send back to the sender
+type ExchangeHandler func(exn *event.Message) ([]*event.Message, error)
+
+// ExchangeReplyHandler is called with the replies to an exn message that
+// was released from escrow by a later event, which must be sent to its sender
+// rather than to whoever sent the event
+type ExchangeReplyHandler func(sender string, replies []*event.Message)
+
+// WithExchangeReplyHandler sets the handler called with the replies to exn
+// messages released from escrow. Without one, those replies are dropped.
+func WithExchangeReplyHandler(h ExchangeReplyHandler) Option {
+	return func(k *Keri) error {
+		if h == nil {
+			return errors.New("exchange reply handler required")
+		}
+
+		k.exnReplies = h
+		return nil
+	}
+}
+
+// WithExchangeHandler registers the handler for exn messages sent to the route
+func WithExchangeHandler(route string, h ExchangeHandler) Option {
+	return func(k *Keri) error {
+		return k.RegisterExchangeHandler(route, h)
+	}
+}
+
+// RegisterExchangeHandler registers the handler for exn messages sent
+// to the route, replacing any handler already registered for it
+func (r *Keri) RegisterExchangeHandler(route string, h ExchangeHandler) error {
+	if route == "" {
+		return errors.New("exchange route required")
+	}
+
+	if h == nil {
+		return errors.New("exchange handler required")
+	}
+
+	r.exnLock.Lock()
+	defer r.exnLock.Unlock()
+
+	if r.exnHandlers == nil {
+		r.exnHandlers = map[string]ExchangeHandler{}
+	}
+
+	r.exnHandlers[route] = h
+	return nil
+}
+
+// Exchange returns an exn message carrying the payload to the route,
+// signed with our current keys
+func (r *Keri) Exchange(route string, payload interface{}) (*event.Message, error) {
+	seal, err := r.signerSeal()
+	if err != nil {
+		return nil, err
+	}
+
+	exn, err := event.NewExchange(route, payload, seal, r.format)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create exchange message")
+	}
+
+	sigs, err := r.sign(exn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &event.Message{Event: exn, Signatures: sigs}, nil
+}
+
+// ProcessExchange verifies an exn message against the current keys of its
+// sender and dispatches it to the handler for its route. Messages signed with
+// keys from an establishment event we have not seen yet are escrowed until
+// we have, or until they time out. Once the escrow holds too many messages,
+// from the sender or overall, further messages are rejected.
+func (r *Keri) ProcessExchange(exn *event.Message) ([]*event.Message, error) {
+	evt := exn.Event
+	if len(evt.Seals) != 1 || evt.Seals[0].Prefix != evt.Prefix {
+		return nil, errors.New("exchange message must seal its sender")
+	}
+
+	r.exnLock.RLock()
+	h, ok := r.exnHandlers[evt.Route]
+	r.exnLock.RUnlock()
+
+	if !ok {
+		return nil, errors.Errorf("no handler for exchange route %s", evt.Route)
+	}
+
+	seal := evt.Seals[0]
+	kel := klog.New(evt.Prefix, r.db)
+
+	// non-transferable senders seal only their prefix, so they can always be verified
+	if seal.Digest != "" {
+		if seal.SequenceInt() >= kel.Size() {
+			return nil, r.escrowExchange(exn)
+		}
+
+		est := kel.CurrentEstablishment()
+		if est == nil {
+			return nil, errors.New("unable to load sender's current establishment event")
+		}
+
+		dig, err := est.GetDigest()
+		if err != nil {
+			return nil, err
+		}
+
+		if seal.Digest != dig {
+			return nil, errors.New("exchange message not signed with the sender's current keys")
+		}
+	}
+
+	err := kel.VerifySealedSignatures(seal, exn)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid exchange message")
+	}
+
+	return h(exn)
+}
+
+// escrowExchange escrows the exn message until we have seen the keys it
+// was signed with, dropping escrowed messages that have timed out first
+func (r *Keri) escrowExchange(exn *event.Message) error {
+	dig, err := exn.Digest()
+	if err != nil {
+		return err
+	}
+
+	r.exnLock.Lock()
+	defer r.exnLock.Unlock()
+
+	r.expireExchanges(time.Now())
+
+	pre := exn.Event.Prefix
+	if _, ok := r.exnEscrow[pre][dig]; ok {
+		return nil
+	}
+
+	if len(r.exnEscrow[pre]) >= exchangeEscrowSize {
+		return errors.Errorf("exchange escrow full for %s", pre)
+	}
+
+	total := 0
+	for _, digs := range r.exnEscrow {
+		total += len(digs)
+	}
+
+	if total >= exchangeEscrowTotal {
+		return errors.New("exchange escrow full")
+	}
+
+	err = r.db.EscrowExchange(exn)
+	if err != nil {
+		return errors.Wrap(err, "unable to escrow exchange message")
+	}
+
+	if r.exnEscrow == nil {
+		r.exnEscrow = map[string]map[string]time.Time{}
+	}
+
+	if r.exnEscrow[pre] == nil {
+		r.exnEscrow[pre] = map[string]time.Time{}
+	}
+
+	r.exnEscrow[pre][dig] = time.Now()
+	return nil
+}
+
+// expireExchanges drops the escrowed exn messages that have timed out
+func (r *Keri) expireExchanges(now time.Time) {
+	for pre, digs := range r.exnEscrow {
+		for dig, at := range digs {
+			if now.Sub(at) > exchangeEscrowTimeout {
+				_ = r.db.RemoveExchangeEscrow(pre, dig)
+				delete(digs, dig)
+			}
+		}
+
+		if len(digs) == 0 {
+			delete(r.exnEscrow, pre)
+		}
+	}
+}
+
+// processExchangeEscrow processes the escrowed exn messages from the
+// sender, which are dispatched once we have seen the keys they were signed
+// with. Any replies are passed to the exchange reply handler. Messages that
+// can not be verified with those keys, that have timed out, or that were
+// escrowed before we restarted are dropped.
+func (r *Keri) processExchangeEscrow(pre string) {
+	kel := klog.New(pre, r.db)
+
+	r.exnLock.Lock()
+	r.expireExchanges(time.Now())
+	r.exnLock.Unlock()
+
+	replies := [][]*event.Message{}
+	_ = r.db.StreamExchangeEscrow(pre, func(exn *event.Message) error {
+		dig, err := exn.Digest()
+		if err != nil {
+			return nil
+		}
+
+		r.exnLock.Lock()
+		_, ok := r.exnEscrow[pre][dig]
+		r.exnLock.Unlock()
+
+		if ok && exn.Event.Seals[0].SequenceInt() >= kel.Size() {
+			return nil
+		}
+
+		r.exnLock.Lock()
+		delete(r.exnEscrow[pre], dig)
+		r.exnLock.Unlock()
+
+		err = r.db.RemoveExchangeEscrow(pre, dig)
+		if err != nil || !ok {
+			return nil
+		}
+
+		msgs, err := r.ProcessExchange(exn)
+		if err != nil || len(msgs) == 0 {
+			return nil
+		}
+
+		replies = append(replies, msgs)
+		return nil
+	})
+
+	if r.exnReplies == nil {
+		return
+	}
+
+	for _, msgs := range replies {
+		r.exnReplies(pre, msgs)
+	}
+}
@@ -0,0 +1,271 @@
+package keri
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/decentralized-identity/kerigo/pkg/db/mem"
+	"github.com/decentralized-identity/kerigo/pkg/derivation"
+	"github.com/decentralized-identity/kerigo/pkg/event"
+	testkms "github.com/decentralized-identity/kerigo/pkg/test/kms"
+)
+
+type greeting struct {
+	Msg string `json:"msg"`
+}
+
+func TestExchange(t *testing.T) {
+	db := mem.New()
+	alice, err := New(testkms.GetKMS(t, nil, db), db)
+	assert.NoError(t, err)
+
+	received := []greeting{}
+	greet := func(exn *event.Message) ([]*event.Message, error) {
+		g := greeting{}
+		err := json.Unmarshal(exn.Event.Payload, &g)
+		if err != nil {
+			return nil, err
+		}
+
+		received = append(received, g)
+		return nil, nil
+	}
+
+	db = mem.New()
+	bob, err := New(testkms.GetKMS(t, nil, db), db, WithExchangeHandler("/greet", greet))
+	assert.NoError(t, err)
+
+	exn, err := alice.Exchange("/greet", greeting{Msg: "hello"})
+	assert.NoError(t, err)
+
+	// bob hasn't seen alice yet
+	out, err := bob.ProcessEvents(roundTrip(t, exn)...)
+	assert.NoError(t, err)
+	assert.Len(t, out, 0)
+	assert.Len(t, received, 0)
+
+	icp, err := alice.Inception()
+	assert.NoError(t, err)
+
+	_, err = bob.ProcessEvents(icp)
+	assert.NoError(t, err)
+	if assert.Len(t, received, 1) {
+		assert.Equal(t, "hello", received[0].Msg)
+	}
+
+	// messages are only dispatched once
+	ixn, err := alice.Interaction(event.SealArray{})
+	assert.NoError(t, err)
+
+	_, err = bob.ProcessEvents(ixn)
+	assert.NoError(t, err)
+	assert.Len(t, received, 1)
+
+	// handlers can reply to the sender
+	err = bob.RegisterExchangeHandler("/ping", func(exn *event.Message) ([]*event.Message, error) {
+		pong, err := bob.Exchange("/pong", nil)
+		if err != nil {
+			return nil, err
+		}
+
+		return []*event.Message{pong}, nil
+	})
+	assert.NoError(t, err)
+
+	ping, err := alice.Exchange("/ping", nil)
+	assert.NoError(t, err)
+
+	out, err = bob.ProcessEvents(ping)
+	assert.NoError(t, err)
+	if assert.Len(t, out, 1) {
+		assert.Equal(t, "/pong", out[0].Event.Route)
+	}
+
+	// routes without a handler are rejected
+	exn, err = alice.Exchange("/unknown", nil)
+	assert.NoError(t, err)
+
+	_, err = bob.ProcessEvents(exn)
+	assert.Error(t, err)
+
+	// as are messages we can't verify
+	exn, err = alice.Exchange("/greet", greeting{Msg: "hello"})
+	assert.NoError(t, err)
+
+	forged := &event.Message{Event: exn.Event, Signatures: []derivation.Derivation{exn.Signatures[0]}}
+	forged.Signatures[0].Raw = append([]byte{}, forged.Signatures[0].Raw...)
+	forged.Signatures[0].Raw[0] ^= 0xff
+
+	_, err = bob.ProcessEvents(forged)
+	assert.Error(t, err)
+
+	// and messages signed with keys that have been rotated away
+	rot, err := alice.Rotate()
+	assert.NoError(t, err)
+
+	_, err = bob.ProcessEvents(rot)
+	assert.NoError(t, err)
+
+	_, err = bob.ProcessEvents(exn)
+	assert.Error(t, err)
+
+	exn, err = alice.Exchange("/greet", greeting{Msg: "rotated"})
+	assert.NoError(t, err)
+
+	_, err = bob.ProcessEvents(exn)
+	assert.NoError(t, err)
+	if assert.Len(t, received, 2) {
+		assert.Equal(t, "rotated", received[1].Msg)
+	}
+}
+
+func TestExchangeEscrow(t *testing.T) {
+	received := 0
+	greet := func(exn *event.Message) ([]*event.Message, error) {
+		received++
+		return nil, nil
+	}
+
+	db := mem.New()
+	bob, err := New(testkms.GetKMS(t, nil, db), db, WithExchangeHandler("/greet", greet))
+	assert.NoError(t, err)
+
+	// senders bob hasn't seen can only escrow so many messages
+	db = mem.New()
+	alice, err := New(testkms.GetKMS(t, nil, db), db)
+	assert.NoError(t, err)
+
+	for i := 0; i < exchangeEscrowSize; i++ {
+		exn, err := alice.Exchange("/greet", greeting{Msg: strconv.Itoa(i)})
+		assert.NoError(t, err)
+
+		_, err = bob.ProcessExchange(exn)
+		assert.NoError(t, err)
+	}
+
+	exn, err := alice.Exchange("/greet", greeting{Msg: "full"})
+	assert.NoError(t, err)
+
+	_, err = bob.ProcessExchange(exn)
+	assert.Error(t, err)
+
+	// as can all senders together
+	total := exchangeEscrowSize
+	for total < exchangeEscrowTotal {
+		db := mem.New()
+		sender, err := New(testkms.GetKMS(t, nil, db), db)
+		assert.NoError(t, err)
+
+		for i := 0; i < exchangeEscrowSize && total < exchangeEscrowTotal; i++ {
+			exn, err := sender.Exchange("/greet", greeting{Msg: strconv.Itoa(i)})
+			assert.NoError(t, err)
+
+			_, err = bob.ProcessExchange(exn)
+			assert.NoError(t, err)
+			total++
+		}
+	}
+
+	db = mem.New()
+	carol, err := New(testkms.GetKMS(t, nil, db), db)
+	assert.NoError(t, err)
+
+	exn, err = carol.Exchange("/greet", greeting{Msg: "full"})
+	assert.NoError(t, err)
+
+	_, err = bob.ProcessExchange(exn)
+	assert.Error(t, err)
+
+	// escrowed messages are dropped once they time out
+	for _, digs := range bob.exnEscrow {
+		for dig := range digs {
+			digs[dig] = time.Now().Add(-exchangeEscrowTimeout - time.Second)
+		}
+	}
+
+	icp, err := alice.Inception()
+	assert.NoError(t, err)
+
+	_, err = bob.ProcessEvents(icp)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, received)
+	assert.Empty(t, bob.exnEscrow)
+
+	escrowed := 0
+	err = bob.db.StreamExchangeEscrow(alice.Prefix(), func(*event.Message) error {
+		escrowed++
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, escrowed)
+
+	// which makes room for new ones
+	_, err = bob.ProcessExchange(exn)
+	assert.NoError(t, err)
+
+	icp, err = carol.Inception()
+	assert.NoError(t, err)
+
+	_, err = bob.ProcessEvents(icp)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, received)
+}
+
+func TestExchangeEscrowReplies(t *testing.T) {
+	db := mem.New()
+	alice, err := New(testkms.GetKMS(t, nil, db), db)
+	assert.NoError(t, err)
+
+	db = mem.New()
+	carol, err := New(testkms.GetKMS(t, nil, db), db)
+	assert.NoError(t, err)
+
+	replies := map[string][]*event.Message{}
+	db = mem.New()
+	bob, err := New(testkms.GetKMS(t, nil, db), db,
+		WithExchangeReplyHandler(func(sender string, msgs []*event.Message) {
+			replies[sender] = append(replies[sender], msgs...)
+		}),
+	)
+	assert.NoError(t, err)
+
+	err = bob.RegisterExchangeHandler("/ping", func(exn *event.Message) ([]*event.Message, error) {
+		pong, err := bob.Exchange("/pong", nil)
+		if err != nil {
+			return nil, err
+		}
+
+		return []*event.Message{pong}, nil
+	})
+	assert.NoError(t, err)
+
+	// alice pings bob before bob has seen her
+	ping, err := alice.Exchange("/ping", nil)
+	assert.NoError(t, err)
+
+	out, err := bob.ProcessEvents(ping)
+	assert.NoError(t, err)
+	assert.Len(t, out, 0)
+
+	// carol sends bob alice's inception, which releases the ping
+	icp, err := alice.Inception()
+	assert.NoError(t, err)
+
+	out, err = bob.ProcessEvents(icp)
+	assert.NoError(t, err)
+
+	// carol only gets the receipt, while the pong goes to alice
+	for _, msg := range out {
+		assert.NotEqual(t, event.EXN, msg.Event.ILK())
+	}
+
+	assert.Len(t, replies, 1)
+	if assert.Len(t, replies[alice.Prefix()], 1) {
+		assert.Equal(t, "/pong", replies[alice.Prefix()][0].Event.Route)
+	}
+	assert.Empty(t, replies[carol.Prefix()])
+}
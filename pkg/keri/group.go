@@ -0,0 +1,1184 @@
+package keri
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/decentralized-identity/kerigo/pkg/derivation"
+	"github.com/decentralized-identity/kerigo/pkg/encoding/stream"
+	"github.com/decentralized-identity/kerigo/pkg/event"
+	"github.com/decentralized-identity/kerigo/pkg/keymanager"
+	klog "github.com/decentralized-identity/kerigo/pkg/log"
+)
+
+const (
+	groupQueueSize = 100
+
+	// groupRotationTimeout is how long a member waits for a group
+	// rotation to be accepted before abandoning the keys it rotated to
+	groupRotationTimeout = 5 * time.Minute
+)
+
+// GroupMessageType identifies the step of the group protocol a
+// coordination message is for
+type GroupMessageType string
+
+const (
+	// GroupJoin announces the keys a member contributes to the group,
+	// either for the inception or for a rotation
+	GroupJoin GroupMessageType = "join"
+
+	// GroupRotate asks every member to rotate the keys they contribute
+	// and announce them with a join
+	GroupRotate GroupMessageType = "rotate"
+
+	// GroupPropose proposes a new group event signed by the proposer
+	GroupPropose GroupMessageType = "propose"
+
+	// GroupSign carries a member's signature for a proposed event
+	GroupSign GroupMessageType = "sign"
+
+	// GroupComplete carries a group event signed by enough
+	// members to meet the signing threshold
+	GroupComplete GroupMessageType = "complete"
+)
+
+// GroupState is the state of the group event at a sequence number
+type GroupState int
+
+const (
+	// GroupIdle means nothing has been proposed for the sequence number
+	GroupIdle GroupState = iota
+
+	// GroupProposed means the event is being built, or waiting on a
+	// proposal from another member
+	GroupProposed
+
+	// GroupSigning means this member has signed the event and is
+	// collecting signatures from the rest of the group
+	GroupSigning
+
+	// GroupCompleted means the event met the signing threshold and
+	// has been accepted into the group KEL
+	GroupCompleted
+)
+
+// GroupMember is the contribution of one controller to a group identifier
+type GroupMember struct {
+	Prefix string `json:"i"`
+	Key    string `json:"k"`
+	Next   string `json:"n"`
+}
+
+// GroupMessage is exchanged between the members of a group to coordinate
+// building and signing the group events. Messages are signed by the sender
+// with the key it currently contributes to the group. Joins are endorsed by
+// the current keys of the sender's own identifier as well, binding the keys
+// it contributes to it.
+type GroupMessage struct {
+	Type        GroupMessageType `json:"t"`
+	Sequence    int              `json:"s"`
+	From        string           `json:"f"`
+	Member      *GroupMember     `json:"m,omitempty"`
+	Event       []byte           `json:"e,omitempty"`
+	Signature   string           `json:"x,omitempty"`
+	Endorsement []string         `json:"c,omitempty"`
+}
+
+// GroupApproval decides whether this member signs an interaction
+// event proposed by another member of the group
+type GroupApproval func(ixn *event.Event) error
+
+// NewGroupMessage creates a coordination message carrying the event message
+func NewGroupMessage(t GroupMessageType, msg *event.Message) (*GroupMessage, error) {
+	ser, err := stream.ToConjoint(msg)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to serialize group event")
+	}
+
+	return &GroupMessage{
+		Type:     t,
+		Sequence: msg.Event.SequenceInt(),
+		Event:    ser,
+	}, nil
+}
+
+// Message returns the event message carried by the coordination message
+func (m *GroupMessage) Message() (*event.Message, error) {
+	if len(m.Event) == 0 {
+		return nil, errors.New("no event in group message")
+	}
+
+	return stream.NewReader(bytes.NewReader(m.Event)).Read()
+}
+
+// signedBytes returns the serialized message without its signatures
+func (m *GroupMessage) signedBytes() ([]byte, error) {
+	unsigned := *m
+	unsigned.Signature = ""
+	unsigned.Endorsement = nil
+
+	return json.Marshal(&unsigned)
+}
+
+// Group is one member's view of a group identifier that is controlled by
+// several independent controllers. Each member contributes a single key,
+// signs the group events with its own index, and exchanges signatures with
+// the other members until the signing threshold is met. Partially signed
+// events are held in the pending escrow of the member's db until then.
+type Group struct {
+	k             *Keri
+	kms           *keymanager.KeyManager
+	size          int
+	threshold     *event.SigThreshold
+	nextThreshold *event.SigThreshold
+
+	approve         GroupApproval
+	rotationTimeout time.Duration
+
+	lock      sync.Mutex
+	pre       string
+	icp       *event.Event
+	index     int
+	members   []string
+	joins     map[int]map[string]*GroupMember
+	announced map[int]*GroupMessage
+	states    map[int]GroupState
+	proposer  map[int]bool
+	rotations map[int]*keymanager.Rotation
+	deferred  []*GroupMessage
+	peers     []*groupPeer
+}
+
+type GroupOption func(*Group) error
+
+// NewGroup creates the local member of a group with size members. The keys
+// contributed to the group are held by kms, separate from the keys of the
+// member's own identifier, so the group can rotate independently.
+func NewGroup(k *Keri, kms *keymanager.KeyManager, size int, opts ...GroupOption) (*Group, error) {
+	if size < 1 {
+		return nil, errors.New("group must have at least one member")
+	}
+
+	g := &Group{
+		k:               k,
+		kms:             kms,
+		size:            size,
+		rotationTimeout: groupRotationTimeout,
+		index:           -1,
+		joins:           map[int]map[string]*GroupMember{},
+		announced:       map[int]*GroupMessage{},
+		states:          map[int]GroupState{},
+		proposer:        map[int]bool{},
+		rotations:       map[int]*keymanager.Rotation{},
+	}
+
+	for _, o := range opts {
+		err := o(g)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if g.threshold == nil {
+		g.threshold = defaultThreshold(size)
+	}
+
+	if g.nextThreshold == nil {
+		g.nextThreshold = defaultThreshold(size)
+	}
+
+	err := g.threshold.Validate(size)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid group signing threshold")
+	}
+
+	err = g.nextThreshold.Validate(size)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid group next signing threshold")
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	err = g.announce(0)
+	if err != nil {
+		return nil, err
+	}
+
+	return g, g.checkJoined(0)
+}
+
+// WithGroupThreshold sets the signing threshold for the group inception.
+// Every member must use the same threshold.
+func WithGroupThreshold(st *event.SigThreshold) GroupOption {
+	return func(g *Group) error {
+		g.threshold = st
+		return nil
+	}
+}
+
+// WithGroupApproval sets the approval for interaction events proposed by
+// other members. Without one, this member refuses to sign them.
+func WithGroupApproval(a GroupApproval) GroupOption {
+	return func(g *Group) error {
+		g.approve = a
+		return nil
+	}
+}
+
+// WithGroupNextThreshold sets the signing threshold committed to for the
+// next keys of the group. Every member must use the same threshold.
+func WithGroupNextThreshold(st *event.SigThreshold) GroupOption {
+	return func(g *Group) error {
+		g.nextThreshold = st
+		return nil
+	}
+}
+
+// WithGroupRotationTimeout sets how long this member waits for a group
+// rotation to be accepted before abandoning it, so it can be retried
+func WithGroupRotationTimeout(d time.Duration) GroupOption {
+	return func(g *Group) error {
+		g.rotationTimeout = d
+		return nil
+	}
+}
+
+// Connect adds another member of the group reachable over the connection.
+// The keys this member contributes are announced to it immediately. Joins
+// are only accepted from members whose KEL we already hold.
+func (g *Group) Connect(rw io.ReadWriter) error {
+	p := &groupPeer{out: make(chan *GroupMessage, groupQueueSize)}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	// joins are announced in order, so each rotation can be
+	// verified against the keys committed to before it
+	sns := []int{}
+	for sn := range g.announced {
+		sns = append(sns, sn)
+	}
+	sort.Ints(sns)
+
+	for _, sn := range sns {
+		err := p.send(g.announced[sn])
+		if err != nil {
+			return err
+		}
+	}
+
+	g.peers = append(g.peers, p)
+
+	go p.write(json.NewEncoder(rw))
+	go g.read(json.NewDecoder(rw))
+
+	return nil
+}
+
+// Prefix returns the group identifier, which is empty until
+// every member has joined
+func (g *Group) Prefix() string {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	return g.pre
+}
+
+// Index returns the index of this member's key in the group
+// key list, or -1 if not every member has joined yet
+func (g *Group) Index() int {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	return g.index
+}
+
+// Members returns the prefixes of the members in key index order
+func (g *Group) Members() []string {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	return append([]string{}, g.members...)
+}
+
+// State returns the state of the group event at the sequence number
+func (g *Group) State(sn int) GroupState {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	return g.states[sn]
+}
+
+// KEL returns the group key event log
+func (g *Group) KEL() *klog.Log {
+	return klog.New(g.Prefix(), g.k.db)
+}
+
+// Rotate starts a rotation of the group keys. Every member rotates the
+// key it contributes, and once all of the new keys have been announced
+// this member proposes the rotation event. Members only keep the keys they
+// rotated to once the rotation is accepted into the group KEL.
+func (g *Group) Rotate() error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	sn, err := g.nextSequence()
+	if err != nil {
+		return err
+	}
+
+	g.proposer[sn] = true
+	err = g.broadcast(&GroupMessage{Type: GroupRotate, Sequence: sn})
+	if err != nil {
+		delete(g.proposer, sn)
+		return err
+	}
+
+	return g.handleRotate(sn)
+}
+
+// Interaction proposes a group interaction event with the provided seals
+func (g *Group) Interaction(payload event.SealArray) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	sn, err := g.nextSequence()
+	if err != nil {
+		return err
+	}
+
+	cur, err := g.k.db.CurrentEvent(g.pre)
+	if err != nil {
+		return errors.Wrap(err, "unexpected error getting group KEL")
+	}
+
+	dig, err := cur.Digest()
+	if err != nil {
+		return err
+	}
+
+	ixn, err := event.NewInteractionEvent(
+		event.WithPrefix(g.pre),
+		event.WithDigest(dig),
+		event.WithDefaultVersion(g.k.format),
+		event.WithSequence(sn),
+		event.WithSeals(payload),
+	)
+	if err != nil {
+		return err
+	}
+
+	g.states[sn] = GroupProposed
+
+	return g.propose(ixn)
+}
+
+// nextSequence returns the sequence number for a new group
+// event, making sure nothing is already in progress for it
+func (g *Group) nextSequence() (int, error) {
+	if g.pre == "" || g.states[0] != GroupCompleted {
+		return 0, errors.New("group has not been incepted")
+	}
+
+	sn := g.k.db.LogSize(g.pre)
+	if g.states[sn] != GroupIdle {
+		return 0, errors.Errorf("group event %d already in progress", sn)
+	}
+
+	return sn, nil
+}
+
+func (g *Group) read(dec *json.Decoder) {
+	for {
+		m := &GroupMessage{}
+		err := dec.Decode(m)
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("group connection closed with (%v)\n", err)
+			}
+			return
+		}
+
+		g.lock.Lock()
+		err = g.verifyMessage(m)
+		if err == nil {
+			err = g.handle(m)
+		}
+		g.lock.Unlock()
+
+		if err != nil {
+			log.Printf("error handling group %s message: (%v)\n", m.Type, err)
+		}
+	}
+}
+
+func (g *Group) handle(m *GroupMessage) error {
+	switch m.Type {
+	case GroupJoin:
+		if m.Sequence > 0 {
+			// another member may have seen the rotate request first
+			err := g.handleRotate(m.Sequence)
+			if err != nil {
+				return err
+			}
+		}
+
+		err := g.join(m.Sequence, m.Member)
+		if err != nil {
+			return err
+		}
+
+		return g.checkJoined(m.Sequence)
+	case GroupRotate:
+		return g.handleRotate(m.Sequence)
+	case GroupPropose, GroupSign, GroupComplete:
+		// nothing can be verified until we know the group inception
+		if g.pre == "" {
+			g.deferred = append(g.deferred, m)
+			return nil
+		}
+
+		msg, err := m.Message()
+		if err != nil {
+			return err
+		}
+
+		if msg.Event.Prefix != g.pre {
+			return errors.Errorf("event for unknown group %s", msg.Event.Prefix)
+		}
+
+		switch m.Type {
+		case GroupPropose:
+			return g.handlePropose(msg)
+		case GroupSign:
+			return g.apply(msg, true)
+		default:
+			return g.apply(msg, false)
+		}
+	}
+
+	return errors.Errorf("unknown group message type %s", m.Type)
+}
+
+// handleRotate prepares a rotation of the key this member contributes and
+// announces it. The rotation is only committed once the group rotation is
+// accepted, and abandoned if that fails or takes longer than the timeout.
+func (g *Group) handleRotate(sn int) error {
+	if g.states[sn] != GroupIdle {
+		return nil
+	}
+
+	if g.pre == "" || sn != g.k.db.LogSize(g.pre) {
+		return errors.Errorf("rotation %d is not the next group event", sn)
+	}
+
+	rot, err := g.kms.PrepareRotation()
+	if err != nil {
+		return errors.Wrap(err, "unable to rotate group keys")
+	}
+
+	g.states[sn] = GroupProposed
+	g.rotations[sn] = rot
+
+	time.AfterFunc(g.rotationTimeout, func() {
+		g.lock.Lock()
+		defer g.lock.Unlock()
+
+		if g.rotations[sn] == rot {
+			log.Printf("group rotation %d timed out\n", sn)
+			g.abandonRotation(sn)
+		}
+	})
+
+	err = g.announce(sn)
+	if err == nil {
+		err = g.checkJoined(sn)
+	}
+
+	if err != nil {
+		g.abandonRotation(sn)
+		return err
+	}
+
+	return nil
+}
+
+// abandonRotation discards the keys this member prepared for the rotation
+// and everything announced for it, so the rotation can be retried
+func (g *Group) abandonRotation(sn int) {
+	rot, ok := g.rotations[sn]
+	if ok {
+		delete(g.rotations, sn)
+
+		err := rot.Abandon()
+		if err != nil {
+			log.Printf("unable to abandon group rotation %d: (%v)\n", sn, err)
+		}
+	}
+
+	delete(g.joins, sn)
+	delete(g.announced, sn)
+	delete(g.proposer, sn)
+	g.states[sn] = GroupIdle
+}
+
+// announce joins the keys this member contributes for the
+// sequence number and sends them to the rest of the group
+func (g *Group) announce(sn int) error {
+	m := &GroupMessage{Type: GroupJoin, Sequence: sn, Member: g.member()}
+
+	err := g.join(sn, m.Member)
+	if err != nil {
+		return err
+	}
+
+	err = g.broadcast(m)
+	g.announced[sn] = m
+
+	return err
+}
+
+func (g *Group) handlePropose(msg *event.Message) error {
+	sn := msg.Event.SequenceInt()
+	if g.states[sn] == GroupCompleted {
+		return nil
+	}
+
+	// a rotation can only be checked once every member has announced
+	// the keys it rotates to, which may arrive after the proposal
+	if msg.Event.ILK() == event.ROT && len(g.joins[sn]) < g.size {
+		pm, err := NewGroupMessage(GroupPropose, msg)
+		if err != nil {
+			return err
+		}
+
+		g.deferred = append(g.deferred, pm)
+		return nil
+	}
+
+	if g.states[sn] != GroupSigning {
+		err := g.verifyProposal(msg)
+		if err != nil {
+			return errors.Wrap(err, "invalid group proposal")
+		}
+
+		mine, err := g.sign(msg)
+		if err != nil {
+			return err
+		}
+
+		g.states[sn] = GroupSigning
+
+		sm, err := NewGroupMessage(GroupSign, mine)
+		if err != nil {
+			return err
+		}
+
+		err = g.broadcast(sm)
+		if err != nil {
+			return err
+		}
+
+		err = g.apply(mine, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	return g.apply(msg, true)
+}
+
+// verifyProposal makes sure the proposed event is exactly the event this
+// member would build and that it was signed by the proposer
+func (g *Group) verifyProposal(msg *event.Message) error {
+	evt := msg.Event
+	kel := klog.New(g.pre, g.k.db)
+
+	// the keys the proposal must be signed with
+	var signers *event.Event
+
+	switch evt.ILK() {
+	case event.ICP:
+		dig, err := msg.Digest()
+		if err != nil {
+			return err
+		}
+
+		expected, err := g.icp.GetDigest()
+		if err != nil {
+			return err
+		}
+
+		if dig != expected {
+			return errors.New("inception does not match group members")
+		}
+
+		signers = g.icp
+	case event.ROT:
+		rot, err := g.rotation(evt.SequenceInt())
+		if err != nil {
+			return err
+		}
+
+		dig, err := msg.Digest()
+		if err != nil {
+			return err
+		}
+
+		expected, err := rot.GetDigest()
+		if err != nil {
+			return err
+		}
+
+		if dig != expected {
+			return errors.New("rotation does not match the keys announced by the group members")
+		}
+
+		signers = rot
+	case event.IXN:
+		err := g.verifyInteraction(evt)
+		if err != nil {
+			return err
+		}
+
+		signers = kel.CurrentEstablishment()
+		if signers == nil {
+			return errors.New("unable to load group establishment event")
+		}
+	default:
+		return errors.Errorf("unsupported group event %s", evt.EventType)
+	}
+
+	return kel.VerifySigs(signers, msg)
+}
+
+// verifyInteraction makes sure the interaction follows the current group
+// event and that it is approved
+func (g *Group) verifyInteraction(ixn *event.Event) error {
+	if ixn.SequenceInt() != g.k.db.LogSize(g.pre) {
+		return errors.New("interaction is not the next group event")
+	}
+
+	cur, err := g.k.db.CurrentEvent(g.pre)
+	if err != nil {
+		return errors.Wrap(err, "unexpected error getting group KEL")
+	}
+
+	dig, err := cur.Digest()
+	if err != nil {
+		return err
+	}
+
+	if ixn.PriorEventDigest != dig {
+		return errors.New("interaction does not follow the current group event")
+	}
+
+	if g.approve == nil {
+		return errors.New("group interactions are not approved by this member")
+	}
+
+	return g.approve(ixn)
+}
+
+// join records the keys announced by a member for the sequence number.
+// Once announced the keys can not change, and no more members than the
+// group size can join.
+func (g *Group) join(sn int, m *GroupMember) error {
+	joins, ok := g.joins[sn]
+	if !ok {
+		joins = map[string]*GroupMember{}
+		g.joins[sn] = joins
+	}
+
+	prior, ok := joins[m.Prefix]
+	if ok && *prior != *m {
+		return errors.Errorf("member %s already announced different keys", m.Prefix)
+	}
+
+	if !ok && len(joins) >= g.size {
+		return errors.Errorf("group already has %d members", g.size)
+	}
+
+	joins[m.Prefix] = m
+	return nil
+}
+
+// lastJoin returns the keys last announced by the member
+// before the sequence number, or nil if there are none
+func (g *Group) lastJoin(pre string, before int) *GroupMember {
+	last := -1
+	for sn, joins := range g.joins {
+		if _, ok := joins[pre]; ok && sn < before && sn > last {
+			last = sn
+		}
+	}
+
+	if last < 0 {
+		return nil
+	}
+
+	return g.joins[last][pre]
+}
+
+// verifyMessage verifies the coordination message was signed by the key its
+// sender currently contributes to the group. A join is signed by the keys it
+// announces, which for a rotation must be the next keys the sender committed
+// to in its prior join, and endorsed by the sender's own identifier.
+func (g *Group) verifyMessage(m *GroupMessage) error {
+	data, err := m.signedBytes()
+	if err != nil {
+		return err
+	}
+
+	var key string
+	switch m.Type {
+	case GroupJoin:
+		if m.Member == nil {
+			return errors.New("join without member")
+		}
+
+		if m.Member.Prefix != m.From {
+			return errors.New("join announced by another member")
+		}
+
+		if m.Sequence > 0 {
+			prior := g.lastJoin(m.From, m.Sequence)
+			if !g.isMember(m.From) || prior == nil {
+				return errors.Errorf("join from unknown member %s", m.From)
+			}
+
+			if m.Member.Key != prior.Next {
+				return errors.Errorf("join from %s does not rotate to its committed next key", m.From)
+			}
+		}
+
+		err = g.verifyEndorsement(m.From, m.Endorsement, data)
+		if err != nil {
+			return err
+		}
+
+		key = m.Member.Key
+	default:
+		last := g.lastJoin(m.From, math.MaxInt32)
+		if last == nil || (g.pre != "" && !g.isMember(m.From)) {
+			return errors.Errorf("message from unknown member %s", m.From)
+		}
+
+		key = last.Key
+	}
+
+	pub, err := derivation.FromPrefix(key)
+	if err != nil {
+		return errors.Wrap(err, "invalid member key")
+	}
+
+	sig, err := derivation.FromAttachedSignature(m.Signature)
+	if err != nil {
+		return errors.Wrap(err, "invalid group message signature")
+	}
+
+	err = derivation.VerifyWithAttachedSignature(pub, sig, data)
+	if err != nil {
+		return errors.Wrapf(err, "invalid group message signature from %s", m.From)
+	}
+
+	return nil
+}
+
+// verifyEndorsement verifies the data was signed by the current keys of the
+// member's identifier, whose KEL we must already hold
+func (g *Group) verifyEndorsement(pre string, endorsement []string, data []byte) error {
+	kel := klog.New(pre, g.k.db)
+	if kel.Size() == 0 {
+		return errors.Errorf("unknown member identifier %s", pre)
+	}
+
+	state, err := kel.KeyState()
+	if err != nil {
+		return errors.Wrap(err, "unable to build member key state")
+	}
+
+	sigs := make([]derivation.Derivation, len(endorsement))
+	for i, e := range endorsement {
+		sig, err := derivation.FromAttachedSignature(e)
+		if err != nil {
+			return errors.Wrap(err, "invalid member endorsement")
+		}
+
+		key, err := state.KeyDerivation(int(sig.KeyIndex))
+		if err != nil {
+			return errors.Wrapf(err, "invalid member endorsement from %s", pre)
+		}
+
+		err = derivation.VerifyWithAttachedSignature(key, sig, data)
+		if err != nil {
+			return errors.Wrapf(err, "invalid member endorsement from %s", pre)
+		}
+
+		sigs[i] = *sig
+	}
+
+	if len(sigs) == 0 || (state.SigThreshold != nil && !state.SigThreshold.Satisfied(sigs)) {
+		return errors.Errorf("join not endorsed by %s", pre)
+	}
+
+	return nil
+}
+
+// checkJoined builds the group event once every member has announced
+// their keys for the sequence number
+func (g *Group) checkJoined(sn int) error {
+	if len(g.joins[sn]) < g.size {
+		return nil
+	}
+
+	if sn == 0 {
+		if g.pre != "" {
+			return nil
+		}
+
+		return g.incept()
+	}
+
+	g.handleDeferred()
+
+	if !g.proposer[sn] || g.states[sn] != GroupProposed {
+		return nil
+	}
+
+	rot, err := g.rotation(sn)
+	if err != nil {
+		return err
+	}
+
+	return g.propose(rot)
+}
+
+// rotation builds the group rotation from the keys the members
+// announced for the sequence number
+func (g *Group) rotation(sn int) (*event.Event, error) {
+	if sn != g.k.db.LogSize(g.pre) {
+		return nil, errors.New("rotation is not the next group event")
+	}
+
+	keys, next, err := g.memberKeys(sn)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := g.k.db.CurrentEvent(g.pre)
+	if err != nil {
+		return nil, errors.Wrap(err, "unexpected error getting group KEL")
+	}
+
+	dig, err := cur.Digest()
+	if err != nil {
+		return nil, err
+	}
+
+	// the new keys are bound by the threshold committed to in the
+	// prior establishment event
+	return event.NewRotationEvent(
+		event.WithPrefix(g.pre),
+		event.WithDigest(dig),
+		event.WithKeys(keyPrefixes(keys)...),
+		event.WithSigThreshold(g.nextThreshold),
+		event.WithDefaultVersion(g.k.format),
+		event.WithSequence(sn),
+		event.WithNext(g.nextThreshold.String(), derivation.Blake3256, keyPrefixes(next)...),
+	)
+}
+
+// incept orders the members, builds the group inception which every member
+// can do independently, and has the first member propose it
+func (g *Group) incept() error {
+	for pre := range g.joins[0] {
+		g.members = append(g.members, pre)
+	}
+	sort.Strings(g.members)
+
+	for i, pre := range g.members {
+		if pre == g.k.Prefix() {
+			g.index = i
+		}
+	}
+
+	keys, next, err := g.memberKeys(0)
+	if err != nil {
+		return err
+	}
+
+	icp, err := createInception(keys, next, g.threshold, g.nextThreshold, g.k.format)
+	if err != nil {
+		return errors.Wrap(err, "unable to create group inception event")
+	}
+
+	g.icp = icp
+	g.pre = icp.Prefix
+	g.states[0] = GroupProposed
+
+	if g.index == 0 {
+		err = g.propose(icp)
+		if err != nil {
+			return err
+		}
+	}
+
+	g.handleDeferred()
+
+	return nil
+}
+
+// handleDeferred handles the messages that arrived before
+// they could be verified, which were deferred until now
+func (g *Group) handleDeferred() {
+	deferred := g.deferred
+	g.deferred = nil
+	for _, m := range deferred {
+		err := g.handle(m)
+		if err != nil {
+			log.Printf("error handling group %s message: (%v)\n", m.Type, err)
+		}
+	}
+}
+
+// memberKeys returns the keys announced by the members for the
+// sequence number, in the group key order
+func (g *Group) memberKeys(sn int) ([]*derivation.Derivation, []*derivation.Derivation, error) {
+	keys := make([]*derivation.Derivation, len(g.members))
+	next := make([]*derivation.Derivation, len(g.members))
+	for i, pre := range g.members {
+		m, ok := g.joins[sn][pre]
+		if !ok {
+			return nil, nil, errors.Errorf("missing keys for member %s", pre)
+		}
+
+		var err error
+		keys[i], err = derivation.FromPrefix(m.Key)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "invalid key for member %s", pre)
+		}
+
+		next[i], err = derivation.FromPrefix(m.Next)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "invalid next key for member %s", pre)
+		}
+	}
+
+	return keys, next, nil
+}
+
+// propose signs the event and sends it to the rest of the group
+func (g *Group) propose(evt *event.Event) error {
+	mine, err := g.sign(&event.Message{Event: evt})
+	if err != nil {
+		return err
+	}
+
+	g.states[evt.SequenceInt()] = GroupSigning
+
+	pm, err := NewGroupMessage(GroupPropose, mine)
+	if err != nil {
+		return err
+	}
+
+	err = g.broadcast(pm)
+	if err != nil {
+		return err
+	}
+
+	return g.apply(mine, true)
+}
+
+// sign returns the event message signed with this member's key
+func (g *Group) sign(msg *event.Message) (*event.Message, error) {
+	raw, err := msg.Raw()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get group event bytes")
+	}
+
+	key, _, signer := g.keys()
+	sig, err := indexedSignature(raw, key, signer, g.index)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to sign group event")
+	}
+
+	return event.NewMessage(msg.Event, event.WithRaw(raw), event.WithSignatures([]derivation.Derivation{*sig}))
+}
+
+// apply adds the signed event to the group KEL. Events that do not meet the
+// signing threshold yet wait in the pending escrow for more signatures. The
+// first time the event is accepted it is optionally sent to the rest of the
+// group so members that have not seen enough signatures can complete.
+func (g *Group) apply(msg *event.Message, announce bool) error {
+	sn := msg.Event.SequenceInt()
+	if g.states[sn] == GroupCompleted {
+		return nil
+	}
+
+	err := klog.New(g.pre, g.k.db).Apply(msg)
+	if err != nil && err != klog.ErrPendingSignatures {
+		return err
+	}
+
+	// signatures from other members can complete the event
+	// before this member has seen it proposed
+	if _, ok := g.states[sn]; !ok {
+		g.states[sn] = GroupIdle
+	}
+
+	// applying an event can release later events from escrow as well
+	for seq, state := range g.states {
+		if state == GroupCompleted {
+			continue
+		}
+
+		accepted, err := g.k.db.EventAt(g.pre, seq)
+		if err != nil || accepted == nil {
+			continue
+		}
+
+		g.states[seq] = GroupCompleted
+
+		// the keys this member prepared are kept only if the
+		// group accepted the rotation to them
+		rot, ok := g.rotations[seq]
+		if ok {
+			delete(g.rotations, seq)
+
+			if accepted.Event.ILK() == event.ROT {
+				err = rot.Commit()
+			} else {
+				err = rot.Abandon()
+			}
+
+			if err != nil {
+				return errors.Wrap(err, "unable to rotate group keys")
+			}
+		}
+
+		if announce {
+			cm, err := NewGroupMessage(GroupComplete, accepted)
+			if err != nil {
+				return err
+			}
+
+			err = g.broadcast(cm)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (g *Group) isMember(pre string) bool {
+	for _, m := range g.members {
+		if m == pre {
+			return true
+		}
+	}
+
+	return false
+}
+
+// member returns the keys currently contributed by this member
+func (g *Group) member() *GroupMember {
+	key, next, _ := g.keys()
+
+	return &GroupMember{
+		Prefix: g.k.Prefix(),
+		Key:    key.AsPrefix(),
+		Next:   next.AsPrefix(),
+	}
+}
+
+// keys returns the key this member currently contributes, its next key and
+// a signer for it. Once a rotation is announced these are the keys of the
+// rotation, even though it has not been committed yet.
+func (g *Group) keys() (*derivation.Derivation, *derivation.Derivation, derivation.Signer) {
+	// only the next group event can be a rotation in progress
+	for _, rot := range g.rotations {
+		return rot.PublicKeys()[0], rot.NextKeys()[0], rot.SignerAt(0)
+	}
+
+	return g.kms.Public(), g.kms.Next(), g.kms.Signer()
+}
+
+// broadcast signs the message with the key this member currently
+// contributes and sends it to every other member
+func (g *Group) broadcast(m *GroupMessage) error {
+	m.From = g.k.Prefix()
+
+	data, err := m.signedBytes()
+	if err != nil {
+		return errors.Wrap(err, "unable to serialize group message")
+	}
+
+	key, _, signer := g.keys()
+	sig, err := indexedSignature(data, key, signer, 0)
+	if err != nil {
+		return errors.Wrap(err, "unable to sign group message")
+	}
+
+	m.Signature = sig.AsPrefix()
+
+	if m.Type == GroupJoin {
+		sigs, err := g.k.signatures(data)
+		if err != nil {
+			return errors.Wrap(err, "unable to endorse group join")
+		}
+
+		m.Endorsement = make([]string, len(sigs))
+		for i := range sigs {
+			m.Endorsement[i] = sigs[i].AsPrefix()
+		}
+	}
+
+	// a member that can't keep up must not stop the rest receiving the message
+	var failed error
+	for _, p := range g.peers {
+		err := p.send(m)
+		if err != nil {
+			failed = err
+		}
+	}
+
+	return failed
+}
+
+// groupPeer queues outgoing messages so a slow member
+// never blocks the handling of incoming messages
+type groupPeer struct {
+	out chan *GroupMessage
+}
+
+func (p *groupPeer) send(m *GroupMessage) error {
+	select {
+	case p.out <- m:
+		return nil
+	default:
+		return errors.Errorf("group peer queue full, unable to send %s message", m.Type)
+	}
+}
+
+func (p *groupPeer) write(enc *json.Encoder) {
+	for m := range p.out {
+		err := enc.Encode(m)
+		if err != nil {
+			log.Printf("unable to write group message (%v)\n", err)
+			return
+		}
+	}
+}
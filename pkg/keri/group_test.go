@@ -0,0 +1,301 @@
+package keri
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/decentralized-identity/kerigo/pkg/db/mem"
+	"github.com/decentralized-identity/kerigo/pkg/event"
+	testkms "github.com/decentralized-identity/kerigo/pkg/test/kms"
+)
+
+// connectedGroups returns the members of a group of size n,
+// connected to every other member
+// groupMembers returns n identifiers that hold each other's KELs
+func groupMembers(t *testing.T, n int) []*Keri {
+	ids := make([]*Keri, n)
+	for i := range ids {
+		db := mem.New()
+		k, err := New(testkms.GetKMS(t, nil, db), db)
+		assert.NoError(t, err)
+
+		ids[i] = k
+	}
+
+	for _, k := range ids {
+		for _, other := range ids {
+			icp, err := other.Inception()
+			assert.NoError(t, err)
+
+			_, err = k.ProcessEvents(icp)
+			assert.NoError(t, err)
+		}
+	}
+
+	return ids
+}
+
+func connectedGroups(t *testing.T, n int, opts ...GroupOption) []*Group {
+	groups := make([]*Group, n)
+	for i, k := range groupMembers(t, n) {
+		var err error
+		groups[i], err = NewGroup(k, testkms.GetKMS(t, nil, mem.New()), n, opts...)
+		assert.NoError(t, err)
+	}
+
+	for i := range groups {
+		for j := i + 1; j < len(groups); j++ {
+			a, b := net.Pipe()
+			assert.NoError(t, groups[i].Connect(a))
+			assert.NoError(t, groups[j].Connect(b))
+		}
+	}
+
+	return groups
+}
+
+func TestGroup(t *testing.T) {
+	groups := connectedGroups(t, 3, WithGroupApproval(func(*event.Event) error {
+		return nil
+	}))
+
+	completed := func(sn int) func() bool {
+		return func() bool {
+			for _, g := range groups {
+				if g.State(sn) != GroupCompleted {
+					return false
+				}
+			}
+			return true
+		}
+	}
+
+	assert.Eventually(t, completed(0), 5*time.Second, 10*time.Millisecond)
+
+	pre := groups[0].Prefix()
+	assert.NotEmpty(t, pre)
+
+	indexes := map[int]bool{}
+	for _, g := range groups {
+		assert.Equal(t, pre, g.Prefix())
+		assert.Equal(t, groups[0].Members(), g.Members())
+		indexes[g.Index()] = true
+	}
+	assert.Len(t, indexes, 3)
+
+	icp := groups[1].KEL().Inception()
+	assert.Len(t, icp.Keys, 3)
+	assert.Equal(t, "2", icp.SigThreshold.String())
+
+	// any member can propose an interaction
+	err := groups[1].Interaction(event.SealArray{})
+	assert.NoError(t, err)
+	assert.Eventually(t, completed(1), 5*time.Second, 10*time.Millisecond)
+
+	// and a rotation, which needs new keys from every member
+	err = groups[2].Rotate()
+	assert.NoError(t, err)
+	assert.Eventually(t, completed(2), 5*time.Second, 10*time.Millisecond)
+
+	for _, g := range groups {
+		kel := g.KEL()
+		assert.Equal(t, 3, kel.Size())
+		assert.Equal(t, event.ROT, kel.Current().ILK())
+		assert.Equal(t, g.kms.Public().AsPrefix(), kel.Current().Keys[g.Index()])
+
+		// enough members signed each event to meet the threshold
+		for sn := 0; sn < 3; sn++ {
+			assert.GreaterOrEqual(t, len(kel.EventAt(sn).Signatures), 2)
+		}
+	}
+
+	// members only rotate their keys for the next group event
+	key := func() string {
+		groups[1].lock.Lock()
+		defer groups[1].lock.Unlock()
+		return groups[1].kms.Public().AsPrefix()
+	}
+	current := key()
+
+	groups[0].lock.Lock()
+	err = groups[0].broadcast(&GroupMessage{Type: GroupRotate, Sequence: 7})
+	groups[0].lock.Unlock()
+	assert.NoError(t, err)
+
+	assert.Never(t, func() bool {
+		return key() != current || groups[1].State(7) != GroupIdle
+	}, 200*time.Millisecond, 10*time.Millisecond)
+}
+
+func TestGroupNotIncepted(t *testing.T) {
+	db := mem.New()
+	k, err := New(testkms.GetKMS(t, nil, db), db)
+	assert.NoError(t, err)
+
+	g, err := NewGroup(k, testkms.GetKMS(t, nil, mem.New()), 2)
+	assert.NoError(t, err)
+	assert.Empty(t, g.Prefix())
+	assert.Equal(t, -1, g.Index())
+
+	err = g.Interaction(event.SealArray{})
+	assert.Error(t, err)
+
+	err = g.Rotate()
+	assert.Error(t, err)
+
+	st, err := event.NewSigThreshold(3)
+	assert.NoError(t, err)
+
+	_, err = NewGroup(k, testkms.GetKMS(t, nil, mem.New()), 2, WithGroupThreshold(st))
+	assert.Error(t, err)
+}
+
+func TestGroupInteractionApproval(t *testing.T) {
+	groups := connectedGroups(t, 2)
+	assert.Eventually(t, func() bool {
+		return groups[0].State(0) == GroupCompleted && groups[1].State(0) == GroupCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// members do not sign interactions they have not approved
+	err := groups[0].Interaction(event.SealArray{})
+	assert.NoError(t, err)
+	assert.Never(t, func() bool {
+		return groups[0].State(1) == GroupCompleted || groups[1].State(1) != GroupIdle
+	}, 200*time.Millisecond, 10*time.Millisecond)
+}
+
+func TestGroupRotationMemberDropsOut(t *testing.T) {
+	groups := connectedGroups(t, 3, WithGroupRotationTimeout(200*time.Millisecond))
+	assert.Eventually(t, func() bool {
+		for _, g := range groups {
+			if g.State(0) != GroupCompleted {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	key := func(g *Group) string {
+		g.lock.Lock()
+		defer g.lock.Unlock()
+		return g.kms.Public().AsPrefix()
+	}
+
+	current := []string{key(groups[0]), key(groups[1])}
+
+	// the last member stops handling messages mid-rotation,
+	// so it never announces its new key
+	groups[2].lock.Lock()
+
+	err := groups[0].Rotate()
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		return groups[1].State(1) == GroupProposed
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the remaining members abandon the rotation and keep the keys
+	// that sign the current group state
+	assert.Eventually(t, func() bool {
+		return groups[0].State(1) == GroupIdle && groups[1].State(1) == GroupIdle
+	}, 5*time.Second, 10*time.Millisecond)
+
+	for i, g := range groups[:2] {
+		assert.Equal(t, current[i], key(g))
+
+		g.lock.Lock()
+		_, err = g.kms.Signer()([]byte("data"))
+		g.lock.Unlock()
+		assert.NoError(t, err)
+
+		assert.Equal(t, 1, g.KEL().Size())
+	}
+
+	// and the rotation can be retried
+	err = groups[0].Rotate()
+	assert.NoError(t, err)
+}
+
+func TestGroupMessages(t *testing.T) {
+	members := make([]*Group, 3)
+	for i, k := range groupMembers(t, 3) {
+		var err error
+		members[i], err = NewGroup(k, testkms.GetKMS(t, nil, mem.New()), 2)
+		assert.NoError(t, err)
+	}
+
+	g := members[0]
+	receive := func(m *GroupMessage) error {
+		g.lock.Lock()
+		defer g.lock.Unlock()
+
+		err := g.verifyMessage(m)
+		if err != nil {
+			return err
+		}
+
+		return g.handle(m)
+	}
+
+	join := *members[1].announced[0]
+
+	t.Run("forged", func(t *testing.T) {
+		forged := join
+		forged.Member = &GroupMember{Prefix: join.Member.Prefix, Key: members[2].kms.Public().AsPrefix(), Next: join.Member.Next}
+		assert.Error(t, receive(&forged))
+
+		unsigned := join
+		unsigned.Signature = ""
+		assert.Error(t, receive(&unsigned))
+
+		other := *members[2].announced[0]
+		other.From = join.From
+		assert.Error(t, receive(&other))
+
+		// keys can't be contributed under the prefix of another identifier
+		impostor := members[2]
+		m := &GroupMessage{Type: GroupJoin, From: join.From, Member: impostor.member()}
+		m.Member.Prefix = join.From
+
+		data, err := m.signedBytes()
+		assert.NoError(t, err)
+
+		sig, err := indexedSignature(data, impostor.kms.Public(), impostor.kms.Signer(), 0)
+		assert.NoError(t, err)
+		m.Signature = sig.AsPrefix()
+
+		sigs, err := impostor.k.signatures(data)
+		assert.NoError(t, err)
+		m.Endorsement = []string{sigs[0].AsPrefix()}
+		assert.Error(t, receive(m))
+
+		m.Endorsement = join.Endorsement
+		assert.Error(t, receive(m))
+
+		// or by identifiers we don't know
+		db := mem.New()
+		k, err := New(testkms.GetKMS(t, nil, db), db)
+		assert.NoError(t, err)
+
+		stranger, err := NewGroup(k, testkms.GetKMS(t, nil, mem.New()), 2)
+		assert.NoError(t, err)
+		assert.Error(t, receive(stranger.announced[0]))
+	})
+
+	t.Run("extra members", func(t *testing.T) {
+		assert.NoError(t, receive(&join))
+		assert.NotEmpty(t, g.Prefix())
+
+		assert.Error(t, receive(members[2].announced[0]))
+		assert.Len(t, g.Members(), 2)
+	})
+
+	t.Run("full queue", func(t *testing.T) {
+		p := &groupPeer{out: make(chan *GroupMessage, 1)}
+		assert.NoError(t, p.send(&join))
+		assert.Error(t, p.send(&join))
+	})
+}
@@ -1,10 +1,7 @@
 package keri
 
 import (
-	"crypto/ed25519"
-	"encoding/json"
-	"fmt"
-	"log"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -21,17 +18,35 @@ import (
 type Option func(*Keri) error
 
 type Keri struct {
-	pre   string
-	kms   *keymanager.KeyManager
-	db    db.DB
-	rcpts *Receipts
+	pre            string
+	kms            *keymanager.KeyManager
+	db             db.DB
+	rcpts          *Receipts
+	format         event.FORMAT
+	threshold      *event.SigThreshold
+	nextThreshold  *event.SigThreshold
+	delegator      string
+	delegation     *event.Message
+	rotation       *keymanager.Rotation
+	witnesses      []string
+	toad           int
+	traits         []prefix.Trait
+	ephemeral      bool
+	witnessClients map[string]WitnessClient
+	exnLock        sync.RWMutex
+	exnHandlers    map[string]ExchangeHandler
+	exnEscrow      map[string]map[string]time.Time
+	exnReplies     ExchangeReplyHandler
+	endLock        sync.Mutex
+	dupHandler     DuplicityHandler
 }
 
 func New(kms *keymanager.KeyManager, db db.DB, opts ...Option) (*Keri, error) {
 	k := &Keri{
-		db:    db,
-		kms:   kms,
-		rcpts: &Receipts{},
+		db:     db,
+		kms:    kms,
+		rcpts:  &Receipts{},
+		format: event.JSON,
 	}
 
 	for _, o := range opts {
@@ -41,21 +56,69 @@ func New(kms *keymanager.KeyManager, db db.DB, opts ...Option) (*Keri, error) {
 		}
 	}
 
-	icp, err := createInception(kms.PublicKey(), kms.Next())
+	if k.threshold == nil {
+		k.threshold = defaultThreshold(len(kms.PublicKeys()))
+	}
+
+	if k.nextThreshold == nil {
+		k.nextThreshold = defaultThreshold(len(kms.NextKeys()))
+	}
+
+	err := k.threshold.Validate(len(kms.PublicKeys()))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid signing threshold")
+	}
+
+	err = k.nextThreshold.Validate(len(kms.NextKeys()))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid next signing threshold")
+	}
+
+	var icpOpts []event.EventOption
+	if k.delegator != "" {
+		icpOpts = append(icpOpts, event.WithType(event.DIP), event.WithDelegator(k.delegator))
+	}
+
+	if len(k.witnesses) > 0 {
+		wits := make([]prefix.Prefix, len(k.witnesses))
+		for i, w := range k.witnesses {
+			wits[i], err = prefix.FromString(w)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid witness prefix %s", w)
+			}
+		}
+
+		icpOpts = append(icpOpts, event.WithWitnesses(wits...), event.WithWitnessThreshold(k.toad))
+	}
+
+	if len(k.traits) > 0 {
+		icpOpts = append(icpOpts, event.WithConfig(k.traits...))
+	}
+
+	var icp *event.Event
+	if k.ephemeral {
+		if k.delegator != "" || len(k.witnesses) > 0 {
+			return nil, errors.New("non-transferable identifiers can not be delegated or witnessed")
+		}
+
+		icp, err = createNonTransferableInception(kms.PublicKeys(), k.format, icpOpts...)
+	} else {
+		icp, err = createInception(kms.PublicKeys(), kms.NextKeys(), k.threshold, k.nextThreshold, k.format, icpOpts...)
+	}
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to create my own inception event")
 	}
 
 	k.pre = icp.Prefix
 
-	sig, err := k.sign(icp)
+	sigs, err := k.sign(icp)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to sign my inception event")
 	}
 
 	msg := &event.Message{
 		Event:      icp,
-		Signatures: []derivation.Derivation{*sig},
+		Signatures: sigs,
 	}
 
 	_, err = k.ProcessEvents(msg)
@@ -63,9 +126,105 @@ func New(kms *keymanager.KeyManager, db db.DB, opts ...Option) (*Keri, error) {
 		return nil, errors.Wrap(err, "unable to process my own inception event")
 	}
 
+	if !db.Seen(k.pre) {
+		k.delegation = msg
+	}
+
 	return k, nil
 }
 
+// WithFormat sets the serialization format used for all of the
+// events created for our own identifier
+func WithFormat(f event.FORMAT) Option {
+	return func(k *Keri) error {
+		switch f {
+		case event.JSON, event.CBOR, event.MSGPK:
+			k.format = f
+			return nil
+		}
+
+		return errors.New("unsupported event format")
+	}
+}
+
+// WithSigningThreshold sets the signing threshold for the keys
+// used in the inception event. Defaults to a majority of the keys.
+func WithSigningThreshold(st *event.SigThreshold) Option {
+	return func(k *Keri) error {
+		k.threshold = st
+		return nil
+	}
+}
+
+// WithNextThreshold sets the signing threshold committed to for the
+// pre-rotated next keys, which is used for every rotation. Defaults
+// to a majority of the next keys.
+func WithNextThreshold(st *event.SigThreshold) Option {
+	return func(k *Keri) error {
+		k.nextThreshold = st
+		return nil
+	}
+}
+
+// WithDelegator creates a delegated identifier, which is only accepted once
+// the delegator approves the inception by anchoring it in their own log
+func WithDelegator(pre string) Option {
+	return func(k *Keri) error {
+		if pre == "" {
+			return errors.New("delegator prefix required")
+		}
+
+		k.delegator = pre
+		return nil
+	}
+}
+
+// WithWitnesses designates the witnesses for our identifier along with
+// the number of witness receipts required for an event to be accepted
+func WithWitnesses(threshold int, pres ...string) Option {
+	return func(k *Keri) error {
+		if threshold < 1 || threshold > len(pres) {
+			return errors.New("witness threshold must be between 1 and the number of witnesses")
+		}
+
+		k.witnesses = pres
+		k.toad = threshold
+		return nil
+	}
+}
+
+// WithEstablishmentOnly creates an identifier that only accepts establishment
+// events, so anchoring data requires a rotation instead of an interaction event
+func WithEstablishmentOnly() Option {
+	return func(k *Keri) error {
+		k.traits = append(k.traits, prefix.EstablishmentOnly)
+		return nil
+	}
+}
+
+// WithDoNotDelegate creates an identifier that can't delegate other identifiers
+func WithDoNotDelegate() Option {
+	return func(k *Keri) error {
+		k.traits = append(k.traits, prefix.DoNotDelegate)
+		return nil
+	}
+}
+
+// WithNonTransferable creates an ephemeral identifier whose prefix is its
+// public key. It can sign receipts and messages, but never rotate its keys.
+func WithNonTransferable() Option {
+	return func(k *Keri) error {
+		k.ephemeral = true
+		return nil
+	}
+}
+
+// defaultThreshold requires a simple majority of the keys
+func defaultThreshold(keys int) *event.SigThreshold {
+	st, _ := event.NewSigThreshold(int64(keys/2 + 1))
+	return st
+}
+
 func (r *Keri) KEL() *klog.Log {
 	return klog.New(r.pre, r.db)
 }
@@ -77,15 +236,25 @@ func (r *Keri) ProcessEvents(msgs ...*event.Message) ([]*event.Message, error) {
 		switch msg.Event.ILK() {
 		case event.ICP, event.ROT, event.DIP, event.IXN, event.DRT:
 			err := r.ProcessEvent(msg)
+			switch errors.Cause(err) {
+			case klog.ErrMissingDelegation, klog.ErrPartiallyWitnessed:
+				// the event is receipted once the delegator approves
+				// it or enough of its witnesses have receipted it
+				continue
+			}
+
 			if err != nil {
 				return nil, err
 			}
 
-			if msg.Event.Prefix == r.pre {
+			r.processExchangeEscrow(msg.Event.Prefix)
+
+			// we can't receipt until our own (delegated) inception is accepted
+			if msg.Event.Prefix == r.pre || !r.db.Seen(r.pre) {
 				continue
 			}
 
-			vrc, err := r.generateReceipt(msg.Event)
+			vrc, err := r.generateReceipt(msg)
 			if err != nil {
 				return nil, errors.Wrap(err, "unable to generate single vrc")
 			}
@@ -98,7 +267,64 @@ func (r *Keri) ProcessEvents(msgs ...*event.Message) ([]*event.Message, error) {
 				return nil, err
 			}
 		case event.RCT:
-			log.Println(event.RCT, "not supported, yet")
+			err := r.ProcessNonTransferableReceipt(msg)
+			if err != nil {
+				return nil, err
+			}
+
+			err = r.ProcessWitnessReceipts(msg)
+			if err != nil {
+				return nil, err
+			}
+		case event.EXN:
+			reply, err := r.ProcessExchange(msg)
+			if err != nil {
+				return nil, err
+			}
+
+			out = append(out, reply...)
+		case event.QRY:
+			reply, err := r.Reply(msg)
+			if err != nil {
+				return nil, err
+			}
+
+			out = append(out, reply...)
+		case event.RPY:
+			if msg.Event.Route == event.EndRoleRoute {
+				err := r.ProcessEndRole(msg)
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			err := r.verifySender(msg)
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid rpy")
+			}
+		case event.KSN:
+			if !event.IsKeyStateNoticeRequest(msg) {
+				_, err := r.ProcessKeyStateNotice(msg)
+
+				// we may be behind the notice, so it can't be verified yet
+				if err != nil && err != ErrUnverifiedKeyStateNotice {
+					return nil, err
+				}
+				continue
+			}
+
+			// others only trust notices from the controller, its witnesses and watchers
+			if !r.db.Seen(r.pre) || !r.publishesKeyState(msg.Event.Prefix) {
+				continue
+			}
+
+			ksn, err := r.KeyStateNotice(msg.Event.Prefix)
+			if err != nil {
+				return nil, err
+			}
+
+			out = append(out, ksn)
 		}
 
 	}
@@ -123,49 +349,170 @@ func (r *Keri) Inception() (*event.Message, error) {
 	return icp, nil
 }
 
-func (r *Keri) Rotate() (*event.Message, error) {
-	err := r.kms.Rotate()
+// PendingDelegation returns our own delegated establishment event that is
+// waiting to be approved by the delegator, or nil if there is none
+func (r *Keri) PendingDelegation() *event.Message {
+	if r.delegation == nil {
+		return nil
+	}
 
-	cur, err := r.db.CurrentEvent(r.pre)
+	accepted, err := r.db.EventAt(r.pre, r.delegation.Event.SequenceInt())
+	if err == nil && accepted != nil {
+		dig, _ := accepted.Digest()
+		pending, _ := r.delegation.Digest()
+		if dig == pending {
+			return nil
+		}
+	}
+
+	return r.delegation
+}
+
+// ApproveDelegation approves an event for an identifier delegated by us by
+// anchoring a seal of the event in a new interaction event
+func (r *Keri) ApproveDelegation(msg *event.Message) (*event.Message, error) {
+	evt := msg.Event
+
+	da := evt.DelegatorSeal
+	switch evt.ILK() {
+	case event.DIP:
+	case event.DRT:
+		if da == nil {
+			icp, err := r.db.Inception(evt.Prefix)
+			if err != nil {
+				return nil, errors.Wrap(err, "unknown delegated identifier")
+			}
+			da = icp.Event.DelegatorSeal
+		}
+	default:
+		return nil, errors.Errorf("unable to approve %s event", evt.EventType)
+	}
+
+	if da == nil || da.Prefix != r.pre {
+		return nil, errors.New("event is not delegated by this identifier")
+	}
+
+	if r.hasTrait(prefix.DoNotDelegate) {
+		return nil, errors.New("this identifier does not allow delegation")
+	}
+
+	dig, err := msg.Digest()
 	if err != nil {
-		return nil, errors.Wrap(err, "unexpected error getting my KEL")
+		return nil, err
 	}
 
-	dig, err := cur.Event.GetDigest()
-	sn := cur.Event.SequenceInt() + 1
+	seal, err := event.NewEventSeal(dig, evt.Prefix, evt.Sequence)
+	if err != nil {
+		return nil, err
+	}
+
+	// establishment only identifiers anchor the seal in a rotation
+	if r.hasTrait(prefix.EstablishmentOnly) {
+		return r.Rotate(seal)
+	}
+
+	return r.Interaction(event.SealArray{seal})
+}
+
+// Rotate rotates to the pre-rotated keys, anchoring any provided seals
+// in the rotation event. Delegated identifiers create a delegated rotation
+// which is only accepted once the delegator approves it. The key manager
+// only rotates once the rotation event has been accepted, so a delegated
+// rotation stays pending until the delegator's approval is processed.
+func (r *Keri) Rotate(seals ...*event.Seal) (*event.Message, error) {
+	if r.ephemeral {
+		return nil, errors.New("non-transferable identifier can not rotate")
+	}
+
+	if r.rotation != nil {
+		return nil, errors.New("delegated rotation waiting for approval")
+	}
+
+	keys, err := r.kms.PrepareRotation()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to rotate keys")
+	}
 
-	keyDer, err := derivation.New(derivation.WithCode(derivation.Ed25519), derivation.WithRaw(r.kms.PublicKey()))
+	msg, err := r.rotate(keys, seals)
 	if err != nil {
+		_ = keys.Abandon()
 		return nil, err
 	}
-	keyPre := prefix.New(keyDer)
 
-	nextKeyPre := prefix.New(r.kms.Next())
+	if r.PendingDelegation() == msg {
+		r.rotation = keys
+		return msg, nil
+	}
+
+	err = keys.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to rotate keys")
+	}
+
+	return msg, nil
+}
+
+// rotate creates, signs and processes our rotation event to the keys
+func (r *Keri) rotate(keys *keymanager.Rotation, seals []*event.Seal) (*event.Message, error) {
+	cur, err := r.db.CurrentEvent(r.pre)
+	if err != nil {
+		return nil, errors.Wrap(err, "unexpected error getting my KEL")
+	}
+
+	dig, err := cur.Digest()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to digest my current event")
+	}
 
-	rot, err := event.NewRotationEvent(
+	sn := cur.Event.SequenceInt() + 1
+
+	// the new signing keys are bound by the threshold committed to in
+	// the prior establishment event
+	opts := []event.EventOption{
 		event.WithPrefix(cur.Event.Prefix),
 		event.WithDigest(dig),
-		event.WithKeys(keyPre),
-		event.WithDefaultVersion(event.JSON),
+		event.WithKeys(keyPrefixes(keys.PublicKeys())...),
+		event.WithSigThreshold(r.nextThreshold),
+		event.WithDefaultVersion(r.format),
 		event.WithSequence(sn),
-		event.WithNext("1", derivation.Blake3256, nextKeyPre),
-	)
+		event.WithNext(r.nextThreshold.String(), derivation.Blake3256, keyPrefixes(keys.NextKeys())...),
+	}
+
+	if len(seals) > 0 {
+		opts = append(opts, event.WithSeals(seals))
+	}
+
+	if r.delegator != "" {
+		opts = append(opts, event.WithType(event.DRT), event.WithDelegator(r.delegator))
+	}
+
+	rot, err := event.NewRotationEvent(opts...)
 
 	if err != nil {
 		return nil, err
 	}
 
-	sig, err := r.sign(rot)
+	rotData, err := rot.Serialize()
 	if err != nil {
-		return nil, errors.Wrap(err, "unable to sign my inception event")
+		return nil, errors.Wrap(err, "unexpected error serializing event")
+	}
+
+	sigs, err := signWith(rotData, keys.PublicKeys(), keys.SignerAt)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to sign my rotation event")
 	}
 
 	msg := &event.Message{
 		Event:      rot,
-		Signatures: []derivation.Derivation{*sig},
+		Signatures: sigs,
 	}
 
 	err = r.ProcessEvent(msg)
+	if errors.Cause(err) == klog.ErrMissingDelegation {
+		r.delegation = msg
+		return msg, nil
+	}
+
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to process my own rotation event")
 	}
@@ -174,18 +521,34 @@ func (r *Keri) Rotate() (*event.Message, error) {
 }
 
 func (r *Keri) Interaction(payload event.SealArray) (*event.Message, error) {
+	if r.rotation != nil {
+		return nil, errors.New("delegated rotation waiting for approval")
+	}
+
+	if r.hasTrait(prefix.EstablishmentOnly) {
+		return nil, errors.New("establishment only identifier can not create interaction events")
+	}
+
+	if r.ephemeral {
+		return nil, errors.New("non-transferable identifier can not create interaction events")
+	}
+
 	cur, err := r.db.CurrentEvent(r.pre)
 	if err != nil {
 		return nil, errors.Wrap(err, "unexpected error getting my KEL")
 	}
 
-	dig, err := cur.Event.GetDigest()
+	dig, err := cur.Digest()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to digest my current event")
+	}
+
 	sn := cur.Event.SequenceInt() + 1
 
 	ixn, err := event.NewInteractionEvent(
 		event.WithPrefix(cur.Event.Prefix),
 		event.WithDigest(dig),
-		event.WithDefaultVersion(event.JSON),
+		event.WithDefaultVersion(r.format),
 		event.WithSequence(sn),
 		event.WithSeals(payload),
 	)
@@ -193,14 +556,14 @@ func (r *Keri) Interaction(payload event.SealArray) (*event.Message, error) {
 		return nil, err
 	}
 
-	sig, err := r.sign(ixn)
+	sigs, err := r.sign(ixn)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to sign my ixn event")
 	}
 
 	msg := &event.Message{
 		Event:      ixn,
-		Signatures: []derivation.Derivation{*sig},
+		Signatures: sigs,
 	}
 
 	err = r.ProcessEvent(msg)
@@ -212,6 +575,16 @@ func (r *Keri) Interaction(payload event.SealArray) (*event.Message, error) {
 
 }
 
+// hasTrait returns true if our identifier was incepted with the trait
+func (r *Keri) hasTrait(t prefix.Trait) bool {
+	ks, err := r.KEL().KeyState()
+	if err != nil {
+		return false
+	}
+
+	return ks.HasTrait(t)
+}
+
 func (r *Keri) FindConnection(prefix string) (*klog.Log, error) {
 	if !r.db.Seen(prefix) {
 		return nil, errors.New("not found")
@@ -253,33 +626,32 @@ func (r *Keri) WaitForReceipt(evt *event.Event, timeout time.Duration) (chan *ev
 	return out, errOut
 }
 
-func (r *Keri) generateReceipt(evt *event.Event) (*event.Message, error) {
+func (r *Keri) generateReceipt(msg *event.Message) (*event.Message, error) {
+	evt := msg.Event
 
 	latestEst, err := r.db.CurrentEstablishmentEvent(r.pre)
 	if err != nil {
 		return nil, errors.Wrap(err, "unexpected error getting current KEL")
 	}
 
-	var rcpt *event.Receipt
-	var sig *derivation.Derivation
+	//Sign the receipted event, not the receipt
+	evtData, err := msg.Raw()
+	if err != nil {
+		return nil, errors.Wrap(err, "unexpected error marshalling receipted event")
+	}
+
 	if latestEst.Event.Next == "" {
-		sig, err = derivation.New(derivation.WithCode(derivation.Ed25519Attached), derivation.WithSigner(r.kms.Signer()))
+		sig, err := derivation.New(derivation.WithCode(r.kms.SignatureCode()), derivation.WithSigner(r.kms.Signer()))
 		if err != nil {
 			return nil, errors.Wrap(err, "unexpected error getting new derivation")
 		}
 
-		//Sign the receipted event, not the receipt
-		evtData, err := json.Marshal(evt)
-		if err != nil {
-			return nil, errors.Wrap(err, "unexpected error marshalling receipted event")
-		}
-
 		_, err = sig.Derive(evtData)
 		if err != nil {
 			return nil, errors.Wrap(err, "unable to derive signature")
 		}
 
-		rcpt, err = event.NewReceipt(evt, event.WithSignature(sig), event.WithSignerPrefix(latestEst.Event.Prefix))
+		rcpt, err := event.NewReceipt(evt, event.WithSignature(sig), event.WithSignerPrefix(latestEst.Event.Prefix))
 		if err != nil {
 			return nil, errors.Wrap(err, "unable to generate receipt:")
 		}
@@ -288,25 +660,19 @@ func (r *Keri) generateReceipt(evt *event.Event) (*event.Message, error) {
 		if err != nil {
 			return nil, errors.Wrap(err, "unable to log receipt")
 		}
-	} else {
 
-		sig, err = derivation.New(derivation.WithCode(derivation.Ed25519Attached), derivation.WithSigner(r.kms.Signer()))
-		if err != nil {
-			return nil, errors.Wrap(err, "unexpected error getting new derivation")
-		}
-
-		//Sign the receipted event, not the receipt
-		evtData, err := evt.Serialize()
-		if err != nil {
-			return nil, errors.Wrap(err, "unexpected error marshalling receipted event")
-		}
+		return rcpt.Message()
+	}
 
-		_, err = sig.Derive(evtData)
-		if err != nil {
-			return nil, errors.Wrap(err, "unable to derive signature")
-		}
+	// transferable receipts are signed by every current key
+	sigs, err := r.signatures(evtData)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to derive signature")
+	}
 
-		rcpt, err = event.NewReceipt(evt, event.WithSignature(sig), event.WithEstablishmentEvent(latestEst.Event))
+	var rcpt *event.Receipt
+	for i := range sigs {
+		rcpt, err = event.NewReceipt(evt, event.WithSignature(&sigs[i]), event.WithEstablishmentEvent(latestEst.Event))
 		if err != nil {
 			return nil, errors.Wrap(err, "unable to generate receipt:")
 		}
@@ -317,25 +683,67 @@ func (r *Keri) generateReceipt(evt *event.Event) (*event.Message, error) {
 		}
 	}
 
-	return rcpt.Message()
+	vrc, err := rcpt.Message()
+	if err != nil {
+		return nil, err
+	}
+
+	vrc.Signatures = sigs
+	return vrc, nil
+}
+
+// sign signs the event with every current key, returning
+// the indexed signatures in key order
+func (r *Keri) sign(evt *event.Event) ([]derivation.Derivation, error) {
+	evtData, err := evt.Serialize()
+	if err != nil {
+		return nil, errors.Wrap(err, "unexpected error serializing event")
+	}
+
+	return r.signatures(evtData)
+}
+
+// signatures signs the data with every current key, returning
+// the indexed signatures in key order
+func (r *Keri) signatures(evtData []byte) ([]derivation.Derivation, error) {
+	return signWith(evtData, r.kms.PublicKeys(), r.kms.SignerAt)
+}
+
+// signWith signs the data with each of the keys, returning
+// the indexed signatures in key order
+func signWith(data []byte, keys []*derivation.Derivation, signerAt func(int) derivation.Signer) ([]derivation.Derivation, error) {
+	sigs := make([]derivation.Derivation, len(keys))
+	for i, key := range keys {
+		sig, err := indexedSignature(data, key, signerAt(i), i)
+		if err != nil {
+			return nil, err
+		}
+
+		sigs[i] = *sig
+	}
+
+	return sigs, nil
 }
 
-func (r *Keri) sign(evt *event.Event) (*derivation.Derivation, error) {
-	sig, err := derivation.New(derivation.WithCode(derivation.Ed25519Attached), derivation.WithSigner(r.kms.Signer()))
+// indexedSignature signs the data with the signer for the key at the index
+func indexedSignature(data []byte, key *derivation.Derivation, signer derivation.Signer, idx int) (*derivation.Derivation, error) {
+	code, err := key.Code.AttachedSignatureCode()
 	if err != nil {
-		return nil, errors.Wrap(err, "unable to create signer derivation")
+		return nil, err
 	}
 
-	evtData, err := json.Marshal(evt)
+	sig, err := derivation.New(derivation.WithCode(code), derivation.WithSigner(signer))
 	if err != nil {
-		return nil, errors.Wrap(err, "unexpected error marshaling event")
+		return nil, errors.Wrap(err, "unable to create signer derivation")
 	}
 
-	_, err = sig.Derive(evtData)
+	_, err = sig.Derive(data)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to sign event")
 	}
 
+	sig.KeyIndex = uint16(idx)
+
 	return sig, nil
 }
 
@@ -343,56 +751,134 @@ func (r *Keri) ProcessEvent(msg *event.Message) error {
 
 	evt := msg.Event
 
-	var kel *klog.Log
-	kel = klog.New(evt.Prefix, r.db)
+	// our own events are accepted before our witnesses receipt them
+	var opts []klog.Option
+	if evt.Prefix == r.pre {
+		opts = append(opts, klog.AcceptUnwitnessed())
+	}
+
+	kel := klog.New(evt.Prefix, r.db, opts...)
 
 	err := kel.Apply(msg)
+	if err == klog.ErrDuplicitous {
+		r.notifyDuplicity(kel, msg)
+	}
+
 	if err != nil {
-		return fmt.Errorf("unable to apply message: (%v)", err)
+		return errors.Wrap(err, "unable to apply message")
 	}
 
-	return nil
+	return r.commitDelegatedRotation()
 }
 
-func (r *Keri) ProcessReceipt(vrc *event.Message) error {
-	seal := vrc.Event.Seals[0]
-	if !r.db.Seen(vrc.Event.Prefix) {
-		return errors.New("unexpected error, received a receipt for an unknown prefix")
+// commitDelegatedRotation rotates the key manager to the keys of our
+// delegated rotation once the delegator's approval has released it
+func (r *Keri) commitDelegatedRotation() error {
+	if r.rotation == nil || r.PendingDelegation() != nil {
+		return nil
 	}
 
-	kel := klog.New(vrc.Event.Prefix, r.db)
+	keys := r.rotation
+	r.rotation = nil
 
-	evt := kel.EventAt(vrc.Event.SequenceInt())
-	if evt == nil {
-		//TODO: Haven't seen the target event yet, add to vrc escrow
-		return errors.New("unverified transferable receipt")
+	err := keys.Commit()
+	if err != nil {
+		return errors.Wrap(err, "unable to rotate keys")
 	}
 
-	if !r.db.Seen(seal.Prefix) {
-		//TODO: Haven't seen the receipter kel yet, add to vrc escrow
-		return errors.New("unverified transferable receipt")
+	return nil
+}
+
+// ProcessNonTransferableReceipt verifies and stores the receipts in an rct
+// message from signers with non-transferable identifiers. Receipts for
+// events we have not seen yet are escrowed until the event is accepted.
+func (r *Keri) ProcessNonTransferableReceipt(rct *event.Message) error {
+	rcpts := rct.NonTransferableReceipts
+
+	// receipts written in disjoint mode name the signer in a seal
+	if len(rcpts) == 0 && len(rct.Event.Seals) > 0 {
+		for i := range rct.Signatures {
+			rcpt, err := event.NewReceipt(rct.Event,
+				event.WithSignerPrefix(rct.Event.Seals[0].Prefix),
+				event.WithSignature(&rct.Signatures[i]),
+			)
+			if err != nil {
+				return errors.Wrap(err, "invalid rct")
+			}
+
+			rcpts = append(rcpts, rcpt)
+		}
 	}
 
-	receiptorKEL := klog.New(seal.Prefix, r.db)
+	kel := klog.New(rct.Event.Prefix, r.db)
+	for _, rcpt := range rcpts {
+		err := kel.ApplyNonTransferableReceipt(rcpt)
+		if err != nil && err != klog.ErrReceiptEscrowed {
+			return errors.Wrap(err, "unable to apply rct")
+		}
+	}
 
-	estEvt := receiptorKEL.EventAt(seal.SequenceInt())
-	if estEvt == nil {
-		//TODO: Haven't seen the establishment event yet, add to vrc escrow
-		return errors.New("unverified transferable receipt")
+	return nil
+}
+
+// ProcessWitnessReceipts verifies and stores the witness receipts in an
+// rct message. Receipts for events in the partially witnessed escrow may
+// result in the event being accepted.
+func (r *Keri) ProcessWitnessReceipts(rct *event.Message) error {
+	kel := klog.New(rct.Event.Prefix, r.db)
+	for _, rcpt := range rct.WitnessReceipts {
+		err := kel.ApplyWitnessReceipt(rcpt)
+		if err != nil {
+			return errors.Wrap(err, "unable to apply witness receipt")
+		}
 	}
 
-	dig, err := estEvt.Event.GetDigest()
-	if err != nil {
-		return err
+	return nil
+}
+
+// ProcessReceipt verifies and stores the transferable receipts in a vrc
+// message against the establishment event of the receiptor. Receipts that
+// can not be verified yet, because we have not seen the receipted event or
+// the receiptor's establishment event, are escrowed until we have.
+func (r *Keri) ProcessReceipt(vrc *event.Message) error {
+	rcpts := vrc.TransferableReceipts
+
+	// receipts written in disjoint mode seal the receiptor's establishment event
+	if len(vrc.Event.Seals) > 0 {
+		for i := range vrc.Signatures {
+			rcpt, err := event.NewReceipt(vrc.Event,
+				event.WithSignature(&vrc.Signatures[i]),
+				event.WithEstablishmentSeal(vrc.Event.Seals[0]),
+			)
+			if err != nil {
+				return errors.Wrap(err, "invalid vrc")
+			}
+
+			rcpts = append(rcpts, rcpt)
+		}
 	}
 
-	if dig != seal.Digest {
-		return errors.New("invalid vrc seal")
+	if len(rcpts) == 0 {
+		return errors.New("no receipts in vrc")
 	}
 
-	err = kel.ApplyReceipt(evt.Event, vrc)
-	if err != nil {
-		return errors.Wrap(err, "unable to apply vrc")
+	kel := klog.New(vrc.Event.Prefix, r.db)
+
+	escrowed := false
+	for _, rcpt := range rcpts {
+		err := kel.ApplyTransferableReceipt(rcpt)
+		if err == klog.ErrReceiptEscrowed {
+			escrowed = true
+			continue
+		}
+
+		if err != nil {
+			return errors.Wrap(err, "unable to apply vrc")
+		}
+	}
+
+	if escrowed {
+		return nil
 	}
 
 	for _, ch := range r.rcpts.RcptChans() {
@@ -402,32 +888,30 @@ func (r *Keri) ProcessReceipt(vrc *event.Message) error {
 	return nil
 }
 
-func createInception(signing ed25519.PublicKey, next *derivation.Derivation) (*event.Event, error) {
-	keyDer, err := derivation.New(derivation.WithCode(derivation.Ed25519), derivation.WithRaw(signing))
-	if err != nil {
-		return nil, err
-	}
-
-	keyPre := prefix.New(keyDer)
-
-	nextKeyPre := prefix.New(next)
+func createInception(signing, next []*derivation.Derivation, threshold, nextThreshold *event.SigThreshold, format event.FORMAT, opts ...event.EventOption) (*event.Event, error) {
+	opts = append([]event.EventOption{
+		event.WithKeys(keyPrefixes(signing)...),
+		event.WithSigThreshold(threshold),
+		event.WithDefaultVersion(format),
+		event.WithNext(nextThreshold.String(), derivation.Blake3256, keyPrefixes(next)...),
+	}, opts...)
 
-	icp, err := event.NewInceptionEvent(event.WithKeys(keyPre), event.WithDefaultVersion(event.JSON), event.WithNext("1", derivation.Blake3256, nextKeyPre))
+	icp, err := event.NewInceptionEvent(opts...)
 	if err != nil {
 		return nil, err
 	}
 
 	// Serialize with defaults to get correct length for version string
 	icp.Prefix = derivation.Blake3256.Default()
-	icp.Version = event.DefaultVersionString(event.JSON)
-	eventBytes, err := event.Serialize(icp, event.JSON)
+	icp.Version = event.DefaultVersionString(format)
+	eventBytes, err := event.Serialize(icp, format)
 	if err != nil {
 		return nil, err
 	}
 
-	icp.Version = event.VersionString(event.JSON, version.Code(), len(eventBytes))
+	icp.Version = event.VersionString(format, version.Code(), len(eventBytes))
 
-	ser, err := event.Serialize(icp, event.JSON)
+	ser, err := event.Serialize(icp, format)
 	if err != nil {
 		return nil, err
 	}
@@ -450,3 +934,53 @@ func createInception(signing ed25519.PublicKey, next *derivation.Derivation) (*e
 
 	return icp, nil
 }
+
+// createNonTransferableInception returns an inception event for the basic
+// prefix derived from the single signing key, which commits to no next keys
+func createNonTransferableInception(signing []*derivation.Derivation, format event.FORMAT, opts ...event.EventOption) (*event.Event, error) {
+	if len(signing) != 1 {
+		return nil, errors.New("non-transferable identifiers require a single key")
+	}
+
+	key := signing[0]
+	nt, err := key.Code.NonTransferableCode()
+	if err != nil {
+		return nil, errors.Wrap(err, "unsupported non-transferable key")
+	}
+
+	basic, err := derivation.New(derivation.WithCode(nt), derivation.WithRaw(key.Raw))
+	if err != nil {
+		return nil, err
+	}
+
+	pre := prefix.New(basic)
+
+	opts = append([]event.EventOption{
+		event.WithPrefix(pre.String()),
+		event.WithKeys(pre),
+		event.WithDefaultVersion(format),
+	}, opts...)
+
+	icp, err := event.NewInceptionEvent(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	eventBytes, err := event.Serialize(icp, format)
+	if err != nil {
+		return nil, err
+	}
+
+	icp.Version = event.VersionString(format, version.Code(), len(eventBytes))
+
+	return icp, nil
+}
+
+func keyPrefixes(keys []*derivation.Derivation) []prefix.Prefix {
+	pres := make([]prefix.Prefix, len(keys))
+	for i, k := range keys {
+		pres[i] = prefix.New(k)
+	}
+
+	return pres
+}
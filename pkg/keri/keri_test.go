@@ -1,15 +1,20 @@
 package keri
 
 import (
+	"bytes"
 	"encoding/base64"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/decentralized-identity/kerigo/pkg/db/mem"
+	"github.com/decentralized-identity/kerigo/pkg/derivation"
 	"github.com/decentralized-identity/kerigo/pkg/encoding/stream"
 	"github.com/decentralized-identity/kerigo/pkg/event"
+	"github.com/decentralized-identity/kerigo/pkg/keymanager"
+	"github.com/decentralized-identity/kerigo/pkg/prefix"
 	testkms "github.com/decentralized-identity/kerigo/pkg/test/kms"
 )
 
@@ -157,6 +162,32 @@ func TestInteractionEvent(t *testing.T) {
 
 }
 
+func TestRotateFailure(t *testing.T) {
+	db := mem.New()
+	k, err := New(testkms.GetKMS(t, nil, db), db)
+	assert.NoError(t, err)
+
+	cur, next := k.kms.Public().AsPrefix(), k.kms.Next().AsPrefix()
+
+	// a rotation that is not accepted leaves the keys where they were
+	threshold := k.nextThreshold
+	k.nextThreshold, err = event.NewSigThreshold(2)
+	assert.NoError(t, err)
+
+	_, err = k.Rotate()
+	assert.Error(t, err)
+	assert.Equal(t, cur, k.kms.Public().AsPrefix())
+	assert.Equal(t, next, k.kms.Next().AsPrefix())
+	assert.Equal(t, 1, k.KEL().Size())
+
+	k.nextThreshold = threshold
+	rot, err := k.Rotate()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{next}, rot.Event.Keys)
+	assert.Equal(t, next, k.kms.Public().AsPrefix())
+	assert.Equal(t, 2, k.KEL().Size())
+}
+
 func TestFindConnection(t *testing.T) {
 	secrets := []string{"ADW3o9m3udwEf0aoOdZLLJdf1aylokP0lwwI_M2J9h0s", "AagumsL8FeGES7tYcnr_5oN6qcwJzZfLKxoniKUpG4qc"}
 
@@ -197,3 +228,653 @@ func TestFindConnection(t *testing.T) {
 	})
 
 }
+
+func TestWithFormat(t *testing.T) {
+	eveSecrets := []string{"ArwXoACJgOleVZ2PY7kXn7rA0II0mHYDhc6WrBH8fDAc", "A6zz7M08-HQSFq92sJ8KJOT2cZ47x7pXFQLPB0pckB3Q"}
+	bobSecrets := []string{"ADW3o9m3udwEf0aoOdZLLJdf1aylokP0lwwI_M2J9h0s", "AagumsL8FeGES7tYcnr_5oN6qcwJzZfLKxoniKUpG4qc", "AagumsL8FeGES7tYcnr_5oN6qcwJzZfLKxoniKUpG4qc"}
+
+	eve, err := New(testkms.GetKMS(t, eveSecrets, mem.New()), mem.New())
+	assert.NoError(t, err)
+
+	bob, err := New(testkms.GetKMS(t, bobSecrets, mem.New()), mem.New(), WithFormat(event.MSGPK))
+	assert.NoError(t, err)
+
+	icp, err := bob.Inception()
+	assert.NoError(t, err)
+	assert.Equal(t, "KERI10MGPK", icp.Event.Version[:10])
+
+	rot, err := bob.Rotate()
+	assert.NoError(t, err)
+	assert.Equal(t, "KERI10MGPK", rot.Event.Version[:10])
+
+	ixn, err := bob.Interaction([]*event.Seal{})
+	assert.NoError(t, err)
+	assert.Equal(t, "KERI10MGPK", ixn.Event.Version[:10])
+
+	// round trip bob's KEL over the wire to eve
+	buf := &bytes.Buffer{}
+	err = stream.NewWriter(buf).WriteAll([]*event.Message{icp, rot, ixn})
+	assert.NoError(t, err)
+
+	msgs, err := stream.NewReader(buf).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 3)
+
+	rcpts, err := eve.ProcessEvents(msgs...)
+	assert.NoError(t, err)
+	assert.Len(t, rcpts, 3)
+
+	kel, err := eve.FindConnection(bob.Prefix())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, kel.Size())
+
+	_, err = New(testkms.GetKMS(t, bobSecrets, mem.New()), mem.New(), WithFormat(event.EDS))
+	assert.Error(t, err)
+}
+
+func TestKeyTypes(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyType keymanager.KeyType
+		code    string
+		sigCode derivation.Code
+	}{
+		{name: "secp256k1", keyType: keymanager.Secp256k1Key, code: "1AAB", sigCode: derivation.EcDSAAttached},
+		{name: "p256", keyType: keymanager.P256Key, code: "1AAJ", sigCode: derivation.EcDSA256r1Attached},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testKeyType(t, tt.keyType, tt.code, tt.sigCode)
+		})
+	}
+}
+
+func testKeyType(t *testing.T, keyType keymanager.KeyType, code string, sigCode derivation.Code) {
+	eveSecrets := []string{"ArwXoACJgOleVZ2PY7kXn7rA0II0mHYDhc6WrBH8fDAc", "A6zz7M08-HQSFq92sJ8KJOT2cZ47x7pXFQLPB0pckB3Q"}
+	bobSecrets := []string{"ADW3o9m3udwEf0aoOdZLLJdf1aylokP0lwwI_M2J9h0s", "AagumsL8FeGES7tYcnr_5oN6qcwJzZfLKxoniKUpG4qc", "AK-nVhMMJciMPvmF5VZE_9H-nhrgng9aJWf7_UHPtRNM"}
+
+	eve, err := New(testkms.GetKMS(t, eveSecrets, mem.New()), mem.New())
+	assert.NoError(t, err)
+
+	bob, err := New(testkms.GetKMS(t, bobSecrets, mem.New(), keymanager.WithKeyType(keyType)), mem.New())
+	assert.NoError(t, err)
+
+	icp, err := bob.Inception()
+	assert.NoError(t, err)
+	assert.Equal(t, code, icp.Event.Keys[0][:4])
+	assert.Equal(t, sigCode, icp.Signatures[0].Code)
+
+	rot, err := bob.Rotate()
+	assert.NoError(t, err)
+
+	ixn, err := bob.Interaction(event.SealArray{})
+	assert.NoError(t, err)
+
+	// send bob's log over the wire to eve to verify
+	buf := &bytes.Buffer{}
+	err = stream.NewWriter(buf).WriteAll([]*event.Message{icp, rot, ixn})
+	assert.NoError(t, err)
+
+	msgs, err := stream.NewReader(buf).ReadAll()
+	assert.NoError(t, err)
+
+	rcpts, err := eve.ProcessEvents(msgs...)
+	assert.NoError(t, err)
+	assert.Len(t, rcpts, 3)
+
+	kel, err := eve.FindConnection(bob.Prefix())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, kel.Size())
+
+	// and eve's receipts back to bob
+	eveICP, err := eve.Inception()
+	assert.NoError(t, err)
+
+	_, err = bob.ProcessEvents(append([]*event.Message{eveICP}, rcpts...)...)
+	assert.NoError(t, err)
+}
+
+func TestMultiKey(t *testing.T) {
+	eve, err := New(testkms.GetKMS(t, nil, mem.New()), mem.New())
+	assert.NoError(t, err)
+
+	kt, err := event.NewWeighted("1/2", "1/2", "1/2")
+	assert.NoError(t, err)
+
+	nt, err := event.NewWeighted("1/2", "1/4", "1/4")
+	assert.NoError(t, err)
+
+	bob, err := New(testkms.GetKMS(t, nil, mem.New(), keymanager.WithKeyCount(3)), mem.New(), WithSigningThreshold(kt), WithNextThreshold(nt))
+	assert.NoError(t, err)
+
+	icp, err := bob.Inception()
+	assert.NoError(t, err)
+	assert.Len(t, icp.Event.Keys, 3)
+	assert.Equal(t, kt.String(), icp.Event.SigThreshold.String())
+	assert.Len(t, icp.Signatures, 3)
+	for i, sig := range icp.Signatures {
+		assert.Equal(t, uint16(i), sig.KeyIndex)
+	}
+
+	rot, err := bob.Rotate()
+	assert.NoError(t, err)
+	assert.Len(t, rot.Event.Keys, 3)
+	assert.Equal(t, nt.String(), rot.Event.SigThreshold.String())
+	assert.Len(t, rot.Signatures, 3)
+
+	ixn, err := bob.Interaction(event.SealArray{})
+	assert.NoError(t, err)
+	assert.Len(t, ixn.Signatures, 3)
+
+	// eve verifies bob's log from the wire
+	buf := &bytes.Buffer{}
+	err = stream.NewWriter(buf).WriteAll([]*event.Message{icp, rot, ixn})
+	assert.NoError(t, err)
+
+	msgs, err := stream.NewReader(buf).ReadAll()
+	assert.NoError(t, err)
+
+	_, err = eve.ProcessEvents(msgs...)
+	assert.NoError(t, err)
+
+	kel, err := eve.FindConnection(bob.Prefix())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, kel.Size())
+
+	// bob receipts with every current key
+	eicp, err := eve.Inception()
+	assert.NoError(t, err)
+
+	out, err := bob.ProcessEvents(eicp)
+	assert.NoError(t, err)
+	if assert.Len(t, out, 1) {
+		assert.Equal(t, event.VRC, out[0].Event.ILK())
+		assert.Len(t, out[0].Signatures, 3)
+		for i, sig := range out[0].Signatures {
+			assert.Equal(t, uint16(i), sig.KeyIndex)
+		}
+
+		_, err = eve.ProcessEvents(out...)
+		assert.NoError(t, err)
+		assert.Len(t, eve.KEL().ReceiptsForEvent(eicp.Event), 3)
+	}
+
+	t.Run("default threshold", func(t *testing.T) {
+		k, err := New(testkms.GetKMS(t, nil, mem.New(), keymanager.WithKeyCount(3)), mem.New())
+		assert.NoError(t, err)
+
+		icp, err := k.Inception()
+		assert.NoError(t, err)
+		assert.Equal(t, "2", icp.Event.SigThreshold.String())
+	})
+
+	t.Run("unsatisfiable threshold", func(t *testing.T) {
+		st, err := event.NewSigThreshold(4)
+		assert.NoError(t, err)
+
+		_, err = New(testkms.GetKMS(t, nil, mem.New(), keymanager.WithKeyCount(3)), mem.New(), WithSigningThreshold(st))
+		assert.Error(t, err)
+
+		_, err = New(testkms.GetKMS(t, nil, mem.New(), keymanager.WithKeyCount(2)), mem.New(), WithNextThreshold(kt))
+		assert.Error(t, err)
+	})
+}
+
+func TestDelegation(t *testing.T) {
+	delegator, err := New(testkms.GetKMS(t, nil, mem.New()), mem.New())
+	assert.NoError(t, err)
+
+	delegate, err := New(testkms.GetKMS(t, nil, mem.New()), mem.New(), WithDelegator(delegator.Prefix()))
+	assert.NoError(t, err)
+
+	// the delegated inception is escrowed until the delegator approves it
+	_, err = delegate.Inception()
+	assert.Error(t, err)
+
+	dip := delegate.PendingDelegation()
+	if !assert.NotNil(t, dip) {
+		return
+	}
+	assert.Equal(t, event.DIP, dip.Event.ILK())
+	assert.Equal(t, delegator.Prefix(), dip.Event.DelegatorSeal.Prefix)
+
+	rcpts, err := delegator.ProcessEvents(dip)
+	assert.NoError(t, err)
+	assert.Len(t, rcpts, 0)
+
+	_, err = delegator.FindConnection(delegate.Prefix())
+	assert.Error(t, err)
+
+	ixn, err := delegator.ApproveDelegation(dip)
+	assert.NoError(t, err)
+	assert.Equal(t, event.IXN, ixn.Event.ILK())
+
+	// anchoring the seal releases the escrowed inception
+	_, err = delegator.FindConnection(delegate.Prefix())
+	assert.NoError(t, err)
+
+	icp, err := delegator.Inception()
+	assert.NoError(t, err)
+
+	_, err = delegate.ProcessEvents(icp, ixn)
+	assert.NoError(t, err)
+	assert.Nil(t, delegate.PendingDelegation())
+
+	accepted, err := delegate.Inception()
+	assert.NoError(t, err)
+	assert.Equal(t, event.DIP, accepted.Event.ILK())
+
+	// delegated rotations are approved the same way
+	drt, err := delegate.Rotate()
+	assert.NoError(t, err)
+	assert.Equal(t, event.DRT, drt.Event.ILK())
+	assert.Equal(t, drt, delegate.PendingDelegation())
+	assert.Equal(t, 1, delegate.KEL().Size())
+
+	// the delegate keeps signing with the keys in its KEL until
+	// the rotation is approved
+	assert.Equal(t, accepted.Event.Keys[0], delegate.kms.Public().AsPrefix())
+
+	_, err = delegate.Interaction(event.SealArray{})
+	assert.Error(t, err)
+
+	_, err = delegate.Rotate()
+	assert.Error(t, err)
+
+	_, err = delegator.ProcessEvents(drt)
+	assert.NoError(t, err)
+
+	dig, err := drt.Event.GetDigest()
+	assert.NoError(t, err)
+
+	seal, err := event.NewEventSeal(dig, drt.Event.Prefix, drt.Event.Sequence)
+	assert.NoError(t, err)
+
+	rot, err := delegator.Rotate(seal)
+	assert.NoError(t, err)
+	assert.Len(t, rot.Event.Seals, 1)
+
+	kel, err := delegator.FindConnection(delegate.Prefix())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, kel.Size())
+
+	_, err = delegate.ProcessEvents(rot)
+	assert.NoError(t, err)
+	assert.Nil(t, delegate.PendingDelegation())
+	assert.Equal(t, 2, delegate.KEL().Size())
+	assert.Equal(t, drt.Event.Keys[0], delegate.kms.Public().AsPrefix())
+
+	// and signs with the rotated keys once it is
+	ixn, err = delegate.Interaction(event.SealArray{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, delegate.KEL().Size())
+
+	_, err = delegator.ProcessEvents(ixn)
+	assert.NoError(t, err)
+
+	// only events delegated by us can be approved
+	_, err = delegate.ApproveDelegation(drt)
+	assert.Error(t, err)
+
+	_, err = delegator.ApproveDelegation(icp)
+	assert.Error(t, err)
+}
+
+func TestInvalidDelegation(t *testing.T) {
+	delegator, err := New(testkms.GetKMS(t, nil, mem.New()), mem.New())
+	assert.NoError(t, err)
+
+	delegate, err := New(testkms.GetKMS(t, nil, mem.New()), mem.New(), WithDelegator(delegator.Prefix()))
+	assert.NoError(t, err)
+
+	// the delegator anchors a seal for a different event at the same location
+	dip := delegate.PendingDelegation()
+	seal, err := event.NewEventSeal("E"+strings.Repeat("A", 43), dip.Event.Prefix, dip.Event.Sequence)
+	assert.NoError(t, err)
+
+	ixn, err := delegator.Interaction(event.SealArray{seal})
+	assert.NoError(t, err)
+
+	icp, err := delegator.Inception()
+	assert.NoError(t, err)
+
+	validator, err := New(testkms.GetKMS(t, nil, mem.New()), mem.New())
+	assert.NoError(t, err)
+
+	_, err = validator.ProcessEvents(icp, ixn)
+	assert.NoError(t, err)
+
+	_, err = validator.ProcessEvents(dip)
+	assert.Error(t, err)
+
+	_, err = validator.FindConnection(delegate.Prefix())
+	assert.Error(t, err)
+}
+
+func TestEstablishmentOnly(t *testing.T) {
+	eo, err := New(testkms.GetKMS(t, nil, mem.New()), mem.New(), WithEstablishmentOnly())
+	assert.NoError(t, err)
+
+	icp, err := eo.Inception()
+	assert.NoError(t, err)
+	assert.Equal(t, []prefix.Trait{prefix.EstablishmentOnly}, icp.Event.Config)
+
+	ks, err := eo.KEL().KeyState()
+	assert.NoError(t, err)
+	assert.True(t, ks.HasTrait(prefix.EstablishmentOnly))
+	assert.False(t, ks.HasTrait(prefix.DoNotDelegate))
+
+	_, err = eo.Interaction(event.SealArray{})
+	assert.Error(t, err)
+
+	// the trait is read from the log, not the options
+	eo.traits = nil
+	_, err = eo.Interaction(event.SealArray{})
+	assert.Error(t, err)
+
+	// interaction events signed by the controller are still rejected
+	dig, err := icp.Event.GetDigest()
+	assert.NoError(t, err)
+
+	ixn, err := event.NewInteractionEvent(
+		event.WithPrefix(eo.Prefix()),
+		event.WithDigest(dig),
+		event.WithDefaultVersion(event.JSON),
+		event.WithSequence(1),
+	)
+	assert.NoError(t, err)
+
+	sigs, err := eo.sign(ixn)
+	assert.NoError(t, err)
+
+	bob, err := New(testkms.GetKMS(t, nil, mem.New()), mem.New())
+	assert.NoError(t, err)
+
+	_, err = bob.ProcessEvents(icp, &event.Message{Event: ixn, Signatures: sigs})
+	assert.Error(t, err)
+
+	kel, err := bob.FindConnection(eo.Prefix())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, kel.Size())
+
+	// delegations are anchored in a rotation instead
+	delegate, err := New(testkms.GetKMS(t, nil, mem.New()), mem.New(), WithDelegator(eo.Prefix()))
+	assert.NoError(t, err)
+
+	dip := delegate.PendingDelegation()
+	_, err = eo.ProcessEvents(dip)
+	assert.NoError(t, err)
+
+	rot, err := eo.ApproveDelegation(dip)
+	assert.NoError(t, err)
+	assert.Equal(t, event.ROT, rot.Event.ILK())
+
+	_, err = eo.FindConnection(delegate.Prefix())
+	assert.NoError(t, err)
+}
+
+func TestDoNotDelegate(t *testing.T) {
+	delegator, err := New(testkms.GetKMS(t, nil, mem.New()), mem.New(), WithDoNotDelegate())
+	assert.NoError(t, err)
+
+	ks, err := delegator.KEL().KeyState()
+	assert.NoError(t, err)
+	assert.Equal(t, []prefix.Trait{prefix.DoNotDelegate}, ks.Config)
+
+	delegate, err := New(testkms.GetKMS(t, nil, mem.New()), mem.New(), WithDelegator(delegator.Prefix()))
+	assert.NoError(t, err)
+
+	dip := delegate.PendingDelegation()
+	if !assert.NotNil(t, dip) {
+		return
+	}
+
+	_, err = delegator.ProcessEvents(dip)
+	assert.Error(t, err)
+
+	_, err = delegator.ApproveDelegation(dip)
+	assert.Error(t, err)
+
+	// the delegated inception is rejected even if the delegator anchored it
+	dig, err := dip.Event.GetDigest()
+	assert.NoError(t, err)
+
+	seal, err := event.NewEventSeal(dig, dip.Event.Prefix, dip.Event.Sequence)
+	assert.NoError(t, err)
+
+	ixn, err := delegator.Interaction(event.SealArray{seal})
+	assert.NoError(t, err)
+
+	icp, err := delegator.Inception()
+	assert.NoError(t, err)
+
+	validator, err := New(testkms.GetKMS(t, nil, mem.New()), mem.New())
+	assert.NoError(t, err)
+
+	_, err = validator.ProcessEvents(icp, ixn)
+	assert.NoError(t, err)
+
+	_, err = validator.ProcessEvents(dip)
+	assert.Error(t, err)
+
+	_, err = validator.FindConnection(delegate.Prefix())
+	assert.Error(t, err)
+}
+
+func TestNonTransferableReceipts(t *testing.T) {
+	controller, err := New(testkms.GetKMS(t, nil, mem.New()), mem.New())
+	assert.NoError(t, err)
+
+	icp, err := controller.Inception()
+	assert.NoError(t, err)
+
+	raw, err := icp.Raw()
+	assert.NoError(t, err)
+
+	kms := testkms.GetKMS(t, nil, mem.New())
+	nt, err := derivation.New(derivation.WithCode(derivation.Ed25519NT), derivation.WithRaw(kms.PublicKey()))
+	assert.NoError(t, err)
+
+	sig, err := derivation.New(derivation.WithCode(derivation.Ed25519Sig), derivation.WithSigner(kms.Signer()))
+	assert.NoError(t, err)
+	_, err = sig.Derive(raw)
+	assert.NoError(t, err)
+
+	rcpt, err := event.NewReceipt(icp.Event, event.WithSignerPrefix(nt.AsPrefix()), event.WithSignature(sig))
+	assert.NoError(t, err)
+
+	msg, err := event.NonTransferableReceiptMessage(rcpt)
+	assert.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	err = stream.NewWriter(buf).Write(msg)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "-CAB"+nt.AsPrefix())
+
+	rct, err := stream.NewReader(buf).Read()
+	assert.NoError(t, err)
+	assert.Len(t, rct.NonTransferableReceipts, 1)
+
+	db := mem.New()
+	validator, err := New(testkms.GetKMS(t, nil, db), db)
+	assert.NoError(t, err)
+
+	// receipts that arrive before the event are escrowed
+	_, err = validator.ProcessEvents(rct)
+	assert.NoError(t, err)
+
+	_, err = validator.ProcessEvents(icp)
+	assert.NoError(t, err)
+
+	kel, err := validator.FindConnection(controller.Prefix())
+	assert.NoError(t, err)
+
+	rcpts, err := kel.NonTransferableReceipts(icp.Event)
+	assert.NoError(t, err)
+	if assert.Len(t, rcpts, 1) {
+		assert.Equal(t, nt.AsPrefix(), rcpts[0].EstPrefix)
+	}
+
+	// receipts with signatures from another key are rejected
+	other := testkms.GetKMS(t, nil, mem.New())
+	forgedSig, err := derivation.New(derivation.WithCode(derivation.Ed25519Sig), derivation.WithSigner(other.Signer()))
+	assert.NoError(t, err)
+	_, err = forgedSig.Derive(raw)
+	assert.NoError(t, err)
+
+	forged, err := event.NewReceipt(icp.Event, event.WithSignerPrefix(nt.AsPrefix()), event.WithSignature(forgedSig))
+	assert.NoError(t, err)
+
+	msg, err = event.NonTransferableReceiptMessage(forged)
+	assert.NoError(t, err)
+
+	_, err = validator.ProcessEvents(msg)
+	assert.Error(t, err)
+}
+
+func TestNonTransferable(t *testing.T) {
+	kms := testkms.GetKMS(t, nil, mem.New())
+	key := kms.PublicKeys()[0]
+
+	db := mem.New()
+	nt, err := New(kms, db, WithNonTransferable())
+	assert.NoError(t, err)
+
+	basic, err := derivation.New(derivation.WithCode(derivation.Ed25519NT), derivation.WithRaw(key.Raw))
+	assert.NoError(t, err)
+	assert.Equal(t, basic.AsPrefix(), nt.Prefix())
+
+	icp, err := nt.Inception()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{nt.Prefix()}, icp.Event.Keys)
+	assert.Empty(t, icp.Event.Next)
+
+	_, err = nt.Rotate()
+	assert.Error(t, err)
+	assert.Equal(t, key.Raw, kms.PublicKeys()[0].Raw)
+	assert.Equal(t, 1, nt.KEL().Size())
+
+	_, err = nt.Interaction(event.SealArray{})
+	assert.Error(t, err)
+
+	_, err = New(testkms.GetKMS(t, nil, mem.New()), mem.New(), WithNonTransferable(), WithWitnesses(1, nt.Prefix()))
+	assert.Error(t, err)
+
+	// validators reject any event after the inception
+	validator, err := New(testkms.GetKMS(t, nil, mem.New()), mem.New())
+	assert.NoError(t, err)
+
+	dig, err := icp.Event.GetDigest()
+	assert.NoError(t, err)
+
+	ixn, err := event.NewInteractionEvent(
+		event.WithPrefix(nt.Prefix()),
+		event.WithDigest(dig),
+		event.WithDefaultVersion(event.JSON),
+		event.WithSequence(1),
+	)
+	assert.NoError(t, err)
+
+	sigs, err := nt.sign(ixn)
+	assert.NoError(t, err)
+
+	_, err = validator.ProcessEvents(icp)
+	assert.NoError(t, err)
+
+	_, err = validator.ProcessEvents(&event.Message{Event: ixn, Signatures: sigs})
+	assert.Error(t, err)
+
+	kel, err := validator.FindConnection(nt.Prefix())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, kel.Size())
+
+	// non-transferable identifiers receipt events
+	controller, err := New(testkms.GetKMS(t, nil, mem.New()), mem.New())
+	assert.NoError(t, err)
+
+	cicp, err := controller.Inception()
+	assert.NoError(t, err)
+
+	rcts, err := nt.ProcessEvents(cicp)
+	assert.NoError(t, err)
+	if assert.Len(t, rcts, 1) {
+		_, err = controller.ProcessEvents(roundTrip(t, rcts...)...)
+		assert.NoError(t, err)
+	}
+
+	rcpts, err := controller.KEL().NonTransferableReceipts(cicp.Event)
+	assert.NoError(t, err)
+	if assert.Len(t, rcpts, 1) {
+		assert.Equal(t, nt.Prefix(), rcpts[0].EstPrefix)
+	}
+
+	// and sign exn messages, verified without their log
+	received := 0
+	err = controller.RegisterExchangeHandler("/greet", func(exn *event.Message) ([]*event.Message, error) {
+		received++
+		return nil, nil
+	})
+	assert.NoError(t, err)
+
+	exn, err := nt.Exchange("/greet", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, nt.Prefix(), exn.Event.Seals[0].Prefix)
+	assert.Empty(t, exn.Event.Seals[0].Digest)
+
+	_, err = controller.ProcessEvents(roundTrip(t, exn)...)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, received)
+}
+
+func TestTransferableReceiptEscrow(t *testing.T) {
+	alice, err := New(testkms.GetKMS(t, nil, mem.New()), mem.New())
+	assert.NoError(t, err)
+
+	bob, err := New(testkms.GetKMS(t, nil, mem.New()), mem.New())
+	assert.NoError(t, err)
+
+	aliceIcp, err := alice.Inception()
+	assert.NoError(t, err)
+
+	bobIcp, err := bob.Inception()
+	assert.NoError(t, err)
+
+	vrcs, err := bob.ProcessEvents(aliceIcp)
+	assert.NoError(t, err)
+	assert.Len(t, vrcs, 1)
+
+	db := mem.New()
+	carol, err := New(testkms.GetKMS(t, nil, db), db)
+	assert.NoError(t, err)
+
+	// neither the receipted event nor bob's log have been seen
+	_, err = carol.ProcessEvents(vrcs...)
+	assert.NoError(t, err)
+
+	_, err = carol.ProcessEvents(aliceIcp)
+	assert.NoError(t, err)
+
+	kel, err := carol.FindConnection(alice.Prefix())
+	assert.NoError(t, err)
+
+	// only our own receipt so far
+	assert.Len(t, kel.ReceiptsForEvent(aliceIcp.Event), 1)
+
+	_, err = carol.ProcessEvents(bobIcp)
+	assert.NoError(t, err)
+	assert.Len(t, kel.ReceiptsForEvent(aliceIcp.Event), 2)
+
+	// receipts signed with keys other than bob's are rejected
+	forged, err := event.NewReceipt(aliceIcp.Event,
+		event.WithSignature(&aliceIcp.Signatures[0]),
+		event.WithEstablishmentEvent(bobIcp.Event),
+	)
+	assert.NoError(t, err)
+
+	msg, err := forged.Message()
+	assert.NoError(t, err)
+
+	_, err = carol.ProcessEvents(msg)
+	assert.Error(t, err)
+}
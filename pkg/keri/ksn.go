@@ -0,0 +1,201 @@
+package keri
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+
+	"github.com/decentralized-identity/kerigo/pkg/encoding/stream"
+	"github.com/decentralized-identity/kerigo/pkg/event"
+	klog "github.com/decentralized-identity/kerigo/pkg/log"
+)
+
+// ErrUnverifiedKeyStateNotice is returned with stale set when a notice from the
+// controller is signed with keys from an establishment event we have not seen.
+// The notice can't be verified, or kept, until we catch up with the log.
+var ErrUnverifiedKeyStateNotice = errors.New("key state notice signed with unseen keys, unable to verify")
+
+// KeyStateNotice returns our signed key state notice for the prefix, which
+// can be our own identifier or that of any controller whose log we hold
+func (r *Keri) KeyStateNotice(pre string) (*event.Message, error) {
+	kel := klog.New(pre, r.db)
+	if kel.Size() == 0 {
+		return nil, errors.Errorf("unknown identifier %s", pre)
+	}
+
+	ksn, err := kel.KeyStateNotice()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to build key state notice")
+	}
+
+	seal, err := r.signerSeal()
+	if err != nil {
+		return nil, err
+	}
+
+	evt, err := event.KeyStateNotice(ksn, seal)
+	if err != nil {
+		return nil, err
+	}
+
+	sigs, err := r.sign(evt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &event.Message{Event: evt, Signatures: sigs}, nil
+}
+
+// publishesKeyState returns true if we answer key state requests for the
+// prefix: our own identifier, and those whose logs we hold as a witness or
+// as a watcher authorized by the controller
+func (r *Keri) publishesKeyState(pre string) bool {
+	if pre == r.pre {
+		return true
+	}
+
+	kel := klog.New(pre, r.db)
+	if kel.Size() == 0 {
+		return false
+	}
+
+	state, err := kel.KeyState()
+	if err == nil && state.HasWitness(r.pre) {
+		return true
+	}
+
+	return r.watches(pre, r.pre)
+}
+
+// watches returns true if the controller of pre has authorized eid as its watcher
+func (r *Keri) watches(pre, eid string) bool {
+	ends, err := r.AuthorizedEndpoints(pre, WatcherRole)
+	if err != nil {
+		return false
+	}
+
+	for _, end := range ends {
+		if end.EID == eid {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ProcessKeyStateNotice verifies a key state notice signed by the controller
+// of the identifier, one of its witnesses or a watcher it authorized, and keeps it if it is the latest
+// notice we have seen. It returns true if our copy of the log is behind the
+// notice. Notices from the controller must be signed with its current keys,
+// and notices that describe a different event at our latest sequence
+// number are rejected. A notice signed with keys from an establishment event
+// we have not seen is unverified: it returns true, as we are behind, along
+// with ErrUnverifiedKeyStateNotice.
+func (r *Keri) ProcessKeyStateNotice(msg *event.Message) (bool, error) {
+	ksn := msg.Event
+	if len(ksn.Seals) != 1 {
+		return false, errors.New("key state notice must seal its signer")
+	}
+
+	signer := ksn.Seals[0]
+	kel := klog.New(ksn.Prefix, r.db)
+
+	if signer.Prefix != ksn.Prefix {
+		if kel.Size() == 0 {
+			return false, errors.Errorf("unable to verify witnesses of unknown identifier %s", ksn.Prefix)
+		}
+
+		state, err := kel.KeyState()
+		if err != nil {
+			return false, errors.Wrap(err, "unable to build key state")
+		}
+
+		if !state.HasWitness(signer.Prefix) && !r.watches(ksn.Prefix, signer.Prefix) {
+			return false, errors.Errorf("%s is not a witness or watcher for %s", signer.Prefix, ksn.Prefix)
+		}
+	} else if signer.SequenceInt() >= kel.Size() {
+		// signed with keys from an establishment event we have not seen
+		return true, ErrUnverifiedKeyStateNotice
+	} else {
+		state, err := kel.KeyState()
+		if err != nil {
+			return false, errors.Wrap(err, "unable to build key state")
+		}
+
+		// keys that have been rotated out may be compromised
+		if signer.SequenceInt() != state.LastEstablishment.SequenceInt() {
+			return false, errors.New("key state notice not signed with the current keys")
+		}
+	}
+
+	err := klog.New(signer.Prefix, r.db).VerifySealedSignatures(signer, msg)
+	if err != nil {
+		return false, errors.Wrap(err, "invalid key state notice")
+	}
+
+	stale, err := kel.Stale(ksn)
+	if err != nil {
+		return false, err
+	}
+
+	latest, err := r.LatestKeyStateNotice(ksn.Prefix)
+	if err == nil && !newer(ksn, latest) {
+		return stale, nil
+	}
+
+	raw, err := stream.ToDisjoint(msg)
+	if err != nil {
+		return false, err
+	}
+
+	err = r.db.Put(ksnName(ksn.Prefix), raw)
+	if err != nil {
+		return false, errors.Wrap(err, "unable to store key state notice")
+	}
+
+	return stale, nil
+}
+
+// LatestKeyStateNotice returns the latest verified key state notice
+// we have received for the prefix
+func (r *Keri) LatestKeyStateNotice(pre string) (*event.Event, error) {
+	raw, err := r.db.Get(ksnName(pre))
+	if err != nil {
+		return nil, errors.Errorf("no key state notice for %s", pre)
+	}
+
+	msg, err := stream.NewReader(bytes.NewReader(raw)).Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read key state notice")
+	}
+
+	return msg.Event, nil
+}
+
+// Stale returns true if the latest key state notice we have received
+// for the prefix describes events that are not in our copy of its log
+func (r *Keri) Stale(pre string) (bool, error) {
+	ksn, err := r.LatestKeyStateNotice(pre)
+	if err != nil {
+		return false, err
+	}
+
+	return klog.New(pre, r.db).Stale(ksn)
+}
+
+// newer returns true if the notice replaces the latest one. A notice from the
+// controller sealed to a later establishment event always does, as the keys
+// that signed the latest one have since been rotated out. Otherwise the
+// notice describing the later event does.
+func newer(ksn, latest *event.Event) bool {
+	signer, last := ksn.Seals[0], latest.Seals[0]
+	if signer.Prefix == ksn.Prefix && last.Prefix == latest.Prefix && signer.SequenceInt() != last.SequenceInt() {
+		return signer.SequenceInt() > last.SequenceInt()
+	}
+
+	return ksn.SequenceInt() >= latest.SequenceInt()
+}
+
+func ksnName(pre string) string {
+	return "ksn/" + pre
+}
@@ -0,0 +1,294 @@
+package keri
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/decentralized-identity/kerigo/pkg/db/mem"
+	"github.com/decentralized-identity/kerigo/pkg/derivation"
+	"github.com/decentralized-identity/kerigo/pkg/encoding/stream"
+	"github.com/decentralized-identity/kerigo/pkg/event"
+	testkms "github.com/decentralized-identity/kerigo/pkg/test/kms"
+)
+
+// roundTrip writes the messages to a stream and reads them back
+func roundTrip(t *testing.T, msgs ...*event.Message) []*event.Message {
+	buf := &bytes.Buffer{}
+	err := stream.NewWriter(buf).WriteAll(msgs)
+	assert.NoError(t, err)
+
+	out, err := stream.NewReader(buf).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, out, len(msgs))
+
+	return out
+}
+
+func TestKeyStateNotice(t *testing.T) {
+	db := mem.New()
+	alice, err := New(testkms.GetKMS(t, nil, db), db)
+	assert.NoError(t, err)
+
+	db = mem.New()
+	bob, err := New(testkms.GetKMS(t, nil, db), db)
+	assert.NoError(t, err)
+
+	icp, err := alice.Inception()
+	assert.NoError(t, err)
+
+	_, err = bob.ProcessEvents(icp)
+	assert.NoError(t, err)
+
+	// bob asks alice for her key state
+	req, err := event.KeyStateNoticeRequest(alice.Prefix())
+	assert.NoError(t, err)
+
+	out, err := alice.ProcessEvents(roundTrip(t, req)...)
+	assert.NoError(t, err)
+	if !assert.Len(t, out, 1) {
+		return
+	}
+
+	ksn := roundTrip(t, out[0])[0]
+	assert.Equal(t, event.KSN, ksn.Event.ILK())
+	assert.Equal(t, "0", ksn.Event.Sequence)
+	assert.NotEmpty(t, ksn.Event.Datetime)
+	assert.Len(t, ksn.Signatures, 1)
+
+	stale, err := bob.ProcessKeyStateNotice(ksn)
+	assert.NoError(t, err)
+	assert.False(t, stale)
+
+	// bob is behind once alice moves on
+	ixn, err := alice.Interaction(event.SealArray{})
+	assert.NoError(t, err)
+
+	ksn, err = alice.KeyStateNotice(alice.Prefix())
+	assert.NoError(t, err)
+
+	_, err = bob.ProcessEvents(roundTrip(t, ksn)...)
+	assert.NoError(t, err)
+
+	stale, err = bob.Stale(alice.Prefix())
+	assert.NoError(t, err)
+	assert.True(t, stale)
+
+	_, err = bob.ProcessEvents(ixn)
+	assert.NoError(t, err)
+
+	stale, err = bob.Stale(alice.Prefix())
+	assert.NoError(t, err)
+	assert.False(t, stale)
+
+	// an older notice does not replace the latest one
+	latest, err := bob.LatestKeyStateNotice(alice.Prefix())
+	assert.NoError(t, err)
+	assert.Equal(t, "1", latest.Sequence)
+
+	_, err = bob.ProcessKeyStateNotice(out[0])
+	assert.NoError(t, err)
+
+	latest, err = bob.LatestKeyStateNotice(alice.Prefix())
+	assert.NoError(t, err)
+	assert.Equal(t, "1", latest.Sequence)
+
+	// notices we can't verify are rejected
+	forged := &event.Message{Event: ksn.Event, Signatures: []derivation.Derivation{ksn.Signatures[0]}}
+	forged.Signatures[0].Raw = append([]byte{}, forged.Signatures[0].Raw...)
+	forged.Signatures[0].Raw[0] ^= 0xff
+
+	_, err = bob.ProcessKeyStateNotice(forged)
+	assert.Error(t, err)
+
+	// only the controller and its witnesses can sign notices
+	db = mem.New()
+	carol, err := New(testkms.GetKMS(t, nil, db), db)
+	assert.NoError(t, err)
+
+	for _, k := range []*Keri{alice, bob} {
+		cicp, err := carol.Inception()
+		assert.NoError(t, err)
+		_, err = k.ProcessEvents(cicp)
+		assert.NoError(t, err)
+	}
+
+	_, err = carol.ProcessEvents(icp, ixn)
+	assert.NoError(t, err)
+
+	ksn, err = carol.KeyStateNotice(alice.Prefix())
+	assert.NoError(t, err)
+
+	_, err = bob.ProcessKeyStateNotice(ksn)
+	assert.Error(t, err)
+
+	// a notice signed with keys that are later compromised can claim any sequence number
+	old, err := alice.KeyStateNotice(alice.Prefix())
+	assert.NoError(t, err)
+
+	pinned := *old.Event
+	pinned.Sequence = "9"
+	sigs, err := alice.sign(&pinned)
+	assert.NoError(t, err)
+
+	stale, err = bob.ProcessKeyStateNotice(&event.Message{Event: &pinned, Signatures: sigs})
+	assert.NoError(t, err)
+	assert.True(t, stale)
+
+	// notices signed with keys bob has not seen can't be verified
+	rot, err := alice.Rotate()
+	assert.NoError(t, err)
+
+	ksn, err = alice.KeyStateNotice(alice.Prefix())
+	assert.NoError(t, err)
+
+	stale, err = bob.ProcessKeyStateNotice(ksn)
+	assert.Equal(t, ErrUnverifiedKeyStateNotice, err)
+	assert.True(t, stale)
+
+	_, err = bob.ProcessEvents(roundTrip(t, ksn)...)
+	assert.NoError(t, err)
+
+	latest, err = bob.LatestKeyStateNotice(alice.Prefix())
+	assert.NoError(t, err)
+	assert.Equal(t, "9", latest.Sequence)
+
+	// once bob has the rotation, notices signed with the rotated keys are rejected
+	// and a notice signed with the current keys replaces the pinned one
+	_, err = bob.ProcessEvents(rot)
+	assert.NoError(t, err)
+
+	_, err = bob.ProcessKeyStateNotice(old)
+	assert.Error(t, err)
+
+	stale, err = bob.ProcessKeyStateNotice(ksn)
+	assert.NoError(t, err)
+	assert.False(t, stale)
+
+	latest, err = bob.LatestKeyStateNotice(alice.Prefix())
+	assert.NoError(t, err)
+	assert.Equal(t, "2", latest.Sequence)
+
+	// requests for identifiers we don't know are ignored
+	req, err = event.KeyStateNoticeRequest("unknown")
+	assert.NoError(t, err)
+
+	out, err = alice.ProcessEvents(req)
+	assert.NoError(t, err)
+	assert.Len(t, out, 0)
+}
+
+func TestWitnessKeyStateNotice(t *testing.T) {
+	w1 := newTestWitness(t)
+
+	db := mem.New()
+	alice, err := New(testkms.GetKMS(t, nil, db), db,
+		WithWitnesses(1, w1.Prefix()),
+		WithWitnessClient(w1.Prefix(), &localWitness{w1}),
+	)
+	assert.NoError(t, err)
+
+	icp, err := alice.Inception()
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = alice.Witness(ctx, icp)
+	assert.NoError(t, err)
+
+	req, err := event.KeyStateNoticeRequest(alice.Prefix())
+	assert.NoError(t, err)
+
+	out, err := w1.ProcessEvents(req)
+	assert.NoError(t, err)
+	if !assert.Len(t, out, 1) {
+		return
+	}
+
+	db = mem.New()
+	bob, err := New(testkms.GetKMS(t, nil, db), db)
+	assert.NoError(t, err)
+
+	// bob can't tell who the witnesses are without alice's log
+	_, err = bob.ProcessKeyStateNotice(out[0])
+	assert.Error(t, err)
+
+	kerl, err := w1.KERL(alice.Prefix())
+	assert.NoError(t, err)
+
+	_, err = bob.ProcessEvents(kerl...)
+	assert.NoError(t, err)
+
+	stale, err := bob.ProcessKeyStateNotice(roundTrip(t, out[0])[0])
+	assert.NoError(t, err)
+	assert.False(t, stale)
+}
+
+func TestWatcherKeyStateNotice(t *testing.T) {
+	db := mem.New()
+	alice, err := New(testkms.GetKMS(t, nil, db), db)
+	assert.NoError(t, err)
+
+	db = mem.New()
+	carol, err := New(testkms.GetKMS(t, nil, db), db)
+	assert.NoError(t, err)
+
+	db = mem.New()
+	bob, err := New(testkms.GetKMS(t, nil, db), db)
+	assert.NoError(t, err)
+
+	icp, err := alice.Inception()
+	assert.NoError(t, err)
+
+	wicp, err := carol.Inception()
+	assert.NoError(t, err)
+
+	_, err = carol.ProcessEvents(icp)
+	assert.NoError(t, err)
+
+	req, err := event.KeyStateNoticeRequest(alice.Prefix())
+	assert.NoError(t, err)
+
+	// carol holds alice's log but doesn't watch it for her yet
+	out, err := carol.ProcessEvents(req)
+	assert.NoError(t, err)
+	assert.Len(t, out, 0)
+
+	end, err := alice.AuthorizeEndpoint(WatcherRole, carol.Prefix(), "http://127.0.0.1:5642")
+	assert.NoError(t, err)
+
+	_, err = carol.ProcessEvents(roundTrip(t, end)...)
+	assert.NoError(t, err)
+
+	out, err = carol.ProcessEvents(req)
+	assert.NoError(t, err)
+	if !assert.Len(t, out, 1) {
+		return
+	}
+
+	ksn := roundTrip(t, out[0])[0]
+	assert.Equal(t, alice.Prefix(), ksn.Event.Prefix)
+	assert.Equal(t, carol.Prefix(), ksn.Event.Seals[0].Prefix)
+
+	_, err = bob.ProcessEvents(icp, wicp)
+	assert.NoError(t, err)
+
+	// bob only trusts carol once alice has authorized her as a watcher
+	_, err = bob.ProcessKeyStateNotice(ksn)
+	assert.Error(t, err)
+
+	_, err = bob.ProcessEvents(roundTrip(t, end)...)
+	assert.NoError(t, err)
+
+	stale, err := bob.ProcessKeyStateNotice(ksn)
+	assert.NoError(t, err)
+	assert.False(t, stale)
+
+	latest, err := bob.LatestKeyStateNotice(alice.Prefix())
+	assert.NoError(t, err)
+	assert.Equal(t, carol.Prefix(), latest.Seals[0].Prefix)
+}
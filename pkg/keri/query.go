@@ -0,0 +1,180 @@
+package keri
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/decentralized-identity/kerigo/pkg/event"
+	klog "github.com/decentralized-identity/kerigo/pkg/log"
+)
+
+// Query returns a signed qry message asking a peer for the results of the route
+func (r *Keri) Query(route string, q *event.Query) (*event.Message, error) {
+	seal, err := r.signerSeal()
+	if err != nil {
+		return nil, err
+	}
+
+	qry, err := event.NewQuery(route, q, seal, r.format)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create query")
+	}
+
+	sigs, err := r.sign(qry)
+	if err != nil {
+		return nil, err
+	}
+
+	return &event.Message{Event: qry, Signatures: sigs}, nil
+}
+
+// Reply answers a query from our database. The messages that answer the
+// query are followed by a signed rpy message that references the query,
+// which is sent on its own if we have nothing for the queried identifier.
+func (r *Keri) Reply(qry *event.Message) ([]*event.Message, error) {
+	err := r.verifySender(qry)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid qry")
+	}
+
+	q := qry.Event.Query
+	if q == nil || q.Prefix == "" {
+		return nil, errors.New("query prefix required")
+	}
+
+	out := []*event.Message{}
+	switch qry.Event.Route {
+	case event.LogsRoute:
+		if q.SequenceInt() < 0 {
+			return nil, errors.New("invalid query sequence number")
+		}
+
+		out, err = r.logs(q.Prefix, q.SequenceInt())
+		if err != nil {
+			return nil, err
+		}
+	case event.KeyStateRoute:
+		// others only trust notices from the controller, its witnesses and watchers
+		if r.publishesKeyState(q.Prefix) {
+			ksn, err := r.KeyStateNotice(q.Prefix)
+			if err != nil {
+				return nil, err
+			}
+
+			out = append(out, ksn)
+		}
+	default:
+		return nil, errors.Errorf("unknown query route %s", qry.Event.Route)
+	}
+
+	seal, err := r.signerSeal()
+	if err != nil {
+		return nil, err
+	}
+
+	rpy, err := event.NewReply(qry.Event, seal)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create reply")
+	}
+
+	sigs, err := r.sign(rpy)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(out, &event.Message{Event: rpy, Signatures: sigs}), nil
+}
+
+// KERL returns the accepted events of the identifier with their
+// signatures and the receipts we hold for them
+func (r *Keri) KERL(pre string) ([]*event.Message, error) {
+	if !r.db.Seen(pre) {
+		return nil, errors.Errorf("unknown prefix %s", pre)
+	}
+
+	return r.logs(pre, 0)
+}
+
+// logs returns the accepted events of the identifier from the sequence
+// number on, with their signatures and the receipts we hold for them
+func (r *Keri) logs(pre string, sn int) ([]*event.Message, error) {
+	out := []*event.Message{}
+	if !r.db.Seen(pre) {
+		return out, nil
+	}
+
+	kel := klog.New(pre, r.db)
+	err := r.db.StreamBySequenceNo(pre, func(msg *event.Message) error {
+		if msg.Event.SequenceInt() < sn {
+			return nil
+		}
+
+		raw, err := msg.Raw()
+		if err != nil {
+			return err
+		}
+
+		m, err := event.NewMessage(msg.Event, event.WithRaw(raw), event.WithSignatures(msg.Signatures))
+		if err != nil {
+			return err
+		}
+
+		m.WitnessReceipts, err = kel.WitnessReceipts(msg.Event)
+		if err != nil {
+			return err
+		}
+
+		m.NonTransferableReceipts, err = kel.NonTransferableReceipts(msg.Event)
+		if err != nil {
+			return err
+		}
+
+		out = append(out, m)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to load log")
+	}
+
+	return out, nil
+}
+
+// verifySender verifies the signatures on a qry or rpy message against
+// the establishment event sealed in it. Messages signed with keys from an
+// establishment event we have not seen yet can't be verified, so they are
+// rejected and the sender must send us its KEL first.
+func (r *Keri) verifySender(msg *event.Message) error {
+	if len(msg.Event.Seals) != 1 {
+		return errors.New("message must seal its sender")
+	}
+
+	seal := msg.Event.Seals[0]
+	kel := klog.New(seal.Prefix, r.db)
+
+	// non-transferable senders seal only their prefix, so they can always be verified
+	if seal.Digest != "" && seal.SequenceInt() >= kel.Size() {
+		return errors.Errorf("unknown establishment event %s for sender %s", seal.Sequence, seal.Prefix)
+	}
+
+	return kel.VerifySealedSignatures(seal, msg)
+}
+
+// signerSeal returns a seal of our latest establishment event, which
+// identifies the keys we sign messages that are not key events with
+func (r *Keri) signerSeal() (*event.Seal, error) {
+	// our key is our prefix, there are no establishment events to seal
+	if r.ephemeral {
+		return event.NewSeal(event.EventSeal, event.WithSealPrefix(r.pre))
+	}
+
+	est, err := r.db.CurrentEstablishmentEvent(r.pre)
+	if err != nil {
+		return nil, errors.Wrap(err, "unexpected error getting current KEL")
+	}
+
+	seal, err := event.SealEstablishment(est.Event)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to seal our establishment event")
+	}
+
+	return seal, nil
+}
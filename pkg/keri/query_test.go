@@ -0,0 +1,124 @@
+package keri
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/decentralized-identity/kerigo/pkg/db/mem"
+	"github.com/decentralized-identity/kerigo/pkg/derivation"
+	"github.com/decentralized-identity/kerigo/pkg/encoding/stream"
+	"github.com/decentralized-identity/kerigo/pkg/event"
+	testkms "github.com/decentralized-identity/kerigo/pkg/test/kms"
+)
+
+func TestQueryLogs(t *testing.T) {
+	w1 := newTestWitness(t)
+
+	db := mem.New()
+	alice, err := New(testkms.GetKMS(t, nil, db), db,
+		WithWitnesses(1, w1.Prefix()),
+		WithWitnessClient(w1.Prefix(), &localWitness{w1}),
+	)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	icp, err := alice.Inception()
+	assert.NoError(t, err)
+
+	_, err = alice.Witness(ctx, icp)
+	assert.NoError(t, err)
+
+	ixn, err := alice.Interaction(event.SealArray{})
+	assert.NoError(t, err)
+
+	_, err = alice.Witness(ctx, ixn)
+	assert.NoError(t, err)
+
+	db = mem.New()
+	bob, err := New(testkms.GetKMS(t, nil, db), db)
+	assert.NoError(t, err)
+
+	qry, err := bob.Query(event.LogsRoute, &event.Query{Prefix: alice.Prefix()})
+	assert.NoError(t, err)
+
+	// queries from senders we don't know can't be verified
+	_, err = alice.ProcessEvents(qry)
+	assert.Error(t, err)
+
+	_, err = alice.ProcessEvents(bob.KEL().EventAt(0))
+	assert.NoError(t, err)
+
+	// the log is followed by the reply, with the witness receipts
+	// for each event written in a separate rct message
+	out, err := alice.ProcessEvents(roundTrip(t, qry)...)
+	assert.NoError(t, err)
+	if !assert.Len(t, out, 3) {
+		return
+	}
+
+	assert.Equal(t, event.RPY, out[2].Event.ILK())
+
+	buf := &bytes.Buffer{}
+	err = stream.NewWriter(buf).WriteAll(out)
+	assert.NoError(t, err)
+
+	reply, err := stream.NewReader(buf).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, reply, 5)
+
+	_, err = bob.ProcessEvents(reply...)
+	assert.NoError(t, err)
+
+	kel, err := bob.FindConnection(alice.Prefix())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, kel.Size())
+
+	for sn := 0; sn < 2; sn++ {
+		witnessed, err := kel.FullyWitnessed(sn)
+		assert.NoError(t, err)
+		assert.True(t, witnessed)
+	}
+
+	// queries from a known sender must verify
+	qry, err = bob.Query(event.KeyStateRoute, &event.Query{Prefix: alice.Prefix()})
+	assert.NoError(t, err)
+
+	out, err = alice.Reply(qry)
+	assert.NoError(t, err)
+	if assert.Len(t, out, 2) {
+		assert.Equal(t, event.KSN, out[0].Event.ILK())
+	}
+
+	forged := &event.Message{Event: qry.Event, Signatures: []derivation.Derivation{qry.Signatures[0]}}
+	forged.Signatures[0].Raw = append([]byte{}, forged.Signatures[0].Raw...)
+	forged.Signatures[0].Raw[0] ^= 0xff
+
+	_, err = alice.Reply(forged)
+	assert.Error(t, err)
+
+	// including those that seal an establishment event we have not seen
+	future := *qry.Event
+	future.Seals = event.SealArray{&event.Seal{
+		Type:     qry.Event.Seals[0].Type,
+		Prefix:   bob.Prefix(),
+		Sequence: "5",
+		Digest:   qry.Event.Seals[0].Digest,
+	}}
+
+	_, err = alice.Reply(&event.Message{Event: &future, Signatures: qry.Signatures})
+	assert.Error(t, err)
+
+	// replies must come from the sender they seal
+	_, err = bob.ProcessEvents(out[1])
+	assert.NoError(t, err)
+
+	forged = &event.Message{Event: out[1].Event, Signatures: []derivation.Derivation{qry.Signatures[0]}}
+	_, err = bob.ProcessEvents(forged)
+	assert.Error(t, err)
+}
@@ -0,0 +1,207 @@
+package keri
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/decentralized-identity/kerigo/pkg/event"
+)
+
+// WitnessClient submits messages to a single witness and returns
+// the messages the witness responded with
+type WitnessClient interface {
+	Submit(ctx context.Context, msgs ...*event.Message) ([]*event.Message, error)
+}
+
+// WitnessResult is the outcome of submitting an event to our witnesses
+type WitnessResult struct {
+	// Receipts holds the verified receipt from each witness that receipted the event
+	Receipts []*event.Receipt
+
+	// Errors holds the error for each witness that failed, keyed by witness prefix
+	Errors map[string]error
+}
+
+// WithWitnessClient sets the client used to reach one of our witnesses
+func WithWitnessClient(pre string, c WitnessClient) Option {
+	return func(k *Keri) error {
+		if c == nil {
+			return errors.New("witness client required")
+		}
+
+		if k.witnessClients == nil {
+			k.witnessClients = map[string]WitnessClient{}
+		}
+
+		k.witnessClients[pre] = c
+		return nil
+	}
+}
+
+// Witness submits one of our events to each of our current witnesses in
+// parallel and collects their receipts. Once the witness threshold has been
+// reached, or every witness has responded, each witness that responded is
+// sent the receipts of the others. An error is returned if the threshold is
+// not reached before the context is done, the result holds the errors from
+// the individual witnesses.
+//
+// Witnesses that have not responded by the time the threshold is reached are
+// not waited for, so they are not sent the receipts of the others. Submit the
+// receipts in the result to them, or witness the event again, to complete
+// their copy of the KERL.
+func (r *Keri) Witness(ctx context.Context, msg *event.Message) (*WitnessResult, error) {
+	if msg.Event.Prefix != r.pre {
+		return nil, errors.New("only our own events can be witnessed")
+	}
+
+	kel := r.KEL()
+	state, err := kel.KeyState()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to build key state")
+	}
+
+	toad := 0
+	if state.WitnessThreshold != "" {
+		t, err := strconv.ParseInt(state.WitnessThreshold, 16, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid witness threshold")
+		}
+		toad = int(t)
+	}
+
+	dig, err := msg.Digest()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &WitnessResult{Errors: map[string]error{}}
+
+	type response struct {
+		pre  string
+		msgs []*event.Message
+		err  error
+	}
+
+	// buffered so late responses do not block once we have returned
+	responses := make(chan response, len(state.Witnesses))
+	pending := 0
+	for _, pre := range state.Witnesses {
+		c, ok := r.witnessClients[pre]
+		if !ok {
+			res.Errors[pre] = errors.New("no client configured for witness")
+			continue
+		}
+
+		pending++
+		go func(pre string, c WitnessClient) {
+			msgs, err := c.Submit(ctx, msg)
+			responses <- response{pre: pre, msgs: msgs, err: err}
+		}(pre, c)
+	}
+
+	receipts := map[string]*event.Receipt{}
+	responded := []string{}
+
+collect:
+	for pending > 0 && (toad == 0 || len(receipts) < toad) {
+		select {
+		case resp := <-responses:
+			pending--
+			if resp.err != nil {
+				res.Errors[resp.pre] = resp.err
+				continue
+			}
+
+			responded = append(responded, resp.pre)
+			for _, m := range resp.msgs {
+				if m.Event.ILK() != event.RCT || m.Event.EventDigest != dig {
+					continue
+				}
+
+				for _, rcpt := range m.WitnessReceipts {
+					err := kel.ApplyWitnessReceipt(rcpt)
+					if err != nil {
+						res.Errors[resp.pre] = errors.Wrapf(err, "invalid receipt from %s", rcpt.EstPrefix)
+						continue
+					}
+
+					receipts[rcpt.EstPrefix] = rcpt
+				}
+			}
+
+			if _, ok := receipts[resp.pre]; !ok && res.Errors[resp.pre] == nil {
+				res.Errors[resp.pre] = errors.New("witness did not receipt the event")
+			}
+		case <-ctx.Done():
+			break collect
+		}
+	}
+
+	pres := make([]string, 0, len(receipts))
+	for pre := range receipts {
+		pres = append(pres, pre)
+	}
+	sort.Strings(pres)
+
+	for _, pre := range pres {
+		res.Receipts = append(res.Receipts, receipts[pre])
+	}
+
+	r.exchangeReceipts(ctx, responded, res)
+
+	if len(receipts) < toad {
+		if ctx.Err() != nil {
+			return res, errors.Wrapf(ctx.Err(), "witness threshold not met, %d of %d receipts", len(receipts), toad)
+		}
+		return res, errors.Errorf("witness threshold not met, %d of %d receipts", len(receipts), toad)
+	}
+
+	return res, nil
+}
+
+// exchangeReceipts sends each witness the receipts of the other witnesses
+func (r *Keri) exchangeReceipts(ctx context.Context, witnesses []string, res *WitnessResult) {
+	var (
+		wg   sync.WaitGroup
+		lock sync.Mutex
+	)
+
+	for _, pre := range witnesses {
+		others := []*event.Receipt{}
+		for _, rcpt := range res.Receipts {
+			if rcpt.EstPrefix != pre {
+				others = append(others, rcpt)
+			}
+		}
+
+		if len(others) == 0 {
+			continue
+		}
+
+		rct, err := event.WitnessReceiptMessage(others...)
+		if err != nil {
+			lock.Lock()
+			res.Errors[pre] = err
+			lock.Unlock()
+			continue
+		}
+
+		wg.Add(1)
+		go func(pre string, c WitnessClient) {
+			defer wg.Done()
+
+			_, err := c.Submit(ctx, rct)
+			if err != nil {
+				lock.Lock()
+				res.Errors[pre] = errors.Wrap(err, "unable to send receipts")
+				lock.Unlock()
+			}
+		}(pre, r.witnessClients[pre])
+	}
+
+	wg.Wait()
+}
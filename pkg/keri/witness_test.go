@@ -0,0 +1,154 @@
+package keri
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/decentralized-identity/kerigo/pkg/db/mem"
+	"github.com/decentralized-identity/kerigo/pkg/event"
+	testkms "github.com/decentralized-identity/kerigo/pkg/test/kms"
+	"github.com/decentralized-identity/kerigo/pkg/witness"
+)
+
+type localWitness struct {
+	w *witness.Witness
+}
+
+func (r *localWitness) Submit(_ context.Context, msgs ...*event.Message) ([]*event.Message, error) {
+	return r.w.ProcessEvents(msgs...)
+}
+
+type failingWitness struct{}
+
+func (r *failingWitness) Submit(_ context.Context, _ ...*event.Message) ([]*event.Message, error) {
+	return nil, errors.New("witness unavailable")
+}
+
+type slowWitness struct{}
+
+func (r *slowWitness) Submit(ctx context.Context, _ ...*event.Message) ([]*event.Message, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func newTestWitness(t *testing.T) *witness.Witness {
+	db := mem.New()
+	w, err := witness.New(testkms.GetKMS(t, nil, db), db)
+	assert.NoError(t, err)
+	return w
+}
+
+func TestWitnessPool(t *testing.T) {
+	w1 := newTestWitness(t)
+	w2 := newTestWitness(t)
+	w3 := newTestWitness(t)
+
+	db := mem.New()
+	k, err := New(testkms.GetKMS(t, nil, db), db,
+		WithWitnesses(2, w1.Prefix(), w2.Prefix(), w3.Prefix()),
+		WithWitnessClient(w1.Prefix(), &localWitness{w1}),
+		WithWitnessClient(w2.Prefix(), &localWitness{w2}),
+		WithWitnessClient(w3.Prefix(), &failingWitness{}),
+	)
+	assert.NoError(t, err)
+
+	icp, err := k.Inception()
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the failing witness may not be waited for once the threshold is met
+	res, err := k.Witness(ctx, icp)
+	assert.NoError(t, err)
+	assert.Len(t, res.Receipts, 2)
+
+	// the receipts are stored in our own log
+	witnessed, err := k.KEL().FullyWitnessed(0)
+	assert.NoError(t, err)
+	assert.True(t, witnessed)
+
+	// each witness that responded received the receipts of the others
+	for _, w := range []*witness.Witness{w1, w2} {
+		kerl, err := w.KERL(k.Prefix())
+		assert.NoError(t, err)
+		if assert.Len(t, kerl, 1) {
+			assert.Len(t, kerl[0].WitnessReceipts, 2)
+		}
+	}
+
+	ixn, err := k.Interaction(event.SealArray{})
+	assert.NoError(t, err)
+
+	res, err = k.Witness(ctx, ixn)
+	assert.NoError(t, err)
+	assert.Len(t, res.Receipts, 2)
+
+	witnessed, err = k.KEL().FullyWitnessed(1)
+	assert.NoError(t, err)
+	assert.True(t, witnessed)
+}
+
+func TestWitnessPoolThresholdNotMet(t *testing.T) {
+	w1 := newTestWitness(t)
+	w2 := newTestWitness(t)
+
+	db := mem.New()
+	k, err := New(testkms.GetKMS(t, nil, db), db,
+		WithWitnesses(2, w1.Prefix(), w2.Prefix()),
+		WithWitnessClient(w1.Prefix(), &localWitness{w1}),
+		WithWitnessClient(w2.Prefix(), &slowWitness{}),
+	)
+	assert.NoError(t, err)
+
+	icp, err := k.Inception()
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	res, err := k.Witness(ctx, icp)
+	assert.Error(t, err)
+	assert.Equal(t, context.DeadlineExceeded, errors.Cause(err))
+	assert.Len(t, res.Receipts, 1)
+
+	witnessed, err := k.KEL().FullyWitnessed(0)
+	assert.NoError(t, err)
+	assert.False(t, witnessed)
+
+	// errors from each witness are reported
+	w3 := newTestWitness(t)
+	db = mem.New()
+	k, err = New(testkms.GetKMS(t, nil, db), db,
+		WithWitnesses(2, w1.Prefix(), w3.Prefix()),
+		WithWitnessClient(w1.Prefix(), &localWitness{w1}),
+		WithWitnessClient(w3.Prefix(), &failingWitness{}),
+	)
+	assert.NoError(t, err)
+
+	icp, err = k.Inception()
+	assert.NoError(t, err)
+
+	res, err = k.Witness(context.Background(), icp)
+	assert.Error(t, err)
+	assert.Len(t, res.Receipts, 1)
+	assert.Len(t, res.Errors, 1)
+	assert.EqualError(t, res.Errors[w3.Prefix()], "witness unavailable")
+
+	// witnesses without a client are reported
+	db = mem.New()
+	k, err = New(testkms.GetKMS(t, nil, db), db, WithWitnesses(1, w1.Prefix()))
+	assert.NoError(t, err)
+
+	icp, err = k.Inception()
+	assert.NoError(t, err)
+
+	res, err = k.Witness(context.Background(), icp)
+	assert.Error(t, err)
+	assert.Len(t, res.Receipts, 0)
+	assert.Error(t, res.Errors[w1.Prefix()])
+}
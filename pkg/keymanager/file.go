@@ -0,0 +1,110 @@
+package keymanager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/google/tink/go/aead"
+	"github.com/google/tink/go/tink"
+	"github.com/pkg/errors"
+
+	"github.com/decentralized-identity/kerigo/pkg/derivation"
+)
+
+// FileKeyStore keeps each private key in its own file, named by its
+// public key, in the provided directory. Keys are envelope encrypted
+// with the AEAD provided with WithFileAEAD, which is required.
+type FileKeyStore struct {
+	dir       string
+	kw        tink.AEAD
+	enveloper tink.AEAD
+}
+
+type FileKeyStoreOption func(*FileKeyStore) error
+
+func NewFileKeyStore(dir string, opts ...FileKeyStoreOption) (*FileKeyStore, error) {
+	ks := &FileKeyStore{
+		dir: dir,
+	}
+
+	for _, o := range opts {
+		err := o(ks)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// never write private keys to disk in the clear
+	if ks.kw == nil {
+		return nil, errors.New("must provide an AEAD to encrypt keys")
+	}
+
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create key store directory")
+	}
+
+	ks.enveloper = aead.NewKMSEnvelopeAEAD2(aead.AES256GCMKeyTemplate(), ks.kw)
+
+	return ks, nil
+}
+
+// WithFileAEAD sets the AEAD used to encrypt the keys written to disk
+func WithFileAEAD(a tink.AEAD) FileKeyStoreOption {
+	return func(ks *FileKeyStore) error {
+		ks.kw = a
+		return nil
+	}
+}
+
+func (r *FileKeyStore) Generate(t KeyType, seed []byte) (*derivation.Derivation, error) {
+	k, err := newPrivateKey(t, seed)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, err := k.public()
+	if err != nil {
+		return nil, err
+	}
+
+	enc, err := encryptKey(r.enveloper, k)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ioutil.WriteFile(r.path(pub), enc, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to write private key")
+	}
+
+	return pub, nil
+}
+
+func (r *FileKeyStore) Sign(pub *derivation.Derivation, data []byte) ([]byte, error) {
+	enc, err := ioutil.ReadFile(r.path(pub))
+	if err != nil {
+		return nil, errors.Wrapf(err, "no private key for %s", pub.AsPrefix())
+	}
+
+	k, err := decryptKey(r.enveloper, enc)
+	if err != nil {
+		return nil, err
+	}
+
+	return k.sign(data)
+}
+
+func (r *FileKeyStore) Delete(pub *derivation.Derivation) error {
+	err := os.Remove(r.path(pub))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "unable to delete private key for %s", pub.AsPrefix())
+	}
+
+	return nil
+}
+
+func (r *FileKeyStore) path(pub *derivation.Derivation) string {
+	return filepath.Join(r.dir, pub.AsPrefix())
+}
@@ -2,11 +2,9 @@ package keymanager
 
 import (
 	"crypto/ed25519"
-	"crypto/rand"
 	"encoding/json"
 
 	"github.com/google/tink/go/aead"
-	"github.com/google/tink/go/signature/subtle"
 	"github.com/google/tink/go/tink"
 	"github.com/pkg/errors"
 
@@ -14,29 +12,55 @@ import (
 	"github.com/decentralized-identity/kerigo/pkg/derivation"
 )
 
-type key struct {
-	Pub     ed25519.PublicKey `json:"pub"`
-	Priv    ed25519.PrivateKey
-	PrivDer *derivation.Derivation
-	signer  *subtle.ED25519Signer
+// KeyType is the signing algorithm used for the managed keys
+type KeyType int
+
+const (
+	Ed25519Key KeyType = iota
+	Secp256k1Key
+	P256Key
+)
+
+// keyTypeOf returns the key type of a public key derivation
+func keyTypeOf(code derivation.Code) (KeyType, error) {
+	switch code {
+	case derivation.Ed25519:
+		return Ed25519Key, nil
+	case derivation.EcDSA256k1:
+		return Secp256k1Key, nil
+	case derivation.EcDSA256r1:
+		return P256Key, nil
+	}
+
+	return 0, errors.Errorf("unsupported key derivation %s", code)
 }
 
 type KeyManager struct {
-	secrets   []string
-	current   *key
-	next      *key
-	enveloper *aead.KMSEnvelopeAEAD
-	store     db.DB
-	kw        tink.AEAD
+	keyType  KeyType
+	secrets  []string
+	keyCount int
+	current  []*derivation.Derivation
+	next     []*derivation.Derivation
+	keyStore KeyStore
+	store    db.DB
+	kw       tink.AEAD
 }
 
 type Option func(*KeyManager) error
 
+var errNoKeys = errors.New("no keys")
+
+// NewKeyManager loads the keys held in the store, generating them if
+// the store has none.
+//
+// WARNING: unless an AEAD is provided with WithAEAD, private keys held
+// by the default key store are saved to the store UNENCRYPTED.
 func NewKeyManager(opts ...Option) (*KeyManager, error) {
 
 	km := &KeyManager{
-		secrets: []string{},
-		kw:      &dummyAEAD{},
+		secrets:  []string{},
+		keyCount: 1,
+		kw:       &dummyAEAD{},
 	}
 
 	for _, o := range opts {
@@ -50,10 +74,16 @@ func NewKeyManager(opts ...Option) (*KeyManager, error) {
 		return nil, errors.New("must provide db")
 	}
 
-	km.enveloper = aead.NewKMSEnvelopeAEAD2(aead.AES256GCMKeyTemplate(), km.kw)
+	if km.keyStore == nil {
+		km.keyStore = newDBKeyStore(km.store, km.kw)
+	}
 
 	err := km.loadKeys()
-	if err != nil {
+	if err != nil && err != errNoKeys {
+		return nil, err
+	}
+
+	if err == errNoKeys {
 		km.current, err = km.nextKeys()
 		if err != nil {
 			return nil, err
@@ -73,6 +103,7 @@ func NewKeyManager(opts ...Option) (*KeyManager, error) {
 	return km, nil
 }
 
+// dummyAEAD does not encrypt anything, it is only used when no AEAD is provided
 type dummyAEAD struct{}
 
 func (d *dummyAEAD) Encrypt(plaintext, additionalData []byte) ([]byte, error) {
@@ -83,68 +114,187 @@ func (d *dummyAEAD) Decrypt(ciphertext, additionalData []byte) ([]byte, error) {
 	return ciphertext, nil
 }
 
-func (r *KeyManager) nextKeys() (*key, error) {
-
-	var privkey ed25519.PrivateKey
-	if len(r.secrets) > 0 {
-		var cur string
-		cur, r.secrets = r.secrets[0], r.secrets[1:]
-
-		der, err := derivation.FromPrefix(cur)
-		if err != nil {
-			return nil, err
+func (r *KeyManager) nextKeys() ([]*derivation.Derivation, error) {
+	keys := make([]*derivation.Derivation, r.keyCount)
+	for i := range keys {
+		var seed []byte
+		if len(r.secrets) > 0 {
+			var cur string
+			cur, r.secrets = r.secrets[0], r.secrets[1:]
+
+			der, err := derivation.FromPrefix(cur)
+			if err != nil {
+				return nil, err
+			}
+			seed = der.Raw
 		}
-		privkey = ed25519.NewKeyFromSeed(der.Raw)
 
-	} else {
-		var err error
-		_, privkey, err = ed25519.GenerateKey(rand.Reader)
+		pub, err := r.keyStore.Generate(r.keyType, seed)
 		if err != nil {
-			return nil, err
+			return nil, errors.Wrap(err, "unable to generate key")
 		}
-	}
-	pubkey := privkey.Public()
 
-	signer, err := subtle.NewED25519SignerFromPrivateKey(&privkey)
-	if err != nil {
-		return nil, err
+		keys[i] = pub
 	}
 
-	nextDer, err := derivation.New(derivation.WithCode(derivation.Ed25519), derivation.WithRaw(pubkey.(ed25519.PublicKey)))
-	if err != nil {
-		return nil, err
+	return keys, nil
+}
+
+// Signer returns a function that signs with the first current key.
+// The signing itself is delegated to the key store.
+func (r *KeyManager) Signer() derivation.Signer {
+	return r.SignerAt(0)
+}
+
+// SignerAt returns a function that signs with the current key at
+// the provided index
+func (r *KeyManager) SignerAt(idx int) derivation.Signer {
+	current := r.current[idx]
+	return func(data []byte) ([]byte, error) {
+		return r.keyStore.Sign(current, data)
 	}
+}
 
-	return &key{
-		Pub:     pubkey.(ed25519.PublicKey),
-		Priv:    privkey,
-		PrivDer: nextDer,
-		signer:  signer,
-	}, nil
+// PublicKey returns the raw bytes of the first current public key
+func (r *KeyManager) PublicKey() []byte {
+	return r.current[0].Raw
+}
 
+// Public returns the derivation of the first current public key
+func (r *KeyManager) Public() *derivation.Derivation {
+	return r.current[0]
 }
 
-func (r *KeyManager) Signer() derivation.Signer {
-	return r.current.signer.Sign
+// PublicKeys returns the derivations of all of the current public keys
+func (r *KeyManager) PublicKeys() []*derivation.Derivation {
+	return r.current
 }
 
-func (r *KeyManager) PublicKey() ed25519.PublicKey {
-	return r.current.Pub
+// SignatureCode returns the attached signature derivation
+// code for signatures created by the current keys
+func (r *KeyManager) SignatureCode() derivation.Code {
+	c, _ := r.current[0].Code.AttachedSignatureCode()
+	return c
 }
 
+// Next returns the derivation of the first next public key
 func (r *KeyManager) Next() *derivation.Derivation {
-	return r.next.PrivDer
+	return r.next[0]
+}
+
+// NextKeys returns the derivations of all of the next public keys
+func (r *KeyManager) NextKeys() []*derivation.Derivation {
+	return r.next
 }
 
+// Rotate makes the next keys current and generates new next keys. The
+// private keys that were current are deleted from the key store once the
+// rotation is saved, so they can no longer sign.
 func (r *KeyManager) Rotate() error {
+	rot, err := r.PrepareRotation()
+	if err != nil {
+		return err
+	}
+
+	return rot.Commit()
+}
+
+// Rotation is a rotation of the keys held by a key manager that has not
+// happened yet. The keys it rotates to can sign, so a rotation event can be
+// built and signed, while the key manager keeps its current keys until the
+// rotation is committed.
+type Rotation struct {
+	km      *KeyManager
+	secrets []string
+	current []*derivation.Derivation
+	next    []*derivation.Derivation
+}
+
+// PrepareRotation generates the new next keys for a rotation
+func (r *KeyManager) PrepareRotation() (*Rotation, error) {
+	secrets := r.secrets
+
 	next, err := r.nextKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Rotation{km: r, secrets: secrets, current: r.next, next: next}, nil
+}
+
+// PublicKeys returns the derivations of the keys that become current
+func (r *Rotation) PublicKeys() []*derivation.Derivation {
+	return r.current
+}
+
+// NextKeys returns the derivations of the new next keys
+func (r *Rotation) NextKeys() []*derivation.Derivation {
+	return r.next
+}
+
+// SignerAt returns a function that signs with the key that
+// becomes current at the provided index
+func (r *Rotation) SignerAt(idx int) derivation.Signer {
+	current := r.current[idx]
+	return func(data []byte) ([]byte, error) {
+		return r.km.keyStore.Sign(current, data)
+	}
+}
+
+// Commit makes the rotated keys current and deletes the private
+// keys that were current from the key store
+func (r *Rotation) Commit() error {
+	km := r.km
+	if !sameKeys(km.next, r.current) {
+		return errors.New("keys rotated since the rotation was prepared")
+	}
+
+	old := km.current
+	km.current = r.current
+	km.next = r.next
+
+	err := km.saveKeys()
 	if err != nil {
 		return err
 	}
 
-	r.current = r.next
-	r.next = next
-	return r.saveKeys()
+	for _, key := range old {
+		err = km.keyStore.Delete(key)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Abandon discards the rotation, deleting the next keys generated for it.
+// The key manager keeps its current and next keys.
+func (r *Rotation) Abandon() error {
+	r.km.secrets = r.secrets
+
+	for _, key := range r.next {
+		err := r.km.keyStore.Delete(key)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func sameKeys(a, b []*derivation.Derivation) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].AsPrefix() != b[i].AsPrefix() {
+			return false
+		}
+	}
+
+	return true
 }
 
 func (r *KeyManager) saveKeys() error {
@@ -161,18 +311,19 @@ func (r *KeyManager) saveKeys() error {
 	return nil
 }
 
-func (r *KeyManager) saveKey(name string, k *key) error {
-	ser, err := json.Marshal(k)
-	if err != nil {
-		return errors.Wrap(err, "unexpected error marshalling next key")
+// saveKey saves the public keys, the private keys are held by the key store
+func (r *KeyManager) saveKey(name string, keys []*derivation.Derivation) error {
+	pres := make([]string, len(keys))
+	for i, k := range keys {
+		pres[i] = k.AsPrefix()
 	}
 
-	enc, err := r.enveloper.Encrypt(ser, []byte{})
+	ser, err := json.Marshal(pres)
 	if err != nil {
-		return errors.Wrap(err, "unexpect error trying to encrypt current key")
+		return errors.Wrapf(err, "unexpected error marshalling key %s", name)
 	}
 
-	err = r.store.Put(name, enc)
+	err = r.store.Put(name, ser)
 	if err != nil {
 		return errors.Wrapf(err, "unable to save key %s", name)
 	}
@@ -180,44 +331,131 @@ func (r *KeyManager) saveKey(name string, k *key) error {
 	return nil
 }
 
+// loadKeys loads the current and next keys, returning errNoKeys if there
+// are none. Keys saved in the legacy format, before private keys were held
+// by a key store, are migrated to the key store. Later rotations generate
+// as many keys of the same type as the next keys, overriding any options.
 func (r *KeyManager) loadKeys() error {
-	var err error
-	r.current, err = r.loadKey("current")
+	_, err := r.store.Get("current")
 	if err != nil {
-		return err
+		return errNoKeys
+	}
+
+	migrated := false
+	for _, name := range []string{"current", "next"} {
+		keys, legacy, err := r.loadKey(name)
+		if err != nil {
+			return err
+		}
+
+		if name == "current" {
+			r.current = keys
+		} else {
+			r.next = keys
+		}
+
+		migrated = migrated || legacy
 	}
 
-	r.next, err = r.loadKey("next")
+	// rotate to as many keys of the same type as were pre-rotated
+	r.keyCount = len(r.next)
+	if r.keyCount == 0 {
+		return errors.New("no next keys saved")
+	}
+
+	r.keyType, err = keyTypeOf(r.next[0].Code)
 	if err != nil {
 		return err
 	}
 
+	if migrated {
+		return r.saveKeys()
+	}
+
 	return nil
 }
 
-func (r *KeyManager) loadKey(name string) (*key, error) {
-	enc, err := r.store.Get(name)
+// loadKey loads the named public keys, importing the private key into
+// the key store if it was saved in the legacy format
+func (r *KeyManager) loadKey(name string) ([]*derivation.Derivation, bool, error) {
+	ser, err := r.store.Get(name)
 	if err != nil {
-		return nil, errors.Wrapf(err, "unable to load key %s", name)
+		return nil, false, errors.Wrapf(err, "unable to load key %s", name)
 	}
 
-	ser, err := r.enveloper.Decrypt(enc, []byte{})
+	pres := []string{}
+	err = json.Unmarshal(ser, &pres)
 	if err != nil {
-		return nil, errors.Wrapf(err, "unable to load key %s", name)
+		key, err := r.migrateKey(ser)
+		if err != nil {
+			return nil, false, errors.Wrapf(err, "unable to read key %s", name)
+		}
+
+		return []*derivation.Derivation{key}, true, nil
 	}
 
-	k := &key{}
-	err = json.Unmarshal(ser, k)
+	keys := make([]*derivation.Derivation, len(pres))
+	for i, pre := range pres {
+		keys[i], err = derivation.FromPrefix(pre)
+		if err != nil {
+			return nil, false, errors.Wrapf(err, "unexpected error parsing key %s", name)
+		}
+	}
+
+	return keys, false, nil
+}
+
+// legacyKey is how a single Ed25519 key was saved, envelope encrypted,
+// before private keys were held by a key store
+type legacyKey struct {
+	Priv ed25519.PrivateKey
+}
+
+// migrateKey imports a legacy key into the key store
+func (r *KeyManager) migrateKey(enc []byte) (*derivation.Derivation, error) {
+	enveloper := aead.NewKMSEnvelopeAEAD2(aead.AES256GCMKeyTemplate(), r.kw)
+	ser, err := enveloper.Decrypt(enc, []byte{})
 	if err != nil {
-		return nil, errors.Wrapf(err, "unexpected error unmarshalling key %s", name)
+		return nil, errors.Wrap(err, "unable to decrypt legacy key")
 	}
 
-	k.signer, err = subtle.NewED25519SignerFromPrivateKey(&k.Priv)
+	k := &legacyKey{}
+	err = json.Unmarshal(ser, k)
 	if err != nil {
-		return nil, errors.Wrapf(err, "unexpected error creating signer for key %s", name)
+		return nil, errors.Wrap(err, "unexpected error unmarshalling legacy key")
+	}
+
+	if len(k.Priv) != ed25519.PrivateKeySize {
+		return nil, errors.New("invalid legacy key")
+	}
+
+	return r.keyStore.Generate(Ed25519Key, k.Priv.Seed())
+}
+
+// WithKeyCount sets the number of signing keys, and pre-rotated
+// next keys, held by the key manager
+func WithKeyCount(n int) Option {
+	return func(km *KeyManager) error {
+		if n < 1 {
+			return errors.New("key count must be at least 1")
+		}
+
+		km.keyCount = n
+		return nil
 	}
+}
 
-	return k, nil
+// WithKeyType sets the type of keys generated by the key manager
+func WithKeyType(t KeyType) Option {
+	return func(km *KeyManager) error {
+		switch t {
+		case Ed25519Key, Secp256k1Key, P256Key:
+			km.keyType = t
+			return nil
+		}
+
+		return errors.New("unsupported key type")
+	}
 }
 
 func WithSecrets(s []string) Option {
@@ -227,6 +465,17 @@ func WithSecrets(s []string) Option {
 	}
 }
 
+// WithKeyStore sets the store that holds the private keys. When not
+// provided, envelope encrypted keys are kept in the db from WithStore
+func WithKeyStore(ks KeyStore) Option {
+	return func(km *KeyManager) error {
+		km.keyStore = ks
+		return nil
+	}
+}
+
+// WithAEAD sets the AEAD used to encrypt keys in the default key store.
+// Without it private keys are saved to the store unencrypted.
 func WithAEAD(a tink.AEAD) Option {
 	return func(km *KeyManager) error {
 		km.kw = a
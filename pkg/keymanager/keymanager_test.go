@@ -1,7 +1,9 @@
 package keymanager
 
 import (
+	"crypto/ed25519"
 	"encoding/base64"
+	"encoding/json"
 	"testing"
 
 	"github.com/google/tink/go/aead"
@@ -9,6 +11,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/decentralized-identity/kerigo/pkg/db/mem"
+	"github.com/decentralized-identity/kerigo/pkg/derivation"
 )
 
 var (
@@ -84,6 +87,144 @@ func TestKeyManager(t *testing.T) {
 		assert.NotEmpty(t, b)
 	})
 
+	t.Run("prepared rotation", func(t *testing.T) {
+		km := keyMgr(t)
+		cur, next := km.Public().AsPrefix(), km.Next().AsPrefix()
+
+		rot, err := km.PrepareRotation()
+		assert.NoError(t, err)
+		assert.Equal(t, next, rot.PublicKeys()[0].AsPrefix())
+
+		// the prepared keys sign before the key manager rotates to them
+		_, err = rot.SignerAt(0)([]byte("test data"))
+		assert.NoError(t, err)
+		assert.Equal(t, cur, km.Public().AsPrefix())
+
+		// abandoning the rotation keeps the current keys
+		err = rot.Abandon()
+		assert.NoError(t, err)
+		assert.Equal(t, cur, km.Public().AsPrefix())
+		assert.Equal(t, next, km.Next().AsPrefix())
+
+		_, err = km.Signer()([]byte("test data"))
+		assert.NoError(t, err)
+
+		rot, err = km.PrepareRotation()
+		assert.NoError(t, err)
+
+		err = rot.Commit()
+		assert.NoError(t, err)
+		assert.Equal(t, next, km.Public().AsPrefix())
+		assert.Equal(t, rot.NextKeys()[0].AsPrefix(), km.Next().AsPrefix())
+
+		// a rotation prepared before another is committed is stale
+		stale, err := km.PrepareRotation()
+		assert.NoError(t, err)
+
+		err = km.Rotate()
+		assert.NoError(t, err)
+
+		err = stale.Commit()
+		assert.Error(t, err)
+	})
+}
+
+func TestKeyManagerKeyTypes(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyType KeyType
+		code    derivation.Code
+		sigCode derivation.Code
+	}{
+		{name: "secp256k1", keyType: Secp256k1Key, code: derivation.EcDSA256k1, sigCode: derivation.EcDSAAttached},
+		{name: "p256", keyType: P256Key, code: derivation.EcDSA256r1, sigCode: derivation.EcDSA256r1Attached},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			km := keyMgr(t, WithKeyType(tt.keyType), WithSecrets(secrets))
+			assert.NotNil(t, km)
+
+			assert.Len(t, km.PublicKey(), 33)
+			assert.Equal(t, tt.code, km.Public().Code)
+			assert.Equal(t, tt.code, km.Next().Code)
+			assert.Equal(t, tt.sigCode, km.SignatureCode())
+
+			next := km.Next().AsPrefix()
+
+			err := km.Rotate()
+			assert.NoError(t, err)
+			assert.Equal(t, next, km.Public().AsPrefix())
+
+			sig, err := km.Signer()([]byte("test data"))
+			assert.NoError(t, err)
+
+			der, err := derivation.New(derivation.WithCode(tt.sigCode), derivation.WithRaw(sig))
+			assert.NoError(t, err)
+			assert.NoError(t, derivation.VerifyWithAttachedSignature(km.Public(), der, []byte("test data")))
+		})
+	}
+
+	_, err := NewKeyManager(WithKeyType(KeyType(99)), WithStore(mem.New()))
+	assert.Error(t, err)
+}
+
+func TestKeyManagerKeyCount(t *testing.T) {
+	db := mem.New()
+	km, err := NewKeyManager(WithKeyCount(3), WithSecrets(secrets), WithStore(db))
+	assert.NoError(t, err)
+
+	assert.Len(t, km.PublicKeys(), 3)
+	assert.Len(t, km.NextKeys(), 3)
+	assert.Equal(t, km.PublicKeys()[0], km.Public())
+
+	next := km.NextKeys()
+	err = km.Rotate()
+	assert.NoError(t, err)
+	assert.Equal(t, next, km.PublicKeys())
+	assert.Len(t, km.NextKeys(), 3)
+
+	for i, key := range km.PublicKeys() {
+		sig, err := km.SignerAt(i)([]byte("test data"))
+		assert.NoError(t, err)
+
+		der, err := derivation.New(derivation.WithCode(derivation.Ed25519Attached), derivation.WithRaw(sig))
+		assert.NoError(t, err)
+		assert.NoError(t, derivation.VerifyWithAttachedSignature(key, der, []byte("test data")))
+	}
+
+	// all of the keys are reloaded from the db
+	km2, err := NewKeyManager(WithStore(db))
+	assert.NoError(t, err)
+	assert.Len(t, km2.PublicKeys(), 3)
+	assert.Equal(t, km.PublicKeys()[2].AsPrefix(), km2.PublicKeys()[2].AsPrefix())
+	assert.Equal(t, km.NextKeys()[2].AsPrefix(), km2.NextKeys()[2].AsPrefix())
+
+	_, err = NewKeyManager(WithKeyCount(0), WithStore(mem.New()))
+	assert.Error(t, err)
+}
+
+func TestKeyManagerReload(t *testing.T) {
+	db := mem.New()
+	km, err := NewKeyManager(WithKeyCount(3), WithKeyType(P256Key), WithStore(db))
+	assert.NoError(t, err)
+
+	// the number and type of keys are taken from the saved keys
+	km2, err := NewKeyManager(WithStore(db))
+	assert.NoError(t, err)
+
+	err = km2.Rotate()
+	assert.NoError(t, err)
+
+	assert.Len(t, km2.PublicKeys(), 3)
+	for i, key := range km2.PublicKeys() {
+		assert.Equal(t, km.NextKeys()[i].AsPrefix(), key.AsPrefix())
+	}
+
+	assert.Len(t, km2.NextKeys(), 3)
+	for _, key := range km2.NextKeys() {
+		assert.Equal(t, derivation.EcDSA256r1, key.Code)
+	}
 }
 
 func TestKeyManagerWithSecrets(t *testing.T) {
@@ -205,4 +346,68 @@ func TestDB(t *testing.T) {
 		assert.Equal(t, enc, enc2)
 
 	})
+
+	t.Run("legacy", func(t *testing.T) {
+		kh, err := keyset.NewHandle(aead.AES256GCMKeyTemplate())
+		assert.NoError(t, err)
+
+		a, err := aead.New(kh)
+		assert.NoError(t, err)
+
+		db := mem.New()
+		enveloper := aead.NewKMSEnvelopeAEAD2(aead.AES256GCMKeyTemplate(), a)
+
+		// keys saved before private keys were held by a key store
+		pubs := map[string]string{}
+		for i, name := range []string{"current", "next"} {
+			der, err := derivation.FromPrefix(secrets[i])
+			assert.NoError(t, err)
+
+			priv := ed25519.NewKeyFromSeed(der.Raw)
+			pub, err := derivation.New(derivation.WithCode(derivation.Ed25519), derivation.WithRaw(priv.Public().(ed25519.PublicKey)))
+			assert.NoError(t, err)
+			pubs[name] = pub.AsPrefix()
+
+			ser, err := json.Marshal(map[string]interface{}{"pub": priv.Public(), "Priv": priv, "PrivDer": pub})
+			assert.NoError(t, err)
+
+			enc, err := enveloper.Encrypt(ser, []byte{})
+			assert.NoError(t, err)
+			assert.NoError(t, db.Put(name, enc))
+		}
+
+		km, err := NewKeyManager(WithAEAD(a), WithStore(db))
+		assert.NoError(t, err)
+		assert.Equal(t, pubs["current"], km.Public().AsPrefix())
+		assert.Equal(t, pubs["next"], km.Next().AsPrefix())
+
+		sig, err := km.Signer()([]byte("test data"))
+		assert.NoError(t, err)
+		assert.True(t, ed25519.Verify(km.PublicKey(), []byte("test data"), sig))
+
+		// and are saved in the current format once migrated
+		cur, err := db.Get("current")
+		assert.NoError(t, err)
+		assert.NoError(t, json.Unmarshal(cur, &[]string{}))
+
+		km, err = NewKeyManager(WithAEAD(a), WithStore(db))
+		assert.NoError(t, err)
+		assert.Equal(t, pubs["current"], km.Public().AsPrefix())
+		assert.NoError(t, km.Rotate())
+		assert.Equal(t, pubs["next"], km.Public().AsPrefix())
+	})
+
+	t.Run("unreadable", func(t *testing.T) {
+		db := mem.New()
+		assert.NoError(t, db.Put("current", []byte("not a key")))
+		assert.NoError(t, db.Put("next", []byte("not a key")))
+
+		// keys that can not be read are never replaced
+		_, err := NewKeyManager(WithStore(db))
+		assert.Error(t, err)
+
+		cur, err := db.Get("current")
+		assert.NoError(t, err)
+		assert.Equal(t, "not a key", string(cur))
+	})
 }
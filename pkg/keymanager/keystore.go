@@ -0,0 +1,254 @@
+package keymanager
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"sync"
+
+	"github.com/google/tink/go/aead"
+	"github.com/google/tink/go/signature/subtle"
+	"github.com/google/tink/go/tink"
+	"github.com/pkg/errors"
+
+	"github.com/decentralized-identity/kerigo/pkg/db"
+	"github.com/decentralized-identity/kerigo/pkg/derivation"
+)
+
+// KeyStore holds the private keys used by the KeyManager. The KeyManager
+// only ever deals with public keys and asks the store to sign on its
+// behalf, so private keys can live anywhere: in memory, on disk, or
+// in a separate process such as a local signing daemon.
+type KeyStore interface {
+	// Generate creates a new key of the provided type and returns the
+	// derivation of its public key. If seed is provided the key is
+	// created from it, otherwise a random key is generated.
+	Generate(t KeyType, seed []byte) (*derivation.Derivation, error)
+
+	// Sign signs the data using the private key for the public key
+	Sign(pub *derivation.Derivation, data []byte) ([]byte, error)
+
+	// Delete removes the private key for the public key, after which
+	// it can no longer sign. Deleting an unknown key is not an error.
+	Delete(pub *derivation.Derivation) error
+}
+
+// privateKey is the representation of a private key shared
+// by the key stores provided by this package
+type privateKey struct {
+	Type KeyType `json:"type"`
+	Seed []byte  `json:"seed"`
+}
+
+func newPrivateKey(t KeyType, seed []byte) (*privateKey, error) {
+	if seed == nil {
+		seed = make([]byte, 32)
+		_, err := rand.Read(seed)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	k := &privateKey{Type: t, Seed: seed}
+
+	// make sure the seed is valid for the key type
+	_, err := k.public()
+	if err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// public returns the derivation of the public key
+func (k *privateKey) public() (*derivation.Derivation, error) {
+	var (
+		code derivation.Code
+		pub  []byte
+		err  error
+	)
+
+	switch k.Type {
+	case Ed25519Key:
+		code = derivation.Ed25519
+		pub = ed25519.NewKeyFromSeed(k.Seed).Public().(ed25519.PublicKey)
+	case Secp256k1Key:
+		code = derivation.EcDSA256k1
+		pub, err = derivation.Secp256k1PublicKey(k.Seed)
+	case P256Key:
+		code = derivation.EcDSA256r1
+		pub, err = derivation.P256PublicKey(k.Seed)
+	default:
+		return nil, errors.New("unsupported key type")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return derivation.New(derivation.WithCode(code), derivation.WithRaw(pub))
+}
+
+func (k *privateKey) sign(data []byte) ([]byte, error) {
+	switch k.Type {
+	case Ed25519Key:
+		priv := ed25519.NewKeyFromSeed(k.Seed)
+		signer, err := subtle.NewED25519SignerFromPrivateKey(&priv)
+		if err != nil {
+			return nil, err
+		}
+		return signer.Sign(data)
+	case Secp256k1Key:
+		return derivation.SignSecp256k1(k.Seed, data)
+	case P256Key:
+		return derivation.SignP256(k.Seed, data)
+	}
+
+	return nil, errors.New("unsupported key type")
+}
+
+// MemKeyStore keeps private keys in memory. Keys are lost
+// when the process exits, which makes it useful for tests.
+type MemKeyStore struct {
+	lock sync.RWMutex
+	keys map[string]*privateKey
+}
+
+func NewMemKeyStore() *MemKeyStore {
+	return &MemKeyStore{
+		keys: map[string]*privateKey{},
+	}
+}
+
+func (r *MemKeyStore) Generate(t KeyType, seed []byte) (*derivation.Derivation, error) {
+	k, err := newPrivateKey(t, seed)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, err := k.public()
+	if err != nil {
+		return nil, err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.keys[pub.AsPrefix()] = k
+
+	return pub, nil
+}
+
+func (r *MemKeyStore) Sign(pub *derivation.Derivation, data []byte) ([]byte, error) {
+	r.lock.RLock()
+	k, ok := r.keys[pub.AsPrefix()]
+	r.lock.RUnlock()
+
+	if !ok {
+		return nil, errors.Errorf("no private key for %s", pub.AsPrefix())
+	}
+
+	return k.sign(data)
+}
+
+func (r *MemKeyStore) Delete(pub *derivation.Derivation) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.keys, pub.AsPrefix())
+	return nil
+}
+
+// dbKeyStore keeps envelope encrypted private keys in a db.DB.
+// This is the key store used when one is not provided.
+type dbKeyStore struct {
+	store     db.DB
+	enveloper tink.AEAD
+}
+
+func newDBKeyStore(store db.DB, kw tink.AEAD) *dbKeyStore {
+	return &dbKeyStore{
+		store:     store,
+		enveloper: aead.NewKMSEnvelopeAEAD2(aead.AES256GCMKeyTemplate(), kw),
+	}
+}
+
+func (r *dbKeyStore) Generate(t KeyType, seed []byte) (*derivation.Derivation, error) {
+	k, err := newPrivateKey(t, seed)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, err := k.public()
+	if err != nil {
+		return nil, err
+	}
+
+	enc, err := encryptKey(r.enveloper, k)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.store.Put(privateKeyName(pub), enc)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to save private key")
+	}
+
+	return pub, nil
+}
+
+func (r *dbKeyStore) Sign(pub *derivation.Derivation, data []byte) ([]byte, error) {
+	enc, err := r.store.Get(privateKeyName(pub))
+	if err != nil {
+		return nil, errors.Wrapf(err, "no private key for %s", pub.AsPrefix())
+	}
+
+	k, err := decryptKey(r.enveloper, enc)
+	if err != nil {
+		return nil, err
+	}
+
+	return k.sign(data)
+}
+
+func (r *dbKeyStore) Delete(pub *derivation.Derivation) error {
+	err := r.store.Delete(privateKeyName(pub))
+	if err != nil {
+		return errors.Wrapf(err, "unable to delete private key for %s", pub.AsPrefix())
+	}
+
+	return nil
+}
+
+func privateKeyName(pub *derivation.Derivation) string {
+	return "key." + pub.AsPrefix()
+}
+
+func encryptKey(enveloper tink.AEAD, k *privateKey) ([]byte, error) {
+	ser, err := json.Marshal(k)
+	if err != nil {
+		return nil, errors.Wrap(err, "unexpected error marshalling private key")
+	}
+
+	enc, err := enveloper.Encrypt(ser, []byte{})
+	if err != nil {
+		return nil, errors.Wrap(err, "unexpected error encrypting private key")
+	}
+
+	return enc, nil
+}
+
+func decryptKey(enveloper tink.AEAD, enc []byte) (*privateKey, error) {
+	ser, err := enveloper.Decrypt(enc, []byte{})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decrypt private key")
+	}
+
+	k := &privateKey{}
+	err = json.Unmarshal(ser, k)
+	if err != nil {
+		return nil, errors.Wrap(err, "unexpected error unmarshalling private key")
+	}
+
+	return k, nil
+}
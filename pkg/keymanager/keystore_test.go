@@ -0,0 +1,137 @@
+package keymanager
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/google/tink/go/aead"
+	"github.com/google/tink/go/keyset"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/decentralized-identity/kerigo/pkg/db/mem"
+	"github.com/decentralized-identity/kerigo/pkg/derivation"
+)
+
+func TestKeyStores(t *testing.T) {
+	td, err := ioutil.TempDir("", "keystore-test-*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	kh, err := keyset.NewHandle(aead.AES256GCMKeyTemplate())
+	assert.NoError(t, err)
+
+	a, err := aead.New(kh)
+	assert.NoError(t, err)
+
+	_, err = NewFileKeyStore(td)
+	assert.Error(t, err, "keys must not be written to disk unencrypted")
+
+	fks, err := NewFileKeyStore(td, WithFileAEAD(a))
+	assert.NoError(t, err)
+
+	stores := map[string]KeyStore{
+		"mem":  NewMemKeyStore(),
+		"file": fks,
+		"db":   newDBKeyStore(mem.New(), a),
+	}
+
+	seed, err := derivation.FromPrefix(secrets[0])
+	assert.NoError(t, err)
+
+	for name, ks := range stores {
+		t.Run(name, func(t *testing.T) {
+			for _, kt := range []KeyType{Ed25519Key, Secp256k1Key, P256Key} {
+				pub, err := ks.Generate(kt, nil)
+				assert.NoError(t, err)
+
+				sig, err := ks.Sign(pub, []byte("test data"))
+				assert.NoError(t, err)
+
+				sc, err := pub.Code.AttachedSignatureCode()
+				assert.NoError(t, err)
+
+				der, err := derivation.New(derivation.WithCode(sc), derivation.WithRaw(sig))
+				assert.NoError(t, err)
+				assert.NoError(t, derivation.VerifyWithAttachedSignature(pub, der, []byte("test data")))
+			}
+
+			pub, err := ks.Generate(Ed25519Key, seed.Raw)
+			assert.NoError(t, err)
+			assert.Equal(t, "D8KY1sKmgyjAiUDdUBPNPyrSz_ad_Qf9yzhDNZlEKiMc", pub.AsPrefix())
+
+			unknown, err := derivation.FromPrefix("DSuhyBcPZEZLK-fcw5tzHn2N46wRCG_ZOoeKtWTOunRA")
+			assert.NoError(t, err)
+
+			_, err = ks.Sign(unknown, []byte("test data"))
+			assert.Error(t, err)
+
+			// deleted keys can no longer sign
+			err = ks.Delete(pub)
+			assert.NoError(t, err)
+
+			_, err = ks.Sign(pub, []byte("test data"))
+			assert.Error(t, err)
+
+			err = ks.Delete(unknown)
+			assert.NoError(t, err)
+		})
+	}
+
+	t.Run("file persists", func(t *testing.T) {
+		pub, err := fks.Generate(Ed25519Key, nil)
+		assert.NoError(t, err)
+
+		reopened, err := NewFileKeyStore(td, WithFileAEAD(a))
+		assert.NoError(t, err)
+
+		_, err = reopened.Sign(pub, []byte("test data"))
+		assert.NoError(t, err)
+
+		// the key is encrypted at rest
+		raw, err := ioutil.ReadFile(fks.path(pub))
+		assert.NoError(t, err)
+		assert.NotContains(t, string(raw), "seed")
+	})
+}
+
+func TestWithKeyStore(t *testing.T) {
+	ks := NewMemKeyStore()
+	db := mem.New()
+
+	km, err := NewKeyManager(WithKeyStore(ks), WithStore(db), WithSecrets(secrets))
+	assert.NoError(t, err)
+
+	cur := km.Public()
+	sig, err := km.Signer()([]byte("test data"))
+	assert.NoError(t, err)
+
+	expected, err := ks.Sign(cur, []byte("test data"))
+	assert.NoError(t, err)
+	assert.Equal(t, expected, sig)
+
+	// only the public keys are kept by the key manager
+	v, err := db.Get("current")
+	assert.NoError(t, err)
+	assert.Equal(t, `["`+cur.AsPrefix()+`"]`, string(v))
+
+	err = km.Rotate()
+	assert.NoError(t, err)
+
+	// the rotated out key can no longer sign
+	_, err = ks.Sign(cur, []byte("test data"))
+	assert.Error(t, err)
+
+	// a key manager reloaded from the db signs using the same key store
+	km2, err := NewKeyManager(WithKeyStore(ks), WithStore(db))
+	assert.NoError(t, err)
+	assert.Equal(t, km.Public().AsPrefix(), km2.Public().AsPrefix())
+	assert.Equal(t, km.Next().AsPrefix(), km2.Next().AsPrefix())
+
+	sig, err = km2.Signer()([]byte("test data"))
+	assert.NoError(t, err)
+
+	expected, err = km.Signer()([]byte("test data"))
+	assert.NoError(t, err)
+	assert.Equal(t, expected, sig)
+}
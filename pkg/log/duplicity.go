@@ -0,0 +1,199 @@
+package log
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/decentralized-identity/kerigo/pkg/event"
+)
+
+// ErrDuplicitous is returned for an event properly signed by the controller
+// that conflicts with the event accepted at the same sequence number. Both
+// events are recorded in the duplicitous log as evidence.
+var ErrDuplicitous = errors.New("conflicting event signed by the controller, added to duplicitous log")
+
+// Duplicity is a pair of conflicting events for the same sequence
+// number, both properly signed by the controller
+type Duplicity struct {
+	// Accepted is the event in the log
+	Accepted *event.Message
+
+	// Duplicitous is the event that conflicts with it
+	Duplicitous *event.Message
+}
+
+// Duplicity returns the duplicity recorded for this log ordered by sequence
+// number, with the signatures and receipts we hold for each event. The
+// receipts of the duplicitous event are those recorded with it.
+func (l *Log) Duplicity() ([]*Duplicity, error) {
+	out := []*Duplicity{}
+	err := l.db.StreamDuplicitous(l.prefix, func(accepted, dup *event.Message) error {
+		acc, err := l.withReceipts(accepted)
+		if err != nil {
+			return err
+		}
+
+		out = append(out, &Duplicity{Accepted: acc, Duplicitous: dup})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to load duplicitous log")
+	}
+
+	return out, nil
+}
+
+// duplicitous handles an event that conflicts with the event accepted at
+// its sequence number. If the controller signed it the pair is recorded as
+// duplicity, otherwise it is added to the likely duplicitous escrow.
+func (l *Log) duplicitous(state *event.Event, e *event.Message) error {
+	dig, err := e.Digest()
+	if err != nil {
+		return err
+	}
+
+	// events superseded by a recovery rotation are not evidence of duplicity
+	if l.superseded(dig) {
+		return errors.New("event superseded by a recovery rotation")
+	}
+
+	sn := e.Event.SequenceInt()
+	accepted := l.EventAt(sn)
+	if accepted == nil {
+		_ = l.db.EscrowLikelyDuplicitiousEvent(e)
+		return errors.New("likely duplictious event")
+	}
+
+	err = l.verifyDuplicitous(e)
+	if err != nil {
+		_ = l.db.EscrowLikelyDuplicitiousEvent(e)
+		return errors.Wrap(err, "likely duplictious event")
+	}
+
+	accDig, err := accepted.Digest()
+	if err != nil {
+		return err
+	}
+
+	known := false
+	err = l.db.StreamDuplicitous(l.prefix, func(_, dup *event.Message) error {
+		dupDig, _ := dup.Digest()
+		known = known || dupDig == dig
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to load duplicitous log")
+	}
+
+	witnesses, _ := witnessing(state.Witnesses, state.WitnessThreshold, e.Event)
+	err = verifyDuplicitousReceipts(witnesses, e)
+	if err != nil {
+		return errors.Wrap(err, "invalid receipt on duplicitous event")
+	}
+
+	// receipts are evidence too, they are kept with the duplicity record
+	// only, so they are never mixed with those of the accepted event
+	err = l.db.LogDuplicitousEvent(accDig, e)
+	if err != nil {
+		return errors.Wrap(err, "unable to log duplicitous event")
+	}
+
+	if known {
+		return errors.New("duplicitous event already recorded")
+	}
+
+	return ErrDuplicitous
+}
+
+// verifyDuplicitous verifies the event was signed by the controller with the
+// keys that were current at its sequence number. A conflicting rotation must
+// rotate to the keys committed to by the establishment event before it.
+func (l *Log) verifyDuplicitous(e *event.Message) error {
+	var signer *event.Event
+	switch e.Event.ILK() {
+	case event.ICP, event.DIP:
+		// a conflicting inception must be signed with the keys of the accepted one
+		signer = l.Inception()
+	case event.ROT, event.DRT:
+		prior := l.establishmentBefore(e.Event.SequenceInt())
+		if prior == nil {
+			return errors.New("unable to find prior establishment event")
+		}
+
+		err := verifyNextKeys(prior, e.Event)
+		if err != nil {
+			return err
+		}
+
+		signer = e.Event
+	case event.IXN:
+		signer = l.signingKeys(e.Event)
+	}
+
+	if signer == nil {
+		return errors.New("unable to find signing keys")
+	}
+
+	err := l.VerifySigs(signer, e)
+	if err != nil {
+		return err
+	}
+
+	if signer.SigThreshold != nil && !signer.SigThreshold.Satisfied(e.Signatures) {
+		return errors.New("signature threshold not met")
+	}
+
+	return nil
+}
+
+// verifyDuplicitousReceipts verifies the witness and non-transferable
+// receipts attached to a duplicitous event
+func verifyDuplicitousReceipts(witnesses []string, e *event.Message) error {
+	for _, rcpt := range e.WitnessReceipts {
+		err := verifyWitnessReceipt(witnesses, e, rcpt)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, rcpt := range e.NonTransferableReceipts {
+		key, err := nonTransferableKey(rcpt.EstPrefix)
+		if err != nil {
+			return err
+		}
+
+		err = verifyNonTransferableReceipt(key, e, rcpt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// withReceipts returns a copy of the message with the witness and
+// non-transferable receipts we hold for the event attached
+func (l *Log) withReceipts(msg *event.Message) (*event.Message, error) {
+	raw, err := msg.Raw()
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := event.NewMessage(msg.Event, event.WithRaw(raw), event.WithSignatures(msg.Signatures))
+	if err != nil {
+		return nil, err
+	}
+
+	m.TransferableReceipts = msg.TransferableReceipts
+
+	m.WitnessReceipts, err = l.WitnessReceipts(msg.Event)
+	if err != nil {
+		return nil, err
+	}
+
+	m.NonTransferableReceipts, err = l.NonTransferableReceipts(msg.Event)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
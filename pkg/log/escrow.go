@@ -1,7 +1,6 @@
 package log
 
 import (
-	"github.com/decentralized-identity/kerigo/pkg/derivation"
 	"github.com/decentralized-identity/kerigo/pkg/event"
 )
 
@@ -10,7 +9,7 @@ type Escrow map[string]*event.Message
 // Get returns the event message with all collected signatures
 // for the given event
 func (e Escrow) Get(evnt *event.Event) (*event.Message, error) {
-	digest, err := digestEvent(evnt)
+	digest, err := evnt.GetDigest()
 	if err != nil {
 		return nil, err
 	}
@@ -38,7 +37,7 @@ func (e Escrow) ForSequence(sequence int) []*event.Message {
 
 // Add a message to the escrow
 func (e Escrow) Add(m *event.Message) error {
-	digest, err := digestEvent(m.Event)
+	digest, err := m.Digest()
 	if err != nil {
 		return err
 	}
@@ -54,7 +53,7 @@ func (e Escrow) Add(m *event.Message) error {
 
 // Remove an event from the escrow
 func (e Escrow) Remove(m *event.Message) error {
-	digest, err := digestEvent(m.Event)
+	digest, err := m.Digest()
 	if err != nil {
 		return err
 	}
@@ -71,7 +70,7 @@ func (e Escrow) Remove(m *event.Message) error {
 // and returns them
 func (e Escrow) Clear(evnt event.Event) ([]*event.Message, error) {
 	sequence := evnt.SequenceInt()
-	digest, err := digestEvent(&evnt)
+	digest, err := evnt.GetDigest()
 	if err != nil {
 		return nil, err
 	}
@@ -88,14 +87,3 @@ func (e Escrow) Clear(evnt event.Event) ([]*event.Message, error) {
 
 	return dups, nil
 }
-
-// digestEvent creates a standard digest of events to use as their index in
-// the escrow
-func digestEvent(evnt *event.Event) (string, error) {
-	serialized, err := evnt.Serialize()
-	if err != nil {
-		return "", err
-	}
-
-	return event.DigestString(serialized, derivation.Blake3256)
-}
@@ -4,25 +4,71 @@ import (
 	"bytes"
 	"fmt"
 	"log"
+	"strconv"
+	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/decentralized-identity/kerigo/pkg/db"
 	"github.com/decentralized-identity/kerigo/pkg/derivation"
 	"github.com/decentralized-identity/kerigo/pkg/event"
+	"github.com/decentralized-identity/kerigo/pkg/prefix"
 )
 
+// ErrPendingSignatures is returned when an event has valid signatures
+// that do not yet meet the signing threshold. The event is held in the
+// pending escrow until enough signatures have been collected.
+var ErrPendingSignatures = errors.New("signature threshold not met, event added to pending escrow")
+
+// ErrMissingDelegation is returned for a delegated event when the delegator
+// has not yet anchored it in their log. The event is held in the delegated
+// escrow until the anchoring event from the delegator is seen.
+var ErrMissingDelegation = errors.New("delegating event not seen, event added to delegated escrow")
+
+// ErrPartiallyWitnessed is returned when an event is properly signed by the
+// controller but has not been receipted by enough of its witnesses. The event
+// is held in the partially witnessed escrow until enough receipts arrive.
+var ErrPartiallyWitnessed = errors.New("witness threshold not met, event added to partially witnessed escrow")
+
+// ErrReceiptEscrowed is returned for a receipt of an event that has not been
+// accepted yet. The receipt is held in the receipt escrow until the event is
+// accepted, at which point it is verified and stored.
+var ErrReceiptEscrowed = errors.New("receipted event not seen, receipt added to receipt escrow")
+
+// errUnverifiableReceipt is returned when the receipted event or the
+// establishment event of the receiptor has not been seen yet
+var errUnverifiableReceipt = errors.New("receipt can not be verified yet")
+
+type Option func(*Log)
+
 // Log contains the Key Event Log for a given identifier
 type Log struct {
-	db     db.DB
-	prefix string
+	db          db.DB
+	prefix      string
+	unwitnessed bool
 }
 
-func New(prefix string, db db.DB) *Log {
-	return &Log{
+func New(prefix string, db db.DB, opts ...Option) *Log {
+	l := &Log{
 		db:     db,
 		prefix: prefix,
 	}
+
+	for _, o := range opts {
+		o(l)
+	}
+
+	return l
+}
+
+// AcceptUnwitnessed accepts events signed by the controller without waiting
+// for the witness threshold to be met. Controllers use this for their own
+// log, and witnesses for the logs they witness, as both must accept an event
+// before it can be receipted.
+func AcceptUnwitnessed() Option {
+	return func(l *Log) {
+		l.unwitnessed = true
+	}
 }
 
 // Inception returns the inception event for this log
@@ -102,6 +148,9 @@ func (l *Log) KeyState() (*event.Event, error) {
 		if kst == nil {
 			kst = &event.Event{}
 			*kst = *e
+
+			// traits are set at inception and hold for the life of the identifier
+			kst.Config = append([]prefix.Trait{}, e.Config...)
 		}
 
 		// Assumption: these will always be provided in the messages
@@ -110,34 +159,7 @@ func (l *Log) KeyState() (*event.Event, error) {
 		kst.Next = e.Next
 		kst.WitnessThreshold = e.WitnessThreshold
 
-		// if you are adding or cutting witnesses, we ignore the witness list
-		if len(e.AddWitness) != 0 || len(e.RemoveWitness) != 0 {
-			for _, w := range e.RemoveWitness {
-				for ci, cw := range kst.Witnesses {
-					if w == cw {
-						kst.Witnesses = append(kst.Witnesses[:ci], kst.Witnesses[ci+1:]...)
-					}
-				}
-			}
-
-			// de-duping...not sure if this is really necessary?
-			for _, w := range e.AddWitness {
-				found := false
-				for _, cw := range kst.Witnesses {
-					if cw == w {
-						found = true
-						break
-					}
-				}
-				if !found {
-					kst.Witnesses = append(kst.Witnesses, w)
-				}
-			}
-
-		} else if len(e.Witnesses) != 0 {
-			// otherwise if we have an included list of witnesses
-			kst.Witnesses = e.Witnesses
-		}
+		kst.Witnesses, _ = witnessing(kst.Witnesses, kst.WitnessThreshold, e)
 
 		last = e
 		return nil
@@ -180,6 +202,143 @@ func (l *Log) KeyState() (*event.Event, error) {
 	return kst, nil
 }
 
+// KeyStateNotice returns an unsigned key state notice for the current state
+// of the log, describing its latest event and establishment event
+func (l *Log) KeyStateNotice() (*event.Event, error) {
+	if l.Size() == 0 {
+		return nil, errors.New("no events in log")
+	}
+
+	kst, err := l.KeyState()
+	if err != nil {
+		return nil, err
+	}
+
+	// only the state itself is copied from the kst, which starts out as
+	// a copy of the inception event
+	ksn := &event.Event{
+		Version:           kst.Version,
+		Prefix:            kst.Prefix,
+		Sequence:          l.Current().Sequence,
+		EventType:         event.KSN.String(),
+		SigThreshold:      kst.SigThreshold,
+		Keys:              kst.Keys,
+		Next:              kst.Next,
+		WitnessThreshold:  kst.WitnessThreshold,
+		Witnesses:         kst.Witnesses,
+		Config:            kst.Config,
+		LastEvent:         kst.LastEvent,
+		LastEstablishment: kst.LastEstablishment,
+		Datetime:          time.Now().UTC().Format(time.RFC3339Nano),
+	}
+
+	return ksn, nil
+}
+
+// Stale reports whether a verified key state notice describes a later
+// event than the latest event in the log. An error is returned if the
+// notice describes a different event at our latest sequence number.
+func (l *Log) Stale(ksn *event.Event) (bool, error) {
+	if ksn.Prefix != l.prefix {
+		return false, errors.New("invalid key state notice for this log")
+	}
+
+	if ksn.LastEvent == nil {
+		return false, errors.New("key state notice missing latest event")
+	}
+
+	if l.Size() == 0 {
+		return true, nil
+	}
+
+	sn := ksn.SequenceInt()
+	current := l.Current().SequenceInt()
+	if sn != current {
+		return sn > current, nil
+	}
+
+	msg, err := l.db.EventAt(l.prefix, sn)
+	if err != nil {
+		return false, err
+	}
+
+	dig, err := msg.Digest()
+	if err != nil {
+		return false, err
+	}
+
+	if dig != ksn.LastEvent.Digest {
+		return false, errors.Errorf("key state notice does not match event %d", sn)
+	}
+
+	return false, nil
+}
+
+// VerifySealedSignatures verifies the signatures on a message that were created
+// by the controller of this log, using the keys of the establishment event in
+// the seal. Non-transferable signers seal only their prefix, which is their key.
+func (l *Log) VerifySealedSignatures(seal *event.Seal, m *event.Message) error {
+	if seal.Prefix != l.prefix {
+		return errors.New("invalid seal for this log")
+	}
+
+	raw, err := m.Raw()
+	if err != nil {
+		return errors.Wrap(err, "unable to get signed bytes")
+	}
+
+	if len(m.Signatures) == 0 {
+		return errors.New("no attached signatures to verify")
+	}
+
+	if key, err := nonTransferableKey(seal.Prefix); err == nil {
+		for i := range m.Signatures {
+			err = derivation.VerifyWithAttachedSignature(key, &m.Signatures[i], raw)
+			if err != nil {
+				return errors.Wrap(err, "invalid signature")
+			}
+		}
+
+		return nil
+	}
+
+	est, err := l.db.EventAt(l.prefix, seal.SequenceInt())
+	if err != nil || est == nil {
+		return errors.Errorf("establishment event %s not seen for %s", seal.Sequence, l.prefix)
+	}
+
+	if !est.Event.IsEstablishment() {
+		return errors.New("signatures not sealed to an establishment event")
+	}
+
+	dig, err := est.Digest()
+	if err != nil {
+		return err
+	}
+
+	if dig != seal.Digest {
+		return errors.New("invalid establishment event seal")
+	}
+
+	for i, sig := range m.Signatures {
+		key, err := est.Event.KeyDerivation(int(sig.KeyIndex))
+		if err != nil {
+			return fmt.Errorf("unable to get key derivation for signing key at index %d (%s)", sig.KeyIndex, err)
+		}
+
+		err = derivation.VerifyWithAttachedSignature(key, &m.Signatures[i], raw)
+		if err != nil {
+			return fmt.Errorf("invalid signature for key at index %d", sig.KeyIndex)
+		}
+	}
+
+	if est.Event.SigThreshold != nil && !est.Event.SigThreshold.Satisfied(m.Signatures) {
+		return errors.New("signature threshold not met")
+	}
+
+	return nil
+}
+
 // Apply the provided event to the log
 // Apply will confirm the sequence number and digest for the new log
 // entry are correct before/ applying. If the event message is for an
@@ -199,6 +358,15 @@ func (l *Log) Apply(e *event.Message) error {
 	}
 
 	ilk := e.Event.ILK()
+
+	// the key of a non-transferable prefix can never change, so its
+	// inception is the only event in its log
+	_, err := nonTransferableKey(l.prefix)
+	basic := err == nil
+	if basic && ilk != event.ICP {
+		return fmt.Errorf("invalid %s event for non-transferable identifier", ilk)
+	}
+
 	state, err := l.KeyState()
 	if err != nil {
 		return fmt.Errorf("unable to build key state (%s)", err.Error())
@@ -208,19 +376,44 @@ func (l *Log) Apply(e *event.Message) error {
 		if ilk == event.ICP || ilk == event.DIP {
 			l.prefix = e.Event.Prefix
 
+			if basic {
+				err = validateNonTransferable(e.Event)
+				if err != nil {
+					return err
+				}
+			}
+
 			err := l.validateSigs(e.Event, e)
 			if err != nil {
 				return err
 			}
 
-			return l.db.LogEvent(e, true)
+			if ilk == event.DIP {
+				err = l.validateDelegation(e.Event.DelegatorSeal, e)
+				if err != nil {
+					return err
+				}
+			}
+
+			err = l.validateWitnessing(state, e)
+			if err != nil {
+				return err
+			}
+
+			err = l.db.LogEvent(e, true)
+			if err != nil {
+				return err
+			}
+
+			l.processReceiptEscrow()
+			return nil
 		} else {
 			return l.db.EscrowOutOfOrderEvent(e)
 		}
 	}
 
 	sn := e.Event.SequenceInt()
-	dig, _ := e.Event.GetDigest()
+	dig, _ := e.Digest()
 	lastsn := state.LastEvent.SequenceInt()
 	nextsn := lastsn + 1
 
@@ -229,19 +422,22 @@ func (l *Log) Apply(e *event.Message) error {
 			return fmt.Errorf("invalid sequence number %d for ICP event", sn)
 		}
 
-		latestEst, err := l.db.CurrentEstablishmentEvent(l.prefix)
+		inception, err := l.db.Inception(l.prefix)
 		if err != nil {
 			return err
 		}
 
-		latestDig, _ := latestEst.Event.GetDigest()
+		icpDig, _ := inception.Digest()
+		if dig != icpDig {
+			return l.duplicitous(state, e)
+		}
 
-		if dig != latestDig {
-			_ = l.db.EscrowLikelyDuplicitiousEvent(e)
-			return errors.New("likely duplictious ICP event")
+		err = l.VerifySigs(inception.Event, e)
+		if err != nil {
+			return err
 		}
 
-		err = l.VerifySigs(state, e)
+		err = l.logWitnessReceipts(inception.Event.Witnesses, e)
 		if err != nil {
 			return err
 		}
@@ -250,30 +446,49 @@ func (l *Log) Apply(e *event.Message) error {
 		return l.db.LogEvent(e, true)
 	}
 
+	if ilk == event.IXN && state.HasTrait(prefix.EstablishmentOnly) {
+		return errors.New("interaction events not allowed for establishment only identifier")
+	}
+
 	// ROT, DRT or IXN
 	if sn > nextsn {
 		//Our of order event
 		return l.db.EscrowOutOfOrderEvent(e)
-	} else if sn == nextsn || ((ilk == event.ROT || ilk == event.DRT) && (lastsn < sn || lastsn <= nextsn)) {
+	} else if sn == nextsn {
 
 		err = l.updateState(state, e)
 		if err != nil {
 			return err
 		}
 
-	} else {
-		// possibly duplilcate
-		latestDig, err := l.db.LastAcceptedDigest(l.prefix, sn)
+	} else if latestDig, err := l.db.LastAcceptedDigest(l.prefix, sn); err != nil {
+		return err
+	} else if dig != string(latestDig) {
+		// a rotation may recover from interaction events signed with
+		// compromised keys, anything else is possibly duplicitous
+		if ilk != event.ROT && ilk != event.DRT {
+			return l.duplicitous(state, e)
+		}
+
+		err = l.recover(state, e)
 		if err != nil {
 			return err
 		}
 
-		if dig != string(latestDig) {
-			_ = l.db.EscrowLikelyDuplicitiousEvent(e)
-			return errors.New("likely duplictious event")
+	} else {
+		// already accepted events were signed with the keys current at their
+		// sequence number, not necessarily the current keys
+		signer := l.signingKeys(e.Event)
+		if signer == nil {
+			return errors.New("unable to find signing keys")
+		}
+
+		err = l.VerifySigs(signer, e)
+		if err != nil {
+			return err
 		}
 
-		err = l.VerifySigs(state, e)
+		err = l.logWitnessReceipts(state.Witnesses, e)
 		if err != nil {
 			return err
 		}
@@ -287,173 +502,916 @@ func (l *Log) Apply(e *event.Message) error {
 	}
 
 	err = l.db.StreamPending(l.prefix, func(esc *event.Message) error {
-		dig, _ := esc.Event.GetDigest()
+		dig, _ := esc.Digest()
 		sn := esc.Event.SequenceInt()
 
-		err = l.Apply(esc)
+		// remove the event before applying it so it is not processed again
+		// from within Apply, it is escrowed again if still not ready
+		err = l.db.RemovePendingEscrow(l.prefix, sn, dig)
 		if err != nil {
-			log.Println("error processing escrowed event", dig)
+			log.Println("error removing pending escrowed item", dig)
 			return nil
 		}
 
-		err = l.db.RemovePendingEscrow(l.prefix, sn, dig)
-		if err != nil {
-			log.Println("error removing pending escrowed item", dig)
+		err = l.Apply(esc)
+		if err != nil && err != ErrPendingSignatures {
+			log.Println("error processing escrowed event", dig)
 			return nil
 		}
 
 		return nil
 	})
 
+	// receipts may have arrived before the events they receipt
+	l.processReceiptEscrow()
+
+	// this event may anchor events delegated by this identifier
+	if len(e.Event.Seals) > 0 {
+		_ = l.db.StreamDelegated(l.prefix, func(esc *event.Message) error {
+			dig, _ := esc.Digest()
+
+			err := l.db.RemoveDelegatedEscrow(l.prefix, esc.Event.Prefix, esc.Event.SequenceInt(), dig)
+			if err != nil {
+				log.Println("error removing delegated escrowed item", dig)
+				return nil
+			}
+
+			err = New(esc.Event.Prefix, l.db).Apply(esc)
+			if err != nil && err != ErrMissingDelegation {
+				log.Println("error processing delegated escrowed event", dig)
+			}
+
+			return nil
+		})
+	}
+
 	//b, _ := json.Marshal(e.Event)
 	//log.Print("Added valid event to KEL event = ", string(b), "\n\n")
 
 	return nil
 }
 
+// ApplyReceipt verifies and stores each signature of a vrc message for the
+// event. ErrReceiptEscrowed is returned if any of them could not be verified
+// yet and were escrowed.
 func (l *Log) ApplyReceipt(evt *event.Event, vrc *event.Message) error {
+	if len(vrc.Event.Seals) == 0 {
+		return errors.New("vrc missing establishment event seal")
+	}
 
-	for _, sig := range vrc.Signatures {
-
-		//TODO:  Verify receipt sig
-		//err = receiptorKEL.Verify(vrc)
-		//if err != nil {
-		//	return errors.Wrap(err, "unable to verify vrc signatures")
-		//}
-
-		opts := []event.ReceiptOpt{event.WithSignature(&sig)}
-
-		if len(vrc.Event.Seals) > 0 {
-			opts = append(opts, event.WithEstablishmentSeal(vrc.Event.Seals[0]))
-		}
-
-		rcpt, err := event.NewReceipt(evt, opts...)
+	escrowed := false
+	for i := range vrc.Signatures {
+		rcpt, err := event.NewReceipt(evt,
+			event.WithSignature(&vrc.Signatures[i]),
+			event.WithEstablishmentSeal(vrc.Event.Seals[0]),
+		)
 		if err != nil {
 			return err
 		}
 
-		err = l.db.LogTransferableReceipt(rcpt)
+		err = l.ApplyTransferableReceipt(rcpt)
+		if err == ErrReceiptEscrowed {
+			escrowed = true
+			continue
+		}
+
 		if err != nil {
 			return err
 		}
 	}
 
+	if escrowed {
+		return ErrReceiptEscrowed
+	}
+
 	return nil
 }
 
-// VerifySigs takes the current log key state and an event message
-// and validates the attached signatures
-func (l *Log) VerifySigs(state *event.Event, m *event.Message) error {
-	mRaw, err := m.Event.Serialize()
+// ApplyTransferableReceipt verifies a receipt from a signer with a
+// transferable identifier against the keys of the signer's establishment
+// event at the sealed sequence number and stores it. Receipts are escrowed
+// if the receipted event or the establishment event has not been seen yet.
+func (l *Log) ApplyTransferableReceipt(rcpt *event.Receipt) error {
+	if rcpt.Prefix != l.prefix {
+		return errors.New("invalid receipt for this log")
+	}
+
+	if rcpt.RctType != event.VRC {
+		return errors.New("not a transferable receipt")
+	}
+
+	err := l.verifyTransferableReceipt(rcpt)
+	if err == errUnverifiableReceipt {
+		err = l.db.EscrowTransferableReceipt(rcpt)
+		if err != nil {
+			return errors.Wrap(err, "unable to escrow receipt")
+		}
+
+		return ErrReceiptEscrowed
+	}
+
 	if err != nil {
 		return err
 	}
 
-	if len(m.Signatures) == 0 {
-		return errors.New("no attached signatures to verify")
+	return l.db.LogTransferableReceipt(rcpt)
+}
+
+// ApplyWitnessReceipt verifies a non-transferable receipt from one of the
+// designated witnesses of an event and stores it. Receipts for events in the
+// partially witnessed escrow may result in the event being accepted.
+func (l *Log) ApplyWitnessReceipt(rcpt *event.Receipt) error {
+	if rcpt.Prefix != l.prefix {
+		return errors.New("invalid receipt for this log")
 	}
 
-	for _, sig := range m.Signatures {
-		keyD, err := state.KeyDerivation(int(sig.KeyIndex))
-		if err != nil {
-			return fmt.Errorf("unable to get key derivation for signing key at index %d (%s)", sig.KeyIndex, err)
+	state, err := l.KeyState()
+	if err != nil {
+		return errors.Wrap(err, "unable to build key state")
+	}
+
+	msg, err := l.db.EventAt(l.prefix, rcpt.Sequence)
+	if err == nil {
+		dig, _ := msg.Digest()
+		if dig == rcpt.Digest {
+			return l.logWitnessReceipt(state.Witnesses, msg, rcpt)
 		}
+	}
 
-		err = derivation.VerifyWithAttachedSignature(keyD, &sig, mRaw)
-		if err != nil {
-			panic(fmt.Errorf("invalid signature for key at index %d", sig.KeyIndex))
+	var esc *event.Message
+	_ = l.db.StreamPartiallyWitnessed(l.prefix, func(m *event.Message) error {
+		dig, _ := m.Digest()
+		if dig == rcpt.Digest {
+			esc = m
 		}
+		return nil
+	})
+
+	if esc == nil {
+		return errors.New("receipted event not found")
+	}
+
+	witnesses, _ := witnessing(state.Witnesses, state.WitnessThreshold, esc.Event)
+	err = l.logWitnessReceipt(witnesses, esc, rcpt)
+	if err != nil {
+		return err
+	}
+
+	// remove the event before applying it again, it is escrowed
+	// again if there are still not enough receipts
+	err = l.db.RemovePartiallyWitnessedEscrow(l.prefix, rcpt.Sequence, rcpt.Digest)
+	if err != nil {
+		return fmt.Errorf("unable to remove event from partially witnessed escrow (%s)", err)
+	}
+
+	err = l.Apply(esc)
+	if err != nil && err != ErrPartiallyWitnessed {
+		return errors.Wrap(err, "unable to apply partially witnessed event")
 	}
 
 	return nil
 }
 
-func (l *Log) validateSigs(state *event.Event, m *event.Message) error {
-	err := l.VerifySigs(state, m)
+// ApplyNonTransferableReceipt verifies a receipt from a signer with a
+// non-transferable identifier against its basic prefix and stores it.
+// Receipts for events that have not been accepted yet are escrowed.
+func (l *Log) ApplyNonTransferableReceipt(rcpt *event.Receipt) error {
+	if rcpt.Prefix != l.prefix {
+		return errors.New("invalid receipt for this log")
+	}
+
+	key, err := nonTransferableKey(rcpt.EstPrefix)
 	if err != nil {
 		return err
 	}
 
-	if state.SigThreshold != nil && !state.SigThreshold.Satisfied(m.Signatures) {
-		err := l.db.EscrowPendingEvent(m)
+	msg, err := l.db.EventAt(l.prefix, rcpt.Sequence)
+	if err != nil || msg == nil {
+		err = l.db.EscrowNonTransferableReceipt(rcpt)
 		if err != nil {
-			return fmt.Errorf("unable to escrow event (%s)", err)
+			return errors.Wrap(err, "unable to escrow receipt")
 		}
 
-		return errors.New("signature threshold not met, event added to pending escrow")
+		return ErrReceiptEscrowed
 	}
 
-	return nil
+	return l.logNonTransferableReceipt(key, msg, rcpt)
 }
 
-func (l *Log) ReceiptsForEvent(evt *event.Event) [][]byte {
-	out := [][]byte{}
+// FullyWitnessed reports whether the accepted event at the sequence number
+// has been receipted by enough of its witnesses to meet the witness threshold.
+// Events that are only signed by the controller return false.
+func (l *Log) FullyWitnessed(sn int) (bool, error) {
+	var (
+		msg       *event.Message
+		witnesses []string
+		toad      string
+	)
+
+	err := l.db.StreamBySequenceNo(l.prefix, func(m *event.Message) error {
+		if m.Event.SequenceInt() > sn {
+			return nil
+		}
 
-	_ = l.db.StreamTransferableReceipts(evt.Prefix, evt.SequenceInt(), func(q []byte) error {
-		out = append(out, q)
+		witnesses, toad = witnessing(witnesses, toad, m.Event)
+		msg = m
 		return nil
 	})
+	if err != nil {
+		return false, err
+	}
 
-	return out
+	if msg == nil || msg.Event.SequenceInt() != sn {
+		return false, errors.New("event not found")
+	}
+
+	threshold, err := witnessThreshold(toad)
+	if err != nil {
+		return false, err
+	}
+
+	dig, err := msg.Digest()
+	if err != nil {
+		return false, err
+	}
+
+	return l.witnessCount(witnesses, dig) >= threshold, nil
 }
 
-func (l *Log) updateState(state *event.Event, e *event.Message) error {
-	ilk := e.Event.ILK()
+// WitnessReceipts returns the witness receipts stored for the event
+func (l *Log) WitnessReceipts(evt *event.Event) ([]*event.Receipt, error) {
+	return receiptCouplets(evt, l.db.StreamWitnessReceipts)
+}
 
-	if ilk == event.ROT || ilk == event.DRT {
-		// the latest establishment event has the current Next digest
-		lastEstablisment := l.EventAt(state.LastEstablishment.SequenceInt())
-		lastNextDig, err := derivation.FromPrefix(lastEstablisment.Event.Next)
-		if err != nil {
-			return fmt.Errorf("unable to parse next digest from last establishment event (%s)", err.Error())
-		}
+// NonTransferableReceipts returns the verified receipts stored for the
+// event from signers with non-transferable identifiers
+func (l *Log) NonTransferableReceipts(evt *event.Event) ([]*event.Receipt, error) {
+	return receiptCouplets(evt, l.db.StreamNonTransferableReceipts)
+}
 
-		// calculate the next digest based on the current keys/signing threshold
-		nextDig, err := e.Event.NextDigest(lastNextDig.Code)
-		if err != nil {
-			return fmt.Errorf("unable to parse next digest event (%s)", err.Error())
-		}
+// receiptCouplets loads the receipt couplets for the event from the stream
+func receiptCouplets(evt *event.Event, stream func(pre, dig string, handler func([]byte) error) error) ([]*event.Receipt, error) {
+	dig, err := evt.GetDigest()
+	if err != nil {
+		return nil, err
+	}
 
-		// this should match what was stored in the last establishment
-		if nextDig != lastNextDig.AsPrefix() {
-			return errors.New("next digest invalid")
+	out := []*event.Receipt{}
+	err = stream(evt.Prefix, dig, func(couplet []byte) error {
+		c, err := event.ParseAttachedCouplet(bytes.NewReader(couplet))
+		if err != nil {
+			return errors.Wrap(err, "unable to parse couplet")
 		}
 
-		err = l.validateSigs(e.Event, e)
+		rcpt, err := event.NewReceipt(evt,
+			event.WithQB64(couplet),
+			event.WithSignerPrefix(c.Prefix.AsPrefix()),
+			event.WithSignature(c.Signature),
+		)
 		if err != nil {
 			return err
 		}
 
-	} else {
-		// In order event or recovery event
-		// to support digest agility, we allow the current event to dictate what
-		// digest they want to use for the prior event
-		inDerivation, err := derivation.FromPrefix(e.Event.PriorEventDigest)
-		if err != nil {
-			return fmt.Errorf("unable to determine digest derivation (%s)", err)
-		}
+		out = append(out, rcpt)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		current := l.Current()
-		curSerialized, err := current.Serialize()
-		if err != nil {
-			return fmt.Errorf("unable to serialize current event (%s)", err)
-		}
+	return out, nil
+}
 
-		curDigest, err := event.Digest(curSerialized, inDerivation.Code)
-		if err != nil {
-			return fmt.Errorf("unable to digest current event (%s)", err)
-		}
+// validateWitnessing stores the witness receipts attached to the event and
+// makes sure enough of its witnesses have receipted it. Events that have not
+// been receipted by enough witnesses are added to the partially witnessed escrow.
+func (l *Log) validateWitnessing(state *event.Event, m *event.Message) error {
+	witnesses, toad := witnessing(state.Witnesses, state.WitnessThreshold, m.Event)
 
-		if !bytes.Equal(curDigest, inDerivation.Raw) {
-			// someone has tried to add an invalid event to the log
-			_ = l.db.EscrowLikelyDuplicitiousEvent(e)
-			return errors.New("invalid digest for new event")
-		}
+	threshold, err := witnessThreshold(toad)
+	if err != nil {
+		return err
+	}
 
-		err = l.validateSigs(state, e)
+	if threshold > len(witnesses) {
+		return fmt.Errorf("witness threshold %d larger than the number of witnesses", threshold)
+	}
+
+	err = l.logWitnessReceipts(witnesses, m)
+	if err != nil {
+		return err
+	}
+
+	dig, err := m.Digest()
+	if err != nil {
+		return err
+	}
+
+	if l.unwitnessed || l.witnessCount(witnesses, dig) >= threshold {
+		return nil
+	}
+
+	err = l.db.EscrowPartiallyWitnessedEvent(m)
+	if err != nil {
+		return fmt.Errorf("unable to escrow event (%s)", err)
+	}
+
+	return ErrPartiallyWitnessed
+}
+
+// logWitnessReceipts verifies and stores the witness receipts attached to the event
+func (l *Log) logWitnessReceipts(witnesses []string, m *event.Message) error {
+	for _, rcpt := range m.WitnessReceipts {
+		err := l.logWitnessReceipt(witnesses, m, rcpt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// logWitnessReceipt verifies the receipt was signed by one of the witnesses
+// using the key of its non-transferable prefix and stores it
+func (l *Log) logWitnessReceipt(witnesses []string, m *event.Message, rcpt *event.Receipt) error {
+	err := verifyWitnessReceipt(witnesses, m, rcpt)
+	if err != nil {
+		return err
+	}
+
+	return l.db.LogWitnessReceipt(rcpt)
+}
+
+// verifyWitnessReceipt verifies the receipt was signed by one of the
+// witnesses using the key of its non-transferable prefix
+func verifyWitnessReceipt(witnesses []string, m *event.Message, rcpt *event.Receipt) error {
+	witness := false
+	for _, w := range witnesses {
+		if w == rcpt.EstPrefix {
+			witness = true
+			break
+		}
+	}
+
+	if !witness {
+		return fmt.Errorf("receipt signer %s is not a witness", rcpt.EstPrefix)
+	}
+
+	key, err := derivation.FromPrefix(rcpt.EstPrefix)
+	if err != nil {
+		return errors.Wrap(err, "invalid witness prefix")
+	}
+
+	raw, err := m.Raw()
+	if err != nil {
+		return err
+	}
+
+	err = derivation.VerifyWithAttachedSignature(key, rcpt.Signature, raw)
+	if err != nil {
+		return errors.Wrap(err, "invalid witness receipt signature")
+	}
+
+	return nil
+}
+
+func (l *Log) logNonTransferableReceipt(key *derivation.Derivation, m *event.Message, rcpt *event.Receipt) error {
+	err := verifyNonTransferableReceipt(key, m, rcpt)
+	if err != nil {
+		return err
+	}
+
+	return l.db.LogNonTransferableReceipt(rcpt)
+}
+
+// verifyNonTransferableReceipt verifies the receipt is for the event and
+// was signed with the key of the signer's non-transferable prefix
+func verifyNonTransferableReceipt(key *derivation.Derivation, m *event.Message, rcpt *event.Receipt) error {
+	dig, err := m.Digest()
+	if err != nil {
+		return err
+	}
+
+	if dig != rcpt.Digest {
+		return errors.New("receipt does not match the accepted event")
+	}
+
+	raw, err := m.Raw()
+	if err != nil {
+		return err
+	}
+
+	err = derivation.VerifyWithAttachedSignature(key, rcpt.Signature, raw)
+	if err != nil {
+		return errors.Wrap(err, "invalid receipt signature")
+	}
+
+	return nil
+}
+
+func (l *Log) verifyTransferableReceipt(rcpt *event.Receipt) error {
+	msg, err := l.db.EventAt(l.prefix, rcpt.Sequence)
+	if err != nil || msg == nil {
+		return errUnverifiableReceipt
+	}
+
+	dig, err := msg.Digest()
+	if err != nil {
+		return err
+	}
+
+	if dig != rcpt.Digest {
+		return errors.New("receipt does not match the accepted event")
+	}
+
+	est, err := l.db.EventAt(rcpt.EstPrefix, rcpt.EstSequence)
+	if err != nil || est == nil {
+		return errUnverifiableReceipt
+	}
+
+	switch est.Event.ILK() {
+	case event.ICP, event.ROT, event.DIP, event.DRT:
+	default:
+		return errors.New("receipt not sealed to an establishment event")
+	}
+
+	estDig, err := est.Digest()
+	if err != nil {
+		return err
+	}
+
+	if estDig != rcpt.EstDigest {
+		return errors.New("invalid vrc seal")
+	}
+
+	key, err := est.Event.KeyDerivation(int(rcpt.Signature.KeyIndex))
+	if err != nil {
+		return fmt.Errorf("unable to get key derivation for signing key at index %d (%s)", rcpt.Signature.KeyIndex, err)
+	}
+
+	raw, err := msg.Raw()
+	if err != nil {
+		return err
+	}
+
+	err = derivation.VerifyWithAttachedSignature(key, rcpt.Signature, raw)
+	if err != nil {
+		return errors.Wrap(err, "invalid receipt signature")
+	}
+
+	return nil
+}
+
+// processReceiptEscrow stores the escrowed receipts that can now be verified
+func (l *Log) processReceiptEscrow() {
+	_ = l.db.StreamNonTransferableReceiptEscrow(l.prefix, func(rcpt *event.Receipt) error {
+		msg, err := l.db.EventAt(l.prefix, rcpt.Sequence)
+		if err != nil || msg == nil {
+			return nil
+		}
+
+		err = l.db.RemoveNonTransferableReceiptEscrow(rcpt)
+		if err != nil {
+			log.Println("error removing escrowed receipt", rcpt.Digest)
+			return nil
+		}
+
+		key, err := nonTransferableKey(rcpt.EstPrefix)
+		if err == nil {
+			err = l.logNonTransferableReceipt(key, msg, rcpt)
+		}
+
+		if err != nil {
+			log.Println("error processing escrowed receipt", rcpt.Digest, err)
+		}
+
+		return nil
+	})
+
+	// transferable receipts may be waiting on this event as either the
+	// receipted event or the establishment event of the receiptor
+	_ = l.db.StreamTransferableReceiptEscrow(func(rcpt *event.Receipt) error {
+		err := New(rcpt.Prefix, l.db).verifyTransferableReceipt(rcpt)
+		if err == errUnverifiableReceipt {
+			return nil
+		}
+
+		rerr := l.db.RemoveTransferableReceiptEscrow(rcpt)
+		if rerr != nil {
+			log.Println("error removing escrowed receipt", rcpt.Digest)
+			return nil
+		}
+
+		if err == nil {
+			err = l.db.LogTransferableReceipt(rcpt)
+		}
+
+		if err != nil {
+			log.Println("error processing escrowed receipt", rcpt.Digest, err)
+		}
+
+		return nil
+	})
+}
+
+// nonTransferableKey returns the public key of a non-transferable basic prefix
+func nonTransferableKey(pre string) (*derivation.Derivation, error) {
+	key, err := derivation.FromPrefix(pre)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid receipt signer prefix")
+	}
+
+	nt, err := key.Code.NonTransferableCode()
+	if err != nil || nt != key.Code {
+		return nil, errors.Errorf("receipt signer %s is not a non-transferable prefix", pre)
+	}
+
+	return key, nil
+}
+
+// validateNonTransferable makes sure the inception of a non-transferable
+// prefix has the prefix as its only key and commits to no next keys
+func validateNonTransferable(icp *event.Event) error {
+	if len(icp.Keys) != 1 || icp.Keys[0] != icp.Prefix {
+		return errors.New("non-transferable prefix must be its only key")
+	}
+
+	if icp.Next != "" {
+		return errors.New("non-transferable identifier can not commit to next keys")
+	}
+
+	return nil
+}
+
+// witnessCount returns the number of witnesses that have receipted the event
+func (l *Log) witnessCount(witnesses []string, dig string) int {
+	receipted := map[string]bool{}
+	_ = l.db.StreamWitnessReceipts(l.prefix, dig, func(couplet []byte) error {
+		c, err := event.ParseAttachedCouplet(bytes.NewReader(couplet))
+		if err != nil {
+			return nil
+		}
+
+		receipted[c.Prefix.AsPrefix()] = true
+		return nil
+	})
+
+	count := 0
+	for _, w := range witnesses {
+		if receipted[w] {
+			count++
+		}
+	}
+
+	return count
+}
+
+// witnessing returns the witnesses and witness threshold in effect once the
+// event has been applied on top of the current witnesses and threshold
+func witnessing(witnesses []string, toad string, e *event.Event) ([]string, string) {
+	switch e.ILK() {
+	case event.ICP, event.DIP:
+		return append([]string{}, e.Witnesses...), e.WitnessThreshold
+	case event.ROT, event.DRT:
+		// if you are adding or cutting witnesses, we ignore the witness list
+		if len(e.AddWitness) == 0 && len(e.RemoveWitness) == 0 {
+			if len(e.Witnesses) != 0 {
+				witnesses = e.Witnesses
+			}
+			return append([]string{}, witnesses...), e.WitnessThreshold
+		}
+
+		cut := map[string]bool{}
+		for _, w := range e.RemoveWitness {
+			cut[w] = true
+		}
+
+		out := []string{}
+		for _, w := range witnesses {
+			if !cut[w] {
+				out = append(out, w)
+			}
+		}
+
+		for _, w := range e.AddWitness {
+			found := false
+			for _, cw := range out {
+				if cw == w {
+					found = true
+					break
+				}
+			}
+			if !found {
+				out = append(out, w)
+			}
+		}
+
+		return out, e.WitnessThreshold
+	}
+
+	return witnesses, toad
+}
+
+// witnessThreshold parses the hex witness threshold of an event
+func witnessThreshold(toad string) (int, error) {
+	if toad == "" {
+		return 0, nil
+	}
+
+	t, err := strconv.ParseInt(toad, 16, 64)
+	if err != nil || t < 0 {
+		return 0, fmt.Errorf("invalid witness threshold %s", toad)
+	}
+
+	return int(t), nil
+}
+
+// VerifySigs takes the current log key state and an event message
+// and validates the attached signatures
+func (l *Log) VerifySigs(state *event.Event, m *event.Message) error {
+	err := m.VerifySize()
+	if err != nil {
+		return errors.Wrap(err, "invalid event size")
+	}
+
+	mRaw, err := m.Raw()
+	if err != nil {
+		return errors.Wrap(err, "unable to get signed event bytes")
+	}
+
+	if len(m.Signatures) == 0 {
+		return errors.New("no attached signatures to verify")
+	}
+
+	for _, sig := range m.Signatures {
+		keyD, err := state.KeyDerivation(int(sig.KeyIndex))
+		if err != nil {
+			return fmt.Errorf("unable to get key derivation for signing key at index %d (%s)", sig.KeyIndex, err)
+		}
+
+		err = derivation.VerifyWithAttachedSignature(keyD, &sig, mRaw)
+		if err != nil {
+			return fmt.Errorf("invalid signature for key at index %d", sig.KeyIndex)
+		}
+	}
+
+	return nil
+}
+
+func (l *Log) validateSigs(state *event.Event, m *event.Message) error {
+	err := l.VerifySigs(state, m)
+	if err != nil {
+		return err
+	}
+
+	if state.SigThreshold == nil || state.SigThreshold.Satisfied(m.Signatures) {
+		return nil
+	}
+
+	// signatures for the same event may arrive separately, for example from
+	// each of the controllers of a group identifier, so combine them with any
+	// already collected in the pending escrow
+	sigs := l.pendingSignatures(m)
+	if state.SigThreshold.Satisfied(sigs) {
+		m.Signatures = sigs
+
+		dig, _ := m.Digest()
+		err := l.db.RemovePendingEscrow(l.prefix, m.Event.SequenceInt(), dig)
+		if err != nil {
+			return fmt.Errorf("unable to remove event from pending escrow (%s)", err)
+		}
+
+		return nil
+	}
+
+	err = l.db.EscrowPendingEvent(m)
+	if err != nil {
+		return fmt.Errorf("unable to escrow event (%s)", err)
+	}
+
+	return ErrPendingSignatures
+}
+
+// pendingSignatures returns the signatures on the message merged with the
+// signatures from the pending escrow for the same event
+func (l *Log) pendingSignatures(m *event.Message) []derivation.Derivation {
+	dig, err := m.Digest()
+	if err != nil {
+		return m.Signatures
+	}
+
+	sigs := append([]derivation.Derivation{}, m.Signatures...)
+	_ = l.db.StreamPending(l.prefix, func(esc *event.Message) error {
+		escDig, _ := esc.Digest()
+		if escDig == dig {
+			sigs = mergeSignatures(sigs, esc.Signatures)
+		}
+		return nil
+	})
+
+	return sigs
+}
+
+// validateDelegation makes sure the delegator has approved the delegated
+// event by anchoring a seal of it in one of their events. Events that have
+// not been anchored yet are added to the delegated escrow.
+func (l *Log) validateDelegation(da *event.Seal, m *event.Message) error {
+	if da == nil || da.Prefix == "" {
+		return errors.New("delegated event missing delegator")
+	}
+
+	delegator := da.Prefix
+	if delegator == m.Event.Prefix {
+		return errors.New("identifier can not delegate to itself")
+	}
+
+	icp, err := l.db.Inception(delegator)
+	if err == nil && icp.Event.HasTrait(prefix.DoNotDelegate) {
+		return errors.New("delegator does not allow delegated identifiers")
+	}
+
+	dig, err := m.Digest()
+	if err != nil {
+		return err
+	}
+
+	anchored := false
+	if !l.db.Seen(delegator) {
+		err = l.db.EscrowDelegatedEvent(delegator, m)
+		if err != nil {
+			return fmt.Errorf("unable to escrow delegated event (%s)", err)
+		}
+
+		return ErrMissingDelegation
+	}
+
+	err = l.db.StreamBySequenceNo(delegator, func(msg *event.Message) error {
+		for _, seal := range msg.Event.Seals {
+			if seal.Prefix != m.Event.Prefix || seal.SequenceInt() != m.Event.SequenceInt() {
+				continue
+			}
+
+			if seal.Digest != dig {
+				return errors.New("delegator anchored a different event")
+			}
+
+			anchored = true
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("invalid delegation (%s)", err)
+	}
+
+	if anchored {
+		return nil
+	}
+
+	err = l.db.EscrowDelegatedEvent(delegator, m)
+	if err != nil {
+		return fmt.Errorf("unable to escrow delegated event (%s)", err)
+	}
+
+	return ErrMissingDelegation
+}
+
+func (l *Log) ReceiptsForEvent(evt *event.Event) [][]byte {
+	out := [][]byte{}
+
+	_ = l.db.StreamTransferableReceipts(evt.Prefix, evt.SequenceInt(), func(q []byte) error {
+		out = append(out, q)
+		return nil
+	})
+
+	return out
+}
+
+// signingKeys returns the establishment event holding the keys current at the
+// event's sequence number. Rotations are signed with the keys they rotate to.
+func (l *Log) signingKeys(e *event.Event) *event.Event {
+	if e.IsEstablishment() {
+		return e
+	}
+
+	return l.establishmentBefore(e.SequenceInt())
+}
+
+// establishmentBefore returns the last establishment event accepted before
+// the sequence number
+func (l *Log) establishmentBefore(sn int) *event.Event {
+	var est *event.Event
+	for _, evt := range l.EstablishmentEvents() {
+		if evt.SequenceInt() < sn {
+			est = evt
+		}
+	}
+
+	return est
+}
+
+// verifyNextKeys verifies the rotation's keys and signing threshold are the
+// ones committed to by the next digest of the prior establishment event
+func verifyNextKeys(prior, rot *event.Event) error {
+	lastNextDig, err := derivation.FromPrefix(prior.Next)
+	if err != nil {
+		return fmt.Errorf("unable to parse next digest from last establishment event (%s)", err.Error())
+	}
+
+	// calculate the next digest based on the current keys/signing threshold
+	nextDig, err := rot.NextDigest(lastNextDig.Code)
+	if err != nil {
+		return fmt.Errorf("unable to parse next digest event (%s)", err.Error())
+	}
+
+	// this should match what was stored in the last establishment
+	if nextDig != lastNextDig.AsPrefix() {
+		return errors.New("next digest invalid")
+	}
+
+	return nil
+}
+
+func (l *Log) updateState(state *event.Event, e *event.Message) error {
+	ilk := e.Event.ILK()
+
+	if ilk == event.ROT || ilk == event.DRT {
+		// delegated identifiers may only rotate with a delegated rotation
+		delegated := state.DelegatorSeal != nil
+		if delegated != (ilk == event.DRT) {
+			return fmt.Errorf("invalid %s event for this identifier", ilk)
+		}
+
+		// the latest establishment event has the current Next digest
+		lastEstablisment := l.EventAt(state.LastEstablishment.SequenceInt())
+		err := verifyNextKeys(lastEstablisment.Event, e.Event)
 		if err != nil {
 			return err
 		}
+
+		err = l.validateSigs(e.Event, e)
+		if err != nil {
+			return err
+		}
+
+		if ilk == event.DRT {
+			if e.Event.DelegatorSeal != nil && e.Event.DelegatorSeal.Prefix != state.DelegatorSeal.Prefix {
+				return errors.New("delegated rotation does not match delegator")
+			}
+
+			err = l.validateDelegation(state.DelegatorSeal, e)
+			if err != nil {
+				return err
+			}
+		}
+
+	} else {
+		// In order event or recovery event
+		// to support digest agility, we allow the current event to dictate what
+		// digest they want to use for the prior event
+		inDerivation, err := derivation.FromPrefix(e.Event.PriorEventDigest)
+		if err != nil {
+			return fmt.Errorf("unable to determine digest derivation (%s)", err)
+		}
+
+		current, err := l.db.CurrentEvent(l.prefix)
+		if err != nil {
+			return fmt.Errorf("unable to load current event (%s)", err)
+		}
+
+		curSerialized, err := current.Raw()
+		if err != nil {
+			return fmt.Errorf("unable to serialize current event (%s)", err)
+		}
+
+		curDigest, err := event.Digest(curSerialized, inDerivation.Code)
+		if err != nil {
+			return fmt.Errorf("unable to digest current event (%s)", err)
+		}
+
+		if !bytes.Equal(curDigest, inDerivation.Raw) {
+			// someone has tried to add an invalid event to the log
+			_ = l.db.EscrowLikelyDuplicitiousEvent(e)
+			return errors.New("invalid digest for new event")
+		}
+
+		err = l.validateSigs(state, e)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := l.validateWitnessing(state, e)
+	if err != nil {
+		return err
+	}
+
+	// a recovery rotation supersedes the events from its sequence number on
+	if sn := e.Event.SequenceInt(); sn < l.Size() {
+		err = l.db.SupersedeEvents(l.prefix, sn)
+		if err != nil {
+			return fmt.Errorf("unable to supersede events (%s)", err)
+		}
 	}
 
 	return l.db.LogEvent(e, true)
@@ -15,6 +15,7 @@ import (
 	"github.com/decentralized-identity/kerigo/pkg/prefix"
 	"github.com/decentralized-identity/kerigo/pkg/test"
 	testkms "github.com/decentralized-identity/kerigo/pkg/test/kms"
+	"github.com/decentralized-identity/kerigo/pkg/version"
 )
 
 // TODO: move these to approved test vectors in main keri repo
@@ -173,6 +174,7 @@ func TestVerifyAndApply(t *testing.T) {
 
 	// Valid sig invalid digest
 	ixn.PriorEventDigest = fmt.Sprintf("%s%s", derivation.Blake3256.String(), strings.Repeat("A", derivation.Blake3256.PrefixBase64Length()-1))
+	resize(t, ixn)
 	ser, err = ixn.Serialize()
 	assert.Nil(err)
 	_, err = der.Derive(ser)
@@ -187,6 +189,7 @@ func TestVerifyAndApply(t *testing.T) {
 
 	// Valid Sig/Digest - should apply
 	ixn.PriorEventDigest, err = icp.GetDigest()
+	resize(t, ixn)
 	assert.Nil(err)
 	ser, err = ixn.Serialize()
 	assert.Nil(err)
@@ -215,6 +218,7 @@ func TestVerifyAndApply(t *testing.T) {
 	)
 	assert.Nil(err)
 	ixn.PriorEventDigest = fmt.Sprintf("%s%s", derivation.Blake3256.String(), strings.Repeat("A", derivation.Blake3256.PrefixBase64Length()-1))
+	resize(t, ixn)
 
 	// No signatures - should silently ignore
 	assert.NoError(l.Apply(&event.Message{Event: ixn, Signatures: []derivation.Derivation{}}))
@@ -250,6 +254,7 @@ func TestVerifyAndApply(t *testing.T) {
 	assert.Nil(err)
 
 	rot.PriorEventDigest, err = l.Current().GetDigest()
+	resize(t, rot)
 	assert.Nil(err)
 
 	// Future event
@@ -261,6 +266,7 @@ func TestVerifyAndApply(t *testing.T) {
 	assert.Nil(err)
 
 	ixn.PriorEventDigest, err = rot.GetDigest()
+	resize(t, ixn)
 	assert.Nil(err)
 	ser, err = ixn.Serialize()
 	assert.Nil(err)
@@ -286,6 +292,150 @@ func TestVerifyAndApply(t *testing.T) {
 	//assert.Equal(ixn, crnt)
 }
 
+func TestVerifyAndApplyCBOR(t *testing.T) {
+	assert := assert.New(t)
+	db := mem.New()
+
+	kms := testkms.GetKMS(t, secrets, mem.New())
+	thresh, _ := event.NewSigThreshold(1)
+	icp := test.InceptionFromSecretsWithFormat(t, event.CBOR, []string{secrets[0]}, []string{secrets[1]}, *thresh, *thresh)
+
+	ser, err := icp.Serialize()
+	assert.NoError(err)
+	assert.Equal(event.VersionString(event.CBOR, version.Code(), len(ser)), icp.Version)
+
+	der, err := derivation.New(derivation.WithCode(derivation.Ed25519Attached), derivation.WithSigner(kms.Signer()))
+	assert.NoError(err)
+	_, err = der.Derive(ser)
+	assert.NoError(err)
+
+	l := New(icp.Prefix, db)
+	assert.NoError(l.Apply(&event.Message{Event: icp, Signatures: []derivation.Derivation{*der}}))
+	assert.Equal(1, l.Size())
+
+	dig, err := icp.GetDigest()
+	assert.NoError(err)
+
+	ixn, err := event.NewInteractionEvent(
+		event.WithSequence(1),
+		event.WithPrefix(icp.Prefix),
+		event.WithDigest(dig),
+		event.WithDefaultVersion(event.CBOR),
+	)
+	assert.NoError(err)
+
+	ser, err = ixn.Serialize()
+	assert.NoError(err)
+	assert.Equal(event.VersionString(event.CBOR, version.Code(), len(ser)), ixn.Version)
+
+	// signature over the JSON serialization must not verify
+	jsonSer, err := event.Serialize(ixn, event.JSON)
+	assert.NoError(err)
+	_, err = der.Derive(jsonSer)
+	assert.NoError(err)
+	assert.Error(l.VerifySigs(icp, &event.Message{Event: ixn, Signatures: []derivation.Derivation{*der}}))
+
+	_, err = der.Derive(ser)
+	assert.NoError(err)
+	assert.NoError(l.Apply(&event.Message{Event: ixn, Signatures: []derivation.Derivation{*der}}))
+	assert.Equal(2, l.Size())
+}
+
+func TestVerifyRawBytes(t *testing.T) {
+	assert := assert.New(t)
+	db := mem.New()
+
+	kms := testkms.GetKMS(t, secrets, mem.New())
+	thresh, _ := event.NewSigThreshold(1)
+	icp := test.InceptionFromSecrets(t, []string{secrets[0]}, []string{secrets[1]}, *thresh, *thresh)
+
+	ser, err := icp.Serialize()
+	assert.NoError(err)
+
+	// the same event, as received from an implementation
+	// that orders its fields differently
+	pre := fmt.Sprintf(`"i":"%s",`, icp.Prefix)
+	raw := []byte(strings.Replace(string(ser), pre, "", 1))
+	raw = []byte(strings.Replace(string(raw), `"t":"icp",`, `"t":"icp",`+pre, 1))
+	assert.Len(raw, len(ser))
+	assert.NotEqual(ser, raw)
+
+	evt, err := event.Deserialize(raw, event.JSON)
+	assert.NoError(err)
+
+	der, err := derivation.New(derivation.WithCode(derivation.Ed25519Attached), derivation.WithSigner(kms.Signer()))
+	assert.NoError(err)
+	_, err = der.Derive(raw)
+	assert.NoError(err)
+
+	l := New(icp.Prefix, db)
+
+	// re-serializing the event does not produce the signed bytes
+	assert.Error(l.VerifySigs(evt, &event.Message{Event: evt, Signatures: []derivation.Derivation{*der}}))
+
+	msg, err := event.NewMessage(evt, event.WithRaw(raw), event.WithSignatures([]derivation.Derivation{*der}))
+	assert.NoError(err)
+	assert.NoError(l.VerifySigs(evt, msg))
+	assert.NoError(l.Apply(msg))
+
+	// the event is identified by the digest of the bytes received
+	dig, err := event.DigestString(raw, derivation.Blake3256)
+	assert.NoError(err)
+	serDig, err := event.DigestString(ser, derivation.Blake3256)
+	assert.NoError(err)
+	assert.NotEqual(serDig, dig)
+
+	evtDig, err := msg.Event.GetDigest()
+	assert.NoError(err)
+	assert.Equal(dig, evtDig)
+
+	// without touching the event the message was created with
+	evtDig, err = evt.GetDigest()
+	assert.NoError(err)
+	assert.Equal(serDig, evtDig)
+
+	// so events are chained to the raw bytes, not the re-serialized event
+	for _, prior := range []string{serDig, dig} {
+		ixn, err := event.NewInteractionEvent(
+			event.WithSequence(1),
+			event.WithPrefix(icp.Prefix),
+			event.WithDigest(prior),
+			event.WithDefaultVersion(event.JSON),
+		)
+		assert.NoError(err)
+
+		ixnSer, err := ixn.Serialize()
+		assert.NoError(err)
+		ixnDer, err := derivation.New(derivation.WithCode(derivation.Ed25519Attached), derivation.WithSigner(kms.Signer()))
+		assert.NoError(err)
+		_, err = ixnDer.Derive(ixnSer)
+		assert.NoError(err)
+
+		err = l.Apply(&event.Message{Event: ixn, Signatures: []derivation.Derivation{*ixnDer}})
+		if prior == serDig {
+			assert.Error(err)
+			continue
+		}
+
+		assert.NoError(err)
+	}
+	assert.Equal(2, l.Size())
+
+	// a size that does not match the version string is rejected
+	padded := []byte(strings.Replace(string(raw), `,"c":[]`, `, "c":[]`, 1))
+	_, err = der.Derive(padded)
+	assert.NoError(err)
+
+	evt, err = event.Deserialize(raw, event.JSON)
+	assert.NoError(err)
+	msg, err = event.NewMessage(evt, event.WithRaw(padded), event.WithSignatures([]derivation.Derivation{*der}))
+	assert.NoError(err)
+	err = l.VerifySigs(evt, msg)
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "does not match event size")
+	}
+}
+
 func TestMultiSigApply(t *testing.T) {
 	assert := assert.New(t)
 
@@ -329,13 +479,14 @@ func TestMultiSigApply(t *testing.T) {
 	assert.Equal(1, l.Size())
 
 	// interaction event with all necessary signatures provided
+	dig, err := icp.GetDigest()
+	assert.Nil(err)
 	ixn, err := event.NewInteractionEvent(
 		event.WithSequence(1),
 		event.WithPrefix(icp.Prefix),
+		event.WithDigest(dig),
 	)
 	assert.Nil(err)
-	ixn.PriorEventDigest, err = icp.GetDigest()
-	assert.Nil(err)
 
 	ser, err = ixn.Serialize()
 	assert.Nil(err)
@@ -351,13 +502,14 @@ func TestMultiSigApply(t *testing.T) {
 	//assert.Len(l.Pending, 0)
 
 	// event with async signature receipt
+	dig, err = ixn.GetDigest()
+	assert.Nil(err)
 	ixn2, err := event.NewInteractionEvent(
 		event.WithSequence(2),
 		event.WithPrefix(icp.Prefix),
+		event.WithDigest(dig),
 	)
 	assert.Nil(err)
-	ixn2.PriorEventDigest, err = ixn.GetDigest()
-	assert.Nil(err)
 
 	ser, err = ixn2.Serialize()
 	assert.Nil(err)
@@ -369,20 +521,21 @@ func TestMultiSigApply(t *testing.T) {
 	assert.Nil(err)
 
 	// Not enough sigs
-	assert.Error(l.Apply(&event.Message{Event: ixn2, Signatures: []derivation.Derivation{*sigDer1}}))
+	assert.Equal(ErrPendingSignatures, l.Apply(&event.Message{Event: ixn2, Signatures: []derivation.Derivation{*sigDer1}}))
 	assert.Equal(2, l.Size())
 	//assert.Len(l.Pending, 1)
 
 	// enough. apply.
-	//assert.NoError(l.Apply(&event.Message{Event: ixn2, Signatures: []derivation.Derivation{*sigDer3}}))
-	//assert.Equal(3, l.Size())
+	assert.NoError(l.Apply(&event.Message{Event: ixn2, Signatures: []derivation.Derivation{*sigDer3}}))
+	assert.Equal(3, l.Size())
+	assert.Len(l.EventAt(2).Signatures, 2)
 	//assert.Len(l.Pending, 0)
 
 	// apply a late signature
-	//assert.NoError(l.Apply(&event.Message{Event: ixn2, Signatures: []derivation.Derivation{*sigDer2}}))
-	//assert.Equal(3, l.Size())
+	assert.NoError(l.Apply(&event.Message{Event: ixn2, Signatures: []derivation.Derivation{*sigDer2}}))
+	assert.Equal(3, l.Size())
 	//assert.Len(l.Pending, 0)
-	//assert.Len(l.EventAt(2).Signatures, 3)
+	assert.Len(l.EventAt(2).Signatures, 3)
 
 	// 3rd event
 	// event with async signature receipt
@@ -392,6 +545,7 @@ func TestMultiSigApply(t *testing.T) {
 	)
 	assert.Nil(err)
 	ixn3.PriorEventDigest, err = ixn2.GetDigest()
+	resize(t, ixn3)
 	assert.Nil(err)
 
 	// Create double future events
@@ -404,6 +558,7 @@ func TestMultiSigApply(t *testing.T) {
 	)
 	assert.Nil(err)
 	ixn4a.PriorEventDigest, err = ixn3.GetDigest()
+	resize(t, ixn4a)
 	assert.Nil(err)
 
 	ixn4b, err := event.NewInteractionEvent(
@@ -413,6 +568,7 @@ func TestMultiSigApply(t *testing.T) {
 	)
 	assert.Nil(err)
 	ixn4b.PriorEventDigest, err = ixn3.GetDigest()
+	resize(t, ixn4b)
 	assert.Nil(err)
 
 	ser, err = ixn4a.Serialize()
@@ -510,42 +666,149 @@ func newKeys(num int) ([]*basicKeys, error) {
 }
 
 func TestReceipts(t *testing.T) {
-	k, err := newKeys(2)
+	thresh, _ := event.NewSigThreshold(1)
+
+	// the controller and the receiptor each have their own keys and log
+	kms := testkms.GetKMS(t, secrets[:2], mem.New())
+	icp := test.InceptionFromSecrets(t, []string{secrets[0]}, []string{secrets[1]}, *thresh, *thresh)
+
+	rkms := testkms.GetKMS(t, secrets[2:4], mem.New())
+	est := test.InceptionFromSecrets(t, []string{secrets[2]}, []string{secrets[3]}, *thresh, *thresh)
+
+	sign := func(signer derivation.Signer, evt *event.Event) *derivation.Derivation {
+		ser, err := evt.Serialize()
+		assert.NoError(t, err)
+
+		der, err := derivation.New(derivation.WithCode(derivation.Ed25519Attached), derivation.WithSigner(signer))
+		assert.NoError(t, err)
+
+		_, err = der.Derive(ser)
+		assert.NoError(t, err)
+
+		return der
+	}
+
+	db := mem.New()
+	kel := New(icp.Prefix, db)
+	err := kel.Apply(&event.Message{Event: icp, Signatures: []derivation.Derivation{*sign(kms.Signer(), icp)}})
 	assert.NoError(t, err)
 
-	icp, err := event.NewInceptionEvent(event.WithDefaultVersion(event.JSON), event.WithKeys(k[0].pre))
+	vrc, err := event.NewReceipt(icp, event.WithSignature(sign(rkms.Signer(), icp)), event.WithEstablishmentEvent(est))
 	assert.NoError(t, err)
-	est, err := event.NewInceptionEvent(event.WithPrefix("Eh0fefvTQ55Jwps4dVnIekf7mZgWoU8bCUsDsKeGiEgU"),
-		event.WithDefaultVersion(event.JSON), event.WithKeys(k[1].pre))
+
+	msg, err := vrc.Message()
 	assert.NoError(t, err)
 
-	kms1 := testkms.GetKMS(t, secrets[:2], mem.New())
-	siger, err := derivation.New(derivation.WithCode(derivation.Ed25519Attached), derivation.WithSigner(kms1.Signer()))
+	// the receiptor's log has not been seen, so the receipt is escrowed
+	err = kel.ApplyReceipt(icp, msg)
+	assert.Equal(t, ErrReceiptEscrowed, err)
+	assert.Len(t, kel.ReceiptsForEvent(icp), 0)
+
+	// and verified once it has been
+	rkel := New(est.Prefix, db)
+	err = rkel.Apply(&event.Message{Event: est, Signatures: []derivation.Derivation{*sign(rkms.Signer(), est)}})
+	assert.NoError(t, err)
+
+	rcpts := kel.ReceiptsForEvent(icp)
+	assert.Len(t, rcpts, 1)
+
+	count := 0
+	_ = db.StreamTransferableReceiptEscrow(func(*event.Receipt) error {
+		count++
+		return nil
+	})
+	assert.Equal(t, 0, count)
+
+	// signatures that are not from the receiptor's keys are rejected
+	forged, err := event.NewReceipt(icp, event.WithSignature(sign(kms.Signer(), icp)), event.WithEstablishmentEvent(est))
+	assert.NoError(t, err)
+
+	msg, err = forged.Message()
+	assert.NoError(t, err)
+
+	err = kel.ApplyReceipt(icp, msg)
+	assert.Error(t, err)
+	assert.Len(t, kel.ReceiptsForEvent(icp), 1)
+}
+
+func TestNonTransferableReceipts(t *testing.T) {
+	kms := testkms.GetKMS(t, secrets, mem.New())
+	thresh, _ := event.NewSigThreshold(1)
+	icp := test.InceptionFromSecrets(t, []string{secrets[0]}, []string{secrets[1]}, *thresh, *thresh)
 
 	ser, err := icp.Serialize()
-	_, err = siger.Derive(ser)
+	assert.NoError(t, err)
+
+	der, err := derivation.New(derivation.WithCode(derivation.Ed25519Attached), derivation.WithSigner(kms.Signer()))
+	assert.NoError(t, err)
+	_, err = der.Derive(ser)
+	assert.NoError(t, err)
 
-	vrc, err := event.NewReceipt(icp, event.WithSignature(siger), event.WithEstablishmentEvent(est))
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
 	assert.NoError(t, err)
 
-	msg := &event.Message{
-		Event: icp,
+	signer := func(data []byte) ([]byte, error) {
+		return ed25519.Sign(priv, data), nil
 	}
 
-	db := mem.New()
-	kel := New(icp.Prefix, db)
-	err = kel.Apply(msg)
+	nt, err := derivation.New(derivation.WithCode(derivation.Ed25519NT), derivation.WithRaw(pub))
+	assert.NoError(t, err)
+
+	sig, err := derivation.New(derivation.WithCode(derivation.Ed25519Sig), derivation.WithSigner(signer))
+	assert.NoError(t, err)
+	_, err = sig.Derive(ser)
+	assert.NoError(t, err)
 
+	rcpt, err := event.NewReceipt(icp, event.WithSignerPrefix(nt.AsPrefix()), event.WithSignature(sig))
 	assert.NoError(t, err)
 
-	msg, err = vrc.Message()
+	db := mem.New()
+	l := New(icp.Prefix, db)
+
+	// receipts for events we have not seen are escrowed
+	err = l.ApplyNonTransferableReceipt(rcpt)
+	assert.Equal(t, ErrReceiptEscrowed, err)
+
+	rcpts, err := l.NonTransferableReceipts(icp)
 	assert.NoError(t, err)
+	assert.Len(t, rcpts, 0)
 
-	err = kel.ApplyReceipt(icp, msg)
+	// and stored once the event is accepted
+	assert.NoError(t, l.Apply(&event.Message{Event: icp, Signatures: []derivation.Derivation{*der}}))
+
+	rcpts, err = l.NonTransferableReceipts(icp)
 	assert.NoError(t, err)
+	if assert.Len(t, rcpts, 1) {
+		assert.Equal(t, nt.AsPrefix(), rcpts[0].EstPrefix)
+	}
 
-	rcpts := kel.ReceiptsForEvent(icp)
+	// the escrow is emptied
+	count := 0
+	_ = db.StreamNonTransferableReceiptEscrow(icp.Prefix, func(*event.Receipt) error {
+		count++
+		return nil
+	})
+	assert.Equal(t, 0, count)
+
+	// applying the receipt again is a no-op
+	assert.NoError(t, l.ApplyNonTransferableReceipt(rcpt))
+
+	rcpts, err = l.NonTransferableReceipts(icp)
+	assert.NoError(t, err)
 	assert.Len(t, rcpts, 1)
+
+	// signatures by another key are rejected
+	forged, err := event.NewReceipt(icp, event.WithSignerPrefix(nt.AsPrefix()), event.WithSignature(der))
+	assert.NoError(t, err)
+	assert.Error(t, l.ApplyNonTransferableReceipt(forged))
+
+	// as are signers with transferable prefixes
+	transferable, err := derivation.New(derivation.WithCode(derivation.Ed25519), derivation.WithRaw(pub))
+	assert.NoError(t, err)
+
+	rcpt, err = event.NewReceipt(icp, event.WithSignerPrefix(transferable.AsPrefix()), event.WithSignature(sig))
+	assert.NoError(t, err)
+	assert.Error(t, l.ApplyNonTransferableReceipt(rcpt))
 }
 
 func TestKeyState(t *testing.T) {
@@ -560,6 +823,7 @@ func TestKeyState(t *testing.T) {
 			Keys:      []string{"k1.1", "k1.2", "k1.3"},
 			Next:      "next1",
 			Witnesses: []string{"w1"},
+			Config:    []prefix.Trait{prefix.DoNotDelegate},
 		}},
 		{Event: &event.Event{
 			Prefix:     "pre",
@@ -626,6 +890,7 @@ func TestKeyState(t *testing.T) {
 	assert.Equal([]string{"k3.1"}, ks.Keys)
 	assert.Equal("next3", ks.Next)
 	assert.Equal([]string{"w1", "w2", "w4", "w42"}, ks.Witnesses)
+	assert.Equal([]prefix.Trait{prefix.DoNotDelegate}, ks.Config)
 	if assert.NotNil(ks.LastEstablishment) {
 		assert.Equal("4", ks.LastEstablishment.Sequence)
 		assert.Equal("EtIfYUO5H0zRUkzMfi1DHTMUWh0fIrLuEuaDHZc7jz2k", ks.LastEstablishment.Digest)
@@ -638,3 +903,91 @@ func TestKeyState(t *testing.T) {
 	}
 
 }
+
+func TestKeyStateNotice(t *testing.T) {
+	db := mem.New()
+	l := New("pre", db)
+
+	_, err := l.KeyStateNotice()
+	assert.Error(t, err)
+
+	evts := []*event.Message{
+		{Event: &event.Event{
+			Prefix:    "pre",
+			Version:   event.DefaultVersionString(event.JSON),
+			EventType: "icp",
+			Sequence:  "0",
+			Keys:      []string{"k1.1"},
+			Next:      "next1",
+			Witnesses: []string{"w1"},
+		}},
+		{Event: &event.Event{
+			Prefix:    "pre",
+			Version:   event.DefaultVersionString(event.JSON),
+			EventType: "ixn",
+			Sequence:  "1",
+		}},
+	}
+
+	for _, evt := range evts {
+		err := db.LogEvent(evt, true)
+		assert.NoError(t, err)
+	}
+
+	ksn, err := l.KeyStateNotice()
+	assert.NoError(t, err)
+	assert.Equal(t, event.KSN, ksn.ILK())
+	assert.Equal(t, "1", ksn.Sequence)
+	assert.Equal(t, []string{"k1.1"}, ksn.Keys)
+	assert.Equal(t, []string{"w1"}, ksn.Witnesses)
+	assert.NotEmpty(t, ksn.Datetime)
+	if assert.NotNil(t, ksn.LastEvent) && assert.NotNil(t, ksn.LastEstablishment) {
+		assert.Equal(t, "1", ksn.LastEvent.Sequence)
+		assert.Equal(t, "0", ksn.LastEstablishment.Sequence)
+	}
+
+	stale, err := l.Stale(ksn)
+	assert.NoError(t, err)
+	assert.False(t, stale)
+
+	// notices of later events mean our log is stale
+	later := *ksn
+	later.Sequence = "2"
+	stale, err = l.Stale(&later)
+	assert.NoError(t, err)
+	assert.True(t, stale)
+
+	earlier := *ksn
+	earlier.Sequence = "0"
+	stale, err = l.Stale(&earlier)
+	assert.NoError(t, err)
+	assert.False(t, stale)
+
+	// a different event at our latest sequence number is an error
+	seal := *ksn.LastEvent
+	seal.Digest = "Eother"
+	dup := *ksn
+	dup.LastEvent = &seal
+	_, err = l.Stale(&dup)
+	assert.Error(t, err)
+
+	// every notice is later than an empty log
+	stale, err = New("pre", mem.New()).Stale(ksn)
+	assert.NoError(t, err)
+	assert.True(t, stale)
+
+	_, err = New("other", db).Stale(ksn)
+	assert.Error(t, err)
+}
+
+// resize updates the size in the version string of an event
+// that has been modified after it was created
+func resize(t *testing.T, e *event.Event) {
+	f, err := event.FormatFromVersion(e.Version)
+	assert.NoError(t, err)
+
+	ser, err := e.Serialize()
+	assert.NoError(t, err)
+
+	e.Version = event.VersionString(f, version.Code(), len(ser))
+}
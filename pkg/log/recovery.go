@@ -0,0 +1,91 @@
+package log
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+
+	"github.com/decentralized-identity/kerigo/pkg/derivation"
+	"github.com/decentralized-identity/kerigo/pkg/event"
+)
+
+// Superseded returns the events removed from the log by recovery rotations,
+// ordered by sequence number, with the signatures and receipts we hold for them
+func (l *Log) Superseded() ([]*event.Message, error) {
+	out := []*event.Message{}
+	err := l.db.StreamSuperseded(l.prefix, func(msg *event.Message) error {
+		m, err := l.withReceipts(msg)
+		if err != nil {
+			return err
+		}
+
+		out = append(out, m)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to load superseded events")
+	}
+
+	return out, nil
+}
+
+// recover applies a rotation that supersedes the interaction events accepted
+// at and after its sequence number. The rotation must be signed by the keys
+// pre-rotated in the last establishment event, which it can't supersede, so
+// a rotation conflicting with an establishment event is duplicitous.
+func (l *Log) recover(state *event.Event, e *event.Message) error {
+	sn := e.Event.SequenceInt()
+	if sn <= state.LastEstablishment.SequenceInt() {
+		return l.duplicitous(state, e)
+	}
+
+	prior := l.EventAt(sn - 1)
+	if prior == nil {
+		return errors.Errorf("unable to find event %d preceding recovery rotation", sn-1)
+	}
+
+	err := chains(prior, e.Event)
+	if err != nil {
+		_ = l.db.EscrowLikelyDuplicitiousEvent(e)
+		return errors.Wrap(err, "invalid recovery rotation")
+	}
+
+	return l.updateState(state, e)
+}
+
+// superseded returns true if the event was removed from the log by a recovery rotation
+func (l *Log) superseded(dig string) bool {
+	found := false
+	_ = l.db.StreamSuperseded(l.prefix, func(msg *event.Message) error {
+		supDig, _ := msg.Digest()
+		found = found || supDig == dig
+		return nil
+	})
+
+	return found
+}
+
+// chains verifies the event's prior event digest is the digest of the raw prior
+// event. To support digest agility the event dictates the digest derivation.
+func chains(prior *event.Message, e *event.Event) error {
+	inDerivation, err := derivation.FromPrefix(e.PriorEventDigest)
+	if err != nil {
+		return errors.Errorf("unable to determine digest derivation (%s)", err)
+	}
+
+	ser, err := prior.Raw()
+	if err != nil {
+		return errors.Errorf("unable to serialize prior event (%s)", err)
+	}
+
+	dig, err := event.Digest(ser, inDerivation.Code)
+	if err != nil {
+		return errors.Errorf("unable to digest prior event (%s)", err)
+	}
+
+	if !bytes.Equal(dig, inDerivation.Raw) {
+		return errors.New("invalid digest for prior event")
+	}
+
+	return nil
+}
@@ -0,0 +1,207 @@
+// Package oobi resolves out-of-band introductions (OOBIs), URLs that tell us
+// where the key event log of an identifier can be fetched from, and serves
+// our own log at the URL others resolve it from.
+package oobi
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/decentralized-identity/kerigo/pkg/encoding/stream"
+	"github.com/decentralized-identity/kerigo/pkg/event"
+	"github.com/decentralized-identity/kerigo/pkg/keri"
+)
+
+// Path is the path OOBIs are served under
+const Path = "/oobi/"
+
+// maxLogSize is the most we read from an OOBI endpoint
+const maxLogSize = 10 << 20
+
+// OOBI is a parsed out-of-band introduction. The endpoint serves the log
+// of the identifier in the role, and is run by the identifier with the EID
+// prefix if it is not the identifier itself.
+type OOBI struct {
+	Prefix   string
+	Role     string
+	EID      string
+	Endpoint string
+}
+
+// New returns an OOBI for the log of the identifier served by the endpoint in the role
+func New(endpoint, pre, role, eid string) (*OOBI, error) {
+	return Parse(strings.TrimSuffix(endpoint, "/") + path(pre, role, eid))
+}
+
+// Parse parses an OOBI URL of the form http://host/oobi/{prefix}[/{role}[/{eid}]].
+// The role is the controller role if the URL does not have one.
+func Parse(raw string) (*OOBI, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid oobi url")
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.Errorf("unsupported oobi scheme %s", u.Scheme)
+	}
+
+	if u.Host == "" {
+		return nil, errors.New("oobi host required")
+	}
+
+	pre, role, eid, err := parsePath(u.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OOBI{
+		Prefix:   pre,
+		Role:     role,
+		EID:      eid,
+		Endpoint: fmt.Sprintf("%s://%s", u.Scheme, u.Host),
+	}, nil
+}
+
+// String returns the URL of the OOBI
+func (o *OOBI) String() string {
+	return o.Endpoint + path(o.Prefix, o.Role, o.EID)
+}
+
+// Resolve fetches the log of the identifier from the OOBI endpoint and
+// processes it into the database of the identity. Once the log has been
+// accepted the endpoint is recorded for the identifier.
+func Resolve(ctx context.Context, id *keri.Keri, raw string) (*OOBI, error) {
+	return ResolveWithClient(ctx, http.DefaultClient, id, raw)
+}
+
+// ResolveWithClient resolves the OOBI like Resolve, using the HTTP client
+func ResolveWithClient(ctx context.Context, client *http.Client, id *keri.Keri, raw string) (*OOBI, error) {
+	o, err := Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.String(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create oobi request")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to fetch oobi")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unable to fetch oobi: %s", resp.Status)
+	}
+
+	msgs, err := stream.NewReader(io.LimitReader(resp.Body, maxLogSize)).ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read oobi log")
+	}
+
+	// the endpoint is only trusted for the log of the identifier it introduces
+	kel := []*event.Message{}
+	for _, msg := range msgs {
+		if msg.Event.Prefix == o.Prefix {
+			kel = append(kel, msg)
+		}
+	}
+
+	_, err = id.ProcessEvents(kel...)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to process oobi log")
+	}
+
+	_, err = id.FindConnection(o.Prefix)
+	if err != nil {
+		return nil, errors.Errorf("oobi did not resolve the log of %s", o.Prefix)
+	}
+
+	err = id.AddEndpoint(o.Prefix, &keri.Endpoint{Role: o.Role, EID: o.EID, URL: o.Endpoint})
+	if err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// Handler serves the log of an identity at its controller OOBI
+type Handler struct {
+	id *keri.Keri
+}
+
+// NewHandler returns a handler that serves the log of the identity
+func NewHandler(id *keri.Keri) *Handler {
+	return &Handler{id: id}
+}
+
+// ServeHTTP serves the log of the identity as a stream of events
+// with their attachments
+func (h *Handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.NotFound(rw, req)
+		return
+	}
+
+	pre, role, _, err := parsePath(req.URL.Path)
+	if err != nil || pre != h.id.Prefix() || role != keri.ControllerRole {
+		http.NotFound(rw, req)
+		return
+	}
+
+	kerl, err := h.id.KERL(pre)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/cesr")
+
+	err = stream.NewWriter(rw, stream.WithSerializationMode(stream.ConjointMode)).WriteAll(kerl)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func parsePath(p string) (pre, role, eid string, err error) {
+	if !strings.HasPrefix(p, Path) {
+		return "", "", "", errors.Errorf("oobi path must start with %s", Path)
+	}
+
+	parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(p, Path), "/"), "/")
+	if len(parts) > 3 || parts[0] == "" {
+		return "", "", "", errors.New("invalid oobi path")
+	}
+
+	role = keri.ControllerRole
+	switch len(parts) {
+	case 3:
+		eid = parts[2]
+		fallthrough
+	case 2:
+		role = parts[1]
+	}
+
+	return parts[0], role, eid, nil
+}
+
+func path(pre, role, eid string) string {
+	p := Path + pre
+	if role != "" {
+		p += "/" + role
+	}
+
+	if eid != "" {
+		p += "/" + eid
+	}
+
+	return p
+}
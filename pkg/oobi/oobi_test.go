@@ -0,0 +1,162 @@
+package oobi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/decentralized-identity/kerigo/pkg/db/mem"
+	"github.com/decentralized-identity/kerigo/pkg/encoding/stream"
+	"github.com/decentralized-identity/kerigo/pkg/event"
+	"github.com/decentralized-identity/kerigo/pkg/keri"
+	testkms "github.com/decentralized-identity/kerigo/pkg/test/kms"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want *OOBI
+		err  string
+	}{
+		{
+			name: "controller",
+			url:  "http://127.0.0.1:5642/oobi/EaU6JR2nmwyZ-i0d8JZAoTNZH3ULvYAfSVPzhzS6b5CM/controller",
+			want: &OOBI{Prefix: "EaU6JR2nmwyZ-i0d8JZAoTNZH3ULvYAfSVPzhzS6b5CM", Role: keri.ControllerRole, Endpoint: "http://127.0.0.1:5642"},
+		},
+		{
+			name: "default role",
+			url:  "https://example.com/oobi/EaU6JR2nmwyZ-i0d8JZAoTNZH3ULvYAfSVPzhzS6b5CM",
+			want: &OOBI{Prefix: "EaU6JR2nmwyZ-i0d8JZAoTNZH3ULvYAfSVPzhzS6b5CM", Role: keri.ControllerRole, Endpoint: "https://example.com"},
+		},
+		{
+			name: "witness",
+			url:  "http://127.0.0.1:5642/oobi/EaU6JR2nmwyZ-i0d8JZAoTNZH3ULvYAfSVPzhzS6b5CM/witness/BGKVzj4ve0VSd8z_AmvhLg4lqcC_9WYX90k03q-R_Ydo/",
+			want: &OOBI{Prefix: "EaU6JR2nmwyZ-i0d8JZAoTNZH3ULvYAfSVPzhzS6b5CM", Role: keri.WitnessRole, EID: "BGKVzj4ve0VSd8z_AmvhLg4lqcC_9WYX90k03q-R_Ydo", Endpoint: "http://127.0.0.1:5642"},
+		},
+		{name: "scheme", url: "tcp://127.0.0.1:5642/oobi/Eabc", err: "unsupported oobi scheme tcp"},
+		{name: "path", url: "http://127.0.0.1:5642/kerl/Eabc", err: "oobi path must start with /oobi/"},
+		{name: "prefix", url: "http://127.0.0.1:5642/oobi/", err: "invalid oobi path"},
+		{name: "too long", url: "http://127.0.0.1:5642/oobi/Eabc/witness/Babc/extra", err: "invalid oobi path"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, err := Parse(tt.url)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, o)
+
+			again, err := Parse(o.String())
+			assert.NoError(t, err)
+			assert.Equal(t, o, again)
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	db := mem.New()
+	alice, err := keri.New(testkms.GetKMS(t, nil, db), db)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(NewHandler(alice))
+	defer srv.Close()
+
+	o, err := New(srv.URL, alice.Prefix(), keri.ControllerRole, "")
+	require.NoError(t, err)
+
+	db = mem.New()
+	bob, err := keri.New(testkms.GetKMS(t, nil, db), db)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = alice.Interaction(event.SealArray{})
+	require.NoError(t, err)
+
+	resolved, err := Resolve(ctx, bob, o.String())
+	require.NoError(t, err)
+	assert.Equal(t, o, resolved)
+
+	kel, err := bob.FindConnection(alice.Prefix())
+	require.NoError(t, err)
+	assert.Equal(t, 2, kel.Size())
+
+	ends, err := bob.Endpoints(alice.Prefix())
+	assert.NoError(t, err)
+	assert.Equal(t, []*keri.Endpoint{{Role: keri.ControllerRole, URL: srv.URL}}, ends)
+
+	// resolving again picks up the events since, signed with rotated keys
+	_, err = alice.Rotate()
+	require.NoError(t, err)
+
+	_, err = alice.Interaction(event.SealArray{})
+	require.NoError(t, err)
+
+	_, err = Resolve(ctx, bob, o.String())
+	require.NoError(t, err)
+	assert.Equal(t, 4, kel.Size())
+
+	// alice only serves her own log
+	o, err = New(srv.URL, bob.Prefix(), keri.ControllerRole, "")
+	require.NoError(t, err)
+
+	resp, err := http.Get(o.String())
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	_, err = Resolve(ctx, alice, o.String())
+	assert.Error(t, err)
+}
+
+func TestResolveOtherLogs(t *testing.T) {
+	db := mem.New()
+	alice, err := keri.New(testkms.GetKMS(t, nil, db), db)
+	require.NoError(t, err)
+
+	db = mem.New()
+	eve, err := keri.New(testkms.GetKMS(t, nil, db), db)
+	require.NoError(t, err)
+
+	// the endpoint introduces alice but also serves the log of eve
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		for _, id := range []*keri.Keri{alice, eve} {
+			kerl, err := id.KERL(id.Prefix())
+			require.NoError(t, err)
+
+			err = stream.NewWriter(rw).WriteAll(kerl)
+			require.NoError(t, err)
+		}
+	}))
+	defer srv.Close()
+
+	o, err := New(srv.URL, alice.Prefix(), keri.ControllerRole, "")
+	require.NoError(t, err)
+
+	db = mem.New()
+	bob, err := keri.New(testkms.GetKMS(t, nil, db), db)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = Resolve(ctx, bob, o.String())
+	require.NoError(t, err)
+
+	_, err = bob.FindConnection(alice.Prefix())
+	assert.NoError(t, err)
+
+	_, err = bob.FindConnection(eve.Prefix())
+	assert.Error(t, err)
+}
@@ -1,6 +1,9 @@
 package prefix
 
 import (
+	"encoding/json"
+	"fmt"
+
 	"github.com/decentralized-identity/kerigo/pkg/derivation"
 )
 
@@ -17,7 +20,7 @@ const (
 type Trait int
 
 const (
-	EstablishmentOnly = iota
+	EstablishmentOnly Trait = iota
 	DoNotDelegate
 )
 
@@ -26,12 +29,44 @@ var (
 		EstablishmentOnly: "EO",
 		DoNotDelegate:     "DND",
 	}
+
+	stringToTrait = map[string]Trait{
+		"EO":  EstablishmentOnly,
+		"DND": DoNotDelegate,
+	}
 )
 
 func (t Trait) String() string {
 	return traitToString[t]
 }
 
+// MarshalJSON outputs the trait as its string code, which is how
+// traits are represented in the "c" field of an event
+func (t Trait) MarshalJSON() ([]byte, error) {
+	s, ok := traitToString[t]
+	if !ok {
+		return nil, fmt.Errorf("unknown trait %d", t)
+	}
+
+	return json.Marshal(s)
+}
+
+func (t *Trait) UnmarshalJSON(b []byte) error {
+	s := ""
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return err
+	}
+
+	trait, ok := stringToTrait[s]
+	if !ok {
+		return fmt.Errorf("unknown trait %s", s)
+	}
+
+	*t = trait
+	return nil
+}
+
 type Prefix interface {
 	String() string
 	Derivation() *derivation.Derivation
@@ -0,0 +1,24 @@
+package prefix
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTraitJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	b, err := json.Marshal([]Trait{EstablishmentOnly, DoNotDelegate})
+	assert.NoError(err)
+	assert.Equal(`["EO","DND"]`, string(b))
+
+	traits := []Trait{}
+	err = json.Unmarshal(b, &traits)
+	assert.NoError(err)
+	assert.Equal([]Trait{EstablishmentOnly, DoNotDelegate}, traits)
+
+	err = json.Unmarshal([]byte(`["XX"]`), &traits)
+	assert.Error(err)
+}
@@ -13,6 +13,11 @@ import (
 )
 
 func InceptionFromSecrets(t *testing.T, keys, nexts []string, threshold, nextThreshold event.SigThreshold) *event.Event {
+	return InceptionFromSecretsWithFormat(t, event.JSON, keys, nexts, threshold, nextThreshold)
+}
+
+// InceptionFromSecretsWithFormat creates an inception event serialized using the provided format
+func InceptionFromSecretsWithFormat(t *testing.T, format event.FORMAT, keys, nexts []string, threshold, nextThreshold event.SigThreshold) *event.Event {
 	var keyPres, nextPres []prefix.Prefix
 
 	for _, k := range keys {
@@ -43,7 +48,7 @@ func InceptionFromSecrets(t *testing.T, keys, nexts []string, threshold, nextThr
 
 	icp, err := event.NewInceptionEvent(
 		event.WithKeys(keyPres...),
-		event.WithDefaultVersion(event.JSON),
+		event.WithDefaultVersion(format),
 		event.WithNext(nextThreshold.String(), derivation.Blake3256, nextPres...),
 	)
 	if !assert.NoError(t, err) {
@@ -56,7 +61,7 @@ func InceptionFromSecrets(t *testing.T, keys, nexts []string, threshold, nextThr
 	if !assert.NoError(t, err) {
 		return nil
 	}
-	icp.Version = event.VersionString(event.JSON, version.Code(), len(eventBytes))
+	icp.Version = event.VersionString(format, version.Code(), len(eventBytes))
 	icp.Prefix = ""
 
 	ser, err := icp.Serialize()
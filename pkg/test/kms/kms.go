@@ -11,7 +11,7 @@ import (
 	"github.com/decentralized-identity/kerigo/pkg/keymanager"
 )
 
-func GetKMS(t *testing.T, secrets []string, store db.DB) *keymanager.KeyManager {
+func GetKMS(t *testing.T, secrets []string, store db.DB, opts ...keymanager.Option) *keymanager.KeyManager {
 
 	kh, err := keyset.NewHandle(aead.AES256GCMKeyTemplate())
 	assert.NoError(t, err)
@@ -19,7 +19,8 @@ func GetKMS(t *testing.T, secrets []string, store db.DB) *keymanager.KeyManager
 	a, err := aead.New(kh)
 	assert.NoError(t, err)
 
-	km, err := keymanager.NewKeyManager(keymanager.WithAEAD(a), keymanager.WithSecrets(secrets), keymanager.WithStore(store))
+	opts = append([]keymanager.Option{keymanager.WithAEAD(a), keymanager.WithSecrets(secrets), keymanager.WithStore(store)}, opts...)
+	km, err := keymanager.NewKeyManager(opts...)
 	assert.NoError(t, err)
 
 	return km
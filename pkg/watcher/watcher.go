@@ -0,0 +1,498 @@
+// Package watcher watches the key event logs that witnesses and peers report
+// for a set of identifiers, and flags any divergence between them as duplicity.
+package watcher
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/decentralized-identity/kerigo/pkg/db/mem"
+	"github.com/decentralized-identity/kerigo/pkg/encoding/stream"
+	"github.com/decentralized-identity/kerigo/pkg/event"
+	klog "github.com/decentralized-identity/kerigo/pkg/log"
+)
+
+const (
+	// DefaultInterval is the time between checks when running the watcher
+	DefaultInterval = 30 * time.Second
+)
+
+// Source reports the key event log of an identifier as seen by a witness or peer
+type Source interface {
+	KERL(ctx context.Context, pre string) ([]*event.Message, error)
+}
+
+// SourceFunc adapts a function to a Source
+type SourceFunc func(ctx context.Context, pre string) ([]*event.Message, error)
+
+// KERL calls the function
+func (f SourceFunc) KERL(ctx context.Context, pre string) ([]*event.Message, error) {
+	return f(ctx, pre)
+}
+
+// HTTPSource fetches key event logs served over HTTP as a stream of
+// events, such as the KERL served by a witness or a controller OOBI
+type HTTPSource struct {
+	base   string
+	client *http.Client
+}
+
+// NewHTTPSource returns a source that fetches the log of an identifier from
+// the base URL followed by its prefix, e.g. http://127.0.0.1:5642/kerl/
+func NewHTTPSource(base string) *HTTPSource {
+	return &HTTPSource{base: base, client: http.DefaultClient}
+}
+
+// KERL fetches the log of the identifier
+func (s *HTTPSource) KERL(ctx context.Context, pre string) ([]*event.Message, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.base+pre, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create request")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to fetch log")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unable to fetch log: %s", resp.Status)
+	}
+
+	msgs, err := stream.NewReader(resp.Body).ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read log")
+	}
+
+	return msgs, nil
+}
+
+// Evidence is a signed event reported by a source
+type Evidence struct {
+	Source string
+	Event  *event.Message
+}
+
+// DuplicityReport holds two conflicting signed events for the
+// same sequence number of an identifier, and who reported them
+type DuplicityReport struct {
+	Prefix   string
+	Sequence int
+	Evidence [2]*Evidence
+	Detected time.Time
+}
+
+// SourceStatus is the latest event a source reported for an identifier.
+// The sequence number is -1 if the source has not reported any.
+type SourceStatus struct {
+	Sequence int
+	Digest   string
+	Error    error
+}
+
+// Status is the consistency of the logs the sources report for an identifier
+type Status struct {
+	Prefix     string
+	Consistent bool
+	Checked    time.Time
+	Sources    map[string]*SourceStatus
+	Duplicity  []*DuplicityReport
+}
+
+// Option configures a Watcher
+type Option func(*Watcher) error
+
+// Watcher compares the logs its sources report for the identifiers
+// it watches, flagging events that conflict at the same sequence number
+type Watcher struct {
+	lock     sync.RWMutex
+	sources  map[string]Source
+	statuses map[string]*Status
+	interval time.Duration
+	handler  func(*DuplicityReport)
+}
+
+// New returns a watcher configured by the options
+func New(opts ...Option) (*Watcher, error) {
+	w := &Watcher{
+		sources:  map[string]Source{},
+		statuses: map[string]*Status{},
+		interval: DefaultInterval,
+	}
+
+	for _, o := range opts {
+		err := o(w)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return w, nil
+}
+
+// WithSource adds a source, named by the prefix or address of the witness or peer
+func WithSource(name string, s Source) Option {
+	return func(w *Watcher) error {
+		if name == "" || s == nil {
+			return errors.New("source name and source required")
+		}
+
+		w.sources[name] = s
+		return nil
+	}
+}
+
+// WithPrefixes watches the identifiers
+func WithPrefixes(pres ...string) Option {
+	return func(w *Watcher) error {
+		for _, pre := range pres {
+			w.Watch(pre)
+		}
+
+		return nil
+	}
+}
+
+// WithInterval sets the time between checks when running the watcher
+func WithInterval(d time.Duration) Option {
+	return func(w *Watcher) error {
+		if d <= 0 {
+			return errors.New("interval must be positive")
+		}
+
+		w.interval = d
+		return nil
+	}
+}
+
+// WithDuplicityHandler sets the function called with each new duplicity report
+func WithDuplicityHandler(h func(*DuplicityReport)) Option {
+	return func(w *Watcher) error {
+		w.handler = h
+		return nil
+	}
+}
+
+// Watch adds the identifier to those the watcher checks
+func (w *Watcher) Watch(pre string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if _, ok := w.statuses[pre]; !ok {
+		w.statuses[pre] = &Status{Prefix: pre, Consistent: true, Sources: map[string]*SourceStatus{}}
+	}
+}
+
+// Unwatch stops checking the identifier and drops its status
+func (w *Watcher) Unwatch(pre string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	delete(w.statuses, pre)
+}
+
+// Prefixes returns the identifiers being watched
+func (w *Watcher) Prefixes() []string {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+
+	out := make([]string, 0, len(w.statuses))
+	for pre := range w.statuses {
+		out = append(out, pre)
+	}
+	sort.Strings(out)
+
+	return out
+}
+
+// Status returns the consistency of the logs reported for the identifier
+// as of the latest check
+func (w *Watcher) Status(pre string) (*Status, error) {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+
+	st, ok := w.statuses[pre]
+	if !ok {
+		return nil, errors.Errorf("%s is not being watched", pre)
+	}
+
+	out := *st
+	out.Sources = make(map[string]*SourceStatus, len(st.Sources))
+	for name, s := range st.Sources {
+		ss := *s
+		out.Sources[name] = &ss
+	}
+	out.Duplicity = append([]*DuplicityReport{}, st.Duplicity...)
+
+	return &out, nil
+}
+
+// Run checks the watched identifiers every interval until the context is done
+func (w *Watcher) Run(ctx context.Context) error {
+	t := time.NewTicker(w.interval)
+	defer t.Stop()
+
+	for {
+		w.Check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// Check asks every source for the logs of the watched identifiers and
+// compares them, returning the duplicity found that had not been reported
+func (w *Watcher) Check(ctx context.Context) []*DuplicityReport {
+	out := []*DuplicityReport{}
+	for _, pre := range w.Prefixes() {
+		out = append(out, w.check(ctx, pre)...)
+	}
+
+	return out
+}
+
+// reported is the verified log a source reported for an identifier,
+// along with the key state notice for it
+type reported struct {
+	name string
+	msgs []*event.Message
+	ksn  *event.Event
+	err  error
+}
+
+func (w *Watcher) check(ctx context.Context, pre string) []*DuplicityReport {
+	w.lock.RLock()
+	names := make([]string, 0, len(w.sources))
+	for name := range w.sources {
+		names = append(names, name)
+	}
+	w.lock.RUnlock()
+	sort.Strings(names)
+
+	res := make([]*reported, len(names))
+	wg := sync.WaitGroup{}
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+
+			r := &reported{name: name}
+			r.msgs, r.err = w.sources[name].KERL(ctx, pre)
+			if r.err == nil {
+				r.msgs, r.ksn, r.err = verify(pre, r.msgs)
+			}
+
+			res[i] = r
+		}(i, name)
+	}
+	wg.Wait()
+
+	sources := map[string]*SourceStatus{}
+	for _, r := range res {
+		ss := &SourceStatus{Sequence: -1, Error: r.err}
+		if r.ksn != nil {
+			ss.Sequence, ss.Digest = r.ksn.SequenceInt(), r.ksn.LastEvent.Digest
+		}
+
+		sources[r.name] = ss
+	}
+
+	found := compare(pre, res)
+
+	w.lock.Lock()
+	st, ok := w.statuses[pre]
+	if !ok {
+		w.lock.Unlock()
+		return nil
+	}
+
+	st.Checked = time.Now()
+	st.Sources = sources
+
+	out := []*DuplicityReport{}
+	for _, d := range found {
+		if !st.known(d) {
+			st.Duplicity = append(st.Duplicity, d)
+			out = append(out, d)
+		}
+	}
+
+	st.Consistent = len(st.Duplicity) == 0
+	h := w.handler
+	w.lock.Unlock()
+
+	if h != nil {
+		for _, d := range out {
+			h(d)
+		}
+	}
+
+	return out
+}
+
+// known returns true if the duplicity has already been reported
+func (s *Status) known(d *DuplicityReport) bool {
+	dig := func(e *Evidence) string {
+		dig, _ := e.Event.Event.GetDigest()
+		return dig
+	}
+
+	for _, r := range s.Duplicity {
+		if r.Sequence != d.Sequence {
+			continue
+		}
+
+		a, b := dig(r.Evidence[0]), dig(r.Evidence[1])
+		x, y := dig(d.Evidence[0]), dig(d.Evidence[1])
+		if (a == x && b == y) || (a == y && b == x) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// compare reports the first pair of sources that disagree on the event at
+// each sequence number. Sources agree when the key state one reports, its
+// sequence number and digest, is in the log of the other, or when the log of
+// one has moved on with a recovery rotation that supersedes the interaction
+// events the other reports.
+func compare(pre string, res []*reported) []*DuplicityReport {
+	out := []*DuplicityReport{}
+	flagged := map[int]bool{}
+	now := time.Now()
+
+	for i, a := range res {
+		for _, b := range res[i+1:] {
+			sn, ok := diverges(a, b)
+			if !ok || flagged[sn] {
+				continue
+			}
+			flagged[sn] = true
+
+			out = append(out, &DuplicityReport{
+				Prefix:   pre,
+				Sequence: sn,
+				Evidence: [2]*Evidence{{Source: a.name, Event: a.msgs[sn]}, {Source: b.name, Event: b.msgs[sn]}},
+				Detected: now,
+			})
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Sequence < out[j].Sequence
+	})
+
+	return out
+}
+
+// diverges returns the sequence number of the first event the sources
+// disagree on, and false if they agree
+func diverges(a, b *reported) (int, bool) {
+	if a.ksn == nil || b.ksn == nil {
+		return 0, false
+	}
+
+	behind, ahead := a, b
+	if behind.ksn.SequenceInt() > ahead.ksn.SequenceInt() {
+		behind, ahead = b, a
+	}
+
+	// the source that is behind reports a key state the other has seen
+	sn := behind.ksn.SequenceInt()
+	dig, err := ahead.msgs[sn].Event.GetDigest()
+	if err == nil && dig == behind.ksn.LastEvent.Digest {
+		return 0, false
+	}
+
+	for sn = 0; sn < behind.ksn.SequenceInt(); sn++ {
+		x, _ := a.msgs[sn].Event.GetDigest()
+		y, _ := b.msgs[sn].Event.GetDigest()
+		if x != y {
+			break
+		}
+	}
+
+	if supersedes(a, b, sn) || supersedes(b, a, sn) {
+		return 0, false
+	}
+
+	return sn, true
+}
+
+// supersedes returns true if the event x reports at the sequence number is
+// a recovery rotation, which supersedes the interaction events y reports
+// from there on. A rotation can't supersede an establishment event.
+func supersedes(x, y *reported, sn int) bool {
+	switch x.msgs[sn].Event.ILK() {
+	case event.ROT, event.DRT:
+		return y.ksn.LastEstablishment.SequenceInt() < sn
+	}
+
+	return false
+}
+
+// verify applies the messages to an empty log of the identifier and
+// returns the messages for the events that were accepted, in order, with
+// the key state notice for them, so sources can't make us report events the
+// controller did not sign. The events accepted before an invalid one are
+// returned with the error. The notice is nil if no event was accepted.
+func verify(pre string, msgs []*event.Message) ([]*event.Message, *event.Event, error) {
+	kel := klog.New(pre, mem.New(), klog.AcceptUnwitnessed())
+
+	var verr error
+	byDig := map[string]*event.Message{}
+	for _, msg := range msgs {
+		if msg.Event.Prefix != pre {
+			continue
+		}
+
+		dig, err := msg.Event.GetDigest()
+		if err != nil {
+			continue
+		}
+
+		byDig[dig] = msg
+
+		err = kel.Apply(msg)
+		if err != nil {
+			verr = errors.Wrapf(err, "invalid event at sequence number %s", msg.Event.Sequence)
+			break
+		}
+	}
+
+	out := []*event.Message{}
+	for i := 0; i < kel.Size(); i++ {
+		evt := kel.EventAt(i)
+		if evt == nil {
+			break
+		}
+
+		dig, err := evt.Event.GetDigest()
+		if err != nil {
+			return out, nil, err
+		}
+
+		out = append(out, byDig[dig])
+	}
+
+	if len(out) == 0 {
+		return out, nil, verr
+	}
+
+	ksn, err := kel.KeyStateNotice()
+	if err != nil {
+		return out, nil, errors.Wrap(err, "unable to build key state notice")
+	}
+
+	return out, ksn, verr
+}
@@ -0,0 +1,272 @@
+package watcher
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/decentralized-identity/kerigo/pkg/db/mem"
+	"github.com/decentralized-identity/kerigo/pkg/event"
+	"github.com/decentralized-identity/kerigo/pkg/keri"
+	testkms "github.com/decentralized-identity/kerigo/pkg/test/kms"
+	"github.com/decentralized-identity/kerigo/pkg/witness"
+)
+
+var secrets = []string{"ADW3o9m3udwEf0aoOdZLLJdf1aylokP0lwwI_M2J9h0s", "AagumsL8FeGES7tYcnr_5oN6qcwJzZfLKxoniKUpG4qc"}
+
+func newTestWitness(t *testing.T) *witness.Witness {
+	db := mem.New()
+	w, err := witness.New(testkms.GetKMS(t, nil, db), db)
+	require.NoError(t, err)
+	return w
+}
+
+// newController returns an identity with the test secrets, so
+// controllers created by it share their keys
+func newController(t *testing.T, wits ...string) *keri.Keri {
+	db := mem.New()
+	k, err := keri.New(testkms.GetKMS(t, secrets, db), db, keri.WithWitnesses(1, wits...))
+	require.NoError(t, err)
+	return k
+}
+
+func kerlSource(w *witness.Witness) SourceFunc {
+	return func(_ context.Context, pre string) ([]*event.Message, error) {
+		return w.KERL(pre)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	w1 := newTestWitness(t)
+	w2 := newTestWitness(t)
+
+	good := newController(t, w1.Prefix(), w2.Prefix())
+	bad := newController(t, w1.Prefix(), w2.Prefix())
+	require.Equal(t, good.Prefix(), bad.Prefix())
+
+	icp, err := good.Inception()
+	require.NoError(t, err)
+
+	for _, w := range []*witness.Witness{w1, w2} {
+		_, err = w.ProcessEvents(icp)
+		require.NoError(t, err)
+	}
+
+	srv := httptest.NewServer(w1)
+	defer srv.Close()
+
+	reports := []*DuplicityReport{}
+	watcher, err := New(
+		WithSource(w1.Prefix(), NewHTTPSource(srv.URL+witness.KERLPath)),
+		WithSource(w2.Prefix(), kerlSource(w2)),
+		WithPrefixes(good.Prefix()),
+		WithDuplicityHandler(func(d *DuplicityReport) {
+			reports = append(reports, d)
+		}),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []string{good.Prefix()}, watcher.Prefixes())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.Empty(t, watcher.Check(ctx))
+
+	st, err := watcher.Status(good.Prefix())
+	require.NoError(t, err)
+	assert.True(t, st.Consistent)
+	assert.False(t, st.Checked.IsZero())
+	for _, name := range []string{w1.Prefix(), w2.Prefix()} {
+		if assert.Contains(t, st.Sources, name) {
+			assert.Equal(t, 0, st.Sources[name].Sequence)
+			assert.NoError(t, st.Sources[name].Error)
+		}
+	}
+
+	// the controller shows each witness a different interaction event
+	ixn, err := good.Interaction(event.SealArray{})
+	require.NoError(t, err)
+
+	_, err = w1.ProcessEvents(ixn)
+	require.NoError(t, err)
+
+	seal, err := event.NewEventSeal("Edig", "Epre", "0")
+	require.NoError(t, err)
+
+	dup, err := bad.Interaction(event.SealArray{seal})
+	require.NoError(t, err)
+
+	_, err = w2.ProcessEvents(dup)
+	require.NoError(t, err)
+
+	found := watcher.Check(ctx)
+	require.Len(t, found, 1)
+	assert.Equal(t, found, reports)
+
+	d := found[0]
+	assert.Equal(t, good.Prefix(), d.Prefix)
+	assert.Equal(t, 1, d.Sequence)
+
+	ixnDig, err := ixn.Event.GetDigest()
+	require.NoError(t, err)
+	dupDig, err := dup.Event.GetDigest()
+	require.NoError(t, err)
+
+	evidence := map[string]string{}
+	for _, e := range d.Evidence {
+		dig, err := e.Event.Event.GetDigest()
+		require.NoError(t, err)
+		assert.NotEmpty(t, e.Event.Signatures)
+		evidence[e.Source] = dig
+	}
+	assert.Equal(t, map[string]string{w1.Prefix(): ixnDig, w2.Prefix(): dupDig}, evidence)
+
+	// duplicity is only reported once
+	assert.Empty(t, watcher.Check(ctx))
+	assert.Len(t, reports, 1)
+
+	st, err = watcher.Status(good.Prefix())
+	require.NoError(t, err)
+	assert.False(t, st.Consistent)
+	assert.Len(t, st.Duplicity, 1)
+	assert.Equal(t, ixnDig, st.Sources[w1.Prefix()].Digest)
+	assert.Equal(t, dupDig, st.Sources[w2.Prefix()].Digest)
+
+	watcher.Unwatch(good.Prefix())
+	assert.Empty(t, watcher.Prefixes())
+
+	_, err = watcher.Status(good.Prefix())
+	assert.Error(t, err)
+}
+
+func TestWatcherForgedEvents(t *testing.T) {
+	w1 := newTestWitness(t)
+
+	k := newController(t, w1.Prefix())
+	icp, err := k.Inception()
+	require.NoError(t, err)
+
+	ixn, err := k.Interaction(event.SealArray{})
+	require.NoError(t, err)
+
+	_, err = w1.ProcessEvents(icp, ixn)
+	require.NoError(t, err)
+
+	seal, err := event.NewEventSeal("Edig", "Epre", "0")
+	require.NoError(t, err)
+
+	other, err := newController(t, w1.Prefix()).Interaction(event.SealArray{seal})
+	require.NoError(t, err)
+
+	// a source can't fabricate events the controller did not sign
+	forger := SourceFunc(func(_ context.Context, pre string) ([]*event.Message, error) {
+		return []*event.Message{icp, {Event: other.Event, Signatures: ixn.Signatures}}, nil
+	})
+
+	watcher, err := New(
+		WithSource(w1.Prefix(), kerlSource(w1)),
+		WithSource("forger", forger),
+		WithPrefixes(k.Prefix()),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.Empty(t, watcher.Check(ctx))
+
+	st, err := watcher.Status(k.Prefix())
+	require.NoError(t, err)
+	assert.True(t, st.Consistent)
+	assert.Equal(t, 1, st.Sources[w1.Prefix()].Sequence)
+	assert.Equal(t, 0, st.Sources["forger"].Sequence)
+	assert.Error(t, st.Sources["forger"].Error)
+}
+
+func TestWatcherRecovery(t *testing.T) {
+	w1 := newTestWitness(t)
+	w2 := newTestWitness(t)
+
+	// bad holds the current signing keys, but good holds the pre-rotated ones
+	good := newController(t, w1.Prefix(), w2.Prefix())
+	bad := newController(t, w1.Prefix(), w2.Prefix())
+
+	icp, err := good.Inception()
+	require.NoError(t, err)
+
+	ixn1, err := bad.Interaction(event.SealArray{})
+	require.NoError(t, err)
+
+	ixn2, err := bad.Interaction(event.SealArray{})
+	require.NoError(t, err)
+
+	for _, w := range []*witness.Witness{w1, w2} {
+		_, err = w.ProcessEvents(icp, ixn1, ixn2)
+		require.NoError(t, err)
+	}
+
+	// only the first witness has seen the recovery rotation
+	rot, err := good.Rotate()
+	require.NoError(t, err)
+	require.Equal(t, 1, rot.Event.SequenceInt())
+
+	_, err = w1.ProcessEvents(rot)
+	require.NoError(t, err)
+
+	watcher, err := New(
+		WithSource(w1.Prefix(), kerlSource(w1)),
+		WithSource(w2.Prefix(), kerlSource(w2)),
+		WithPrefixes(good.Prefix()),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.Empty(t, watcher.Check(ctx))
+
+	rotDig, err := rot.Event.GetDigest()
+	require.NoError(t, err)
+	ixnDig, err := ixn2.Event.GetDigest()
+	require.NoError(t, err)
+
+	st, err := watcher.Status(good.Prefix())
+	require.NoError(t, err)
+	assert.True(t, st.Consistent)
+	assert.Equal(t, 1, st.Sources[w1.Prefix()].Sequence)
+	assert.Equal(t, rotDig, st.Sources[w1.Prefix()].Digest)
+	assert.Equal(t, 2, st.Sources[w2.Prefix()].Sequence)
+	assert.Equal(t, ixnDig, st.Sources[w2.Prefix()].Digest)
+
+	// a rotation can't supersede another rotation
+	other := newController(t, w1.Prefix(), w2.Prefix())
+
+	seal, err := event.NewEventSeal("Edig", "Epre", "0")
+	require.NoError(t, err)
+
+	conflict, err := other.Rotate(seal)
+	require.NoError(t, err)
+	require.Equal(t, 1, conflict.Event.SequenceInt())
+
+	_, err = w2.ProcessEvents(conflict)
+	require.NoError(t, err)
+
+	found := watcher.Check(ctx)
+	require.Len(t, found, 1)
+	assert.Equal(t, 1, found[0].Sequence)
+
+	conflictDig, err := conflict.Event.GetDigest()
+	require.NoError(t, err)
+
+	evidence := map[string]string{}
+	for _, e := range found[0].Evidence {
+		dig, err := e.Event.Event.GetDigest()
+		require.NoError(t, err)
+		evidence[e.Source] = dig
+	}
+	assert.Equal(t, map[string]string{w1.Prefix(): rotDig, w2.Prefix(): conflictDig}, evidence)
+}
@@ -0,0 +1,335 @@
+package witness
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/decentralized-identity/kerigo/pkg/db"
+	"github.com/decentralized-identity/kerigo/pkg/derivation"
+	"github.com/decentralized-identity/kerigo/pkg/encoding/stream"
+	"github.com/decentralized-identity/kerigo/pkg/event"
+	"github.com/decentralized-identity/kerigo/pkg/keymanager"
+	klog "github.com/decentralized-identity/kerigo/pkg/log"
+)
+
+const (
+	// KERLPath is the path the fully witnessed KERL of a
+	// controller is served from, followed by its prefix
+	KERLPath = "/kerl/"
+)
+
+// Witness receipts the key events of the controllers that designate it
+// as one of their witnesses. Witnesses have non-transferable identifiers,
+// so their receipts are signature couplets of their basic prefix and a
+// signature over the receipted event.
+type Witness struct {
+	kms  *keymanager.KeyManager
+	db   db.DB
+	pre  string
+	code derivation.Code
+	lock sync.Mutex
+}
+
+func New(kms *keymanager.KeyManager, db db.DB) (*Witness, error) {
+	w := &Witness{
+		kms: kms,
+		db:  db,
+	}
+
+	key := kms.Public()
+
+	nt, err := key.Code.NonTransferableCode()
+	if err != nil {
+		return nil, errors.Wrap(err, "unsupported witness key")
+	}
+
+	w.code, err = key.Code.SignatureCode()
+	if err != nil {
+		return nil, errors.Wrap(err, "unsupported witness key")
+	}
+
+	pre, err := derivation.New(derivation.WithCode(nt), derivation.WithRaw(key.Raw))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create witness prefix")
+	}
+
+	w.pre = pre.AsPrefix()
+
+	return w, nil
+}
+
+// Prefix returns the non-transferable prefix of the witness
+func (w *Witness) Prefix() string {
+	return w.pre
+}
+
+// ProcessEvents validates key events for the controllers we witness,
+// returning a receipt message for each event we receipted. Receipt
+// messages from other witnesses are verified and stored.
+func (w *Witness) ProcessEvents(msgs ...*event.Message) ([]*event.Message, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	out := []*event.Message{}
+	for _, msg := range msgs {
+		switch msg.Event.ILK() {
+		case event.ICP, event.ROT, event.IXN, event.DIP, event.DRT:
+			rct, err := w.processEvent(msg)
+			if err != nil {
+				return nil, err
+			}
+
+			if rct != nil {
+				out = append(out, rct)
+			}
+		case event.RCT:
+			err := w.processReceipts(msg.WitnessReceipts)
+			if err != nil {
+				return nil, err
+			}
+		case event.KSN:
+			if !event.IsKeyStateNoticeRequest(msg) {
+				continue
+			}
+
+			ksn, err := w.KeyStateNotice(msg.Event.Prefix)
+			if err != nil {
+				return nil, err
+			}
+
+			out = append(out, ksn)
+		}
+	}
+
+	return out, nil
+}
+
+func (w *Witness) processEvent(msg *event.Message) (*event.Message, error) {
+	evt := msg.Event
+	kel := klog.New(evt.Prefix, w.db, klog.AcceptUnwitnessed())
+
+	// only start a log for controllers that designate us
+	ilk := evt.ILK()
+	if kel.Size() == 0 && (ilk == event.ICP || ilk == event.DIP) && !evt.HasWitness(w.pre) {
+		return nil, errors.Errorf("not a witness for %s", evt.Prefix)
+	}
+
+	err := kel.Apply(msg)
+	if err == klog.ErrPendingSignatures || err == klog.ErrMissingDelegation {
+		// receipted once the event is accepted
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to apply event")
+	}
+
+	accepted, err := w.db.EventAt(evt.Prefix, evt.SequenceInt())
+	if err != nil {
+		// escrowed out of order
+		return nil, nil
+	}
+
+	dig, err := evt.GetDigest()
+	if err != nil {
+		return nil, err
+	}
+
+	acceptedDig, err := accepted.Event.GetDigest()
+	if err != nil {
+		return nil, err
+	}
+
+	if dig != acceptedDig {
+		return nil, nil
+	}
+
+	state, err := kel.KeyState()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to build key state")
+	}
+
+	if !state.HasWitness(w.pre) {
+		return nil, errors.Errorf("not a witness for %s", evt.Prefix)
+	}
+
+	err = w.processReceipts(msg.WitnessReceipts)
+	if err != nil {
+		return nil, err
+	}
+
+	rcpt, err := w.receipt(accepted)
+	if err != nil {
+		return nil, err
+	}
+
+	err = w.db.LogWitnessReceipt(rcpt)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to log receipt")
+	}
+
+	rcpts, err := kel.WitnessReceipts(accepted.Event)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to load receipts")
+	}
+
+	return event.WitnessReceiptMessage(rcpts...)
+}
+
+// receipt signs the accepted event
+func (w *Witness) receipt(msg *event.Message) (*event.Receipt, error) {
+	raw, err := msg.Raw()
+	if err != nil {
+		return nil, errors.Wrap(err, "unexpected error marshalling receipted event")
+	}
+
+	sig, err := derivation.New(derivation.WithCode(w.code), derivation.WithSigner(w.kms.Signer()))
+	if err != nil {
+		return nil, errors.Wrap(err, "unexpected error getting new derivation")
+	}
+
+	_, err = sig.Derive(raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to derive signature")
+	}
+
+	return event.NewReceipt(msg.Event, event.WithSignerPrefix(w.pre), event.WithSignature(sig))
+}
+
+// processReceipts stores the receipts of other witnesses
+func (w *Witness) processReceipts(rcpts []*event.Receipt) error {
+	for _, rcpt := range rcpts {
+		if rcpt.EstPrefix == w.pre {
+			continue
+		}
+
+		err := klog.New(rcpt.Prefix, w.db).ApplyWitnessReceipt(rcpt)
+		if err != nil {
+			return errors.Wrap(err, "invalid witness receipt")
+		}
+	}
+
+	return nil
+}
+
+// KeyStateNotice returns the key state notice for a controller we witness,
+// signed with our non-transferable key
+func (w *Witness) KeyStateNotice(pre string) (*event.Message, error) {
+	kel := klog.New(pre, w.db)
+	if kel.Size() == 0 {
+		return nil, errors.Errorf("unknown controller %s", pre)
+	}
+
+	ksn, err := kel.KeyStateNotice()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to build key state notice")
+	}
+
+	seal, err := event.NewSeal(event.EventSeal, event.WithSealPrefix(w.pre))
+	if err != nil {
+		return nil, err
+	}
+
+	evt, err := event.KeyStateNotice(ksn, seal)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := evt.Serialize()
+	if err != nil {
+		return nil, errors.Wrap(err, "unexpected error serializing key state notice")
+	}
+
+	code, err := w.kms.Public().Code.AttachedSignatureCode()
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := derivation.New(derivation.WithCode(code), derivation.WithSigner(w.kms.Signer()))
+	if err != nil {
+		return nil, errors.Wrap(err, "unexpected error getting new derivation")
+	}
+
+	_, err = sig.Derive(raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to derive signature")
+	}
+
+	return &event.Message{Event: evt, Signatures: []derivation.Derivation{*sig}}, nil
+}
+
+// KERL returns the fully witnessed key event receipt log for the controller,
+// with the controller signatures and every witness receipt attached to each
+// event. The log ends before the first event still short of its witness
+// threshold, as the events after it can't be validated without it.
+func (w *Witness) KERL(pre string) ([]*event.Message, error) {
+	kel := klog.New(pre, w.db)
+	if kel.Size() == 0 {
+		return nil, errors.Errorf("unknown controller %s", pre)
+	}
+
+	out := []*event.Message{}
+	witnessed := true
+	err := w.db.StreamBySequenceNo(pre, func(msg *event.Message) error {
+		if !witnessed {
+			return nil
+		}
+
+		var err error
+		witnessed, err = kel.FullyWitnessed(msg.Event.SequenceInt())
+		if err != nil || !witnessed {
+			return err
+		}
+
+		rcpts, err := kel.WitnessReceipts(msg.Event)
+		if err != nil {
+			return err
+		}
+
+		raw, err := msg.Raw()
+		if err != nil {
+			return err
+		}
+
+		// the stored event is shared, the message gets its own copy
+		m, err := event.NewMessage(msg.Event, event.WithRaw(raw), event.WithSignatures(msg.Signatures))
+		if err != nil {
+			return err
+		}
+
+		m.WitnessReceipts = rcpts
+		out = append(out, m)
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to load KERL")
+	}
+
+	return out, nil
+}
+
+// ServeHTTP serves the KERL of a controller as a stream of
+// events with their attachments
+func (w *Witness) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet || !strings.HasPrefix(req.URL.Path, KERLPath) {
+		http.NotFound(rw, req)
+		return
+	}
+
+	kerl, err := w.KERL(strings.TrimPrefix(req.URL.Path, KERLPath))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/cesr")
+
+	err = stream.NewWriter(rw, stream.WithSerializationMode(stream.ConjointMode)).WriteAll(kerl)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+	}
+}
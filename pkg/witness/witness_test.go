@@ -0,0 +1,414 @@
+package witness
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/decentralized-identity/kerigo/pkg/db/mem"
+	"github.com/decentralized-identity/kerigo/pkg/derivation"
+	"github.com/decentralized-identity/kerigo/pkg/direct"
+	"github.com/decentralized-identity/kerigo/pkg/encoding/stream"
+	"github.com/decentralized-identity/kerigo/pkg/event"
+	"github.com/decentralized-identity/kerigo/pkg/keri"
+	klog "github.com/decentralized-identity/kerigo/pkg/log"
+	testkms "github.com/decentralized-identity/kerigo/pkg/test/kms"
+)
+
+func newWitness(t *testing.T) *Witness {
+	db := mem.New()
+	w, err := New(testkms.GetKMS(t, nil, db), db)
+	assert.NoError(t, err)
+	return w
+}
+
+func TestReceipt(t *testing.T) {
+	w := newWitness(t)
+	assert.Equal(t, "B", w.Prefix()[:1])
+
+	db := mem.New()
+	k, err := keri.New(testkms.GetKMS(t, nil, db), db, keri.WithWitnesses(1, w.Prefix()))
+	assert.NoError(t, err)
+
+	icp, err := k.Inception()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{w.Prefix()}, icp.Event.Witnesses)
+	assert.Equal(t, "1", icp.Event.WitnessThreshold)
+
+	rcts, err := w.ProcessEvents(icp)
+	assert.NoError(t, err)
+	if !assert.Len(t, rcts, 1) {
+		return
+	}
+
+	// receipts survive a round trip through a stream as witness couplets
+	buf := &bytes.Buffer{}
+	err = stream.NewWriter(buf).Write(rcts[0])
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "-BAB"+w.Prefix())
+
+	rct, err := stream.NewReader(buf).Read()
+	assert.NoError(t, err)
+	assert.Equal(t, event.RCT, rct.Event.ILK())
+	assert.Len(t, rct.Signatures, 0)
+	if !assert.Len(t, rct.WitnessReceipts, 1) {
+		return
+	}
+
+	dig, err := icp.Event.GetDigest()
+	assert.NoError(t, err)
+
+	rcpt := rct.WitnessReceipts[0]
+	assert.Equal(t, w.Prefix(), rcpt.EstPrefix)
+	assert.Equal(t, icp.Event.Prefix, rcpt.Prefix)
+	assert.Equal(t, dig, rcpt.Digest)
+
+	raw, err := icp.Raw()
+	assert.NoError(t, err)
+
+	key, err := derivation.FromPrefix(w.Prefix())
+	assert.NoError(t, err)
+	assert.NoError(t, derivation.VerifyWithAttachedSignature(key, rcpt.Signature, raw))
+
+	ixn, err := k.Interaction(event.SealArray{})
+	assert.NoError(t, err)
+
+	rcts, err = w.ProcessEvents(ixn)
+	assert.NoError(t, err)
+	assert.Len(t, rcts, 1)
+
+	// controllers that have not designated us are refused
+	db = mem.New()
+	other, err := keri.New(testkms.GetKMS(t, nil, db), db)
+	assert.NoError(t, err)
+
+	icp, err = other.Inception()
+	assert.NoError(t, err)
+
+	_, err = w.ProcessEvents(icp)
+	assert.Error(t, err)
+
+	_, err = w.KERL(other.Prefix())
+	assert.Error(t, err)
+}
+
+func TestKERL(t *testing.T) {
+	w1 := newWitness(t)
+	w2 := newWitness(t)
+
+	db := mem.New()
+	k, err := keri.New(testkms.GetKMS(t, nil, db), db, keri.WithWitnesses(2, w1.Prefix(), w2.Prefix()))
+	assert.NoError(t, err)
+
+	icp, err := k.Inception()
+	assert.NoError(t, err)
+
+	rcts, err := w1.ProcessEvents(icp)
+	assert.NoError(t, err)
+
+	// the second witness also stores the receipts of the first
+	rcts, err = w2.ProcessEvents(append([]*event.Message{icp}, rcts...)...)
+	assert.NoError(t, err)
+	assert.Len(t, rcts, 1)
+
+	kerl, err := w2.KERL(k.Prefix())
+	assert.NoError(t, err)
+	assert.Len(t, kerl, 1)
+	assert.Len(t, kerl[0].WitnessReceipts, 2)
+
+	// witnesses that were not designated refuse the event
+	w3 := newWitness(t)
+	_, err = w3.ProcessEvents(icp)
+	assert.Error(t, err)
+
+	srv := httptest.NewServer(w2)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + KERLPath + k.Prefix())
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	msgs, err := stream.NewReader(resp.Body).ReadAll()
+	assert.NoError(t, err)
+	if !assert.Len(t, msgs, 1) {
+		return
+	}
+	assert.Len(t, msgs[0].Signatures, 1)
+	assert.Len(t, msgs[0].WitnessReceipts, 2)
+
+	resp, err = http.Get(srv.URL + KERLPath + "Eunknown")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// events short of the witness threshold are left out
+	ixn, err := k.Interaction(event.SealArray{})
+	assert.NoError(t, err)
+
+	_, err = w2.ProcessEvents(ixn)
+	assert.NoError(t, err)
+
+	kerl, err = w2.KERL(k.Prefix())
+	assert.NoError(t, err)
+	assert.Len(t, kerl, 1)
+
+	resp, err = http.Get(srv.URL + KERLPath + k.Prefix())
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	msgs, err = stream.NewReader(resp.Body).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 1)
+
+	rcts, err = w1.ProcessEvents(ixn)
+	assert.NoError(t, err)
+
+	_, err = w2.ProcessEvents(rcts...)
+	assert.NoError(t, err)
+
+	kerl, err = w2.KERL(k.Prefix())
+	assert.NoError(t, err)
+	assert.Len(t, kerl, 2)
+}
+
+func TestKERLConcurrent(t *testing.T) {
+	w := newWitness(t)
+
+	db := mem.New()
+	k, err := keri.New(testkms.GetKMS(t, nil, db), db, keri.WithWitnesses(1, w.Prefix()))
+	assert.NoError(t, err)
+
+	icp, err := k.Inception()
+	assert.NoError(t, err)
+
+	_, err = w.ProcessEvents(icp)
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		ixn, err := k.Interaction(event.SealArray{})
+		assert.NoError(t, err)
+
+		_, err = w.ProcessEvents(ixn)
+		assert.NoError(t, err)
+	}
+
+	srv := httptest.NewServer(w)
+	defer srv.Close()
+
+	// the stored events are shared by every request, and by
+	// the witness as it keeps processing events
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			resp, err := http.Get(srv.URL + KERLPath + k.Prefix())
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer resp.Body.Close()
+
+			msgs, err := stream.NewReader(resp.Body).ReadAll()
+			assert.NoError(t, err)
+			assert.GreaterOrEqual(t, len(msgs), 4)
+		}()
+	}
+
+	for i := 0; i < 3; i++ {
+		ixn, err := k.Interaction(event.SealArray{})
+		assert.NoError(t, err)
+
+		_, err = w.ProcessEvents(ixn)
+		assert.NoError(t, err)
+
+		for sn := 0; sn < 4; sn++ {
+			msg, err := w.db.EventAt(k.Prefix(), sn)
+			assert.NoError(t, err)
+
+			_, err = msg.Event.GetDigest()
+			assert.NoError(t, err)
+		}
+	}
+
+	wg.Wait()
+}
+
+func TestDirectMode(t *testing.T) {
+	w := newWitness(t)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	srv := &direct.Server{Handler: w}
+	go func() {
+		_ = srv.Serve(ln)
+	}()
+	defer ln.Close()
+
+	db := mem.New()
+	k, err := keri.New(testkms.GetKMS(t, nil, db), db, keri.WithWitnesses(1, w.Prefix()))
+	assert.NoError(t, err)
+
+	icp, err := k.Inception()
+	assert.NoError(t, err)
+
+	c, err := net.Dial("tcp", ln.Addr().String())
+	assert.NoError(t, err)
+	defer c.Close()
+
+	err = stream.NewWriter(c, stream.WithAttachmentGroups()).Write(icp)
+	assert.NoError(t, err)
+
+	rct, err := stream.NewReader(c).Read()
+	assert.NoError(t, err)
+	assert.Equal(t, event.RCT, rct.Event.ILK())
+	assert.Equal(t, k.Prefix(), rct.Event.Prefix)
+	if assert.Len(t, rct.WitnessReceipts, 1) {
+		assert.Equal(t, w.Prefix(), rct.WitnessReceipts[0].EstPrefix)
+	}
+}
+
+func TestPartiallyWitnessed(t *testing.T) {
+	w1 := newWitness(t)
+	w2 := newWitness(t)
+
+	db := mem.New()
+	k, err := keri.New(testkms.GetKMS(t, nil, db), db, keri.WithWitnesses(2, w1.Prefix(), w2.Prefix()))
+	assert.NoError(t, err)
+
+	icp, err := k.Inception()
+	assert.NoError(t, err)
+
+	// the controller accepts its own event before it is witnessed
+	witnessed, err := k.KEL().FullyWitnessed(0)
+	assert.NoError(t, err)
+	assert.False(t, witnessed)
+
+	rcts1, err := w1.ProcessEvents(icp)
+	assert.NoError(t, err)
+
+	rcts2, err := w2.ProcessEvents(icp)
+	assert.NoError(t, err)
+
+	// validators hold the event until the witness threshold is met
+	vdb := mem.New()
+	kel := klog.New(k.Prefix(), vdb)
+
+	err = kel.Apply(icp)
+	assert.Equal(t, klog.ErrPartiallyWitnessed, err)
+	assert.Equal(t, 0, kel.Size())
+
+	err = kel.ApplyWitnessReceipt(rcts1[0].WitnessReceipts[0])
+	assert.NoError(t, err)
+	assert.Equal(t, 0, kel.Size())
+
+	// a receipt signed by someone other than the witness is rejected
+	forged := *rcts2[0].WitnessReceipts[0]
+	forged.Signature = rcts1[0].WitnessReceipts[0].Signature
+	err = kel.ApplyWitnessReceipt(&forged)
+	assert.Error(t, err)
+	assert.Equal(t, 0, kel.Size())
+
+	err = kel.ApplyWitnessReceipt(rcts2[0].WitnessReceipts[0])
+	assert.NoError(t, err)
+	assert.Equal(t, 1, kel.Size())
+
+	witnessed, err = kel.FullyWitnessed(0)
+	assert.NoError(t, err)
+	assert.True(t, witnessed)
+
+	// a fully witnessed KERL is accepted right away
+	_, err = w2.ProcessEvents(rcts1...)
+	assert.NoError(t, err)
+
+	kerl, err := w2.KERL(k.Prefix())
+	assert.NoError(t, err)
+
+	kel = klog.New(k.Prefix(), mem.New())
+	err = kel.Apply(kerl[0])
+	assert.NoError(t, err)
+	assert.Equal(t, 1, kel.Size())
+
+	// later events are escrowed in the same way
+	ixn, err := k.Interaction(event.SealArray{})
+	assert.NoError(t, err)
+
+	err = kel.Apply(ixn)
+	assert.Equal(t, klog.ErrPartiallyWitnessed, err)
+	assert.Equal(t, 1, kel.Size())
+
+	rcts1, err = w1.ProcessEvents(ixn)
+	assert.NoError(t, err)
+
+	rcts2, err = w2.ProcessEvents(ixn)
+	assert.NoError(t, err)
+
+	for _, rct := range append(rcts1, rcts2...) {
+		err = kel.ApplyWitnessReceipt(rct.WitnessReceipts[0])
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 2, kel.Size())
+}
+
+func TestWitnessPool(t *testing.T) {
+	w1 := newWitness(t)
+	w2 := newWitness(t)
+
+	addrs := []string{}
+	for _, w := range []*Witness{w1, w2} {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		defer ln.Close()
+
+		srv := &direct.Server{Handler: w}
+		go func() {
+			_ = srv.Serve(ln)
+		}()
+
+		addrs = append(addrs, ln.Addr().String())
+	}
+
+	db := mem.New()
+	k, err := keri.New(testkms.GetKMS(t, nil, db), db,
+		keri.WithWitnesses(2, w1.Prefix(), w2.Prefix()),
+		keri.WithWitnessClient(w1.Prefix(), direct.NewWitnessClient(addrs[0])),
+		keri.WithWitnessClient(w2.Prefix(), direct.NewWitnessClient(addrs[1])),
+	)
+	assert.NoError(t, err)
+
+	icp, err := k.Inception()
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := k.Witness(ctx, icp)
+	assert.NoError(t, err)
+	assert.Len(t, res.Errors, 0)
+	assert.Len(t, res.Receipts, 2)
+
+	witnessed, err := k.KEL().FullyWitnessed(0)
+	assert.NoError(t, err)
+	assert.True(t, witnessed)
+
+	// the witnesses publish our key state
+	req, err := event.KeyStateNoticeRequest(k.Prefix())
+	assert.NoError(t, err)
+
+	out, err := direct.NewWitnessClient(addrs[0]).Submit(ctx, req)
+	assert.NoError(t, err)
+	if assert.Len(t, out, 1) {
+		stale, err := k.ProcessKeyStateNotice(out[0])
+		assert.NoError(t, err)
+		assert.False(t, stale)
+	}
+}